@@ -0,0 +1,262 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// The streaming AEAD encrypts a stream of data in chunks of AEADStreamChunkSize bytes, each
+// sealed with XChaCha20-Poly1305, following the STREAM construction
+// (https://eprint.iacr.org/2015/189.pdf).
+//
+// The encrypted stream is made of a header followed by the sealed chunks:
+//
+//	header = version (1 byte) || nonce prefix (16 random bytes)
+//	chunk  = XChaCha20-Poly1305(key, nonce, plaintext chunk, additional data = header || additionalData)
+//	nonce  = nonce prefix || chunk counter (7 bytes, big endian) || last chunk flag (1 byte)
+//
+// All the chunks but the last contain exactly AEADStreamChunkSize bytes of plaintext. As the
+// counter and the last chunk flag are part of the nonce, reordered, duplicated, removed or
+// truncated chunks are detected when decrypting.
+
+const (
+	// AEADStreamVersion is the version of the format of the streams written by AEADStreamWriter.
+	AEADStreamVersion byte = 1
+
+	// AEADStreamChunkSize is the size of the plaintext chunks of a stream, in bytes.
+	AEADStreamChunkSize = 64 * 1024
+
+	// AEADStreamHeaderSize is the size of the header of a stream, in bytes.
+	AEADStreamHeaderSize = 1 + aeadStreamNoncePrefixSize
+
+	aeadStreamNoncePrefixSize    = AEADNonceSize - 8
+	aeadStreamEncryptedChunkSize = AEADStreamChunkSize + aeadOverhead
+	aeadOverhead                 = 16 // size of the Poly1305 tag
+	// the counter is encoded on 7 bytes
+	aeadStreamMaxChunks = 1<<56 - 1
+)
+
+var (
+	// ErrAEADStreamUnsupportedVersion is returned when reading a stream with an unknown version.
+	ErrAEADStreamUnsupportedVersion = errors.New("crypto: unsupported stream version")
+
+	// ErrAEADStreamInvalid is returned when a chunk of a stream can't be authenticated, because
+	// it has been modified, reordered or encrypted with another key or additional data.
+	ErrAEADStreamInvalid = errors.New("crypto: invalid stream")
+
+	// ErrAEADStreamTruncated is returned when a stream ends before its last chunk.
+	ErrAEADStreamTruncated = errors.New("crypto: truncated stream")
+
+	// ErrAEADStreamTooLong is returned when writing more than 2^56 - 1 chunks to a stream.
+	ErrAEADStreamTooLong = errors.New("crypto: stream is too long")
+)
+
+// AEADStreamWriter encrypts the data written to it using the streaming AEAD, and writes it to
+// the underlying io.Writer. Close must be called to write the last chunk: streams which
+// have not been closed fail to decrypt.
+type AEADStreamWriter struct {
+	aead           cipher.AEAD
+	w              io.Writer
+	additionalData []byte
+	nonce          []byte
+	counter        uint64
+	buf            []byte
+	sealed         []byte
+	closed         bool
+}
+
+// NewAEADStreamWriter returns an AEADStreamWriter encrypting the data written to it with the
+// given 256-bit key and writing it to w. additionalData is authenticated but not encrypted,
+// and must be provided to decrypt the stream.
+// The header of the stream is written immediately.
+func NewAEADStreamWriter(key []byte, w io.Writer, additionalData []byte) (*AEADStreamWriter, error) {
+	aead, err := NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	noncePrefix, err := RandBytes(aeadStreamNoncePrefixSize)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, AEADStreamHeaderSize)
+	header = append(header, AEADStreamVersion)
+	header = append(header, noncePrefix...)
+	if _, err = w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &AEADStreamWriter{
+		aead:           aead,
+		w:              w,
+		additionalData: append(header, additionalData...),
+		nonce:          append(noncePrefix, make([]byte, 8)...),
+		buf:            make([]byte, 0, AEADStreamChunkSize),
+		sealed:         make([]byte, 0, aeadStreamEncryptedChunkSize),
+	}, nil
+}
+
+// Write implements the io.Writer interface.
+func (stream *AEADStreamWriter) Write(p []byte) (n int, err error) {
+	if stream.closed {
+		return 0, errors.New("crypto: write to closed stream")
+	}
+	for len(p) > 0 {
+		// a full chunk is only sealed when more data is written, as it may be the last one
+		if len(stream.buf) == AEADStreamChunkSize {
+			if err = stream.sealChunk(false); err != nil {
+				return
+			}
+		}
+		written := copy(stream.buf[len(stream.buf):AEADStreamChunkSize], p)
+		stream.buf = stream.buf[:len(stream.buf)+written]
+		p = p[written:]
+		n += written
+	}
+	return
+}
+
+// Close seals and writes the last chunk of the stream. It does not close the underlying
+// io.Writer.
+func (stream *AEADStreamWriter) Close() error {
+	if stream.closed {
+		return errors.New("crypto: stream already closed")
+	}
+	stream.closed = true
+	err := stream.sealChunk(true)
+	Zeroize(stream.buf[:cap(stream.buf)])
+	return err
+}
+
+func (stream *AEADStreamWriter) sealChunk(last bool) error {
+	if stream.counter == aeadStreamMaxChunks {
+		return ErrAEADStreamTooLong
+	}
+	setAEADStreamNonce(stream.nonce, stream.counter, last)
+	stream.sealed = stream.aead.Seal(stream.sealed[:0], stream.nonce, stream.buf, stream.additionalData)
+	if _, err := stream.w.Write(stream.sealed); err != nil {
+		return err
+	}
+	stream.counter++
+	stream.buf = stream.buf[:0]
+	return nil
+}
+
+// AEADStreamReader decrypts a stream written by an AEADStreamWriter. The plaintext of a chunk
+// is only returned once the chunk has been authenticated, but as the stream is decrypted
+// progressively, the data read before an error must be discarded by the caller.
+type AEADStreamReader struct {
+	aead           cipher.AEAD
+	r              io.Reader
+	additionalData []byte
+	nonce          []byte
+	counter        uint64
+	// buf holds an encrypted chunk, plus a byte of the next chunk to detect the last one
+	buf       []byte
+	buffered  int
+	out       []byte
+	plaintext []byte
+	last      bool
+	err       error
+}
+
+// NewAEADStreamReader reads the header of the stream from r and returns an AEADStreamReader
+// decrypting it with the given 256-bit key and additionalData.
+func NewAEADStreamReader(key []byte, r io.Reader, additionalData []byte) (*AEADStreamReader, error) {
+	aead, err := NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, AEADStreamHeaderSize)
+	if _, err = io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrAEADStreamTruncated
+		}
+		return nil, err
+	}
+	if header[0] != AEADStreamVersion {
+		return nil, ErrAEADStreamUnsupportedVersion
+	}
+
+	return &AEADStreamReader{
+		aead:           aead,
+		r:              r,
+		additionalData: append(header, additionalData...),
+		nonce:          append(header[1:AEADStreamHeaderSize:AEADStreamHeaderSize], make([]byte, 8)...),
+		buf:            make([]byte, aeadStreamEncryptedChunkSize+1),
+		out:            make([]byte, 0, AEADStreamChunkSize),
+	}, nil
+}
+
+// Read implements the io.Reader interface.
+func (stream *AEADStreamReader) Read(p []byte) (n int, err error) {
+	for len(stream.plaintext) == 0 {
+		if stream.err != nil {
+			return 0, stream.err
+		}
+		if stream.last {
+			return 0, io.EOF
+		}
+		if stream.err = stream.openChunk(); stream.err != nil {
+			Zeroize(stream.out[:cap(stream.out)])
+		}
+	}
+	n = copy(p, stream.plaintext)
+	stream.plaintext = stream.plaintext[n:]
+	return n, nil
+}
+
+func (stream *AEADStreamReader) openChunk() error {
+	if stream.counter == aeadStreamMaxChunks {
+		return ErrAEADStreamTooLong
+	}
+
+	n, err := io.ReadFull(stream.r, stream.buf[stream.buffered:])
+	stream.buffered += n
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		// no byte after this chunk: it must be the last one
+		if stream.buffered < aeadOverhead {
+			return ErrAEADStreamTruncated
+		}
+		stream.last = true
+	case err != nil:
+		return err
+	}
+
+	chunkSize := stream.buffered
+	if !stream.last {
+		chunkSize = aeadStreamEncryptedChunkSize
+	}
+	setAEADStreamNonce(stream.nonce, stream.counter, stream.last)
+	stream.plaintext, err = stream.aead.Open(stream.out[:0], stream.nonce, stream.buf[:chunkSize], stream.additionalData)
+	if err != nil {
+		if stream.last && chunkSize == aeadStreamEncryptedChunkSize {
+			// the stream may have been truncated right after a full chunk
+			setAEADStreamNonce(stream.nonce, stream.counter, false)
+			if _, err = stream.aead.Open(stream.out[:0], stream.nonce, stream.buf[:chunkSize], stream.additionalData); err == nil {
+				stream.plaintext = nil
+				return ErrAEADStreamTruncated
+			}
+		}
+		return ErrAEADStreamInvalid
+	}
+	stream.counter++
+
+	if !stream.last {
+		// keep the first byte of the next chunk
+		stream.buf[0] = stream.buf[aeadStreamEncryptedChunkSize]
+		stream.buffered = 1
+	}
+	return nil
+}
+
+func setAEADStreamNonce(nonce []byte, counter uint64, last bool) {
+	binary.BigEndian.PutUint64(nonce[aeadStreamNoncePrefixSize:], counter<<8)
+	if last {
+		nonce[AEADNonceSize-1] = 1
+	}
+}
@@ -0,0 +1,244 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func encryptAEADStream(t *testing.T, key, plaintext, ad []byte) []byte {
+	var buf bytes.Buffer
+	stream, err := NewAEADStreamWriter(key, &buf, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// write in uneven pieces to exercise the chunking
+	for len(plaintext) > 0 {
+		n := 1000 + len(plaintext)%7000
+		if n > len(plaintext) {
+			n = len(plaintext)
+		}
+		if _, err = stream.Write(plaintext[:n]); err != nil {
+			t.Fatal(err)
+		}
+		plaintext = plaintext[n:]
+	}
+	if err = stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decryptAEADStream(key, ciphertext, ad []byte) ([]byte, error) {
+	stream, err := NewAEADStreamReader(key, bytes.NewReader(ciphertext), ad)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(stream)
+}
+
+func TestAEADStreamEncryptDecrypt(t *testing.T) {
+	key, err := NewAEADKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ad := []byte("additional data")
+	sizes := []int{0, 1, AEADStreamChunkSize - 1, AEADStreamChunkSize, AEADStreamChunkSize + 1,
+		3 * AEADStreamChunkSize, 3*AEADStreamChunkSize + 1234}
+
+	for _, size := range sizes {
+		plaintext, err := RandBytes(uint64(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ciphertext := encryptAEADStream(t, key, plaintext, ad)
+
+		chunks := size/AEADStreamChunkSize + 1
+		if size > 0 && size%AEADStreamChunkSize == 0 {
+			chunks--
+		}
+		expectedSize := AEADStreamHeaderSize + size + chunks*aeadOverhead
+		if len(ciphertext) != expectedSize {
+			t.Errorf("size %d: bad ciphertext size (%d), expecting: %d", size, len(ciphertext), expectedSize)
+		}
+
+		decrypted, err := decryptAEADStream(key, ciphertext, ad)
+		if err != nil {
+			t.Errorf("size %d: %s", size, err)
+		}
+		if !bytes.Equal(plaintext, decrypted) {
+			t.Errorf("size %d: bad plaintext while decrypting", size)
+		}
+	}
+}
+
+func TestAEADStreamBadKeyOrAdditionalData(t *testing.T) {
+	key, _ := NewAEADKey()
+	otherKey, _ := NewAEADKey()
+	ciphertext := encryptAEADStream(t, key, []byte("this is a plaintext message"), []byte("ad"))
+
+	if _, err := decryptAEADStream(otherKey, ciphertext, []byte("ad")); err != ErrAEADStreamInvalid {
+		t.Errorf("decrypting with another key: %v, expecting: %v", err, ErrAEADStreamInvalid)
+	}
+	if _, err := decryptAEADStream(key, ciphertext, []byte("other ad")); err != ErrAEADStreamInvalid {
+		t.Errorf("decrypting with other additional data: %v, expecting: %v", err, ErrAEADStreamInvalid)
+	}
+}
+
+func TestAEADStreamUnsupportedVersion(t *testing.T) {
+	key, _ := NewAEADKey()
+	ciphertext := encryptAEADStream(t, key, []byte("this is a plaintext message"), nil)
+	ciphertext[0] = 42
+
+	if _, err := decryptAEADStream(key, ciphertext, nil); err != ErrAEADStreamUnsupportedVersion {
+		t.Errorf("%v, expecting: %v", err, ErrAEADStreamUnsupportedVersion)
+	}
+}
+
+func TestAEADStreamTruncated(t *testing.T) {
+	key, _ := NewAEADKey()
+	plaintext, _ := RandBytes(2*AEADStreamChunkSize + 10)
+	ciphertext := encryptAEADStream(t, key, plaintext, nil)
+	firstChunkEnd := AEADStreamHeaderSize + AEADStreamChunkSize + aeadOverhead
+
+	tests := []struct {
+		name     string
+		size     int
+		expected error
+	}{
+		{"header", AEADStreamHeaderSize - 1, ErrAEADStreamTruncated},
+		{"no chunk", AEADStreamHeaderSize, ErrAEADStreamTruncated},
+		{"after a chunk", firstChunkEnd, ErrAEADStreamTruncated},
+		{"after two chunks", firstChunkEnd + AEADStreamChunkSize + aeadOverhead, ErrAEADStreamTruncated},
+		{"in a chunk", firstChunkEnd - 1, ErrAEADStreamInvalid},
+		{"in the last chunk", len(ciphertext) - 1, ErrAEADStreamInvalid},
+	}
+
+	for _, test := range tests {
+		_, err := decryptAEADStream(key, ciphertext[:test.size], nil)
+		if err != test.expected {
+			t.Errorf("%s: %v, expecting: %v", test.name, err, test.expected)
+		}
+	}
+}
+
+func TestAEADStreamReorderedChunks(t *testing.T) {
+	key, _ := NewAEADKey()
+	plaintext, _ := RandBytes(3*AEADStreamChunkSize + 10)
+	ciphertext := encryptAEADStream(t, key, plaintext, nil)
+	chunkSize := AEADStreamChunkSize + aeadOverhead
+	header := ciphertext[:AEADStreamHeaderSize]
+	chunk := func(i int) []byte {
+		start := AEADStreamHeaderSize + i*chunkSize
+		end := start + chunkSize
+		if end > len(ciphertext) {
+			end = len(ciphertext)
+		}
+		return ciphertext[start:end]
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	tests := map[string][]byte{
+		"swapped":    join(header, chunk(1), chunk(0), chunk(2), chunk(3)),
+		"duplicated": join(header, chunk(0), chunk(0), chunk(1), chunk(2), chunk(3)),
+		"removed":    join(header, chunk(0), chunk(2), chunk(3)),
+		"appended":   join(header, chunk(0), chunk(1), chunk(2), chunk(3), chunk(3)),
+	}
+
+	for name, tampered := range tests {
+		if _, err := decryptAEADStream(key, tampered, nil); err != ErrAEADStreamInvalid {
+			t.Errorf("%s: %v, expecting: %v", name, err, ErrAEADStreamInvalid)
+		}
+	}
+}
+
+func TestAEADStreamReadAfterError(t *testing.T) {
+	key, _ := NewAEADKey()
+	ciphertext := encryptAEADStream(t, key, []byte("this is a plaintext message"), nil)
+	ciphertext[len(ciphertext)-1] ^= 1
+
+	stream, err := NewAEADStreamReader(key, bytes.NewReader(ciphertext), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	for i := 0; i < 2; i++ {
+		if n, err := stream.Read(buf); n != 0 || err != ErrAEADStreamInvalid {
+			t.Errorf("read %d: (%d, %v), expecting: (0, %v)", i, n, err, ErrAEADStreamInvalid)
+		}
+	}
+}
+
+func TestAEADStreamWriteAfterClose(t *testing.T) {
+	key, _ := NewAEADKey()
+	stream, err := NewAEADStreamWriter(key, ioutil.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stream.Write([]byte("data")); err == nil {
+		t.Error("writing to a closed stream should fail")
+	}
+	if err = stream.Close(); err == nil {
+		t.Error("closing a closed stream should fail")
+	}
+}
+
+// TestAEADStreamFuzzTampered decrypts randomly tampered streams, which must never be
+// successfully decrypted.
+func TestAEADStreamFuzzTampered(t *testing.T) {
+	key, _ := NewAEADKey()
+	rng := rand.New(rand.NewSource(42))
+	iterations := 500
+	if testing.Short() {
+		iterations = 50
+	}
+
+	for i := 0; i < iterations; i++ {
+		plaintext := make([]byte, rng.Intn(3*AEADStreamChunkSize))
+		rng.Read(plaintext)
+		ciphertext := encryptAEADStream(t, key, plaintext, nil)
+		tampered := append([]byte{}, ciphertext...)
+
+		switch rng.Intn(4) {
+		case 0: // flip a bit
+			tampered[rng.Intn(len(tampered))] ^= 1 << uint(rng.Intn(8))
+		case 1: // truncate
+			tampered = tampered[:rng.Intn(len(tampered))]
+		case 2: // append garbage
+			garbage := make([]byte, 1+rng.Intn(100))
+			rng.Read(garbage)
+			tampered = append(tampered, garbage...)
+		case 3: // remove a range
+			start := rng.Intn(len(tampered))
+			end := start + 1 + rng.Intn(len(tampered)-start)
+			tampered = append(tampered[:start], tampered[end:]...)
+		}
+
+		stream, err := NewAEADStreamReader(key, bytes.NewReader(tampered), nil)
+		if err != nil {
+			continue
+		}
+		if _, err = io.Copy(ioutil.Discard, stream); err == nil {
+			t.Fatalf("iteration %d: tampered stream successfully decrypted", i)
+		}
+	}
+}
+
+func BenchmarkAEADStream(b *testing.B) {
+	key, _ := NewAEADKey()
+	plaintext := make([]byte, 1024*1024)
+	b.SetBytes(int64(len(plaintext)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stream, _ := NewAEADStreamWriter(key, ioutil.Discard, nil)
+		stream.Write(plaintext)
+		stream.Close()
+	}
+}
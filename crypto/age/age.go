@@ -0,0 +1,263 @@
+// Package age implements the age v1 file encryption format (https://age-encryption.org/v1),
+// so files encrypted by this package can be decrypted by the age command line tool and
+// other implementations, and vice versa.
+//
+// Files are encrypted to one or more recipients (X25519 public keys, or a passphrase), and
+// decrypted with the corresponding identities:
+//
+//	identity, err := age.GenerateX25519Identity()
+//	w, err := age.Encrypt(file, identity.Recipient())
+//	w.Write(data)
+//	w.Close()
+//
+//	r, err := age.Decrypt(file, identity)
+//	data, err := ioutil.ReadAll(r)
+//
+// The optional ASCII armor is supported with NewArmorWriter and NewArmorReader.
+package age
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bloom42/gobox/crypto"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const fileKeySize = 16
+
+var (
+	// ErrIncorrectIdentity is returned by Identity.Unwrap when none of the stanzas can be
+	// unwrapped by the identity.
+	ErrIncorrectIdentity = errors.New("age: incorrect identity for recipient block")
+
+	// ErrNoIdentityMatch is returned by Decrypt when none of the identities can unwrap the
+	// file key.
+	ErrNoIdentityMatch = errors.New("age: no identity matched any of the recipients")
+
+	// ErrInvalidHeader is returned (wrapped) by Decrypt when the header of the file is malformed.
+	ErrInvalidHeader = errors.New("age: invalid header")
+
+	// ErrHeaderMACMismatch is returned by Decrypt when the file key has been unwrapped, but the
+	// header can't be authenticated with it.
+	ErrHeaderMACMismatch = errors.New("age: header MAC mismatch")
+
+	// ErrInvalidPayload is returned (wrapped) by the reader returned by Decrypt when the
+	// payload has been modified or truncated.
+	ErrInvalidPayload = errors.New("age: invalid payload")
+)
+
+// Recipient is implemented by the types a file can be encrypted to.
+type Recipient interface {
+	// Wrap encrypts fileKey and returns the stanzas to add to the header of the file.
+	Wrap(fileKey []byte) ([]*Stanza, error)
+}
+
+// Identity is implemented by the types which can decrypt files.
+type Identity interface {
+	// Unwrap returns the file key decrypted from one of the stanzas of the header, or
+	// ErrIncorrectIdentity if none of them can be decrypted by the identity. Other errors
+	// make the decryption fail.
+	Unwrap(stanzas []*Stanza) (fileKey []byte, err error)
+}
+
+// Encrypt encrypts a file to one or more recipients. The data written to the returned
+// io.WriteCloser is encrypted and written to dst. Close must be called to complete the file;
+// it does not close dst.
+func Encrypt(dst io.Writer, recipients ...Recipient) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("age: no recipients specified")
+	}
+
+	fileKey, err := crypto.RandBytes(fileKeySize)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Zeroize(fileKey)
+
+	var stanzas []*Stanza
+	for _, recipient := range recipients {
+		recipientStanzas, err := recipient.Wrap(fileKey)
+		if err != nil {
+			return nil, fmt.Errorf("age: wrapping file key for %T: %w", recipient, err)
+		}
+		for _, stanza := range recipientStanzas {
+			if stanza.Type == "scrypt" && len(recipients) != 1 {
+				return nil, errors.New("age: a ScryptRecipient can't be used with other recipients")
+			}
+		}
+		stanzas = append(stanzas, recipientStanzas...)
+	}
+
+	header, err := marshalHeader(stanzas, fileKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := crypto.RandBytes(payloadNonceSize)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = dst.Write(append(header, nonce...)); err != nil {
+		return nil, err
+	}
+	return newPayloadWriter(fileKey, nonce, dst)
+}
+
+// Decrypt decrypts a file encrypted to one or more identities. The header is read and
+// authenticated before Decrypt returns, and the payload is decrypted as the returned
+// io.Reader is read.
+//
+// The plaintext of each chunk of the payload is only returned once it has been authenticated,
+// but as the file is decrypted progressively, the data read before an error must be
+// discarded by the caller.
+func Decrypt(src io.Reader, identities ...Identity) (io.Reader, error) {
+	if len(identities) == 0 {
+		return nil, errors.New("age: no identities specified")
+	}
+
+	r := bufio.NewReader(src)
+	header, err := parseHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileKey []byte
+	for _, identity := range identities {
+		fileKey, err = identity.Unwrap(header.stanzas)
+		if errors.Is(err, ErrIncorrectIdentity) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	if fileKey == nil {
+		return nil, ErrNoIdentityMatch
+	}
+	defer crypto.Zeroize(fileKey)
+
+	mac, err := headerMAC(fileKey, header.raw)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, header.mac) {
+		return nil, ErrHeaderMACMismatch
+	}
+
+	nonce := make([]byte, payloadNonceSize)
+	if _, err = io.ReadFull(r, nonce); err != nil {
+		return nil, fmt.Errorf("%w: reading payload nonce: %s", ErrInvalidHeader, err)
+	}
+	return newPayloadReader(fileKey, nonce, r)
+}
+
+// ParseIdentities parses a file with one or more identities (such as the files generated by
+// age-keygen), one per line. Empty lines and lines starting with "#" are ignored.
+func ParseIdentities(r io.Reader) ([]Identity, error) {
+	var identities []Identity
+	err := parseKeyFile(r, func(line string) error {
+		identity, err := ParseX25519Identity(line)
+		if err != nil {
+			return err
+		}
+		identities = append(identities, identity)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(identities) == 0 {
+		return nil, errors.New("age: no identities found")
+	}
+	return identities, nil
+}
+
+// ParseRecipients parses a file with one or more recipients, one per line. Empty lines and
+// lines starting with "#" are ignored.
+func ParseRecipients(r io.Reader) ([]Recipient, error) {
+	var recipients []Recipient
+	err := parseKeyFile(r, func(line string) error {
+		recipient, err := ParseX25519Recipient(line)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, recipient)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, errors.New("age: no recipients found")
+	}
+	return recipients, nil
+}
+
+func parseKeyFile(r io.Reader, parseLine func(line string) error) error {
+	const maxKeyFileSize = 1 << 24
+	scanner := bufio.NewScanner(io.LimitReader(r, maxKeyFileSize))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := parseLine(line); err != nil {
+			// the error may contain the key: only report the line number
+			return fmt.Errorf("age: malformed key at line %d", lineNumber)
+		}
+	}
+	return scanner.Err()
+}
+
+// unwrapEach calls unwrap on each stanza until one returns a file key, or an error which
+// is not ErrIncorrectIdentity.
+func unwrapEach(stanzas []*Stanza, unwrap func(stanza *Stanza) ([]byte, error)) ([]byte, error) {
+	for _, stanza := range stanzas {
+		fileKey, err := unwrap(stanza)
+		if errors.Is(err, ErrIncorrectIdentity) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return fileKey, nil
+	}
+	return nil, ErrIncorrectIdentity
+}
+
+// wrapFileKey encrypts fileKey with ChaCha20-Poly1305 and a zero nonce, as wrapKey is
+// only used once.
+func wrapFileKey(wrapKey, fileKey []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return aead.Seal(nil, nonce, fileKey, nil), nil
+}
+
+// unwrapFileKey decrypts the body of a stanza encrypted with wrapFileKey.
+func unwrapFileKey(wrapKey, body []byte) ([]byte, error) {
+	// the size is checked before decrypting, so a ciphertext can't be crafted to decrypt
+	// with several keys
+	if len(body) != fileKeySize+payloadTagSize {
+		return nil, fmt.Errorf("%w: invalid stanza body size", ErrInvalidHeader)
+	}
+	aead, err := chacha20poly1305.New(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	fileKey, err := aead.Open(nil, nonce, body, nil)
+	if err != nil {
+		return nil, ErrIncorrectIdentity
+	}
+	return fileKey, nil
+}
@@ -0,0 +1,250 @@
+package age
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/bloom42/gobox/crypto"
+)
+
+func encrypt(t *testing.T, plaintext []byte, recipients ...Recipient) []byte {
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, recipients...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(file []byte, identities ...Identity) ([]byte, error) {
+	r, err := Decrypt(bytes.NewReader(file), identities...)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestEncryptDecryptX25519(t *testing.T) {
+	identity, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{0, 1, payloadChunkSize - 1, payloadChunkSize, payloadChunkSize + 1, 3*payloadChunkSize + 42} {
+		plaintext, err := crypto.RandBytes(uint64(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := encrypt(t, plaintext, other.Recipient(), identity.Recipient())
+
+		for _, id := range []Identity{identity, other} {
+			decrypted, err := decrypt(file, id)
+			if err != nil {
+				t.Fatalf("size %d: %s", size, err)
+			}
+			if !bytes.Equal(plaintext, decrypted) {
+				t.Errorf("size %d: bad plaintext while decrypting", size)
+			}
+		}
+	}
+}
+
+func TestEncryptDecryptScrypt(t *testing.T) {
+	recipient, err := NewScryptRecipient("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient.SetWorkFactor(10)
+	plaintext := []byte("this is a plaintext message")
+	file := encrypt(t, plaintext, recipient)
+
+	identity, err := NewScryptIdentity("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := decrypt(file, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, decrypted) {
+		t.Error("bad plaintext while decrypting")
+	}
+
+	wrongIdentity, _ := NewScryptIdentity("wrong passphrase")
+	if _, err = decrypt(file, wrongIdentity); err != ErrNoIdentityMatch {
+		t.Errorf("decrypting with a wrong passphrase: %v, expecting: %v", err, ErrNoIdentityMatch)
+	}
+
+	identity.SetMaxWorkFactor(9)
+	if _, err = decrypt(file, identity); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("decrypting with a too large work factor: %v, expecting: %v", err, ErrInvalidHeader)
+	}
+}
+
+func TestScryptRecipientMustBeAlone(t *testing.T) {
+	scryptRecipient, _ := NewScryptRecipient("passphrase")
+	identity, _ := GenerateX25519Identity()
+
+	if _, err := Encrypt(ioutil.Discard, scryptRecipient, identity.Recipient()); err == nil {
+		t.Error("encrypting to a scrypt recipient and another recipient should fail")
+	}
+}
+
+func TestDecryptNoMatch(t *testing.T) {
+	identity, _ := GenerateX25519Identity()
+	other, _ := GenerateX25519Identity()
+	file := encrypt(t, []byte("this is a plaintext message"), identity.Recipient())
+
+	if _, err := decrypt(file, other); err != ErrNoIdentityMatch {
+		t.Errorf("%v, expecting: %v", err, ErrNoIdentityMatch)
+	}
+}
+
+func TestDecryptTamperedHeader(t *testing.T) {
+	identity, _ := GenerateX25519Identity()
+	file := encrypt(t, []byte("this is a plaintext message"), identity.Recipient())
+
+	// add a stanza, which is ignored by the identity but not authenticated by the MAC
+	footer := bytes.Index(file, []byte("\n---")) + 1
+	tampered := append([]byte{}, file[:footer]...)
+	tampered = append(tampered, "-> grease\n\n"...)
+	tampered = append(tampered, file[footer:]...)
+
+	if _, err := decrypt(tampered, identity); err != ErrHeaderMACMismatch {
+		t.Errorf("%v, expecting: %v", err, ErrHeaderMACMismatch)
+	}
+}
+
+func TestDecryptTruncatedPayload(t *testing.T) {
+	identity, _ := GenerateX25519Identity()
+	plaintext, _ := crypto.RandBytes(2 * payloadChunkSize)
+	file := encrypt(t, plaintext, identity.Recipient())
+
+	r, err := Decrypt(bytes.NewReader(file[:len(file)-payloadChunkSize]), identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.Copy(ioutil.Discard, r); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("%v, expecting: %v", err, ErrInvalidPayload)
+	}
+}
+
+func TestX25519Encoding(t *testing.T) {
+	identity, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := identity.String()
+	if !strings.HasPrefix(encoded, "AGE-SECRET-KEY-1") {
+		t.Errorf("bad identity encoding: %s", encoded)
+	}
+	parsed, err := ParseX25519Identity(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed.PrivateKey(), identity.PrivateKey()) {
+		t.Error("parsed identity doesn't match")
+	}
+
+	recipient := identity.Recipient()
+	if !strings.HasPrefix(recipient.String(), "age1") {
+		t.Errorf("bad recipient encoding: %s", recipient)
+	}
+	parsedRecipient, err := ParseX25519Recipient(recipient.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsedRecipient.PublicKey(), recipient.PublicKey()) {
+		t.Error("parsed recipient doesn't match")
+	}
+
+	if _, err = ParseX25519Recipient(encoded); err == nil {
+		t.Error("parsing an identity as a recipient should fail")
+	}
+	if _, err = ParseX25519Identity(recipient.String()); err == nil {
+		t.Error("parsing a recipient as an identity should fail")
+	}
+	corrupted := []byte(recipient.String())
+	corrupted[10] ^= 'a' ^ 'c'
+	if _, err = ParseX25519Recipient(string(corrupted)); err == nil {
+		t.Error("parsing a recipient with a bad checksum should fail")
+	}
+}
+
+func TestParseIdentities(t *testing.T) {
+	keyFile := `# created: 2020-10-27T10:00:00Z
+
+AGE-SECRET-KEY-1EGTZVFFV20835NWYV6270LXYVK2VKNX2MMDKWYKLMGR48UAWX40Q2P2LM0
+`
+	identities, err := ParseIdentities(strings.NewReader(keyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 {
+		t.Fatalf("%d identities parsed, expecting: 1", len(identities))
+	}
+
+	if _, err = ParseIdentities(strings.NewReader("# no keys\n")); err == nil {
+		t.Error("parsing a file without identities should fail")
+	}
+	if _, err = ParseIdentities(strings.NewReader("AGE-SECRET-KEY-1XXX\n")); err == nil {
+		t.Error("parsing a malformed identity should fail")
+	}
+}
+
+func TestArmor(t *testing.T) {
+	identity, _ := GenerateX25519Identity()
+
+	for _, size := range []int{0, 1, 47, 48, 1000, 2 * payloadChunkSize} {
+		plaintext, _ := crypto.RandBytes(uint64(size))
+		var armored bytes.Buffer
+		armor := NewArmorWriter(&armored)
+		w, err := Encrypt(armor, identity.Recipient())
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(plaintext)
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err = armor.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(armored.String(), "\n"), "\n")
+		if lines[0] != armorHeader || lines[len(lines)-1] != armorFooter {
+			t.Fatalf("size %d: bad armor header or footer", size)
+		}
+		for _, line := range lines[1 : len(lines)-1] {
+			if len(line) > columnsPerLine {
+				t.Fatalf("size %d: armor line too long: %d", size, len(line))
+			}
+		}
+
+		r, err := Decrypt(NewArmorReader(&armored), identity)
+		if err != nil {
+			t.Fatalf("size %d: %s", size, err)
+		}
+		decrypted, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("size %d: %s", size, err)
+		}
+		if !bytes.Equal(plaintext, decrypted) {
+			t.Errorf("size %d: bad plaintext while decrypting", size)
+		}
+	}
+}
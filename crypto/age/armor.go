@@ -0,0 +1,220 @@
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	armorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+	armorFooter = "-----END AGE ENCRYPTED FILE-----"
+	// maxArmorWhitespace is the maximum amount of whitespace accepted before and after
+	// an armored file
+	maxArmorWhitespace = 1024
+)
+
+// ErrInvalidArmor is returned (wrapped) by the reader returned by NewArmorReader when the
+// armor is malformed.
+var ErrInvalidArmor = errors.New("age: invalid armor")
+
+type armorWriter struct {
+	dst     io.Writer
+	encoder io.WriteCloser
+	lines   *lineWrapper
+	started bool
+	closed  bool
+}
+
+// NewArmorWriter returns an io.WriteCloser encoding the data written to it with the age
+// ASCII armor: a PEM like base64 encoding, used to encrypt files to a text format.
+// Close must be called to write the end of the armor; it does not close dst.
+func NewArmorWriter(dst io.Writer) io.WriteCloser {
+	lines := &lineWrapper{dst: dst}
+	return &armorWriter{
+		dst:     dst,
+		encoder: base64.NewEncoder(base64.StdEncoding.Strict(), lines),
+		lines:   lines,
+	}
+}
+
+func (w *armorWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("age: write to closed armor writer")
+	}
+	if !w.started {
+		if _, err := io.WriteString(w.dst, armorHeader+"\n"); err != nil {
+			return 0, err
+		}
+		w.started = true
+	}
+	return w.encoder.Write(p)
+}
+
+func (w *armorWriter) Close() error {
+	if w.closed {
+		return errors.New("age: armor writer already closed")
+	}
+	if !w.started {
+		if _, err := io.WriteString(w.dst, armorHeader+"\n"); err != nil {
+			return err
+		}
+	}
+	w.closed = true
+	if err := w.encoder.Close(); err != nil {
+		return err
+	}
+	footer := armorFooter + "\n"
+	if w.lines.written != 0 {
+		footer = "\n" + footer
+	}
+	_, err := io.WriteString(w.dst, footer)
+	return err
+}
+
+// lineWrapper inserts a newline every columnsPerLine bytes.
+type lineWrapper struct {
+	dst     io.Writer
+	written int
+}
+
+func (w *lineWrapper) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		if w.written == columnsPerLine {
+			if _, err = w.dst.Write([]byte{'\n'}); err != nil {
+				return
+			}
+			w.written = 0
+		}
+		size := columnsPerLine - w.written
+		if size > len(p) {
+			size = len(p)
+		}
+		written, err := w.dst.Write(p[:size])
+		n += written
+		w.written += written
+		if err != nil {
+			return n, err
+		}
+		p = p[size:]
+	}
+	return
+}
+
+type armorReader struct {
+	r       *bufio.Reader
+	started bool
+	buf     [bytesPerLine]byte
+	unread  []byte
+	err     error
+}
+
+// NewArmorReader returns an io.Reader decoding an armored file. Whitespace is accepted before
+// and after the armor, and lines may end with CRLF.
+func NewArmorReader(r io.Reader) io.Reader {
+	return &armorReader{r: bufio.NewReader(r)}
+}
+
+func (r *armorReader) Read(p []byte) (int, error) {
+	for len(r.unread) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if err := r.readLine(); err != nil {
+			if err != io.EOF {
+				err = fmt.Errorf("%w: %s", ErrInvalidArmor, err)
+				r.unread = nil
+			}
+			r.err = err
+		}
+	}
+	n := copy(p, r.unread)
+	r.unread = r.unread[n:]
+	return n, nil
+}
+
+func (r *armorReader) getLine() ([]byte, error) {
+	line, err := r.r.ReadBytes('\n')
+	if err == io.EOF && len(line) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil && err != io.EOF {
+		return nil, err
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	return line, nil
+}
+
+// readLine decodes the next line of the armor into r.unread.
+func (r *armorReader) readLine() error {
+	skipped := 0
+	for !r.started {
+		line, err := r.getLine()
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			skipped += len(line) + 1
+			if skipped > maxArmorWhitespace {
+				return errors.New("too much leading whitespace")
+			}
+			continue
+		}
+		if string(line) != armorHeader {
+			return fmt.Errorf("invalid first line: %q", line)
+		}
+		r.started = true
+	}
+
+	line, err := r.getLine()
+	if err != nil {
+		return err
+	}
+	if string(line) == armorFooter {
+		return r.checkTrailing()
+	}
+	if len(line) > columnsPerLine {
+		return errors.New("line too long")
+	}
+	// the base64 decoder ignores carriage returns
+	if len(line) == 0 || bytes.IndexByte(line, '\r') != -1 {
+		return fmt.Errorf("invalid line: %q", line)
+	}
+	n, err := base64.StdEncoding.Strict().Decode(r.buf[:], line)
+	if err != nil {
+		return err
+	}
+	r.unread = r.buf[:n]
+
+	// the data always ends with a short line
+	if n < bytesPerLine {
+		line, err := r.getLine()
+		if err != nil {
+			return err
+		}
+		if string(line) != armorFooter {
+			return fmt.Errorf("invalid closing line: %q", line)
+		}
+		return r.checkTrailing()
+	}
+	return nil
+}
+
+// checkTrailing checks that only whitespace follows the armor, and returns io.EOF.
+func (r *armorReader) checkTrailing() error {
+	trailing, err := ioutil.ReadAll(io.LimitReader(r.r, maxArmorWhitespace))
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(trailing)) != 0 {
+		return errors.New("trailing data after armored file")
+	}
+	if len(trailing) == maxArmorWhitespace {
+		return errors.New("too much trailing whitespace")
+	}
+	return io.EOF
+}
@@ -0,0 +1,197 @@
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	headerIntro        = "age-encryption.org/v1\n"
+	stanzaPrefix       = "->"
+	footerPrefix       = "---"
+	columnsPerLine     = 64
+	bytesPerLine       = columnsPerLine / 4 * 3
+	headerMACSize      = sha256.Size
+	maxHeaderLineCount = 1 << 16
+)
+
+// b64 is the encoding used in the header: standard base64 without padding, rejecting
+// non canonical encodings.
+var b64 = base64.RawStdEncoding.Strict()
+
+// Stanza is a recipient stanza of the header of an age file, holding the file key wrapped
+// for a recipient.
+type Stanza struct {
+	Type string
+	Args []string
+	Body []byte
+}
+
+type header struct {
+	stanzas []*Stanza
+	mac     []byte
+	// raw is the encoded header, up to and including the "---" of the footer, which is
+	// authenticated by mac
+	raw []byte
+}
+
+func invalidHeader(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidHeader, fmt.Sprintf(format, args...))
+}
+
+func (stanza *Stanza) marshal(w *bytes.Buffer) {
+	w.WriteString(stanzaPrefix)
+	for _, arg := range append([]string{stanza.Type}, stanza.Args...) {
+		w.WriteByte(' ')
+		w.WriteString(arg)
+	}
+	w.WriteByte('\n')
+	body := b64.EncodeToString(stanza.Body)
+	// the body always ends with a line shorter than columnsPerLine, which may be empty
+	for len(body) >= columnsPerLine {
+		w.WriteString(body[:columnsPerLine])
+		w.WriteByte('\n')
+		body = body[columnsPerLine:]
+	}
+	w.WriteString(body)
+	w.WriteByte('\n')
+}
+
+// marshalHeader encodes a header holding stanzas, authenticated with fileKey.
+func marshalHeader(stanzas []*Stanza, fileKey []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(headerIntro)
+	for _, stanza := range stanzas {
+		if !isValidArg(stanza.Type) {
+			return nil, fmt.Errorf("age: invalid stanza type: %q", stanza.Type)
+		}
+		for _, arg := range stanza.Args {
+			if !isValidArg(arg) {
+				return nil, fmt.Errorf("age: invalid stanza argument: %q", arg)
+			}
+		}
+		stanza.marshal(&buf)
+	}
+	buf.WriteString(footerPrefix)
+	mac, err := headerMAC(fileKey, buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(b64.EncodeToString(mac))
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// headerMAC computes the HMAC-SHA-256 of the raw header with a key derived from fileKey.
+func headerMAC(fileKey, raw []byte) ([]byte, error) {
+	key := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, fileKey, nil, []byte("header")), key); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(raw)
+	return mac.Sum(nil), nil
+}
+
+// parseHeader reads the header from r, which is left at the beginning of the payload.
+func parseHeader(r *bufio.Reader) (*header, error) {
+	h := &header{}
+	var raw bytes.Buffer
+	readLine := func() (string, error) {
+		if raw.Len() > maxHeaderLineCount*(columnsPerLine+1) {
+			return "", invalidHeader("header is too long")
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return "", invalidHeader("unexpected end of header")
+			}
+			return "", err
+		}
+		raw.WriteString(line)
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+
+	intro, err := readLine()
+	if err != nil {
+		return nil, err
+	}
+	if intro+"\n" != headerIntro {
+		return nil, invalidHeader("unexpected intro: %q", intro)
+	}
+
+	for {
+		line, err := readLine()
+		if err != nil {
+			return nil, err
+		}
+		args := strings.Split(line, " ")
+
+		if args[0] == footerPrefix {
+			if len(args) != 2 {
+				return nil, invalidHeader("malformed closing line: %q", line)
+			}
+			h.mac, err = b64.DecodeString(args[1])
+			if err != nil || len(h.mac) != headerMACSize {
+				return nil, invalidHeader("malformed closing line: %q", line)
+			}
+			h.raw = raw.Bytes()[:raw.Len()-len(line)-1+len(footerPrefix)]
+			return h, nil
+		}
+
+		if args[0] != stanzaPrefix || len(args) < 2 {
+			return nil, invalidHeader("malformed stanza opening line: %q", line)
+		}
+		for _, arg := range args[1:] {
+			if !isValidArg(arg) {
+				return nil, invalidHeader("malformed stanza opening line: %q", line)
+			}
+		}
+		stanza := &Stanza{Type: args[1], Args: args[2:], Body: []byte{}}
+		for {
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			if len(line) > columnsPerLine {
+				return nil, invalidHeader("malformed stanza body line: too long")
+			}
+			// the base64 decoder ignores carriage returns
+			if strings.IndexByte(line, '\r') != -1 {
+				return nil, invalidHeader("malformed stanza body line: %q", line)
+			}
+			body, err := b64.DecodeString(line)
+			if err != nil {
+				return nil, invalidHeader("malformed stanza body line %q: %s", line, err)
+			}
+			stanza.Body = append(stanza.Body, body...)
+			// a stanza body always ends with a short line
+			if len(body) < bytesPerLine {
+				break
+			}
+		}
+		h.stanzas = append(h.stanzas, stanza)
+	}
+}
+
+// isValidArg reports whether arg is a non empty string of visible ASCII characters.
+func isValidArg(arg string) bool {
+	if arg == "" {
+		return false
+	}
+	for i := 0; i < len(arg); i++ {
+		if arg[i] < 33 || arg[i] > 126 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package age
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/bloom42/gobox/crypto"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	scryptLabel    = "age-encryption.org/v1/scrypt"
+	scryptSaltSize = 16
+
+	// DefaultScryptWorkFactor is the default work factor (log2 of the scrypt N parameter)
+	// used by ScryptRecipient, which takes about one second on a modern machine.
+	DefaultScryptWorkFactor = 18
+
+	// DefaultScryptMaxWorkFactor is the default maximum work factor accepted by ScryptIdentity.
+	DefaultScryptMaxWorkFactor = 22
+)
+
+// ScryptRecipient is a passphrase based recipient. The files encrypted to a ScryptRecipient
+// can't be encrypted to other recipients.
+type ScryptRecipient struct {
+	passphrase []byte
+	workFactor int
+}
+
+// NewScryptRecipient returns a ScryptRecipient for the given passphrase.
+func NewScryptRecipient(passphrase string) (*ScryptRecipient, error) {
+	if passphrase == "" {
+		return nil, errors.New("age: passphrase can't be empty")
+	}
+	return &ScryptRecipient{passphrase: []byte(passphrase), workFactor: DefaultScryptWorkFactor}, nil
+}
+
+// SetWorkFactor sets the scrypt work factor to 2^logN. It must be between 1 and 30, and lower
+// or equal to the maximum work factor of the ScryptIdentity used to decrypt the files.
+// Default to DefaultScryptWorkFactor.
+func (recipient *ScryptRecipient) SetWorkFactor(logN int) {
+	if logN < 1 || logN > 30 {
+		panic("age: invalid scrypt work factor")
+	}
+	recipient.workFactor = logN
+}
+
+// Wrap implements the Recipient interface.
+func (recipient *ScryptRecipient) Wrap(fileKey []byte) ([]*Stanza, error) {
+	salt, err := crypto.RandBytes(scryptSaltSize)
+	if err != nil {
+		return nil, err
+	}
+	wrapKey, err := scryptWrapKey(recipient.passphrase, salt, recipient.workFactor)
+	if err != nil {
+		return nil, err
+	}
+	body, err := wrapFileKey(wrapKey, fileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	stanza := &Stanza{
+		Type: "scrypt",
+		Args: []string{b64.EncodeToString(salt), strconv.Itoa(recipient.workFactor)},
+		Body: body,
+	}
+	return []*Stanza{stanza}, nil
+}
+
+// ScryptIdentity is a passphrase based identity, which can decrypt the files encrypted to a
+// ScryptRecipient with the same passphrase.
+type ScryptIdentity struct {
+	passphrase    []byte
+	maxWorkFactor int
+}
+
+// NewScryptIdentity returns a ScryptIdentity for the given passphrase.
+func NewScryptIdentity(passphrase string) (*ScryptIdentity, error) {
+	if passphrase == "" {
+		return nil, errors.New("age: passphrase can't be empty")
+	}
+	return &ScryptIdentity{passphrase: []byte(passphrase), maxWorkFactor: DefaultScryptMaxWorkFactor}, nil
+}
+
+// SetMaxWorkFactor sets the maximum accepted scrypt work factor to 2^logN. It must be between
+// 1 and 30. Default to DefaultScryptMaxWorkFactor.
+//
+// This caps the amount of work that Decrypt might have to do to process received files.
+func (identity *ScryptIdentity) SetMaxWorkFactor(logN int) {
+	if logN < 1 || logN > 30 {
+		panic("age: invalid scrypt work factor")
+	}
+	identity.maxWorkFactor = logN
+}
+
+// Unwrap implements the Identity interface.
+func (identity *ScryptIdentity) Unwrap(stanzas []*Stanza) ([]byte, error) {
+	for _, stanza := range stanzas {
+		if stanza.Type == "scrypt" && len(stanzas) != 1 {
+			return nil, fmt.Errorf("%w: an scrypt stanza must be alone in the header", ErrInvalidHeader)
+		}
+	}
+	return unwrapEach(stanzas, identity.unwrap)
+}
+
+func (identity *ScryptIdentity) unwrap(stanza *Stanza) ([]byte, error) {
+	if stanza.Type != "scrypt" {
+		return nil, ErrIncorrectIdentity
+	}
+	if len(stanza.Args) != 2 {
+		return nil, fmt.Errorf("%w: invalid scrypt stanza", ErrInvalidHeader)
+	}
+	salt, err := b64.DecodeString(stanza.Args[0])
+	if err != nil || len(salt) != scryptSaltSize {
+		return nil, fmt.Errorf("%w: invalid scrypt stanza salt", ErrInvalidHeader)
+	}
+	logN, err := parseScryptWorkFactor(stanza.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	if logN > identity.maxWorkFactor {
+		return nil, fmt.Errorf("%w: scrypt work factor is too large: %d", ErrInvalidHeader, logN)
+	}
+
+	wrapKey, err := scryptWrapKey(identity.passphrase, salt, logN)
+	if err != nil {
+		return nil, err
+	}
+	return unwrapFileKey(wrapKey, stanza.Body)
+}
+
+// parseScryptWorkFactor parses a work factor, which must be a positive decimal number without
+// leading zeros.
+func parseScryptWorkFactor(s string) (int, error) {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, fmt.Errorf("%w: invalid scrypt work factor: %q", ErrInvalidHeader, s)
+		}
+	}
+	if s == "" || s[0] == '0' || len(s) > 2 {
+		return 0, fmt.Errorf("%w: invalid scrypt work factor: %q", ErrInvalidHeader, s)
+	}
+	logN, _ := strconv.Atoi(s)
+	return logN, nil
+}
+
+func scryptWrapKey(passphrase, salt []byte, logN int) ([]byte, error) {
+	labeledSalt := make([]byte, 0, len(scryptLabel)+len(salt))
+	labeledSalt = append(labeledSalt, scryptLabel...)
+	labeledSalt = append(labeledSalt, salt...)
+	return scrypt.Key(passphrase, labeledSalt, 1<<uint(logN), 8, 1, crypto.AEADKeySize)
+}
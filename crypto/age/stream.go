@@ -0,0 +1,189 @@
+package age
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// The payload is encrypted with ChaCha20-Poly1305 in chunks of payloadChunkSize bytes
+// using the STREAM construction: the nonce of a chunk is its 11 bytes big endian counter,
+// followed by a byte set to 1 for the last chunk. The last chunk may be full, but can
+// only be empty if the whole payload is empty.
+
+const (
+	payloadNonceSize = 16
+	payloadChunkSize = 64 * 1024
+	payloadTagSize   = 16
+)
+
+func payloadAEAD(fileKey, nonce []byte) (cipher.AEAD, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, fileKey, nonce, []byte("payload")), key); err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.New(key)
+}
+
+func incrementNonce(nonce *[chacha20poly1305.NonceSize]byte) {
+	for i := len(nonce) - 2; i >= 0; i-- {
+		nonce[i]++
+		if nonce[i] != 0 {
+			return
+		}
+	}
+	// 2^88 chunks can't be reached
+	panic("age: chunk counter wrapped around")
+}
+
+type payloadWriter struct {
+	aead   cipher.AEAD
+	dst    io.Writer
+	nonce  [chacha20poly1305.NonceSize]byte
+	buf    []byte
+	sealed []byte
+	closed bool
+}
+
+func newPayloadWriter(fileKey, nonce []byte, dst io.Writer) (*payloadWriter, error) {
+	aead, err := payloadAEAD(fileKey, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &payloadWriter{
+		aead:   aead,
+		dst:    dst,
+		buf:    make([]byte, 0, payloadChunkSize),
+		sealed: make([]byte, 0, payloadChunkSize+payloadTagSize),
+	}, nil
+}
+
+func (w *payloadWriter) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, errors.New("age: write to closed writer")
+	}
+	for len(p) > 0 {
+		// a full chunk is only sealed when more data is written, as it may be the last one
+		if len(w.buf) == payloadChunkSize {
+			if err = w.sealChunk(false); err != nil {
+				return
+			}
+		}
+		written := copy(w.buf[len(w.buf):payloadChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+written]
+		p = p[written:]
+		n += written
+	}
+	return
+}
+
+func (w *payloadWriter) Close() error {
+	if w.closed {
+		return errors.New("age: writer already closed")
+	}
+	w.closed = true
+	return w.sealChunk(true)
+}
+
+func (w *payloadWriter) sealChunk(last bool) error {
+	if last {
+		w.nonce[len(w.nonce)-1] = 1
+	}
+	w.sealed = w.aead.Seal(w.sealed[:0], w.nonce[:], w.buf, nil)
+	if _, err := w.dst.Write(w.sealed); err != nil {
+		return err
+	}
+	incrementNonce(&w.nonce)
+	w.buf = w.buf[:0]
+	return nil
+}
+
+type payloadReader struct {
+	aead      cipher.AEAD
+	src       io.Reader
+	nonce     [chacha20poly1305.NonceSize]byte
+	buf       []byte
+	out       []byte
+	plaintext []byte
+	err       error
+}
+
+func newPayloadReader(fileKey, nonce []byte, src io.Reader) (*payloadReader, error) {
+	aead, err := payloadAEAD(fileKey, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &payloadReader{
+		aead: aead,
+		src:  src,
+		buf:  make([]byte, payloadChunkSize+payloadTagSize),
+		out:  make([]byte, 0, payloadChunkSize),
+	}, nil
+}
+
+func (r *payloadReader) Read(p []byte) (int, error) {
+	for len(r.plaintext) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.readChunk()
+	}
+	n := copy(p, r.plaintext)
+	r.plaintext = r.plaintext[n:]
+	return n, nil
+}
+
+// readChunk decrypts the next chunk. Once the last chunk has been decrypted, it checks that
+// the payload ends and returns io.EOF.
+func (r *payloadReader) readChunk() error {
+	first := r.nonce == [chacha20poly1305.NonceSize]byte{}
+	n, err := io.ReadFull(r.src, r.buf)
+	last := false
+	switch {
+	case err == io.EOF:
+		return fmt.Errorf("%w: missing last chunk", ErrInvalidPayload)
+	case err == io.ErrUnexpectedEOF:
+		if n == payloadTagSize && !first {
+			return fmt.Errorf("%w: last chunk is empty", ErrInvalidPayload)
+		}
+		last = true
+		r.nonce[len(r.nonce)-1] = 1
+	case err != nil:
+		return err
+	}
+
+	plaintext, err := r.aead.Open(r.out[:0], r.nonce[:], r.buf[:n], nil)
+	if err != nil && !last {
+		// a full chunk may be the last one
+		last = true
+		r.nonce[len(r.nonce)-1] = 1
+		plaintext, err = r.aead.Open(r.out[:0], r.nonce[:], r.buf[:n], nil)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: chunk can't be authenticated", ErrInvalidPayload)
+	}
+	incrementNonce(&r.nonce)
+	r.plaintext = plaintext
+
+	if last {
+		// the plaintext of the last chunk is released before reporting trailing data
+		var b [1]byte
+		n, err := r.src.Read(b[:])
+		for n == 0 && err == nil {
+			n, err = r.src.Read(b[:])
+		}
+		switch {
+		case n > 0:
+			return fmt.Errorf("%w: trailing data after the last chunk", ErrInvalidPayload)
+		case err != io.EOF:
+			return err
+		}
+		return io.EOF
+	}
+	return nil
+}
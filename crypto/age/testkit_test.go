@@ -0,0 +1,147 @@
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The test vectors in testdata/testkit come from the age test suite
+// (https://github.com/C2SP/CCTV/tree/main/age), without the vectors of the ML-KEM
+// hybrid recipients which are not supported. See its README for the format.
+
+type testkitVector struct {
+	expect     string
+	payload    string
+	identities []Identity
+	armored    bool
+	file       []byte
+}
+
+func parseTestkitVector(t *testing.T, data []byte) *testkitVector {
+	vector := &testkitVector{}
+	r := bufio.NewReader(bytes.NewReader(data))
+	compressed := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("invalid vector: %s", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			break
+		}
+		parts := strings.SplitN(line, ": ", 2)
+		if len(parts) != 2 {
+			t.Fatalf("invalid vector header line: %q", line)
+		}
+		switch key, value := parts[0], parts[1]; key {
+		case "expect":
+			vector.expect = value
+		case "payload":
+			vector.payload = value
+		case "identity":
+			identity, err := ParseX25519Identity(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vector.identities = append(vector.identities, identity)
+		case "passphrase":
+			identity, err := NewScryptIdentity(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vector.identities = append(vector.identities, identity)
+		case "armored":
+			vector.armored = value == "yes"
+		case "compressed":
+			compressed = value == "zlib"
+		case "file key", "comment":
+		default:
+			t.Fatalf("unknown vector header: %q", key)
+		}
+	}
+
+	file, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compressed {
+		zr, err := zlib.NewReader(bytes.NewReader(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file, err = ioutil.ReadAll(zr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vector.file = file
+	return vector
+}
+
+func TestTestkit(t *testing.T) {
+	files, err := filepath.Glob("testdata/testkit/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test vectors found")
+	}
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			testTestkitVector(t, parseTestkitVector(t, data))
+		})
+	}
+}
+
+func testTestkitVector(t *testing.T, vector *testkitVector) {
+	var in io.Reader = bytes.NewReader(vector.file)
+	if vector.armored {
+		in = NewArmorReader(in)
+	}
+
+	var payload bytes.Buffer
+	r, err := Decrypt(in, vector.identities...)
+	if err == nil {
+		_, err = io.Copy(&payload, r)
+	}
+
+	var result string
+	switch {
+	case err == nil:
+		result = "success"
+	case errors.Is(err, ErrInvalidArmor):
+		result = "armor failure"
+	case errors.Is(err, ErrNoIdentityMatch):
+		result = "no match"
+	case errors.Is(err, ErrHeaderMACMismatch):
+		result = "HMAC failure"
+	case errors.Is(err, ErrInvalidPayload):
+		result = "payload failure"
+	default:
+		result = "header failure"
+	}
+	if result != vector.expect {
+		t.Fatalf("expected %q, got %q (%v)", vector.expect, result, err)
+	}
+
+	if vector.payload != "" {
+		sum := sha256.Sum256(payload.Bytes())
+		if hex.EncodeToString(sum[:]) != vector.payload {
+			t.Errorf("bad payload hash")
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package age
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bloom42/gobox/crypto"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	x25519Label        = "age-encryption.org/v1/X25519"
+	x25519RecipientHRP = "age"
+	x25519IdentityHRP  = "AGE-SECRET-KEY-"
+)
+
+// X25519Recipient is the standard age public key. Files encrypted to it can be decrypted
+// with the corresponding X25519Identity.
+//
+// Its string encoding is a Bech32 string starting with "age1".
+type X25519Recipient struct {
+	publicKey crypto.Curve25519PublicKey
+}
+
+// NewX25519Recipient returns the X25519Recipient for the given public key.
+func NewX25519Recipient(publicKey crypto.Curve25519PublicKey) (*X25519Recipient, error) {
+	if len(publicKey) != crypto.Curve25519PublicKeySize {
+		return nil, errors.New("age: invalid X25519 public key size")
+	}
+	return &X25519Recipient{publicKey: publicKey}, nil
+}
+
+// ParseX25519Recipient parses a Bech32 encoded "age1" public key.
+func ParseX25519Recipient(s string) (*X25519Recipient, error) {
+	hrp, publicKey, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("age: malformed recipient %q: %w", s, err)
+	}
+	if hrp != x25519RecipientHRP {
+		return nil, fmt.Errorf("age: malformed recipient %q: invalid type %q", s, hrp)
+	}
+	recipient, err := NewX25519Recipient(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("age: malformed recipient %q: %w", s, err)
+	}
+	return recipient, nil
+}
+
+// PublicKey returns the public key of the recipient.
+func (recipient *X25519Recipient) PublicKey() crypto.Curve25519PublicKey {
+	return recipient.publicKey
+}
+
+// String returns the Bech32 encoding of the recipient.
+func (recipient *X25519Recipient) String() string {
+	s, _ := bech32Encode(x25519RecipientHRP, recipient.publicKey)
+	return s
+}
+
+// Wrap implements the Recipient interface.
+func (recipient *X25519Recipient) Wrap(fileKey []byte) ([]*Stanza, error) {
+	ephemeralPublicKey, ephemeralPrivateKey, err := crypto.GenerateCurve25519KeyPair()
+	defer crypto.Zeroize(ephemeralPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := ephemeralPrivateKey.KeyExchange(recipient.publicKey)
+	defer crypto.Zeroize(sharedSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapKey, err := x25519WrapKey(sharedSecret, ephemeralPublicKey, recipient.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	body, err := wrapFileKey(wrapKey, fileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	stanza := &Stanza{
+		Type: "X25519",
+		Args: []string{b64.EncodeToString(ephemeralPublicKey)},
+		Body: body,
+	}
+	return []*Stanza{stanza}, nil
+}
+
+// X25519Identity is the standard age private key, which can decrypt the files encrypted to
+// the corresponding X25519Recipient.
+//
+// Its string encoding is a Bech32 string starting with "AGE-SECRET-KEY-1".
+type X25519Identity struct {
+	privateKey crypto.Curve25519PrivateKey
+	publicKey  crypto.Curve25519PublicKey
+}
+
+// GenerateX25519Identity generates a new random X25519Identity.
+func GenerateX25519Identity() (*X25519Identity, error) {
+	publicKey, privateKey, err := crypto.GenerateCurve25519KeyPair()
+	if err != nil {
+		return nil, err
+	}
+	return &X25519Identity{privateKey: privateKey, publicKey: publicKey}, nil
+}
+
+// NewX25519Identity returns the X25519Identity for the given private key.
+func NewX25519Identity(privateKey crypto.Curve25519PrivateKey) (*X25519Identity, error) {
+	if len(privateKey) != crypto.Curve25519PrivateKeySize {
+		return nil, errors.New("age: invalid X25519 private key size")
+	}
+	publicKey, err := privateKey.Public()
+	if err != nil {
+		return nil, err
+	}
+	return &X25519Identity{privateKey: privateKey, publicKey: publicKey}, nil
+}
+
+// ParseX25519Identity parses a Bech32 encoded "AGE-SECRET-KEY-1" private key.
+func ParseX25519Identity(s string) (*X25519Identity, error) {
+	hrp, privateKey, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("age: malformed secret key: %w", err)
+	}
+	if hrp != strings.ToLower(x25519IdentityHRP) {
+		return nil, fmt.Errorf("age: malformed secret key: unknown type %q", hrp)
+	}
+	identity, err := NewX25519Identity(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("age: malformed secret key: %w", err)
+	}
+	return identity, nil
+}
+
+// Recipient returns the X25519Recipient corresponding to the identity.
+func (identity *X25519Identity) Recipient() *X25519Recipient {
+	return &X25519Recipient{publicKey: identity.publicKey}
+}
+
+// PrivateKey returns the private key of the identity.
+func (identity *X25519Identity) PrivateKey() crypto.Curve25519PrivateKey {
+	return identity.privateKey
+}
+
+// String returns the Bech32 encoding of the identity.
+func (identity *X25519Identity) String() string {
+	s, _ := bech32Encode(x25519IdentityHRP, identity.privateKey)
+	return s
+}
+
+// Unwrap implements the Identity interface.
+func (identity *X25519Identity) Unwrap(stanzas []*Stanza) ([]byte, error) {
+	return unwrapEach(stanzas, identity.unwrap)
+}
+
+func (identity *X25519Identity) unwrap(stanza *Stanza) ([]byte, error) {
+	if stanza.Type != "X25519" {
+		return nil, ErrIncorrectIdentity
+	}
+	if len(stanza.Args) != 1 {
+		return nil, fmt.Errorf("%w: invalid X25519 stanza", ErrInvalidHeader)
+	}
+	ephemeralPublicKey, err := b64.DecodeString(stanza.Args[0])
+	if err != nil || len(ephemeralPublicKey) != crypto.Curve25519PublicKeySize {
+		return nil, fmt.Errorf("%w: invalid X25519 stanza share", ErrInvalidHeader)
+	}
+
+	sharedSecret, err := identity.privateKey.KeyExchange(ephemeralPublicKey)
+	defer crypto.Zeroize(sharedSecret)
+	if err != nil {
+		// the share is a low order point
+		return nil, fmt.Errorf("%w: invalid X25519 stanza share: %s", ErrInvalidHeader, err)
+	}
+
+	wrapKey, err := x25519WrapKey(sharedSecret, ephemeralPublicKey, identity.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return unwrapFileKey(wrapKey, stanza.Body)
+}
+
+func x25519WrapKey(sharedSecret, ephemeralPublicKey, publicKey []byte) ([]byte, error) {
+	salt := make([]byte, 0, len(ephemeralPublicKey)+len(publicKey))
+	salt = append(salt, ephemeralPublicKey...)
+	salt = append(salt, publicKey...)
+	wrapKey := make([]byte, crypto.AEADKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, salt, []byte(x25519Label)), wrapKey); err != nil {
+		return nil, err
+	}
+	return wrapKey, nil
+}
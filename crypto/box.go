@@ -0,0 +1,184 @@
+package crypto
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+const (
+	// BoxNonceSize is the size, in bytes, of the nonces of `Box`.
+	BoxNonceSize = 24
+
+	// BoxOverhead is the difference, in bytes, between the size of a box and the size of its
+	// message.
+	BoxOverhead = box.Overhead
+
+	// SealedBoxOverhead is the difference, in bytes, between the size of a sealed box and the size
+	// of its message: the ephemeral public key and the authentication tag.
+	SealedBoxOverhead = box.AnonymousOverhead
+
+	// SignedSealedBoxOverhead is the difference, in bytes, between the size of a signed sealed box
+	// and the size of its message.
+	SignedSealedBoxOverhead = SealedBoxOverhead + Ed25519SignatureSize
+)
+
+var (
+	// ErrInvalidBox is returned when a box can't be opened: it was not encrypted for this key, or
+	// it has been modified.
+	ErrInvalidBox = errors.New("crypto: invalid box")
+
+	// ErrInvalidBoxSignature is returned by `OpenSignedSealedBox` when the box was not signed by
+	// the expected sender.
+	ErrInvalidBoxSignature = errors.New("crypto: invalid box signature")
+)
+
+// The boxes below are compatible with libsodium's `crypto_box_easy` and `crypto_box_seal`, which
+// use XSalsa20-Poly1305 instead of the XChaCha20-Poly1305 of `Encrypt` and `EncryptEphemeral`.
+
+func toArray32(key []byte) (*[32]byte, error) {
+	if len(key) != 32 {
+		return nil, errors.New("crypto: Invalid Curve25519 key size")
+	}
+	var array [32]byte
+	copy(array[:], key)
+	return &array, nil
+}
+
+// Box encrypts and authenticates message for publicKey, from the given private key, using
+// XSalsa20-Poly1305 with the shared secret of a x25519 key exchange. It is compatible with libsodium's
+// `crypto_box_easy`. The nonce must be `BoxNonceSize` bytes, and unique for each pair of keys: it
+// can be generated with `RandBytes`.
+func (publicKey Curve25519PublicKey) Box(fromPrivateKey Curve25519PrivateKey, nonce, message []byte) ([]byte, error) {
+	peerPublicKey, err := toArray32(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := toArray32(fromPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(privateKey[:])
+	if len(nonce) != BoxNonceSize {
+		return nil, errors.New("crypto: Invalid box nonce size")
+	}
+	var boxNonce [BoxNonceSize]byte
+	copy(boxNonce[:], nonce)
+
+	return box.Seal(nil, message, &boxNonce, peerPublicKey, privateKey), nil
+}
+
+// OpenBox verifies and decrypts a box created by `Box`, or libsodium's `crypto_box_easy`, with the
+// public key of the sender.
+func (privateKey Curve25519PrivateKey) OpenBox(fromPublicKey Curve25519PublicKey, nonce, ciphertext []byte) ([]byte, error) {
+	peerPublicKey, err := toArray32(fromPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := toArray32(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(key[:])
+	if len(nonce) != BoxNonceSize {
+		return nil, errors.New("crypto: Invalid box nonce size")
+	}
+	var boxNonce [BoxNonceSize]byte
+	copy(boxNonce[:], nonce)
+
+	message, ok := box.Open(nil, ciphertext, &boxNonce, peerPublicKey, key)
+	if !ok {
+		return nil, ErrInvalidBox
+	}
+	return message, nil
+}
+
+// SealedBox anonymously encrypts message for publicKey, with an ephemeral key pair. It is
+// compatible with libsodium's `crypto_box_seal`: the sealed box is
+// `ephemeralPublicKey || Box(nonce=blake2b(size=BoxNonceSize, message=ephemeralPublicKey || publicKey))`.
+//
+// The recipient can't know who sent the message: use `SignedSealedBox` to authenticate the sender.
+func (publicKey Curve25519PublicKey) SealedBox(message []byte) ([]byte, error) {
+	recipient, err := toArray32(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return box.SealAnonymous(nil, message, recipient, RandReader())
+}
+
+// OpenSealedBox decrypts a box created by `SealedBox`, or libsodium's `crypto_box_seal`.
+func (privateKey Curve25519PrivateKey) OpenSealedBox(sealedBox []byte) ([]byte, error) {
+	key, err := toArray32(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(key[:])
+	publicKey, err := privateKey.Public()
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := toArray32(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	message, ok := box.OpenAnonymous(nil, sealedBox, recipient, key)
+	if !ok {
+		return nil, ErrInvalidBox
+	}
+	return message, nil
+}
+
+// SignedSealedBox signs message with the Ed25519 private key of the sender, then seals the
+// signature and message for publicKey with `SealedBox`:
+// `SealedBox(Sign(publicKey || message) || message)`.
+//
+// The public key of the recipient is signed with the message, so the recipient can't forward
+// it to someone else as if it had been sent to them.
+func (publicKey Curve25519PublicKey) SignedSealedBox(fromPrivateKey Ed25519PrivateKey, message []byte) ([]byte, error) {
+	if len(publicKey) != Curve25519PublicKeySize {
+		return nil, errors.New("crypto: Invalid Curve25519 key size")
+	}
+	signedMessage := make([]byte, 0, len(publicKey)+len(message))
+	signedMessage = append(signedMessage, publicKey...)
+	signedMessage = append(signedMessage, message...)
+	signature, err := fromPrivateKey.Sign(RandReader(), signedMessage, Ed25519SignerOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, 0, len(signature)+len(message))
+	plaintext = append(plaintext, signature...)
+	plaintext = append(plaintext, message...)
+	defer Zeroize(plaintext)
+	return publicKey.SealedBox(plaintext)
+}
+
+// OpenSignedSealedBox opens a box created by `SignedSealedBox`, and verifies that it has been
+// signed by the given Ed25519 public key.
+func (privateKey Curve25519PrivateKey) OpenSignedSealedBox(fromPublicKey Ed25519PublicKey, sealedBox []byte) ([]byte, error) {
+	plaintext, err := privateKey.OpenSealedBox(sealedBox)
+	if err != nil {
+		return nil, err
+	}
+	if len(plaintext) < Ed25519SignatureSize {
+		return nil, ErrInvalidBox
+	}
+	signature, message := plaintext[:Ed25519SignatureSize], plaintext[Ed25519SignatureSize:]
+
+	publicKey, err := privateKey.Public()
+	if err != nil {
+		return nil, err
+	}
+	signedMessage := make([]byte, 0, len(publicKey)+len(message))
+	signedMessage = append(signedMessage, publicKey...)
+	signedMessage = append(signedMessage, message...)
+	valid, err := fromPublicKey.Verify(signedMessage, signature)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, ErrInvalidBoxSignature
+	}
+	return message, nil
+}
@@ -0,0 +1,171 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+type hexBytes []byte
+
+func (h *hexBytes) UnmarshalJSON(data []byte) (err error) {
+	var s string
+	if err = json.Unmarshal(data, &s); err != nil {
+		return
+	}
+	*h, err = hex.DecodeString(s)
+	return
+}
+
+type libsodiumBoxFixture struct {
+	Message hexBytes `json:"message"`
+	Box     hexBytes `json:"box"`
+}
+
+// libsodiumBoxFixtures are generated with libsodium's crypto_box_easy, crypto_box_seal and
+// crypto_sign_detached.
+type libsodiumBoxFixtures struct {
+	AlicePrivateKey       hexBytes              `json:"alice_private_key"`
+	AlicePublicKey        hexBytes              `json:"alice_public_key"`
+	BobPrivateKey         hexBytes              `json:"bob_private_key"`
+	BobPublicKey          hexBytes              `json:"bob_public_key"`
+	AliceSigningPublicKey hexBytes              `json:"alice_signing_public_key"`
+	Nonce                 hexBytes              `json:"nonce"`
+	Boxes                 []libsodiumBoxFixture `json:"boxes"`
+	SealedBoxes           []libsodiumBoxFixture `json:"sealed_boxes"`
+	SignedSealedBoxes     []libsodiumBoxFixture `json:"signed_sealed_boxes"`
+}
+
+func loadLibsodiumBoxFixtures(t *testing.T) libsodiumBoxFixtures {
+	var fixtures libsodiumBoxFixtures
+	data, err := ioutil.ReadFile("testdata/libsodium_boxes.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+	return fixtures
+}
+
+func TestBoxLibsodium(t *testing.T) {
+	fixtures := loadLibsodiumBoxFixtures(t)
+	bobPublicKey := Curve25519PublicKey(fixtures.BobPublicKey)
+	bobPrivateKey := Curve25519PrivateKey(fixtures.BobPrivateKey)
+
+	for _, fixture := range fixtures.Boxes {
+		ciphertext, err := bobPublicKey.Box(Curve25519PrivateKey(fixtures.AlicePrivateKey), fixtures.Nonce, fixture.Message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(ciphertext, fixture.Box) {
+			t.Errorf("box: %x, expecting: %x", ciphertext, []byte(fixture.Box))
+		}
+
+		message, err := bobPrivateKey.OpenBox(Curve25519PublicKey(fixtures.AlicePublicKey), fixtures.Nonce, fixture.Box)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(message, fixture.Message) {
+			t.Errorf("message: %x, expecting: %x", message, []byte(fixture.Message))
+		}
+	}
+
+	for _, fixture := range fixtures.SealedBoxes {
+		message, err := bobPrivateKey.OpenSealedBox(fixture.Box)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(message, fixture.Message) {
+			t.Errorf("sealed box message: %x, expecting: %x", message, []byte(fixture.Message))
+		}
+	}
+
+	for _, fixture := range fixtures.SignedSealedBoxes {
+		message, err := bobPrivateKey.OpenSignedSealedBox(Ed25519PublicKey(fixtures.AliceSigningPublicKey), fixture.Box)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(message, fixture.Message) {
+			t.Errorf("signed sealed box message: %x, expecting: %x", message, []byte(fixture.Message))
+		}
+	}
+}
+
+func TestBoxErrors(t *testing.T) {
+	fixtures := loadLibsodiumBoxFixtures(t)
+	alicePrivateKey := Curve25519PrivateKey(fixtures.AlicePrivateKey)
+	bobPrivateKey := Curve25519PrivateKey(fixtures.BobPrivateKey)
+	aliceSigningPublicKey := Ed25519PublicKey(fixtures.AliceSigningPublicKey)
+
+	tampered := append([]byte{}, fixtures.Boxes[1].Box...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := bobPrivateKey.OpenBox(Curve25519PublicKey(fixtures.AlicePublicKey), fixtures.Nonce, tampered); err != ErrInvalidBox {
+		t.Errorf("tampered box: %v, expecting: %v", err, ErrInvalidBox)
+	}
+	if _, err := bobPrivateKey.OpenBox(Curve25519PublicKey(fixtures.AlicePublicKey), fixtures.Nonce[:12], fixtures.Boxes[1].Box); err == nil {
+		t.Error("opening a box with an invalid nonce should fail")
+	}
+
+	if _, err := alicePrivateKey.OpenSealedBox(fixtures.SealedBoxes[1].Box); err != ErrInvalidBox {
+		t.Errorf("sealed box for another key: %v, expecting: %v", err, ErrInvalidBox)
+	}
+	if _, err := bobPrivateKey.OpenSealedBox(fixtures.SealedBoxes[1].Box[:SealedBoxOverhead-1]); err != ErrInvalidBox {
+		t.Errorf("truncated sealed box: %v, expecting: %v", err, ErrInvalidBox)
+	}
+
+	// a sealed box without signature
+	if _, err := bobPrivateKey.OpenSignedSealedBox(aliceSigningPublicKey, fixtures.SealedBoxes[2].Box); err != ErrInvalidBoxSignature {
+		t.Errorf("unsigned sealed box: %v, expecting: %v", err, ErrInvalidBoxSignature)
+	}
+	otherSigningPublicKey, _, err := GenerateEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bobPrivateKey.OpenSignedSealedBox(otherSigningPublicKey, fixtures.SignedSealedBoxes[1].Box); err != ErrInvalidBoxSignature {
+		t.Errorf("signed by another key: %v, expecting: %v", err, ErrInvalidBoxSignature)
+	}
+}
+
+func TestSignedSealedBox(t *testing.T) {
+	message := []byte("this is a simple message")
+	signingPublicKey, signingPrivateKey, err := GenerateEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobPublicKey, bobPrivateKey, err := GenerateCurve25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	carolPublicKey, carolPrivateKey, err := GenerateCurve25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealedBox, err := bobPublicKey.SignedSealedBox(signingPrivateKey, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sealedBox) != len(message)+SignedSealedBoxOverhead {
+		t.Errorf("signed sealed box size: %d, expecting: %d", len(sealedBox), len(message)+SignedSealedBoxOverhead)
+	}
+	plaintext, err := bobPrivateKey.OpenSignedSealedBox(signingPublicKey, sealedBox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ConstantTimeCompare(message, plaintext) {
+		t.Errorf("Message (%s) and plaintext (%s) don't match", string(message), string(plaintext))
+	}
+
+	// bob forwards the signed message to carol
+	signedMessage, _ := bobPrivateKey.OpenSealedBox(sealedBox)
+	forwarded, err := carolPublicKey.SealedBox(signedMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = carolPrivateKey.OpenSignedSealedBox(signingPublicKey, forwarded); err != ErrInvalidBoxSignature {
+		t.Errorf("forwarded box: %v, expecting: %v", err, ErrInvalidBoxSignature)
+	}
+}
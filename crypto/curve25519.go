@@ -55,7 +55,8 @@ func (publicKey Curve25519PublicKey) Encrypt(fromPrivateKey Curve25519PrivateKey
 }
 
 // EncryptEphemeral generates an ephemeral Curve25519KeyPair and `Encrypt` message using the public key,
-// the ephemeral privateKey and `blake2b(size=AEADNonceSize, message=ephemeralPublicKey || publicKey)` as nonce
+// the ephemeral privateKey and `blake2b(size=AEADNonceSize, message=ephemeralPublicKey || publicKey)` as nonce.
+// It is not compatible with libsodium: use `SealedBox` for messages exchanged with libsodium clients.
 func (publicKey Curve25519PublicKey) EncryptEphemeral(message []byte) (ciphertext []byte, ephemeralPublicKey Curve25519PublicKey, err error) {
 	ephemeralPublicKey, ephemeralPrivateKey, err := GenerateCurve25519KeyPair()
 	defer Zeroize(ephemeralPrivateKey)
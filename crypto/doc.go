@@ -9,10 +9,47 @@
 // Pasword
 //
 // Only th efunction `HashPassword` should be used for password hashing.
+// `PasswordPolicy` adds an optional pepper, and reports the hashes which should be upgraded
+// (`NeedsRehash`) to the current parameters, including legacy bcrypt, scrypt and PBKDF2 hashes.
 //
 // AEAD
 //
 // AEAD (Authenticated Encryption with Associated Data) is used for secret key (symmetric) cryptography.
+// Large files and other streams of data should be encrypted with `NewAEADStreamWriter` and decrypted
+// with `NewAEADStreamReader`, which do not need to hold the whole plaintext in memory.
+//
+// The `envelope` subpackage implements envelope encryption with versioned data encryption keys
+// wrapped by a master key, which can be rotated. The `shamir` subpackage splits a master key in
+// shares, any k of which can recover it, for escrow among several operators.
+//
+// Messages encrypted for a Curve25519 public key which must be opened by libsodium clients should
+// use `SealedBox` (anonymous sender), `SignedSealedBox` (sender authenticated by an Ed25519 key)
+// or `Box`, compatible with libsodium's `crypto_box_seal` and `crypto_box_easy`.
+//
+// Keys
+//
+// Ed25519 and Curve25519 keys can be encoded to PKCS#8 / PKIX (`MarshalPEM`, `ParseEd25519PrivateKeyPEM`...)
+// and JWK (`JWK`, `JWKS`). Ed25519 keys can also be encoded to the OpenSSH formats
+// (`MarshalAuthorizedKey`, `MarshalOpenSSH`), optionally encrypted with a passphrase.
+//
+// Long lived secret keys should be held in a `SecretBuffer` (`NewSecretAEADKey`,
+// `DeriveSecretKeyFromPassword`, `GenerateSecretEd25519KeyPair`): its memory is locked, out of
+// the Go heap, and must be released with `Destroy`.
+//
+// File encryption
+//
+// The `age` subpackage implements the age file encryption format, interoperable with the age command
+// line tool.
+//
+// Tokens
+//
+// The `paseto` subpackage implements PASETO v4 local (encrypted) and public (signed) tokens, with
+// claims validation.
+//
+// Secure channels
+//
+// The `noise` subpackage implements the Noise Protocol Framework, to build authenticated and encrypted
+// channels between peers identified by static Curve25519 keys.
 //
 // Hash
 //
@@ -0,0 +1,398 @@
+// Package envelope implements envelope encryption with key rotation.
+//
+// Data is encrypted with data encryption keys (DEK), which are stored wrapped (encrypted) by a
+// single master key. A Keyring holds several versioned DEKs: new data is always encrypted with
+// the current one, and each ciphertext embeds the ID of the key used to encrypt it, so data
+// encrypted with previous keys can still be decrypted after a rotation:
+//
+//	ring, err := envelope.New(masterKey)
+//	ciphertext, err := ring.Encrypt(plaintext, additionalData)
+//
+//	keyID, err := ring.Rotate()
+//	plaintext, err := ring.Decrypt(ciphertext, additionalData)
+//	ciphertext, err = ring.Reencrypt(ciphertext, additionalData)
+//
+// The wrapped DEKs are exported with MarshalJSON and restored with Load. Only the master key
+// needs to be kept secret (for example in the system keyring, see MasterKeyFromKeyring).
+//
+// Ciphertexts have the following format:
+//
+//	version (1 byte) || key ID (4 bytes, big endian) || nonce (24 bytes) || XChaCha20-Poly1305 ciphertext
+//
+// where the version and the key ID are authenticated with the additional data.
+package envelope
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bloom42/gobox/crypto"
+)
+
+const (
+	// Version is the version of the format of the ciphertexts produced by a Keyring.
+	Version byte = 1
+
+	// MasterKeySize is the size of a master key, in bytes.
+	MasterKeySize = crypto.AEADKeySize
+
+	// HeaderSize is the size of the header of the ciphertexts: version || key ID.
+	HeaderSize = 1 + 4
+
+	// Overhead is the difference between the size of a ciphertext and the size of its plaintext.
+	Overhead = HeaderSize + crypto.AEADNonceSize + 16
+
+	wrappingKeyInfo = "gobox/crypto/envelope: key wrapping"
+)
+
+var (
+	// ErrInvalidMasterKey is returned when the master key does not have a size of MasterKeySize.
+	ErrInvalidMasterKey = errors.New("envelope: invalid master key")
+
+	// ErrUnknownKey is returned when decrypting a ciphertext encrypted with a key which is not in
+	// the keyring.
+	ErrUnknownKey = errors.New("envelope: unknown key")
+
+	// ErrInactiveKey is returned when decrypting a ciphertext encrypted with a deactivated key.
+	ErrInactiveKey = errors.New("envelope: key is not active")
+
+	// ErrInvalidCiphertext is returned when a ciphertext is malformed or can't be authenticated,
+	// because it has been modified or the additional data don't match.
+	ErrInvalidCiphertext = errors.New("envelope: invalid ciphertext")
+
+	// ErrUnsupportedVersion is returned when decrypting a ciphertext with an unknown version.
+	ErrUnsupportedVersion = errors.New("envelope: unsupported version")
+)
+
+// KeyInfo describes a data encryption key of a Keyring.
+type KeyInfo struct {
+	ID        uint32
+	CreatedAt time.Time
+	Active    bool
+	Current   bool
+}
+
+type dataKey struct {
+	id        uint32
+	createdAt time.Time
+	active    bool
+	// wrapped is the key encrypted with the wrapping key: nonce || ciphertext
+	wrapped []byte
+	aead    cipher.AEAD
+}
+
+// Keyring holds versioned data encryption keys wrapped by a master key. It is safe for
+// concurrent use.
+type Keyring struct {
+	mutex       sync.RWMutex
+	wrappingKey []byte
+	keys        map[uint32]*dataKey
+	current     uint32
+}
+
+// New returns a Keyring using masterKey to wrap its keys, with a first data encryption key.
+func New(masterKey []byte) (*Keyring, error) {
+	keyring, err := newKeyring(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = keyring.Rotate(); err != nil {
+		return nil, err
+	}
+	return keyring, nil
+}
+
+func newKeyring(masterKey []byte) (*Keyring, error) {
+	if len(masterKey) != MasterKeySize {
+		return nil, ErrInvalidMasterKey
+	}
+	wrappingKey, err := crypto.DeriveKeyFromKey(masterKey, []byte(wrappingKeyInfo), crypto.AEADKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return &Keyring{
+		wrappingKey: wrappingKey,
+		keys:        map[uint32]*dataKey{},
+	}, nil
+}
+
+// NewMasterKey generates a new random master key.
+func NewMasterKey() ([]byte, error) {
+	return crypto.RandBytes(MasterKeySize)
+}
+
+// Rotate generates a new data encryption key, which becomes the current key used by Encrypt.
+// The previous keys remain active, so the data encrypted with them can still be decrypted.
+func (keyring *Keyring) Rotate() (keyID uint32, err error) {
+	keyring.mutex.Lock()
+	defer keyring.mutex.Unlock()
+
+	keyID = keyring.current + 1
+	if keyID == 0 {
+		return 0, errors.New("envelope: too many keys")
+	}
+	key, err := crypto.NewAEADKey()
+	if err != nil {
+		return 0, err
+	}
+	defer crypto.Zeroize(key)
+
+	wrapped, nonce, err := crypto.AEADEncrypt(keyring.wrappingKey, key, wrappedKeyAdditionalData(keyID))
+	if err != nil {
+		return 0, err
+	}
+	aead, err := crypto.NewAEAD(key)
+	if err != nil {
+		return 0, err
+	}
+	keyring.keys[keyID] = &dataKey{
+		id:        keyID,
+		createdAt: time.Now().UTC(),
+		active:    true,
+		wrapped:   append(nonce, wrapped...),
+		aead:      aead,
+	}
+	keyring.current = keyID
+	return keyID, nil
+}
+
+// CurrentKeyID returns the ID of the key used by Encrypt.
+func (keyring *Keyring) CurrentKeyID() uint32 {
+	keyring.mutex.RLock()
+	defer keyring.mutex.RUnlock()
+	return keyring.current
+}
+
+// Keys returns the keys of the keyring, sorted by ID.
+func (keyring *Keyring) Keys() []KeyInfo {
+	keyring.mutex.RLock()
+	defer keyring.mutex.RUnlock()
+
+	keys := make([]KeyInfo, 0, len(keyring.keys))
+	for _, key := range keyring.keys {
+		keys = append(keys, KeyInfo{
+			ID:        key.id,
+			CreatedAt: key.createdAt,
+			Active:    key.active,
+			Current:   key.id == keyring.current,
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// Deactivate deactivates a key: ciphertexts encrypted with it can no longer be decrypted.
+// It should only be called once all the data encrypted with the key have been reencrypted.
+// The current key can't be deactivated.
+func (keyring *Keyring) Deactivate(keyID uint32) error {
+	return keyring.setActive(keyID, false)
+}
+
+// Activate reactivates a key deactivated with Deactivate.
+func (keyring *Keyring) Activate(keyID uint32) error {
+	return keyring.setActive(keyID, true)
+}
+
+func (keyring *Keyring) setActive(keyID uint32, active bool) error {
+	keyring.mutex.Lock()
+	defer keyring.mutex.Unlock()
+
+	key, ok := keyring.keys[keyID]
+	if !ok {
+		return ErrUnknownKey
+	}
+	if keyID == keyring.current && !active {
+		return errors.New("envelope: the current key can't be deactivated")
+	}
+	key.active = active
+	return nil
+}
+
+// Encrypt encrypts plaintext with the current key. additionalData is authenticated but not
+// encrypted, and must be provided to decrypt the ciphertext (for example the name of the
+// table and the column, and the ID of the row, so a value can't be moved to another row).
+func (keyring *Keyring) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	keyring.mutex.RLock()
+	key := keyring.keys[keyring.current]
+	keyring.mutex.RUnlock()
+
+	nonce, err := crypto.NewAEADNonce()
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, HeaderSize, Overhead+len(plaintext))
+	ciphertext[0] = Version
+	binary.BigEndian.PutUint32(ciphertext[1:HeaderSize], key.id)
+	ciphertext = append(ciphertext, nonce...)
+	ad := append(ciphertext[:HeaderSize:HeaderSize], additionalData...)
+	return key.aead.Seal(ciphertext, nonce, plaintext, ad), nil
+}
+
+// Decrypt decrypts a ciphertext encrypted by Encrypt with any active key of the keyring.
+func (keyring *Keyring) Decrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	keyID, err := KeyID(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < Overhead {
+		return nil, ErrInvalidCiphertext
+	}
+
+	keyring.mutex.RLock()
+	key, ok := keyring.keys[keyID]
+	active := ok && key.active
+	keyring.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownKey, keyID)
+	}
+	if !active {
+		return nil, fmt.Errorf("%w: %d", ErrInactiveKey, keyID)
+	}
+
+	header := ciphertext[:HeaderSize:HeaderSize]
+	nonce := ciphertext[HeaderSize : HeaderSize+crypto.AEADNonceSize]
+	plaintext, err := key.aead.Open(nil, nonce, ciphertext[HeaderSize+crypto.AEADNonceSize:], append(header, additionalData...))
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plaintext, nil
+}
+
+// Reencrypt decrypts a ciphertext and encrypts it again with the current key. It should be used
+// after a rotation to migrate the existing data to the new key, before deactivating the
+// previous ones. Ciphertexts already encrypted with the current key are returned unchanged.
+func (keyring *Keyring) Reencrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	keyID, err := KeyID(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if keyID == keyring.CurrentKeyID() {
+		if _, err = keyring.Decrypt(ciphertext, additionalData); err != nil {
+			return nil, err
+		}
+		return ciphertext, nil
+	}
+
+	plaintext, err := keyring.Decrypt(ciphertext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Zeroize(plaintext)
+	return keyring.Encrypt(plaintext, additionalData)
+}
+
+// NeedsReencrypt reports whether ciphertext was encrypted with another key than the current key.
+func (keyring *Keyring) NeedsReencrypt(ciphertext []byte) bool {
+	keyID, err := KeyID(ciphertext)
+	return err == nil && keyID != keyring.CurrentKeyID()
+}
+
+// KeyID returns the ID of the key used to encrypt ciphertext.
+func KeyID(ciphertext []byte) (uint32, error) {
+	if len(ciphertext) < HeaderSize {
+		return 0, ErrInvalidCiphertext
+	}
+	if ciphertext[0] != Version {
+		return 0, ErrUnsupportedVersion
+	}
+	return binary.BigEndian.Uint32(ciphertext[1:HeaderSize]), nil
+}
+
+// the key ID is authenticated, so a wrapped key can't be swapped with another one
+func wrappedKeyAdditionalData(keyID uint32) []byte {
+	ad := make([]byte, 4)
+	binary.BigEndian.PutUint32(ad, keyID)
+	return ad
+}
+
+type jsonKeyring struct {
+	Version byte          `json:"version"`
+	Current uint32        `json:"current"`
+	Keys    []jsonDataKey `json:"keys"`
+}
+
+type jsonDataKey struct {
+	ID         uint32    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Active     bool      `json:"active"`
+	WrappedKey []byte    `json:"wrapped_key"`
+}
+
+// MarshalJSON encodes the keyring with its keys wrapped by the master key, to be restored
+// with Load. The master key is not part of the encoding.
+func (keyring *Keyring) MarshalJSON() ([]byte, error) {
+	keyring.mutex.RLock()
+	defer keyring.mutex.RUnlock()
+
+	encoded := jsonKeyring{
+		Version: Version,
+		Current: keyring.current,
+		Keys:    make([]jsonDataKey, 0, len(keyring.keys)),
+	}
+	for _, key := range keyring.keys {
+		encoded.Keys = append(encoded.Keys, jsonDataKey{
+			ID:         key.id,
+			CreatedAt:  key.createdAt,
+			Active:     key.active,
+			WrappedKey: key.wrapped,
+		})
+	}
+	sort.Slice(encoded.Keys, func(i, j int) bool { return encoded.Keys[i].ID < encoded.Keys[j].ID })
+	return json.Marshal(encoded)
+}
+
+// Load restores a keyring encoded with MarshalJSON, unwrapping its keys with masterKey.
+func Load(masterKey, data []byte) (*Keyring, error) {
+	var encoded jsonKeyring
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, fmt.Errorf("envelope: decoding keyring: %w", err)
+	}
+	if encoded.Version != Version {
+		return nil, ErrUnsupportedVersion
+	}
+
+	keyring, err := newKeyring(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, encodedKey := range encoded.Keys {
+		if len(encodedKey.WrappedKey) < crypto.AEADNonceSize {
+			return nil, fmt.Errorf("envelope: malformed key %d", encodedKey.ID)
+		}
+		if _, ok := keyring.keys[encodedKey.ID]; ok {
+			return nil, fmt.Errorf("envelope: duplicate key %d", encodedKey.ID)
+		}
+		nonce := encodedKey.WrappedKey[:crypto.AEADNonceSize]
+		key, err := crypto.AEADDecrypt(keyring.wrappingKey, nonce, encodedKey.WrappedKey[crypto.AEADNonceSize:],
+			wrappedKeyAdditionalData(encodedKey.ID))
+		if err != nil {
+			return nil, fmt.Errorf("envelope: unwrapping key %d: %w", encodedKey.ID, ErrInvalidMasterKey)
+		}
+		aead, err := crypto.NewAEAD(key)
+		crypto.Zeroize(key)
+		if err != nil {
+			return nil, err
+		}
+		keyring.keys[encodedKey.ID] = &dataKey{
+			id:        encodedKey.ID,
+			createdAt: encodedKey.CreatedAt,
+			active:    encodedKey.Active,
+			wrapped:   encodedKey.WrappedKey,
+			aead:      aead,
+		}
+		if encodedKey.ID > keyring.current {
+			keyring.current = encodedKey.ID
+		}
+	}
+
+	if current, ok := keyring.keys[encoded.Current]; !ok || encoded.Current != keyring.current || !current.active {
+		return nil, errors.New("envelope: invalid current key")
+	}
+	return keyring, nil
+}
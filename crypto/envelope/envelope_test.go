@@ -0,0 +1,197 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/bloom42/gobox/keyring"
+)
+
+func newTestKeyring(t *testing.T) (*Keyring, []byte) {
+	masterKey, err := NewMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, err := New(masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring, masterKey
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	ring, _ := newTestKeyring(t)
+	plaintext := []byte("this is a plaintext message")
+	ad := []byte("users.email:42")
+
+	ciphertext, err := ring.Encrypt(plaintext, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ciphertext) != len(plaintext)+Overhead {
+		t.Errorf("ciphertext size: %d, expecting: %d", len(ciphertext), len(plaintext)+Overhead)
+	}
+	keyID, err := KeyID(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != 1 || keyID != ring.CurrentKeyID() {
+		t.Errorf("key ID: %d, expecting: 1", keyID)
+	}
+
+	decrypted, err := ring.Decrypt(ciphertext, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, decrypted) {
+		t.Error("bad plaintext while decrypting")
+	}
+
+	if _, err = ring.Decrypt(ciphertext, []byte("users.email:43")); err != ErrInvalidCiphertext {
+		t.Errorf("decrypting with bad additional data: %v, expecting: %v", err, ErrInvalidCiphertext)
+	}
+	for i := range ciphertext {
+		tampered := append([]byte{}, ciphertext...)
+		tampered[i] ^= 1
+		if _, err = ring.Decrypt(tampered, ad); err == nil {
+			t.Fatalf("tampered ciphertext (byte %d) decrypted", i)
+		}
+	}
+	if _, err = ring.Decrypt(ciphertext[:Overhead-1], ad); err != ErrInvalidCiphertext {
+		t.Errorf("decrypting a truncated ciphertext: %v, expecting: %v", err, ErrInvalidCiphertext)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	ring, _ := newTestKeyring(t)
+	plaintext := []byte("this is a plaintext message")
+
+	oldCiphertext, err := ring.Encrypt(plaintext, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID, err := ring.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != 2 || ring.CurrentKeyID() != 2 {
+		t.Errorf("key ID after rotation: %d, expecting: 2", keyID)
+	}
+	if !ring.NeedsReencrypt(oldCiphertext) {
+		t.Error("ciphertext encrypted with the previous key should need to be reencrypted")
+	}
+
+	decrypted, err := ring.Decrypt(oldCiphertext, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, decrypted) {
+		t.Error("bad plaintext while decrypting with the previous key")
+	}
+
+	newCiphertext, err := ring.Reencrypt(oldCiphertext, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID, _ = KeyID(newCiphertext); keyID != 2 {
+		t.Errorf("reencrypted with key %d, expecting: 2", keyID)
+	}
+	if ring.NeedsReencrypt(newCiphertext) {
+		t.Error("reencrypted ciphertext should not need to be reencrypted")
+	}
+	unchanged, err := ring.Reencrypt(newCiphertext, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unchanged, newCiphertext) {
+		t.Error("ciphertext encrypted with the current key should not be reencrypted")
+	}
+
+	if err = ring.Deactivate(2); err == nil {
+		t.Error("deactivating the current key should fail")
+	}
+	if err = ring.Deactivate(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ring.Decrypt(oldCiphertext, nil); !errors.Is(err, ErrInactiveKey) {
+		t.Errorf("decrypting with a deactivated key: %v, expecting: %v", err, ErrInactiveKey)
+	}
+	if decrypted, err = ring.Decrypt(newCiphertext, nil); err != nil || !bytes.Equal(plaintext, decrypted) {
+		t.Errorf("decrypting the reencrypted ciphertext: %v", err)
+	}
+
+	keys := ring.Keys()
+	if len(keys) != 2 || keys[0].Active || !keys[1].Active || keys[0].Current || !keys[1].Current {
+		t.Errorf("bad keys: %+v", keys)
+	}
+
+	other, _ := newTestKeyring(t)
+	if _, err = other.Decrypt(newCiphertext, nil); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("decrypting with an unknown key: %v, expecting: %v", err, ErrUnknownKey)
+	}
+}
+
+func TestMarshalLoad(t *testing.T) {
+	ring, masterKey := newTestKeyring(t)
+	oldCiphertext, _ := ring.Encrypt([]byte("old"), nil)
+	ring.Rotate()
+	ring.Deactivate(1)
+	ciphertext, _ := ring.Encrypt([]byte("new"), nil)
+
+	data, err := json.Marshal(ring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(masterKey, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.CurrentKeyID() != 2 {
+		t.Errorf("current key: %d, expecting: 2", loaded.CurrentKeyID())
+	}
+	if decrypted, err := loaded.Decrypt(ciphertext, nil); err != nil || string(decrypted) != "new" {
+		t.Errorf("decrypting with the loaded keyring: %v", err)
+	}
+	if _, err = loaded.Decrypt(oldCiphertext, nil); !errors.Is(err, ErrInactiveKey) {
+		t.Errorf("decrypting with a deactivated key: %v, expecting: %v", err, ErrInactiveKey)
+	}
+
+	otherMasterKey, _ := NewMasterKey()
+	if _, err = Load(otherMasterKey, data); !errors.Is(err, ErrInvalidMasterKey) {
+		t.Errorf("loading with another master key: %v, expecting: %v", err, ErrInvalidMasterKey)
+	}
+	if _, err = Load(masterKey[:16], data); err != ErrInvalidMasterKey {
+		t.Errorf("loading with a short master key: %v, expecting: %v", err, ErrInvalidMasterKey)
+	}
+
+	// swapping the wrapped keys must be detected
+	var encoded jsonKeyring
+	json.Unmarshal(data, &encoded)
+	encoded.Keys[0].WrappedKey, encoded.Keys[1].WrappedKey = encoded.Keys[1].WrappedKey, encoded.Keys[0].WrappedKey
+	swapped, _ := json.Marshal(encoded)
+	if _, err = Load(masterKey, swapped); err == nil {
+		t.Error("loading a keyring with swapped keys should fail")
+	}
+}
+
+func TestMasterKeyFromKeyring(t *testing.T) {
+	keyring.MockInit()
+
+	if _, err := MasterKeyFromKeyring("service", "user"); err != keyring.ErrNotFound {
+		t.Errorf("%v, expecting: %v", err, keyring.ErrNotFound)
+	}
+
+	masterKey, _ := NewMasterKey()
+	if err := StoreMasterKeyInKeyring("service", "user", masterKey); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := MasterKeyFromKeyring("service", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(masterKey, loaded) {
+		t.Error("loaded master key doesn't match")
+	}
+}
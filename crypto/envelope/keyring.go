@@ -0,0 +1,37 @@
+package envelope
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/bloom42/gobox/keyring"
+)
+
+// MasterKeyFromKeyring loads a master key stored in the system keyring with
+// StoreMasterKeyInKeyring. keyring.ErrNotFound is returned if there is no such key.
+func MasterKeyFromKeyring(service, user string) ([]byte, error) {
+	encoded, err := keyring.Get(service, user)
+	if err != nil {
+		if errors.Is(err, keyring.ErrNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("envelope: loading master key from keyring: %w", err)
+	}
+	masterKey, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(masterKey) != MasterKeySize {
+		return nil, ErrInvalidMasterKey
+	}
+	return masterKey, nil
+}
+
+// StoreMasterKeyInKeyring stores a master key in the system keyring, base64 encoded.
+func StoreMasterKeyInKeyring(service, user string, masterKey []byte) error {
+	if len(masterKey) != MasterKeySize {
+		return ErrInvalidMasterKey
+	}
+	if err := keyring.Set(service, user, base64.StdEncoding.EncodeToString(masterKey)); err != nil {
+		return fmt.Errorf("envelope: storing master key in keyring: %w", err)
+	}
+	return nil
+}
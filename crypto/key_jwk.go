@@ -0,0 +1,181 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+const (
+	// JWKKeyTypeOKP is the JWK key type of Ed25519 and X25519 keys (RFC 8037).
+	JWKKeyTypeOKP = "OKP"
+
+	// JWKCurveEd25519 is the JWK curve of Ed25519 keys.
+	JWKCurveEd25519 = "Ed25519"
+
+	// JWKCurveX25519 is the JWK curve of X25519 keys.
+	JWKCurveX25519 = "X25519"
+
+	// JWKAlgorithmEdDSA is the JWS algorithm of Ed25519 signatures.
+	JWKAlgorithmEdDSA = "EdDSA"
+)
+
+// JWK is a JSON Web Key (RFC 7517) of type OKP, holding an Ed25519 or X25519 key (RFC 8037).
+// Private keys have the `D` field set.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	D         string `json:"d,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set (RFC 7517 section 5).
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Key returns the key of the set with the given key ID.
+func (jwks JWKS) Key(keyID string) (jwk JWK, ok bool) {
+	for _, jwk = range jwks.Keys {
+		if jwk.KeyID == keyID {
+			return jwk, true
+		}
+	}
+	return JWK{}, false
+}
+
+// Public returns the public key of jwk, without the private key.
+func (jwk JWK) Public() JWK {
+	jwk.D = ""
+	return jwk
+}
+
+// Thumbprint returns the JWK thumbprint (RFC 7638) of jwk, encoded in base64url. It is the same
+// for the public and private keys, and can be used as key ID.
+func (jwk JWK) Thumbprint() string {
+	// the required members, in lexicographic order, without whitespace
+	hash := sha256.Sum256([]byte(`{"crv":"` + jwk.Curve + `","kty":"` + jwk.KeyType + `","x":"` + jwk.X + `"}`))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func (jwk JWK) decode(curve string, private bool) (x, d []byte, err error) {
+	if jwk.KeyType != JWKKeyTypeOKP || jwk.Curve != curve {
+		err = fmt.Errorf("%w: not a %s JWK: %s %s", ErrInvalidKeyEncoding, curve, jwk.KeyType, jwk.Curve)
+		return
+	}
+	if x, err = base64.RawURLEncoding.DecodeString(jwk.X); err != nil || len(x) != 32 {
+		err = fmt.Errorf("%w: invalid JWK x parameter", ErrInvalidKeyEncoding)
+		return
+	}
+	if private {
+		if jwk.D == "" {
+			err = fmt.Errorf("%w: not a private JWK", ErrInvalidKeyEncoding)
+			return
+		}
+		if d, err = base64.RawURLEncoding.DecodeString(jwk.D); err != nil || len(d) != 32 {
+			err = fmt.Errorf("%w: invalid JWK d parameter", ErrInvalidKeyEncoding)
+			return
+		}
+	}
+	return
+}
+
+// JWK returns publicKey as a JWK, with the given key ID.
+func (publicKey Ed25519PublicKey) JWK(keyID string) JWK {
+	return JWK{
+		KeyType:   JWKKeyTypeOKP,
+		Curve:     JWKCurveEd25519,
+		X:         base64.RawURLEncoding.EncodeToString(publicKey),
+		KeyID:     keyID,
+		Use:       "sig",
+		Algorithm: JWKAlgorithmEdDSA,
+	}
+}
+
+// JWK returns privateKey as a JWK, with the given key ID.
+func (privateKey Ed25519PrivateKey) JWK(keyID string) JWK {
+	jwk := privateKey.Public().JWK(keyID)
+	jwk.D = base64.RawURLEncoding.EncodeToString(privateKey.Seed())
+	return jwk
+}
+
+// Ed25519PublicKey returns the Ed25519 public key of jwk.
+func (jwk JWK) Ed25519PublicKey() (Ed25519PublicKey, error) {
+	x, _, err := jwk.decode(JWKCurveEd25519, false)
+	if err != nil {
+		return nil, err
+	}
+	return Ed25519PublicKey(x), nil
+}
+
+// Ed25519PrivateKey returns the Ed25519 private key of jwk, and checks that it matches its public
+// key.
+func (jwk JWK) Ed25519PrivateKey() (Ed25519PrivateKey, error) {
+	x, d, err := jwk.decode(JWKCurveEd25519, true)
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(d)
+	privateKey, err := NewEd25519PrivateKeyFromSeed(d)
+	if err != nil {
+		return nil, err
+	}
+	if !ConstantTimeCompare(privateKey.Public(), x) {
+		return nil, errors.New("crypto: the JWK private key doesn't match its public key")
+	}
+	return privateKey, nil
+}
+
+// JWK returns publicKey as a JWK, with the given key ID.
+func (publicKey Curve25519PublicKey) JWK(keyID string) JWK {
+	return JWK{
+		KeyType: JWKKeyTypeOKP,
+		Curve:   JWKCurveX25519,
+		X:       base64.RawURLEncoding.EncodeToString(publicKey),
+		KeyID:   keyID,
+		Use:     "enc",
+	}
+}
+
+// JWK returns privateKey as a JWK, with the given key ID.
+func (privateKey Curve25519PrivateKey) JWK(keyID string) (JWK, error) {
+	publicKey, err := privateKey.Public()
+	if err != nil {
+		return JWK{}, err
+	}
+	jwk := publicKey.JWK(keyID)
+	jwk.D = base64.RawURLEncoding.EncodeToString(privateKey)
+	return jwk, nil
+}
+
+// Curve25519PublicKey returns the X25519 public key of jwk.
+func (jwk JWK) Curve25519PublicKey() (Curve25519PublicKey, error) {
+	x, _, err := jwk.decode(JWKCurveX25519, false)
+	if err != nil {
+		return nil, err
+	}
+	return Curve25519PublicKey(x), nil
+}
+
+// Curve25519PrivateKey returns the X25519 private key of jwk, and checks that it matches its public
+// key.
+func (jwk JWK) Curve25519PrivateKey() (Curve25519PrivateKey, error) {
+	x, d, err := jwk.decode(JWKCurveX25519, true)
+	if err != nil {
+		return nil, err
+	}
+	privateKey := Curve25519PrivateKey(d)
+	publicKey, err := privateKey.Public()
+	if err != nil {
+		return nil, err
+	}
+	if !ConstantTimeCompare(publicKey, x) {
+		Zeroize(d)
+		return nil, errors.New("crypto: the JWK private key doesn't match its public key")
+	}
+	return privateKey, nil
+}
@@ -0,0 +1,110 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+// test vectors from RFC 8037 appendix A
+func TestEd25519JWK(t *testing.T) {
+	data := `{"kty":"OKP","crv":"Ed25519",` +
+		`"d":"nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A",` +
+		`"x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`
+	var jwk JWK
+	if err := json.Unmarshal([]byte(data), &jwk); err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := jwk.Ed25519PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedSeed, _ := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	if !bytes.Equal(privateKey.Seed(), expectedSeed) {
+		t.Errorf("seed: %x, expecting: %x", privateKey.Seed(), expectedSeed)
+	}
+	if thumbprint := jwk.Thumbprint(); thumbprint != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Errorf("thumbprint: %s", thumbprint)
+	}
+
+	encoded := privateKey.JWK(jwk.Thumbprint())
+	if encoded.X != jwk.X || encoded.D != jwk.D || encoded.Algorithm != JWKAlgorithmEdDSA {
+		t.Errorf("JWK: %+v", encoded)
+	}
+	publicKey, err := encoded.Public().Ed25519PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(publicKey, privateKey.Public()) {
+		t.Error("the public key doesn't match the private key")
+	}
+	if _, err = encoded.Public().Ed25519PrivateKey(); err == nil {
+		t.Error("getting the private key of a public JWK should fail")
+	}
+	if _, err = encoded.Curve25519PublicKey(); err == nil {
+		t.Error("getting a X25519 key from an Ed25519 JWK should fail")
+	}
+
+	otherPublicKey, _, _ := GenerateEd25519KeyPair()
+	mismatch := encoded
+	mismatch.X = otherPublicKey.JWK("").X
+	if _, err = mismatch.Ed25519PrivateKey(); err == nil {
+		t.Error("a private key which doesn't match the public key should fail")
+	}
+}
+
+func TestCurve25519JWK(t *testing.T) {
+	// keys from RFC 7748 section 6.1
+	privateKeyBytes, _ := hex.DecodeString("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	publicKeyBytes, _ := hex.DecodeString("8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a")
+
+	jwk, err := Curve25519PrivateKey(privateKeyBytes).JWK("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := jwk.Curve25519PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(publicKey, publicKeyBytes) {
+		t.Errorf("public key: %x, expecting: %x", []byte(publicKey), publicKeyBytes)
+	}
+	privateKey, err := jwk.Curve25519PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(privateKey, privateKeyBytes) {
+		t.Errorf("private key: %x, expecting: %x", []byte(privateKey), privateKeyBytes)
+	}
+	if _, err = jwk.Ed25519PublicKey(); err == nil {
+		t.Error("getting an Ed25519 key from a X25519 JWK should fail")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	signingPublicKey, _, _ := GenerateEd25519KeyPair()
+	encryptionPublicKey, _, _ := GenerateCurve25519KeyPair()
+	jwks := JWKS{Keys: []JWK{signingPublicKey.JWK("sig-1"), encryptionPublicKey.JWK("enc-1")}}
+
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded JWKS
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	jwk, ok := decoded.Key("enc-1")
+	if !ok {
+		t.Fatal("key enc-1 not found")
+	}
+	publicKey, err := jwk.Curve25519PublicKey()
+	if err != nil || !bytes.Equal(publicKey, encryptionPublicKey) {
+		t.Errorf("key enc-1: %x, %v", []byte(publicKey), err)
+	}
+	if _, ok = decoded.Key("unknown"); ok {
+		t.Error("unknown key found")
+	}
+}
@@ -0,0 +1,231 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+const (
+	pemTypePrivateKey = "PRIVATE KEY"
+	pemTypePublicKey  = "PUBLIC KEY"
+)
+
+var (
+	// ErrInvalidKeyEncoding is returned (wrapped) when parsing a malformed key, or a key of
+	// another type.
+	ErrInvalidKeyEncoding = errors.New("crypto: invalid key encoding")
+
+	// oidX25519 is the algorithm identifier of X25519 keys (RFC 8410)
+	oidX25519 = asn1.ObjectIdentifier{1, 3, 101, 110}
+)
+
+// Ed25519 keys are encoded by crypto/x509. X25519 keys are not supported by crypto/x509, and
+// are encoded with the structures below (RFC 8410).
+
+type pkcs8 struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+type pkixPublicKey struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+func decodePEM(data []byte, pemType string) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block found", ErrInvalidKeyEncoding)
+	}
+	if block.Type != pemType {
+		return nil, fmt.Errorf("%w: unexpected PEM block type: %s", ErrInvalidKeyEncoding, block.Type)
+	}
+	return block.Bytes, nil
+}
+
+// MarshalPKCS8 encodes privateKey in the PKCS#8 (ASN.1 DER) format.
+func (privateKey Ed25519PrivateKey) MarshalPKCS8() ([]byte, error) {
+	if len(privateKey) != Ed25519PrivateKeySize {
+		return nil, errors.New("crypto: Invalid Ed25519 private key size")
+	}
+	return x509.MarshalPKCS8PrivateKey(ed25519.PrivateKey(privateKey))
+}
+
+// MarshalPEM encodes privateKey in the PKCS#8 format, in a "PRIVATE KEY" PEM block, as used by
+// OpenSSL.
+func (privateKey Ed25519PrivateKey) MarshalPEM() ([]byte, error) {
+	der, err := privateKey.MarshalPKCS8()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypePrivateKey, Bytes: der}), nil
+}
+
+// ParseEd25519PrivateKeyPKCS8 parses an Ed25519 private key in the PKCS#8 (ASN.1 DER) format.
+func ParseEd25519PrivateKeyPKCS8(der []byte) (Ed25519PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeyEncoding, err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an Ed25519 private key", ErrInvalidKeyEncoding)
+	}
+	return Ed25519PrivateKey(privateKey), nil
+}
+
+// ParseEd25519PrivateKeyPEM parses an Ed25519 private key in the PKCS#8 format, in a
+// "PRIVATE KEY" PEM block.
+func ParseEd25519PrivateKeyPEM(data []byte) (Ed25519PrivateKey, error) {
+	der, err := decodePEM(data, pemTypePrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return ParseEd25519PrivateKeyPKCS8(der)
+}
+
+// MarshalPKIX encodes publicKey in the PKIX (ASN.1 DER) format.
+func (publicKey Ed25519PublicKey) MarshalPKIX() ([]byte, error) {
+	if len(publicKey) != Ed25519PublicKeySize {
+		return nil, errors.New("crypto: Invalid Ed25519 public key size")
+	}
+	return x509.MarshalPKIXPublicKey(ed25519.PublicKey(publicKey))
+}
+
+// MarshalPEM encodes publicKey in the PKIX format, in a "PUBLIC KEY" PEM block.
+func (publicKey Ed25519PublicKey) MarshalPEM() ([]byte, error) {
+	der, err := publicKey.MarshalPKIX()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypePublicKey, Bytes: der}), nil
+}
+
+// ParseEd25519PublicKeyPKIX parses an Ed25519 public key in the PKIX (ASN.1 DER) format.
+func ParseEd25519PublicKeyPKIX(der []byte) (Ed25519PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeyEncoding, err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an Ed25519 public key", ErrInvalidKeyEncoding)
+	}
+	return Ed25519PublicKey(publicKey), nil
+}
+
+// ParseEd25519PublicKeyPEM parses an Ed25519 public key in the PKIX format, in a "PUBLIC KEY"
+// PEM block.
+func ParseEd25519PublicKeyPEM(data []byte) (Ed25519PublicKey, error) {
+	der, err := decodePEM(data, pemTypePublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return ParseEd25519PublicKeyPKIX(der)
+}
+
+// MarshalPKCS8 encodes privateKey in the PKCS#8 (ASN.1 DER) format.
+func (privateKey Curve25519PrivateKey) MarshalPKCS8() ([]byte, error) {
+	if len(privateKey) != Curve25519PrivateKeySize {
+		return nil, errors.New("crypto: Invalid Curve25519 private key size")
+	}
+	// the private key is wrapped in an OCTET STRING (RFC 8410 section 7)
+	curvePrivateKey, err := asn1.Marshal([]byte(privateKey))
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkcs8{
+		Algorithm:  pkix.AlgorithmIdentifier{Algorithm: oidX25519},
+		PrivateKey: curvePrivateKey,
+	})
+}
+
+// MarshalPEM encodes privateKey in the PKCS#8 format, in a "PRIVATE KEY" PEM block, as used by
+// OpenSSL.
+func (privateKey Curve25519PrivateKey) MarshalPEM() ([]byte, error) {
+	der, err := privateKey.MarshalPKCS8()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypePrivateKey, Bytes: der}), nil
+}
+
+// ParseCurve25519PrivateKeyPKCS8 parses a X25519 private key in the PKCS#8 (ASN.1 DER) format.
+func ParseCurve25519PrivateKeyPKCS8(der []byte) (Curve25519PrivateKey, error) {
+	var key pkcs8
+	if rest, err := asn1.Unmarshal(der, &key); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: malformed PKCS#8 private key", ErrInvalidKeyEncoding)
+	}
+	if !key.Algorithm.Algorithm.Equal(oidX25519) {
+		return nil, fmt.Errorf("%w: not a X25519 private key", ErrInvalidKeyEncoding)
+	}
+	var privateKey []byte
+	if rest, err := asn1.Unmarshal(key.PrivateKey, &privateKey); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: malformed X25519 private key", ErrInvalidKeyEncoding)
+	}
+	if len(privateKey) != Curve25519PrivateKeySize {
+		return nil, fmt.Errorf("%w: invalid X25519 private key size", ErrInvalidKeyEncoding)
+	}
+	return Curve25519PrivateKey(privateKey), nil
+}
+
+// ParseCurve25519PrivateKeyPEM parses a X25519 private key in the PKCS#8 format, in a
+// "PRIVATE KEY" PEM block.
+func ParseCurve25519PrivateKeyPEM(data []byte) (Curve25519PrivateKey, error) {
+	der, err := decodePEM(data, pemTypePrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCurve25519PrivateKeyPKCS8(der)
+}
+
+// MarshalPKIX encodes publicKey in the PKIX (ASN.1 DER) format.
+func (publicKey Curve25519PublicKey) MarshalPKIX() ([]byte, error) {
+	if len(publicKey) != Curve25519PublicKeySize {
+		return nil, errors.New("crypto: Invalid Curve25519 public key size")
+	}
+	return asn1.Marshal(pkixPublicKey{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidX25519},
+		PublicKey: asn1.BitString{Bytes: publicKey, BitLength: 8 * len(publicKey)},
+	})
+}
+
+// MarshalPEM encodes publicKey in the PKIX format, in a "PUBLIC KEY" PEM block.
+func (publicKey Curve25519PublicKey) MarshalPEM() ([]byte, error) {
+	der, err := publicKey.MarshalPKIX()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypePublicKey, Bytes: der}), nil
+}
+
+// ParseCurve25519PublicKeyPKIX parses a X25519 public key in the PKIX (ASN.1 DER) format.
+func ParseCurve25519PublicKeyPKIX(der []byte) (Curve25519PublicKey, error) {
+	var key pkixPublicKey
+	if rest, err := asn1.Unmarshal(der, &key); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: malformed PKIX public key", ErrInvalidKeyEncoding)
+	}
+	if !key.Algorithm.Algorithm.Equal(oidX25519) {
+		return nil, fmt.Errorf("%w: not a X25519 public key", ErrInvalidKeyEncoding)
+	}
+	if key.PublicKey.BitLength != 8*Curve25519PublicKeySize {
+		return nil, fmt.Errorf("%w: invalid X25519 public key size", ErrInvalidKeyEncoding)
+	}
+	return Curve25519PublicKey(key.PublicKey.Bytes), nil
+}
+
+// ParseCurve25519PublicKeyPEM parses a X25519 public key in the PKIX format, in a "PUBLIC KEY"
+// PEM block.
+func ParseCurve25519PublicKeyPEM(data []byte) (Curve25519PublicKey, error) {
+	der, err := decodePEM(data, pemTypePublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCurve25519PublicKeyPKIX(der)
+}
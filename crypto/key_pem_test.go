@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func readTestKey(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile("testdata/keys/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// the keys of testdata/keys are generated with `openssl genpkey -algorithm ed25519|x25519`
+func TestEd25519PEM(t *testing.T) {
+	privatePEM := readTestKey(t, "ed25519.pem")
+	publicPEM := readTestKey(t, "ed25519.pub.pem")
+
+	privateKey, err := ParseEd25519PrivateKeyPEM(privatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := ParseEd25519PublicKeyPEM(publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(privateKey.Public(), publicKey) {
+		t.Error("the public key doesn't match the private key")
+	}
+
+	encoded, err := privateKey.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, privatePEM) {
+		t.Errorf("private key PEM:\n%s\nexpecting:\n%s", encoded, privatePEM)
+	}
+	encoded, err = publicKey.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, publicPEM) {
+		t.Errorf("public key PEM:\n%s\nexpecting:\n%s", encoded, publicPEM)
+	}
+
+	if _, err = ParseEd25519PrivateKeyPEM(publicPEM); !errors.Is(err, ErrInvalidKeyEncoding) {
+		t.Errorf("parsing a public key as private key: %v, expecting: %v", err, ErrInvalidKeyEncoding)
+	}
+	if _, err = ParseEd25519PrivateKeyPEM(readTestKey(t, "x25519.pem")); !errors.Is(err, ErrInvalidKeyEncoding) {
+		t.Errorf("parsing a X25519 key: %v, expecting: %v", err, ErrInvalidKeyEncoding)
+	}
+}
+
+func TestCurve25519PEM(t *testing.T) {
+	privatePEM := readTestKey(t, "x25519.pem")
+	publicPEM := readTestKey(t, "x25519.pub.pem")
+
+	privateKey, err := ParseCurve25519PrivateKeyPEM(privatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := ParseCurve25519PublicKeyPEM(publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey2, err := privateKey.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(publicKey, publicKey2) {
+		t.Error("the public key doesn't match the private key")
+	}
+
+	encoded, err := privateKey.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, privatePEM) {
+		t.Errorf("private key PEM:\n%s\nexpecting:\n%s", encoded, privatePEM)
+	}
+	encoded, err = publicKey.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, publicPEM) {
+		t.Errorf("public key PEM:\n%s\nexpecting:\n%s", encoded, publicPEM)
+	}
+
+	if _, err = ParseCurve25519PublicKeyPEM(readTestKey(t, "ed25519.pub.pem")); !errors.Is(err, ErrInvalidKeyEncoding) {
+		t.Errorf("parsing an Ed25519 key: %v, expecting: %v", err, ErrInvalidKeyEncoding)
+	}
+	if _, err = ParseCurve25519PrivateKeyPEM([]byte("not a key")); !errors.Is(err, ErrInvalidKeyEncoding) {
+		t.Errorf("parsing garbage: %v, expecting: %v", err, ErrInvalidKeyEncoding)
+	}
+}
@@ -0,0 +1,274 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	sshKeyTypeEd25519      = "ssh-ed25519"
+	sshPrivateKeyMagic     = "openssh-key-v1\x00"
+	pemTypeOpenSSH         = "OPENSSH PRIVATE KEY"
+	sshCipherAES256CTR     = "aes256-ctr"
+	sshKDFBcrypt           = "bcrypt"
+	sshSaltSize            = 16
+	sshBcryptRounds        = 16
+	sshUnencryptedBlockLen = 8
+)
+
+var (
+	// ErrKeyPassphraseRequired is returned when parsing a private key encrypted with a passphrase,
+	// without passphrase.
+	ErrKeyPassphraseRequired = errors.New("crypto: the private key is encrypted with a passphrase")
+
+	// ErrInvalidKeyPassphrase is returned when the passphrase used to decrypt a private key is
+	// not valid.
+	ErrInvalidKeyPassphrase = errors.New("crypto: invalid passphrase")
+)
+
+// MarshalAuthorizedKey encodes publicKey in the format of OpenSSH's authorized_keys files, like
+// `ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAA... comment`, followed by a newline.
+func (publicKey Ed25519PublicKey) MarshalAuthorizedKey(comment string) ([]byte, error) {
+	if len(publicKey) != Ed25519PublicKeySize {
+		return nil, errors.New("crypto: Invalid Ed25519 public key size")
+	}
+	line := sshKeyTypeEd25519 + " " + base64.StdEncoding.EncodeToString(sshPublicKeyBlob(publicKey))
+	if comment != "" {
+		line += " " + comment
+	}
+	return []byte(line + "\n"), nil
+}
+
+// ParseEd25519AuthorizedKey parses an Ed25519 public key from a line of an authorized_keys file.
+// The options before the key type, if any, are ignored.
+func ParseEd25519AuthorizedKey(line []byte) (publicKey Ed25519PublicKey, comment string, err error) {
+	fields := strings.Fields(string(line))
+	for i, field := range fields {
+		if field != sshKeyTypeEd25519 || i+1 >= len(fields) {
+			continue
+		}
+		blob, err := base64.StdEncoding.DecodeString(fields[i+1])
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidKeyEncoding, err)
+		}
+		if publicKey, err = parseSSHPublicKeyBlob(blob); err != nil {
+			return nil, "", err
+		}
+		return publicKey, strings.Join(fields[i+2:], " "), nil
+	}
+	return nil, "", fmt.Errorf("%w: no %s key found", ErrInvalidKeyEncoding, sshKeyTypeEd25519)
+}
+
+// MarshalOpenSSH encodes privateKey in the OpenSSH private key format, in an
+// "OPENSSH PRIVATE KEY" PEM block, as generated by ssh-keygen. If passphrase is not empty, the key
+// is encrypted with aes256-ctr and a key derived from passphrase with bcrypt_pbkdf, like
+// ssh-keygen does.
+func (privateKey Ed25519PrivateKey) MarshalOpenSSH(comment string, passphrase []byte) ([]byte, error) {
+	if len(privateKey) != Ed25519PrivateKeySize {
+		return nil, errors.New("crypto: Invalid Ed25519 private key size")
+	}
+	checkBytes, err := RandBytes(4)
+	if err != nil {
+		return nil, err
+	}
+
+	cipherName, kdfName := "none", "none"
+	var kdfOptions []byte
+	blockSize := sshUnencryptedBlockLen
+	var salt []byte
+	if len(passphrase) != 0 {
+		cipherName, kdfName = sshCipherAES256CTR, sshKDFBcrypt
+		blockSize = aes.BlockSize
+		if salt, err = RandBytes(sshSaltSize); err != nil {
+			return nil, err
+		}
+		kdfOptions = appendSSHString(nil, salt)
+		kdfOptions = appendSSHUint32(kdfOptions, sshBcryptRounds)
+	}
+
+	publicKey := privateKey.Public()
+	private := append(checkBytes, checkBytes...)
+	private = appendSSHString(private, []byte(sshKeyTypeEd25519))
+	private = appendSSHString(private, publicKey)
+	private = appendSSHString(private, privateKey)
+	private = appendSSHString(private, []byte(comment))
+	for i := 1; len(private)%blockSize != 0; i++ {
+		private = append(private, byte(i))
+	}
+	defer Zeroize(private)
+
+	if len(passphrase) != 0 {
+		stream, err := newSSHKeyStream(passphrase, salt, sshBcryptRounds)
+		if err != nil {
+			return nil, err
+		}
+		stream.XORKeyStream(private, private)
+	}
+
+	data := []byte(sshPrivateKeyMagic)
+	data = appendSSHString(data, []byte(cipherName))
+	data = appendSSHString(data, []byte(kdfName))
+	data = appendSSHString(data, kdfOptions)
+	data = appendSSHUint32(data, 1)
+	data = appendSSHString(data, sshPublicKeyBlob(publicKey))
+	data = appendSSHString(data, private)
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypeOpenSSH, Bytes: data}), nil
+}
+
+// ParseEd25519PrivateKeyOpenSSH parses an Ed25519 private key in the OpenSSH private key format.
+// ErrKeyPassphraseRequired is returned if the key is encrypted and passphrase is empty.
+func ParseEd25519PrivateKeyOpenSSH(data, passphrase []byte) (privateKey Ed25519PrivateKey, comment string, err error) {
+	der, err := decodePEM(data, pemTypeOpenSSH)
+	if err != nil {
+		return
+	}
+	if !bytes.HasPrefix(der, []byte(sshPrivateKeyMagic)) {
+		err = fmt.Errorf("%w: not an OpenSSH private key", ErrInvalidKeyEncoding)
+		return
+	}
+	reader := sshReader{data: der[len(sshPrivateKeyMagic):]}
+	cipherName := string(reader.readString())
+	kdfName := string(reader.readString())
+	kdfOptions := sshReader{data: reader.readString()}
+	numKeys := reader.readUint32()
+	publicKeyBlob := reader.readString()
+	private := append([]byte{}, reader.readString()...)
+	defer Zeroize(private)
+	if reader.err != nil || len(reader.data) != 0 || numKeys != 1 {
+		err = fmt.Errorf("%w: malformed OpenSSH private key", ErrInvalidKeyEncoding)
+		return
+	}
+	publicKey, err := parseSSHPublicKeyBlob(publicKeyBlob)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case cipherName == "none" && kdfName == "none":
+		if len(private)%sshUnencryptedBlockLen != 0 {
+			err = fmt.Errorf("%w: malformed OpenSSH private key", ErrInvalidKeyEncoding)
+			return
+		}
+	case cipherName == sshCipherAES256CTR && kdfName == sshKDFBcrypt:
+		if len(passphrase) == 0 {
+			err = ErrKeyPassphraseRequired
+			return
+		}
+		salt := kdfOptions.readString()
+		rounds := kdfOptions.readUint32()
+		if kdfOptions.err != nil || len(private)%aes.BlockSize != 0 || rounds > 1<<16 {
+			err = fmt.Errorf("%w: malformed OpenSSH private key", ErrInvalidKeyEncoding)
+			return
+		}
+		var stream cipher.Stream
+		if stream, err = newSSHKeyStream(passphrase, salt, int(rounds)); err != nil {
+			return
+		}
+		stream.XORKeyStream(private, private)
+	default:
+		err = fmt.Errorf("%w: unsupported OpenSSH private key encryption: %s, %s", ErrInvalidKeyEncoding, cipherName, kdfName)
+		return
+	}
+
+	reader = sshReader{data: private}
+	checkInt1, checkInt2 := reader.readUint32(), reader.readUint32()
+	if reader.err != nil || checkInt1 != checkInt2 {
+		if cipherName != "none" {
+			err = ErrInvalidKeyPassphrase
+		} else {
+			err = fmt.Errorf("%w: malformed OpenSSH private key", ErrInvalidKeyEncoding)
+		}
+		return
+	}
+	keyType := string(reader.readString())
+	privatePublicKey := reader.readString()
+	key := reader.readString()
+	comment = string(reader.readString())
+	for i, b := range reader.data {
+		if b != byte(i+1) {
+			reader.err = errors.New("invalid padding")
+		}
+	}
+	if reader.err != nil || keyType != sshKeyTypeEd25519 || len(key) != Ed25519PrivateKeySize ||
+		!bytes.Equal(privatePublicKey, publicKey) || !bytes.Equal(key[32:], publicKey) {
+		err = fmt.Errorf("%w: malformed OpenSSH private key", ErrInvalidKeyEncoding)
+		return
+	}
+	privateKey = append(Ed25519PrivateKey{}, key...)
+	return
+}
+
+func newSSHKeyStream(passphrase, salt []byte, rounds int) (cipher.Stream, error) {
+	keyIV, err := bcryptPBKDF(passphrase, salt, rounds, 32+aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(keyIV)
+	block, err := aes.NewCipher(keyIV[:32])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewCTR(block, keyIV[32:]), nil
+}
+
+// sshPublicKeyBlob returns the SSH wire encoding of an Ed25519 public key.
+func sshPublicKeyBlob(publicKey Ed25519PublicKey) []byte {
+	blob := appendSSHString(nil, []byte(sshKeyTypeEd25519))
+	return appendSSHString(blob, publicKey)
+}
+
+func parseSSHPublicKeyBlob(blob []byte) (Ed25519PublicKey, error) {
+	reader := sshReader{data: blob}
+	keyType := string(reader.readString())
+	publicKey := reader.readString()
+	if reader.err != nil || len(reader.data) != 0 || keyType != sshKeyTypeEd25519 ||
+		len(publicKey) != Ed25519PublicKeySize {
+		return nil, fmt.Errorf("%w: invalid %s public key", ErrInvalidKeyEncoding, sshKeyTypeEd25519)
+	}
+	return append(Ed25519PublicKey{}, publicKey...), nil
+}
+
+func appendSSHUint32(data []byte, n uint32) []byte {
+	var buffer [4]byte
+	binary.BigEndian.PutUint32(buffer[:], n)
+	return append(data, buffer[:]...)
+}
+
+func appendSSHString(data, s []byte) []byte {
+	data = appendSSHUint32(data, uint32(len(s)))
+	return append(data, s...)
+}
+
+// sshReader reads the SSH wire encoding. The first error is sticky.
+type sshReader struct {
+	data []byte
+	err  error
+}
+
+func (reader *sshReader) readUint32() uint32 {
+	if reader.err != nil || len(reader.data) < 4 {
+		reader.err = errors.New("unexpected end of data")
+		return 0
+	}
+	n := binary.BigEndian.Uint32(reader.data)
+	reader.data = reader.data[4:]
+	return n
+}
+
+func (reader *sshReader) readString() []byte {
+	size := reader.readUint32()
+	if reader.err != nil || uint32(len(reader.data)) < size {
+		reader.err = errors.New("unexpected end of data")
+		return nil
+	}
+	s := reader.data[:size]
+	reader.data = reader.data[size:]
+	return s
+}
@@ -0,0 +1,83 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// the keys of testdata/keys are generated with `ssh-keygen -t ed25519`
+func TestEd25519OpenSSH(t *testing.T) {
+	privateKey, comment, err := ParseEd25519PrivateKeyOpenSSH(readTestKey(t, "ssh_ed25519"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comment != "alice@example.com" {
+		t.Errorf("comment: %q, expecting: %q", comment, "alice@example.com")
+	}
+
+	authorizedKey := readTestKey(t, "ssh_ed25519.pub")
+	publicKey, comment, err := ParseEd25519AuthorizedKey(authorizedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(privateKey.Public(), publicKey) {
+		t.Error("the public key doesn't match the private key")
+	}
+	encoded, err := publicKey.MarshalAuthorizedKey(comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, authorizedKey) {
+		t.Errorf("authorized key: %s, expecting: %s", encoded, authorizedKey)
+	}
+
+	withOptions := append([]byte(`no-pty,from="10.0.0.0/8" `), authorizedKey...)
+	if publicKey2, _, err := ParseEd25519AuthorizedKey(withOptions); err != nil || !bytes.Equal(publicKey, publicKey2) {
+		t.Errorf("parsing an authorized key with options: %v", err)
+	}
+	if _, _, err = ParseEd25519AuthorizedKey([]byte("ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQ user")); !errors.Is(err, ErrInvalidKeyEncoding) {
+		t.Errorf("parsing a RSA key: %v, expecting: %v", err, ErrInvalidKeyEncoding)
+	}
+
+	// round trip
+	for _, passphrase := range [][]byte{nil, []byte("passphrase")} {
+		encoded, err = privateKey.MarshalOpenSSH("alice@example.com", passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		privateKey2, comment, err := ParseEd25519PrivateKeyOpenSSH(encoded, passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(privateKey, privateKey2) || comment != "alice@example.com" {
+			t.Errorf("round trip with passphrase %q: %q", passphrase, comment)
+		}
+	}
+}
+
+func TestEd25519OpenSSHEncrypted(t *testing.T) {
+	data := readTestKey(t, "ssh_ed25519_encrypted")
+
+	if _, _, err := ParseEd25519PrivateKeyOpenSSH(data, nil); err != ErrKeyPassphraseRequired {
+		t.Errorf("without passphrase: %v, expecting: %v", err, ErrKeyPassphraseRequired)
+	}
+	if _, _, err := ParseEd25519PrivateKeyOpenSSH(data, []byte("wrong passphrase")); err != ErrInvalidKeyPassphrase {
+		t.Errorf("with a wrong passphrase: %v, expecting: %v", err, ErrInvalidKeyPassphrase)
+	}
+
+	privateKey, comment, err := ParseEd25519PrivateKeyOpenSSH(data, []byte("correct horse battery staple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comment != "bob@example.com" {
+		t.Errorf("comment: %q, expecting: %q", comment, "bob@example.com")
+	}
+	publicKey, _, err := ParseEd25519AuthorizedKey(readTestKey(t, "ssh_ed25519_encrypted.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(privateKey.Public(), publicKey) {
+		t.Error("the public key doesn't match the private key")
+	}
+}
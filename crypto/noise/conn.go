@@ -0,0 +1,234 @@
+package noise
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bloom42/gobox/crypto"
+)
+
+// MaxPayloadSize is the maximum size of the plaintext of a transport message, in bytes. Larger
+// writes to a Conn are split in several messages.
+const MaxPayloadSize = MaxMessageSize - TagSize
+
+// Conn is a net.Conn secured by a Noise handshake. Each message is prefixed with its size, encoded
+// as a 16-bit big endian integer.
+//
+// The handshake is run by the first call to Read or Write, or explicitly with Handshake.
+type Conn struct {
+	conn   net.Conn
+	config Config
+
+	handshakeMutex sync.Mutex
+	handshakeErr   error
+	handshakeDone  bool
+	handshakeHash  []byte
+	remoteStatic   crypto.Curve25519PublicKey
+
+	readMutex   sync.Mutex
+	readCipher  *CipherState
+	readBuffer  []byte
+	readPending []byte
+	readErr     error
+
+	writeMutex  sync.Mutex
+	writeCipher *CipherState
+	writeBuffer []byte
+}
+
+// Client returns a new Conn using conn as the underlying transport, acting as the initiator of
+// the handshake.
+func Client(conn net.Conn, config Config) *Conn {
+	config.Initiator = true
+	return &Conn{conn: conn, config: config}
+}
+
+// Server returns a new Conn using conn as the underlying transport, acting as the responder of
+// the handshake.
+func Server(conn net.Conn, config Config) *Conn {
+	config.Initiator = false
+	return &Conn{conn: conn, config: config}
+}
+
+// Handshake runs the handshake if it has not been run yet. Deadlines can be set on the
+// underlying connection to avoid waiting indefinitely for the remote peer.
+func (c *Conn) Handshake() error {
+	c.handshakeMutex.Lock()
+	defer c.handshakeMutex.Unlock()
+
+	if c.handshakeDone || c.handshakeErr != nil {
+		return c.handshakeErr
+	}
+	c.handshakeErr = c.handshake()
+	c.handshakeDone = c.handshakeErr == nil
+	return c.handshakeErr
+}
+
+func (c *Conn) handshake() error {
+	state, err := NewHandshakeState(c.config)
+	if err != nil {
+		return err
+	}
+
+	var initiatorCipher, responderCipher *CipherState
+	for i := range c.config.Pattern.Messages {
+		if (i%2 == 0) == c.config.Initiator {
+			var message []byte
+			message, initiatorCipher, responderCipher, err = state.WriteMessage(make([]byte, 2), nil)
+			if err != nil {
+				return err
+			}
+			binary.BigEndian.PutUint16(message, uint16(len(message)-2))
+			if _, err = c.conn.Write(message); err != nil {
+				return err
+			}
+		} else {
+			message, err := c.readFrame()
+			if err != nil {
+				return err
+			}
+			if _, initiatorCipher, responderCipher, err = state.ReadMessage(nil, message); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.handshakeHash = state.HandshakeHash()
+	c.remoteStatic = state.RemoteStaticKey()
+	if c.config.Initiator {
+		c.writeCipher, c.readCipher = initiatorCipher, responderCipher
+	} else {
+		c.writeCipher, c.readCipher = responderCipher, initiatorCipher
+	}
+	return nil
+}
+
+// readFrame reads the next message from the underlying connection.
+func (c *Conn) readFrame() ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(c.conn, size[:]); err != nil {
+		return nil, err
+	}
+	if cap(c.readBuffer) == 0 {
+		c.readBuffer = make([]byte, MaxMessageSize)
+	}
+	message := c.readBuffer[:binary.BigEndian.Uint16(size[:])]
+	if _, err := io.ReadFull(c.conn, message); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return message, nil
+}
+
+// Read reads and decrypts data from the connection.
+func (c *Conn) Read(p []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+
+	for len(c.readPending) == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+		message, err := c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+		// decrypt in place: the plaintext is shorter than the ciphertext. The stream can't be
+		// resynchronized after a failure, so the error is permanent
+		if c.readPending, err = c.readCipher.Decrypt(message[:0], nil, message); err != nil {
+			c.readErr = err
+			return 0, err
+		}
+	}
+	n := copy(p, c.readPending)
+	c.readPending = c.readPending[n:]
+	return n, nil
+}
+
+// Write encrypts and writes data to the connection.
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	n := 0
+	for len(p) > 0 {
+		size := len(p)
+		if size > MaxPayloadSize {
+			size = MaxPayloadSize
+		}
+		message, err := c.writeCipher.Encrypt(c.writeBuffer[:0], nil, p[:size])
+		if err != nil {
+			return n, err
+		}
+		c.writeBuffer = message
+		var header [2]byte
+		binary.BigEndian.PutUint16(header[:], uint16(len(message)))
+		if _, err = c.conn.Write(append(header[:], message...)); err != nil {
+			return n, err
+		}
+		n += size
+		p = p[size:]
+	}
+	return n, nil
+}
+
+// Close closes the underlying connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// HandshakeHash returns the hash of the handshake, which uniquely identifies the session. It can
+// be used for channel binding.
+func (c *Conn) HandshakeHash() ([]byte, error) {
+	if err := c.Handshake(); err != nil {
+		return nil, err
+	}
+	return append([]byte{}, c.handshakeHash...), nil
+}
+
+// RemoteStaticKey returns the static public key of the remote peer, once authenticated by the
+// handshake. It is nil for the patterns which don't authenticate the remote peer.
+func (c *Conn) RemoteStaticKey() (crypto.Curve25519PublicKey, error) {
+	if err := c.Handshake(); err != nil {
+		return nil, err
+	}
+	return c.remoteStatic, nil
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the underlying connection.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the underlying connection.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the underlying connection.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+var _ net.Conn = (*Conn)(nil)
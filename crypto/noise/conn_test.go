@@ -0,0 +1,95 @@
+package noise
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/bloom42/gobox/crypto"
+)
+
+func TestConn(t *testing.T) {
+	clientKeyPair, _ := GenerateKeyPair()
+	serverKeyPair, _ := GenerateKeyPair()
+
+	for _, pattern := range []Pattern{PatternNN, PatternNK, PatternXX, PatternIK} {
+		t.Run(pattern.Name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			client := Client(clientConn, Config{
+				Pattern:         pattern,
+				Prologue:        []byte("test v1"),
+				StaticKeyPair:   &clientKeyPair,
+				RemoteStaticKey: serverKeyPair.PublicKey,
+			})
+			server := Server(serverConn, Config{
+				Pattern:       pattern,
+				Prologue:      []byte("test v1"),
+				StaticKeyPair: &serverKeyPair,
+			})
+			defer client.Close()
+			defer server.Close()
+
+			data, _ := crypto.RandBytes(3*MaxPayloadSize + 42)
+			errs := make(chan error, 1)
+			go func() {
+				_, err := client.Write(data)
+				errs <- err
+			}()
+			received := make([]byte, len(data))
+			if _, err := io.ReadFull(server, received); err != nil {
+				t.Fatal(err)
+			}
+			if err := <-errs; err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, received) {
+				t.Error("received data doesn't match")
+			}
+
+			go func() {
+				_, err := server.Write([]byte("pong"))
+				errs <- err
+			}()
+			pong := make([]byte, 4)
+			if _, err := io.ReadFull(client, pong); err != nil || string(pong) != "pong" {
+				t.Fatalf("reading pong: %q, %v", pong, err)
+			}
+			if err := <-errs; err != nil {
+				t.Fatal(err)
+			}
+
+			clientHash, _ := client.HandshakeHash()
+			serverHash, _ := server.HandshakeHash()
+			if !bytes.Equal(clientHash, serverHash) {
+				t.Error("handshake hashes don't match")
+			}
+			clientKey, _ := server.RemoteStaticKey()
+			if pattern.needsLocalStatic(true) != (clientKey != nil) {
+				t.Errorf("remote static key of the server: %x", clientKey)
+			}
+			if clientKey != nil && !bytes.Equal(clientKey, clientKeyPair.PublicKey) {
+				t.Error("the server doesn't have the static key of the client")
+			}
+		})
+	}
+}
+
+func TestConnWrongServerKey(t *testing.T) {
+	serverKeyPair, _ := GenerateKeyPair()
+	otherKeyPair, _ := GenerateKeyPair()
+	clientConn, serverConn := net.Pipe()
+	client := Client(clientConn, Config{Pattern: PatternNK, RemoteStaticKey: otherKeyPair.PublicKey})
+	server := Server(serverConn, Config{Pattern: PatternNK, StaticKeyPair: &serverKeyPair})
+
+	go func() {
+		client.Handshake()
+		client.Close()
+	}()
+	if err := server.Handshake(); err != ErrDecryption {
+		t.Errorf("%v, expecting: %v", err, ErrDecryption)
+	}
+	if _, err := server.Write([]byte("data")); err != ErrDecryption {
+		t.Errorf("writing after a failed handshake: %v, expecting: %v", err, ErrDecryption)
+	}
+}
@@ -0,0 +1,243 @@
+package noise
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bloom42/gobox/crypto"
+)
+
+// Config configures a handshake.
+type Config struct {
+	// Pattern is the handshake pattern. It must be the same for both peers.
+	Pattern Pattern
+
+	// Initiator must be true for the peer sending the first handshake message.
+	Initiator bool
+
+	// Prologue is optional data, such as the negotiated protocol version, which must be the same
+	// for both peers. It is authenticated by the handshake.
+	Prologue []byte
+
+	// StaticKeyPair is the long term key pair of the peer, required by the patterns authenticating
+	// it (such as the initiator of IK, or both peers of XX).
+	StaticKeyPair *KeyPair
+
+	// RemoteStaticKey is the static public key of the remote peer, required by the patterns in
+	// which it is known before the handshake (such as the initiator of NK and IK).
+	RemoteStaticKey crypto.Curve25519PublicKey
+
+	// Random is the source of entropy of the ephemeral keys. Default to crypto.RandReader().
+	Random io.Reader
+}
+
+// HandshakeState is the state of a peer during a handshake. WriteMessage and ReadMessage must be
+// called in turn, following the messages of the pattern, until they return the cipher states of
+// the transport messages. It is not safe for concurrent use.
+type HandshakeState struct {
+	symmetricState symmetricState
+	config         Config
+	localEphemeral *KeyPair
+	remoteStatic   crypto.Curve25519PublicKey
+	remoteEph      crypto.Curve25519PublicKey
+	messageIndex   int
+	failed         bool
+}
+
+// NewHandshakeState returns the initial state of a handshake.
+func NewHandshakeState(config Config) (*HandshakeState, error) {
+	if len(config.Pattern.Messages) == 0 {
+		return nil, errors.New("noise: empty handshake pattern")
+	}
+	if config.Pattern.needsLocalStatic(config.Initiator) &&
+		(config.StaticKeyPair == nil || len(config.StaticKeyPair.PublicKey) != DHSize || len(config.StaticKeyPair.PrivateKey) != DHSize) {
+		return nil, fmt.Errorf("noise: pattern %s requires a static key pair", config.Pattern.Name)
+	}
+	if config.Pattern.needsRemoteStatic(config.Initiator) && len(config.RemoteStaticKey) != DHSize {
+		return nil, fmt.Errorf("noise: pattern %s requires the remote static key", config.Pattern.Name)
+	}
+	if config.Random == nil {
+		config.Random = crypto.RandReader()
+	}
+
+	state := &HandshakeState{config: config}
+	if config.Pattern.needsRemoteStatic(config.Initiator) {
+		state.remoteStatic = config.RemoteStaticKey
+	}
+	state.symmetricState.initialize(config.Pattern.ProtocolName())
+	state.symmetricState.mixHash(config.Prologue)
+
+	for i, preMessages := range [][]Token{config.Pattern.InitiatorPreMessages, config.Pattern.ResponderPreMessages} {
+		local := (i == 0) == config.Initiator
+		for _, token := range preMessages {
+			if token != TokenS {
+				return nil, errors.New("noise: only static keys are supported in pre-messages")
+			}
+			if local {
+				state.symmetricState.mixHash(config.StaticKeyPair.PublicKey)
+			} else {
+				state.symmetricState.mixHash(state.remoteStatic)
+			}
+		}
+	}
+	return state, nil
+}
+
+// WriteMessage appends the next handshake message, carrying payload, to out. When the last message
+// of the handshake is written, the cipher states of the messages sent by the initiator and by
+// the responder are returned.
+func (state *HandshakeState) WriteMessage(out, payload []byte) (message []byte, initiatorCipherState, responderCipherState *CipherState, err error) {
+	if state.failed || state.messageIndex >= len(state.config.Pattern.Messages) ||
+		(state.messageIndex%2 == 0) != state.config.Initiator {
+		return nil, nil, nil, ErrUnexpectedMessage
+	}
+	start := len(out)
+
+	for _, token := range state.config.Pattern.Messages[state.messageIndex] {
+		switch token {
+		case TokenE:
+			privateKey := make([]byte, DHSize)
+			if _, err = io.ReadFull(state.config.Random, privateKey); err != nil {
+				return nil, nil, nil, state.fail(err)
+			}
+			publicKey, err := crypto.Curve25519PrivateKey(privateKey).Public()
+			if err != nil {
+				return nil, nil, nil, state.fail(err)
+			}
+			state.localEphemeral = &KeyPair{PublicKey: publicKey, PrivateKey: privateKey}
+			out = append(out, publicKey...)
+			state.symmetricState.mixHash(publicKey)
+		case TokenS:
+			if out, err = state.symmetricState.encryptAndHash(out, state.config.StaticKeyPair.PublicKey); err != nil {
+				return nil, nil, nil, state.fail(err)
+			}
+		default:
+			if err = state.mixDH(token); err != nil {
+				return nil, nil, nil, state.fail(err)
+			}
+		}
+	}
+	if out, err = state.symmetricState.encryptAndHash(out, payload); err != nil {
+		return nil, nil, nil, state.fail(err)
+	}
+	if len(out)-start > MaxMessageSize {
+		return nil, nil, nil, state.fail(ErrMessageTooLarge)
+	}
+
+	state.messageIndex++
+	if state.messageIndex == len(state.config.Pattern.Messages) {
+		initiatorCipherState, responderCipherState = state.symmetricState.split()
+	}
+	return out, initiatorCipherState, responderCipherState, nil
+}
+
+// ReadMessage reads the next handshake message and appends its payload to out. When the last
+// message of the handshake is read, the cipher states of the messages sent by the initiator and by
+// the responder are returned.
+func (state *HandshakeState) ReadMessage(out, message []byte) (payload []byte, initiatorCipherState, responderCipherState *CipherState, err error) {
+	if state.failed || state.messageIndex >= len(state.config.Pattern.Messages) ||
+		(state.messageIndex%2 == 0) == state.config.Initiator {
+		return nil, nil, nil, ErrUnexpectedMessage
+	}
+	if len(message) > MaxMessageSize {
+		return nil, nil, nil, state.fail(ErrMessageTooLarge)
+	}
+
+	for _, token := range state.config.Pattern.Messages[state.messageIndex] {
+		switch token {
+		case TokenE:
+			if len(message) < DHSize {
+				return nil, nil, nil, state.fail(ErrShortMessage)
+			}
+			state.remoteEph = append(crypto.Curve25519PublicKey{}, message[:DHSize]...)
+			message = message[DHSize:]
+			state.symmetricState.mixHash(state.remoteEph)
+		case TokenS:
+			size := DHSize
+			if state.symmetricState.cipherState.hasKey {
+				size += TagSize
+			}
+			if len(message) < size {
+				return nil, nil, nil, state.fail(ErrShortMessage)
+			}
+			remoteStatic, err := state.symmetricState.decryptAndHash(nil, message[:size])
+			if err != nil {
+				return nil, nil, nil, state.fail(err)
+			}
+			state.remoteStatic = remoteStatic
+			message = message[size:]
+		default:
+			if err = state.mixDH(token); err != nil {
+				return nil, nil, nil, state.fail(err)
+			}
+		}
+	}
+	if state.symmetricState.cipherState.hasKey && len(message) < TagSize {
+		return nil, nil, nil, state.fail(ErrShortMessage)
+	}
+	if out, err = state.symmetricState.decryptAndHash(out, message); err != nil {
+		return nil, nil, nil, state.fail(err)
+	}
+
+	state.messageIndex++
+	if state.messageIndex == len(state.config.Pattern.Messages) {
+		initiatorCipherState, responderCipherState = state.symmetricState.split()
+	}
+	return out, initiatorCipherState, responderCipherState, nil
+}
+
+// mixDH performs the key exchange of a DH token, and mixes its result into the chaining key.
+func (state *HandshakeState) mixDH(token Token) error {
+	var localKey *KeyPair
+	var remoteKey crypto.Curve25519PublicKey
+	// es: the ephemeral key of the initiator and the static key of the responder, and so on
+	initiatorKeyIsStatic := token == TokenSE || token == TokenSS
+	responderKeyIsStatic := token == TokenES || token == TokenSS
+	localIsStatic, remoteIsStatic := initiatorKeyIsStatic, responderKeyIsStatic
+	if !state.config.Initiator {
+		localIsStatic, remoteIsStatic = responderKeyIsStatic, initiatorKeyIsStatic
+	}
+	if localIsStatic {
+		localKey = state.config.StaticKeyPair
+	} else {
+		localKey = state.localEphemeral
+	}
+	if remoteIsStatic {
+		remoteKey = state.remoteStatic
+	} else {
+		remoteKey = state.remoteEph
+	}
+	if localKey == nil || remoteKey == nil {
+		return errors.New("noise: invalid handshake pattern: missing key")
+	}
+
+	sharedSecret, err := localKey.PrivateKey.KeyExchange(remoteKey)
+	if err != nil {
+		return fmt.Errorf("noise: invalid public key: %w", err)
+	}
+	state.symmetricState.mixKey(sharedSecret)
+	crypto.Zeroize(sharedSecret)
+	return nil
+}
+
+func (state *HandshakeState) fail(err error) error {
+	state.failed = true
+	return err
+}
+
+// HandshakeHash returns the hash of the handshake, which uniquely identifies the session once the
+// handshake is complete. It can be used for channel binding.
+func (state *HandshakeState) HandshakeHash() []byte {
+	return append([]byte{}, state.symmetricState.hash...)
+}
+
+// RemoteStaticKey returns the static public key of the remote peer, if it is known.
+func (state *HandshakeState) RemoteStaticKey() crypto.Curve25519PublicKey {
+	return state.remoteStatic
+}
+
+// Complete reports whether all the messages of the handshake have been written or read.
+func (state *HandshakeState) Complete() bool {
+	return state.messageIndex == len(state.config.Pattern.Messages)
+}
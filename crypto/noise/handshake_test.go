@@ -0,0 +1,337 @@
+package noise
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bloom42/gobox/crypto"
+)
+
+type testVector struct {
+	name          string
+	prologue      []byte
+	initStatic    []byte
+	respStatic    []byte
+	initEphemeral []byte
+	respEphemeral []byte
+	messages      [][2][]byte // payload, ciphertext
+	handshakeHash []byte
+	source        string
+}
+
+func parseTestVectors(t *testing.T) []*testVector {
+	file, err := os.Open("testdata/vectors.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var vectors []*testVector
+	var vector *testVector
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			t.Fatalf("line %d: malformed line", lineNumber)
+		}
+		key := parts[0]
+		value, err := hex.DecodeString(parts[1])
+		if key == "handshake" {
+			vector = &testVector{name: parts[1], source: "vectors.txt:" + strconv.Itoa(lineNumber)}
+			vectors = append(vectors, vector)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("line %d: %s", lineNumber, err)
+		}
+		switch {
+		case key == "prologue":
+			vector.prologue = value
+		case key == "init_static":
+			vector.initStatic = value
+		case key == "resp_static":
+			vector.respStatic = value
+		case key == "gen_init_ephemeral":
+			vector.initEphemeral = value
+		case key == "gen_resp_ephemeral":
+			vector.respEphemeral = value
+		case strings.HasPrefix(key, "msg_") && strings.HasSuffix(key, "_payload"):
+			vector.messages = append(vector.messages, [2][]byte{value, nil})
+		case strings.HasPrefix(key, "msg_") && strings.HasSuffix(key, "_ciphertext"):
+			vector.messages[len(vector.messages)-1][1] = value
+		default:
+			t.Fatalf("line %d: unknown key %q", lineNumber, key)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return vectors
+}
+
+// parseCacophonyTestVectors parses the vectors of testdata/cacophony.txt, in the JSON format of
+// the vectors of the cacophony Haskell implementation, keeping only the supported protocols.
+// As the vectors of vectors.txt are generated by flynn/noise itself, the cacophony vectors are
+// required, and must cover each supported pattern.
+func parseCacophonyTestVectors(t *testing.T, patterns map[string]Pattern) []*testVector {
+	data, err := ioutil.ReadFile("testdata/cacophony.txt")
+	if err != nil {
+		t.Fatalf("the cacophony vectors are required: %s", err)
+	}
+	var file struct {
+		Vectors []struct {
+			ProtocolName     string   `json:"protocol_name"`
+			InitPrologue     hexBytes `json:"init_prologue"`
+			InitStatic       hexBytes `json:"init_static"`
+			InitEphemeral    hexBytes `json:"init_ephemeral"`
+			InitRemoteStatic hexBytes `json:"init_remote_static"`
+			InitPSKs         []string `json:"init_psks"`
+			RespPrologue     hexBytes `json:"resp_prologue"`
+			RespStatic       hexBytes `json:"resp_static"`
+			RespEphemeral    hexBytes `json:"resp_ephemeral"`
+			HandshakeHash    hexBytes `json:"handshake_hash"`
+			Fail             bool     `json:"fail"`
+			Messages         []struct {
+				Payload    hexBytes `json:"payload"`
+				Ciphertext hexBytes `json:"ciphertext"`
+			} `json:"messages"`
+		} `json:"vectors"`
+	}
+	if err = json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("cacophony.txt: %s", err)
+	}
+
+	var vectors []*testVector
+	for i, v := range file.Vectors {
+		pattern, ok := patterns[strings.Split(v.ProtocolName, "_")[1]]
+		if !ok || pattern.ProtocolName() != v.ProtocolName || v.Fail || len(v.InitPSKs) != 0 ||
+			!bytes.Equal(v.InitPrologue, v.RespPrologue) {
+			continue
+		}
+		vector := &testVector{
+			name:          v.ProtocolName,
+			prologue:      v.InitPrologue,
+			initStatic:    v.InitStatic,
+			respStatic:    v.RespStatic,
+			initEphemeral: v.InitEphemeral,
+			respEphemeral: v.RespEphemeral,
+			handshakeHash: v.HandshakeHash,
+			source:        "cacophony.txt#" + strconv.Itoa(i),
+		}
+		for _, message := range v.Messages {
+			vector.messages = append(vector.messages, [2][]byte{message.Payload, message.Ciphertext})
+		}
+		vectors = append(vectors, vector)
+	}
+	for name, pattern := range patterns {
+		found := false
+		for _, vector := range vectors {
+			found = found || vector.name == pattern.ProtocolName()
+		}
+		if !found {
+			t.Fatalf("cacophony.txt: no vector for the %s pattern", name)
+		}
+	}
+	return vectors
+}
+
+// hexBytes decodes a hex encoded JSON string.
+type hexBytes []byte
+
+func (b *hexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := hex.DecodeString(s)
+	*b = decoded
+	return err
+}
+
+func testKeyPair(t *testing.T, privateKey []byte) *KeyPair {
+	if privateKey == nil {
+		return nil
+	}
+	publicKey, err := crypto.Curve25519PrivateKey(privateKey).Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &KeyPair{PublicKey: publicKey, PrivateKey: privateKey}
+}
+
+func TestVectors(t *testing.T) {
+	patterns := map[string]Pattern{"NN": PatternNN, "NK": PatternNK, "XX": PatternXX, "IK": PatternIK}
+	vectors := append(parseTestVectors(t), parseCacophonyTestVectors(t, patterns)...)
+	if len(vectors) == 0 {
+		t.Fatal("no test vectors found")
+	}
+
+	for _, vector := range vectors {
+		vector := vector
+		t.Run(vector.name+"@"+vector.source, func(t *testing.T) {
+			pattern, ok := patterns[strings.Split(vector.name, "_")[1]]
+			if !ok || pattern.ProtocolName() != vector.name {
+				t.Fatalf("unsupported protocol: %s", vector.name)
+			}
+			initiatorConfig := Config{
+				Pattern:       pattern,
+				Initiator:     true,
+				Prologue:      vector.prologue,
+				StaticKeyPair: testKeyPair(t, vector.initStatic),
+				Random:        bytes.NewReader(vector.initEphemeral),
+			}
+			responderConfig := Config{
+				Pattern:       pattern,
+				Prologue:      vector.prologue,
+				StaticKeyPair: testKeyPair(t, vector.respStatic),
+				Random:        bytes.NewReader(vector.respEphemeral),
+			}
+			if pattern.needsRemoteStatic(true) {
+				initiatorConfig.RemoteStaticKey = responderConfig.StaticKeyPair.PublicKey
+			}
+			initiator, err := NewHandshakeState(initiatorConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			responder, err := NewHandshakeState(responderConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var initiatorCiphers, responderCiphers [2]*CipherState
+			for i, message := range vector.messages {
+				payload, expected := message[0], message[1]
+				var ciphertext, decrypted []byte
+				if i < len(pattern.Messages) {
+					writer, reader := initiator, responder
+					if i%2 == 1 {
+						writer, reader = responder, initiator
+					}
+					var c1, c2 *CipherState
+					ciphertext, c1, c2, err = writer.WriteMessage(nil, payload)
+					if err != nil {
+						t.Fatalf("message %d: %s", i, err)
+					}
+					if i%2 == 0 {
+						initiatorCiphers = [2]*CipherState{c1, c2}
+					} else {
+						responderCiphers = [2]*CipherState{c1, c2}
+					}
+					decrypted, c1, c2, err = reader.ReadMessage(nil, ciphertext)
+					if err != nil {
+						t.Fatalf("message %d: %s", i, err)
+					}
+					if i%2 == 0 {
+						responderCiphers = [2]*CipherState{c1, c2}
+					} else {
+						initiatorCiphers = [2]*CipherState{c1, c2}
+					}
+				} else {
+					// transport messages: the first cipher state is used by the initiator to send
+					sender, receiver := initiatorCiphers[0], responderCiphers[0]
+					if (i-len(pattern.Messages))%2 == 1 {
+						sender, receiver = responderCiphers[1], initiatorCiphers[1]
+					}
+					if ciphertext, err = sender.Encrypt(nil, nil, payload); err != nil {
+						t.Fatalf("message %d: %s", i, err)
+					}
+					if decrypted, err = receiver.Decrypt(nil, nil, ciphertext); err != nil {
+						t.Fatalf("message %d: %s", i, err)
+					}
+				}
+				if !bytes.Equal(ciphertext, expected) {
+					t.Fatalf("message %d: ciphertext %x, expecting: %x", i, ciphertext, expected)
+				}
+				if !bytes.Equal(decrypted, payload) {
+					t.Fatalf("message %d: payload %x, expecting: %x", i, decrypted, payload)
+				}
+			}
+
+			if !initiator.Complete() || !responder.Complete() {
+				t.Error("handshake should be complete")
+			}
+			if !bytes.Equal(initiator.HandshakeHash(), responder.HandshakeHash()) {
+				t.Error("handshake hashes don't match")
+			}
+			if vector.handshakeHash != nil && !bytes.Equal(initiator.HandshakeHash(), vector.handshakeHash) {
+				t.Errorf("handshake hash %x, expecting: %x", initiator.HandshakeHash(), vector.handshakeHash)
+			}
+			if vector.initStatic != nil && !bytes.Equal(responder.RemoteStaticKey(), initiatorConfig.StaticKeyPair.PublicKey) {
+				t.Error("the responder doesn't have the static key of the initiator")
+			}
+		})
+	}
+}
+
+func TestHandshakeErrors(t *testing.T) {
+	serverKeyPair, _ := GenerateKeyPair()
+	otherKeyPair, _ := GenerateKeyPair()
+
+	if _, err := NewHandshakeState(Config{Pattern: PatternIK, Initiator: true, StaticKeyPair: &serverKeyPair}); err == nil {
+		t.Error("IK without remote static key should fail")
+	}
+	if _, err := NewHandshakeState(Config{Pattern: PatternXX}); err == nil {
+		t.Error("XX without static key pair should fail")
+	}
+
+	// the initiator expects another responder
+	initiator, _ := NewHandshakeState(Config{Pattern: PatternNK, Initiator: true, RemoteStaticKey: otherKeyPair.PublicKey})
+	responder, _ := NewHandshakeState(Config{Pattern: PatternNK, StaticKeyPair: &serverKeyPair})
+	if _, _, _, err := initiator.ReadMessage(nil, nil); err != ErrUnexpectedMessage {
+		t.Errorf("reading out of turn: %v, expecting: %v", err, ErrUnexpectedMessage)
+	}
+	message, _, _, err := initiator.WriteMessage(nil, []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = responder.ReadMessage(nil, message); err != ErrDecryption {
+		t.Errorf("reading a message for another responder: %v, expecting: %v", err, ErrDecryption)
+	}
+	if _, _, _, err = responder.WriteMessage(nil, nil); err != ErrUnexpectedMessage {
+		t.Errorf("writing after a failure: %v, expecting: %v", err, ErrUnexpectedMessage)
+	}
+
+	responder, _ = NewHandshakeState(Config{Pattern: PatternNK, StaticKeyPair: &serverKeyPair})
+	if _, _, _, err = responder.ReadMessage(nil, message[:40]); err != ErrShortMessage {
+		t.Errorf("reading a truncated message: %v, expecting: %v", err, ErrShortMessage)
+	}
+}
+
+func TestCipherStateRekey(t *testing.T) {
+	initiator, _ := NewHandshakeState(Config{Pattern: PatternNN, Initiator: true})
+	responder, _ := NewHandshakeState(Config{Pattern: PatternNN})
+	message, _, _, _ := initiator.WriteMessage(nil, nil)
+	responder.ReadMessage(nil, message)
+	message, receiver, _, _ := responder.WriteMessage(nil, nil)
+	_, sender, _, err := initiator.ReadMessage(nil, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = initiator.ReadMessage(nil, message); err != ErrUnexpectedMessage {
+		t.Errorf("reading after the end of the handshake: %v, expecting: %v", err, ErrUnexpectedMessage)
+	}
+
+	sender.Rekey()
+	receiver.Rekey()
+	ciphertext, _ := sender.Encrypt(nil, []byte("ad"), []byte("message"))
+	if plaintext, err := receiver.Decrypt(nil, []byte("ad"), ciphertext); err != nil || string(plaintext) != "message" {
+		t.Errorf("decrypting after rekeying: %q, %v", plaintext, err)
+	}
+
+	sender.Rekey()
+	ciphertext, _ = sender.Encrypt(nil, nil, []byte("message"))
+	if _, err = receiver.Decrypt(nil, nil, ciphertext); err != ErrDecryption {
+		t.Errorf("decrypting with the old key: %v, expecting: %v", err, ErrDecryption)
+	}
+}
@@ -0,0 +1,73 @@
+// Package noise implements the Noise Protocol Framework (https://noiseprotocol.org/noise.html),
+// to build authenticated and encrypted channels from static Curve25519 keys, without a PKI.
+//
+// Only the 25519_ChaChaPoly_BLAKE2b cipher suite is supported: Curve25519 (X25519) key
+// exchanges, ChaCha20-Poly1305 encryption and BLAKE2b-512 hashing. The NN, NK, XX and IK
+// handshake patterns are provided, and other patterns can be described with Pattern.
+//
+// HandshakeState is the handshake state machine of the specification, which can be used with
+// any transport, while Client and Server wrap a net.Conn to handshake and then exchange transport
+// messages, each prefixed with its size as a 16-bit big endian integer:
+//
+//	conn := noise.Client(rawConn, noise.Config{
+//		Pattern:         noise.PatternIK,
+//		StaticKeyPair:   clientKeyPair,
+//		RemoteStaticKey: serverPublicKey,
+//	})
+//	_, err := conn.Write(data)
+package noise
+
+import (
+	"errors"
+
+	"github.com/bloom42/gobox/crypto"
+)
+
+const (
+	// CipherSuite is the name of the cipher suite, as used in the protocol names.
+	CipherSuite = "25519_ChaChaPoly_BLAKE2b"
+
+	// MaxMessageSize is the maximum size of a Noise message, in bytes.
+	MaxMessageSize = 65535
+
+	// DHSize is the size of the public keys, in bytes.
+	DHSize = crypto.Curve25519PublicKeySize
+
+	// TagSize is the size of the authentication tag of the encrypted data, in bytes.
+	TagSize = 16
+
+	hashSize = 64
+)
+
+var (
+	// ErrMessageTooLarge is returned when a message would be larger than MaxMessageSize.
+	ErrMessageTooLarge = errors.New("noise: message is too large")
+
+	// ErrShortMessage is returned when reading a truncated handshake message.
+	ErrShortMessage = errors.New("noise: message is too short")
+
+	// ErrDecryption is returned when a message can't be authenticated.
+	ErrDecryption = errors.New("noise: message authentication failed")
+
+	// ErrUnexpectedMessage is returned when writing or reading a handshake message out of turn,
+	// or after the end of the handshake.
+	ErrUnexpectedMessage = errors.New("noise: unexpected handshake message")
+
+	// ErrNonceExhausted is returned when 2^64 - 1 messages have been encrypted with the same key.
+	ErrNonceExhausted = errors.New("noise: nonce exhausted")
+)
+
+// KeyPair is a Curve25519 key pair.
+type KeyPair struct {
+	PublicKey  crypto.Curve25519PublicKey
+	PrivateKey crypto.Curve25519PrivateKey
+}
+
+// GenerateKeyPair generates a new random key pair, for example to be used as static key pair.
+func GenerateKeyPair() (KeyPair, error) {
+	publicKey, privateKey, err := crypto.GenerateCurve25519KeyPair()
+	if err != nil {
+		return KeyPair{}, err
+	}
+	return KeyPair{PublicKey: publicKey, PrivateKey: privateKey}, nil
+}
@@ -0,0 +1,111 @@
+package noise
+
+// Token is a token of a handshake message pattern.
+type Token uint8
+
+// The tokens of the handshake patterns.
+const (
+	TokenE Token = iota
+	TokenS
+	TokenEE
+	TokenES
+	TokenSE
+	TokenSS
+)
+
+// Pattern is a handshake pattern: the keys known by the peers before the handshake (the
+// pre-messages), and the tokens of the handshake messages, the first one being sent by the
+// initiator.
+type Pattern struct {
+	Name                 string
+	InitiatorPreMessages []Token
+	ResponderPreMessages []Token
+	Messages             [][]Token
+}
+
+var (
+	// PatternNN is an unauthenticated handshake: only ephemeral keys are exchanged.
+	PatternNN = Pattern{
+		Name: "NN",
+		Messages: [][]Token{
+			{TokenE},
+			{TokenE, TokenEE},
+		},
+	}
+
+	// PatternNK authenticates the responder, whose static key is known by the initiator.
+	PatternNK = Pattern{
+		Name:                 "NK",
+		ResponderPreMessages: []Token{TokenS},
+		Messages: [][]Token{
+			{TokenE, TokenES},
+			{TokenE, TokenEE},
+		},
+	}
+
+	// PatternXX authenticates both peers, which send their static keys during the handshake.
+	PatternXX = Pattern{
+		Name: "XX",
+		Messages: [][]Token{
+			{TokenE},
+			{TokenE, TokenEE, TokenS, TokenES},
+			{TokenS, TokenSE},
+		},
+	}
+
+	// PatternIK authenticates both peers in a single round trip: the static key of the responder
+	// is known by the initiator, which sends its own static key in the first message.
+	PatternIK = Pattern{
+		Name:                 "IK",
+		ResponderPreMessages: []Token{TokenS},
+		Messages: [][]Token{
+			{TokenE, TokenES, TokenS, TokenSS},
+			{TokenE, TokenEE, TokenSE},
+		},
+	}
+)
+
+// ProtocolName returns the full name of the protocol using the pattern, such as
+// "Noise_XX_25519_ChaChaPoly_BLAKE2b".
+func (pattern Pattern) ProtocolName() string {
+	return "Noise_" + pattern.Name + "_" + CipherSuite
+}
+
+// needsLocalStatic reports whether the initiator (or the responder) needs a static key pair.
+func (pattern Pattern) needsLocalStatic(initiator bool) bool {
+	preMessages := pattern.ResponderPreMessages
+	if initiator {
+		preMessages = pattern.InitiatorPreMessages
+	}
+	for _, token := range preMessages {
+		if token == TokenS {
+			return true
+		}
+	}
+	for i, message := range pattern.Messages {
+		if (i%2 == 0) != initiator {
+			continue
+		}
+		for _, token := range message {
+			if token == TokenS {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// needsRemoteStatic reports whether the initiator (or the responder) must know the static key of
+// its peer before the handshake.
+func (pattern Pattern) needsRemoteStatic(initiator bool) bool {
+	preMessages := pattern.InitiatorPreMessages
+	if initiator {
+		preMessages = pattern.ResponderPreMessages
+	}
+	for _, token := range preMessages {
+		if token == TokenS {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package noise
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"encoding/binary"
+	"hash"
+	"math"
+
+	"github.com/bloom42/gobox/crypto"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// CipherState encrypts and decrypts the transport messages sent in one direction, once the
+// handshake is complete. It is not safe for concurrent use.
+type CipherState struct {
+	key    [chacha20poly1305.KeySize]byte
+	aead   cipher.AEAD
+	nonce  uint64
+	hasKey bool
+}
+
+func (state *CipherState) initializeKey(key []byte) {
+	copy(state.key[:], key)
+	// the error can't happen as the key has the right size
+	state.aead, _ = chacha20poly1305.New(state.key[:])
+	state.nonce = 0
+	state.hasKey = true
+}
+
+func (state *CipherState) nonceBytes(nonce uint64) []byte {
+	var n [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint64(n[4:], nonce)
+	return n[:]
+}
+
+// Encrypt appends the encryption of plaintext, authenticating additionalData, to out.
+func (state *CipherState) Encrypt(out, additionalData, plaintext []byte) ([]byte, error) {
+	if !state.hasKey {
+		return append(out, plaintext...), nil
+	}
+	// the maximum nonce is reserved for Rekey
+	if state.nonce == math.MaxUint64 {
+		return nil, ErrNonceExhausted
+	}
+	out = state.aead.Seal(out, state.nonceBytes(state.nonce), plaintext, additionalData)
+	state.nonce++
+	return out, nil
+}
+
+// Decrypt appends the decryption of ciphertext, authenticating additionalData, to out.
+func (state *CipherState) Decrypt(out, additionalData, ciphertext []byte) ([]byte, error) {
+	if !state.hasKey {
+		return append(out, ciphertext...), nil
+	}
+	if state.nonce == math.MaxUint64 {
+		return nil, ErrNonceExhausted
+	}
+	out, err := state.aead.Open(out, state.nonceBytes(state.nonce), ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	state.nonce++
+	return out, nil
+}
+
+// Rekey replaces the key with a new key derived from it. The peers must rekey their cipher
+// states at the same time, for example after a given number of messages.
+func (state *CipherState) Rekey() {
+	var zeros [chacha20poly1305.KeySize]byte
+	key := state.aead.Seal(nil, state.nonceBytes(math.MaxUint64), zeros[:], nil)
+	nonce := state.nonce
+	state.initializeKey(key[:chacha20poly1305.KeySize])
+	state.nonce = nonce
+	crypto.Zeroize(key)
+}
+
+// Nonce returns the number of messages encrypted or decrypted with the cipher state.
+func (state *CipherState) Nonce() uint64 {
+	return state.nonce
+}
+
+func newHash() hash.Hash {
+	// the error can only happen with an invalid key or size
+	h, _ := blake2b.New512(nil)
+	return h
+}
+
+func hmacHash(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(newHash, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+// hkdf returns the 2 outputs of the HKDF function of the specification.
+func hkdf(chainingKey, inputKeyMaterial []byte) (output1, output2 []byte) {
+	tempKey := hmacHash(chainingKey, inputKeyMaterial)
+	output1 = hmacHash(tempKey, []byte{0x01})
+	output2 = hmacHash(tempKey, output1, []byte{0x02})
+	crypto.Zeroize(tempKey)
+	return
+}
+
+// symmetricState holds the chaining key and the handshake hash during the handshake.
+type symmetricState struct {
+	cipherState CipherState
+	chainingKey []byte
+	hash        []byte
+}
+
+func (state *symmetricState) initialize(protocolName string) {
+	if len(protocolName) <= hashSize {
+		state.hash = make([]byte, hashSize)
+		copy(state.hash, protocolName)
+	} else {
+		h := newHash()
+		h.Write([]byte(protocolName))
+		state.hash = h.Sum(nil)
+	}
+	state.chainingKey = append([]byte{}, state.hash...)
+}
+
+func (state *symmetricState) mixKey(inputKeyMaterial []byte) {
+	var tempKey []byte
+	state.chainingKey, tempKey = hkdf(state.chainingKey, inputKeyMaterial)
+	state.cipherState.initializeKey(tempKey[:chacha20poly1305.KeySize])
+	crypto.Zeroize(tempKey)
+}
+
+func (state *symmetricState) mixHash(data []byte) {
+	h := newHash()
+	h.Write(state.hash)
+	h.Write(data)
+	state.hash = h.Sum(nil)
+}
+
+func (state *symmetricState) encryptAndHash(out, plaintext []byte) ([]byte, error) {
+	start := len(out)
+	out, err := state.cipherState.Encrypt(out, state.hash, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	state.mixHash(out[start:])
+	return out, nil
+}
+
+func (state *symmetricState) decryptAndHash(out, ciphertext []byte) ([]byte, error) {
+	out, err := state.cipherState.Decrypt(out, state.hash, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	state.mixHash(ciphertext)
+	return out, nil
+}
+
+func (state *symmetricState) split() (*CipherState, *CipherState) {
+	key1, key2 := hkdf(state.chainingKey, nil)
+	cipherState1, cipherState2 := &CipherState{}, &CipherState{}
+	cipherState1.initializeKey(key1[:chacha20poly1305.KeySize])
+	cipherState2.initializeKey(key2[:chacha20poly1305.KeySize])
+	crypto.Zeroize(key1)
+	crypto.Zeroize(key2)
+	crypto.Zeroize(state.chainingKey)
+	return cipherState1, cipherState2
+}
@@ -0,0 +1,292 @@
+package paseto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bloom42/gobox/crypto"
+)
+
+var (
+	// ErrTokenExpired is returned when parsing a token whose expiration time (exp) has passed.
+	ErrTokenExpired = errors.New("paseto: token is expired")
+
+	// ErrTokenNotYetValid is returned when parsing a token whose not before time (nbf) has not
+	// been reached yet.
+	ErrTokenNotYetValid = errors.New("paseto: token is not valid yet")
+
+	// ErrInvalidIssuedAt is returned when parsing a token issued (iat) in the future.
+	ErrInvalidIssuedAt = errors.New("paseto: token is issued in the future")
+
+	// ErrInvalidAudience is returned when the audience (aud) of a token is not the expected one.
+	ErrInvalidAudience = errors.New("paseto: invalid audience")
+
+	// ErrInvalidIssuer is returned when the issuer (iss) of a token is not the expected one.
+	ErrInvalidIssuer = errors.New("paseto: invalid issuer")
+
+	// ErrInvalidSubject is returned when the subject (sub) of a token is not the expected one.
+	ErrInvalidSubject = errors.New("paseto: invalid subject")
+
+	// ErrMissingExpiration is returned when a token without expiration time is parsed with
+	// RequireExpiration.
+	ErrMissingExpiration = errors.New("paseto: token has no expiration time")
+
+	// ErrInvalidClaims is returned (wrapped) when the message of a token is not a valid JSON
+	// object of claims.
+	ErrInvalidClaims = errors.New("paseto: invalid claims")
+)
+
+// Claims are the claims carried by a token. Zero values are omitted from the token.
+type Claims struct {
+	// Issuer (iss) identifies the party which issued the token.
+	Issuer string
+	// Subject (sub) identifies the subject of the token, such as a user ID.
+	Subject string
+	// Audience (aud) identifies the recipient for which the token is intended.
+	Audience string
+	// TokenID (jti) is an unique identifier of the token.
+	TokenID string
+	// ExpiresAt (exp) is the time after which the token must not be accepted.
+	ExpiresAt time.Time
+	// NotBefore (nbf) is the time before which the token must not be accepted.
+	NotBefore time.Time
+	// IssuedAt (iat) is the time at which the token was issued.
+	IssuedAt time.Time
+	// Custom holds the other claims.
+	Custom map[string]interface{}
+}
+
+var registeredClaims = []string{"iss", "sub", "aud", "jti", "exp", "nbf", "iat"}
+
+// MarshalJSON encodes the claims as a JSON object, with the times formatted as RFC 3339 strings.
+func (claims Claims) MarshalJSON() ([]byte, error) {
+	object := make(map[string]interface{}, len(claims.Custom)+len(registeredClaims))
+	for key, value := range claims.Custom {
+		object[key] = value
+	}
+	for key, value := range map[string]string{
+		"iss": claims.Issuer,
+		"sub": claims.Subject,
+		"aud": claims.Audience,
+		"jti": claims.TokenID,
+	} {
+		if value != "" {
+			object[key] = value
+		} else {
+			delete(object, key)
+		}
+	}
+	for key, value := range map[string]time.Time{
+		"exp": claims.ExpiresAt,
+		"nbf": claims.NotBefore,
+		"iat": claims.IssuedAt,
+	} {
+		if !value.IsZero() {
+			object[key] = value.Format(time.RFC3339)
+		} else {
+			delete(object, key)
+		}
+	}
+	return json.Marshal(object)
+}
+
+// UnmarshalJSON decodes a JSON object of claims. The registered claims must be strings, and
+// the times must be formatted as RFC 3339 strings.
+func (claims *Claims) UnmarshalJSON(data []byte) error {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+	if object == nil {
+		return errors.New("claims must be a JSON object")
+	}
+
+	*claims = Claims{}
+	stringClaims := map[string]*string{
+		"iss": &claims.Issuer,
+		"sub": &claims.Subject,
+		"aud": &claims.Audience,
+		"jti": &claims.TokenID,
+	}
+	timeClaims := map[string]*time.Time{
+		"exp": &claims.ExpiresAt,
+		"nbf": &claims.NotBefore,
+		"iat": &claims.IssuedAt,
+	}
+	for key, value := range object {
+		if field, ok := stringClaims[key]; ok {
+			if err := json.Unmarshal(value, field); err != nil {
+				return fmt.Errorf("claim %q must be a string", key)
+			}
+		} else if field, ok := timeClaims[key]; ok {
+			var s string
+			if err := json.Unmarshal(value, &s); err != nil {
+				return fmt.Errorf("claim %q must be a string", key)
+			}
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return fmt.Errorf("claim %q must be a RFC 3339 time", key)
+			}
+			*field = t
+		} else {
+			var custom interface{}
+			if err := json.Unmarshal(value, &custom); err != nil {
+				return err
+			}
+			if claims.Custom == nil {
+				claims.Custom = map[string]interface{}{}
+			}
+			claims.Custom[key] = custom
+		}
+	}
+	return nil
+}
+
+// EncryptV4Local returns a v4.local token carrying the claims. footer and implicitAssertion are
+// optional.
+func (claims *Claims) EncryptV4Local(key, footer, implicitAssertion []byte) (string, error) {
+	message, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	return EncryptV4Local(key, message, footer, implicitAssertion)
+}
+
+// SignV4Public returns a v4.public token carrying the claims. footer and implicitAssertion are
+// optional.
+func (claims *Claims) SignV4Public(privateKey crypto.Ed25519PrivateKey, footer, implicitAssertion []byte) (string, error) {
+	message, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	return SignV4Public(privateKey, message, footer, implicitAssertion)
+}
+
+// ParseV4Local decrypts a v4.local token created by Claims.EncryptV4Local, and validates its
+// claims. The expiration, not before and issued at times are always validated when present.
+func ParseV4Local(key []byte, token string, implicitAssertion []byte, options ...ValidateOption) (*Claims, []byte, error) {
+	message, footer, err := DecryptV4Local(key, token, implicitAssertion)
+	if err != nil {
+		return nil, nil, err
+	}
+	claims, err := parseClaims(message, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	return claims, footer, nil
+}
+
+// ParseV4Public verifies a v4.public token created by Claims.SignV4Public, and validates its
+// claims. The expiration, not before and issued at times are always validated when present.
+func ParseV4Public(publicKey crypto.Ed25519PublicKey, token string, implicitAssertion []byte, options ...ValidateOption) (*Claims, []byte, error) {
+	message, footer, err := VerifyV4Public(publicKey, token, implicitAssertion)
+	if err != nil {
+		return nil, nil, err
+	}
+	claims, err := parseClaims(message, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	return claims, footer, nil
+}
+
+func parseClaims(message []byte, options []ValidateOption) (*Claims, error) {
+	claims := &Claims{}
+	if err := json.Unmarshal(message, claims); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidClaims, err)
+	}
+	if err := claims.Validate(options...); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+type validateConfig struct {
+	audience          *string
+	issuer            *string
+	subject           *string
+	leeway            time.Duration
+	now               func() time.Time
+	requireExpiration bool
+}
+
+// ValidateOption is used to configure the validation of claims.
+type ValidateOption func(config *validateConfig)
+
+// ValidateAudience checks that the audience (aud) of the token is audience.
+func ValidateAudience(audience string) ValidateOption {
+	return func(config *validateConfig) {
+		config.audience = &audience
+	}
+}
+
+// ValidateIssuer checks that the issuer (iss) of the token is issuer.
+func ValidateIssuer(issuer string) ValidateOption {
+	return func(config *validateConfig) {
+		config.issuer = &issuer
+	}
+}
+
+// ValidateSubject checks that the subject (sub) of the token is subject.
+func ValidateSubject(subject string) ValidateOption {
+	return func(config *validateConfig) {
+		config.subject = &subject
+	}
+}
+
+// RequireExpiration rejects the tokens without expiration time (exp).
+func RequireExpiration() ValidateOption {
+	return func(config *validateConfig) {
+		config.requireExpiration = true
+	}
+}
+
+// Leeway sets the tolerated clock skew when validating the times of the token. Default to 0.
+func Leeway(leeway time.Duration) ValidateOption {
+	return func(config *validateConfig) {
+		config.leeway = leeway
+	}
+}
+
+// Clock sets the function returning the current time. Default to time.Now.
+func Clock(now func() time.Time) ValidateOption {
+	return func(config *validateConfig) {
+		config.now = now
+	}
+}
+
+// Validate validates the claims: the expiration (exp), not before (nbf) and issued at (iat)
+// times when they are set, and the claims required by the options.
+func (claims *Claims) Validate(options ...ValidateOption) error {
+	config := &validateConfig{now: time.Now}
+	for _, option := range options {
+		option(config)
+	}
+	now := config.now()
+
+	if claims.ExpiresAt.IsZero() {
+		if config.requireExpiration {
+			return ErrMissingExpiration
+		}
+	} else if now.After(claims.ExpiresAt.Add(config.leeway)) {
+		return ErrTokenExpired
+	}
+	if !claims.NotBefore.IsZero() && now.Add(config.leeway).Before(claims.NotBefore) {
+		return ErrTokenNotYetValid
+	}
+	if !claims.IssuedAt.IsZero() && now.Add(config.leeway).Before(claims.IssuedAt) {
+		return ErrInvalidIssuedAt
+	}
+	if config.audience != nil && claims.Audience != *config.audience {
+		return ErrInvalidAudience
+	}
+	if config.issuer != nil && claims.Issuer != *config.issuer {
+		return ErrInvalidIssuer
+	}
+	if config.subject != nil && claims.Subject != *config.subject {
+		return ErrInvalidSubject
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package paseto
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bloom42/gobox/crypto"
+)
+
+func TestClaimsV4Local(t *testing.T) {
+	key, _ := NewV4LocalKey()
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	claims := &Claims{
+		Issuer:    "auth.example.com",
+		Subject:   "user-42",
+		Audience:  "api.example.com",
+		TokenID:   "87IFSGFgPNtQNNuw0AtuLttP",
+		ExpiresAt: now.Add(time.Hour),
+		NotBefore: now,
+		IssuedAt:  now,
+		Custom:    map[string]interface{}{"role": "admin"},
+	}
+	token, err := claims.EncryptV4Local(key, []byte("key-id"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, footer, err := ParseV4Local(key, token, nil,
+		Clock(func() time.Time { return now.Add(time.Minute) }),
+		ValidateAudience("api.example.com"),
+		ValidateIssuer("auth.example.com"),
+		ValidateSubject("user-42"),
+		RequireExpiration(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(footer) != "key-id" {
+		t.Errorf("footer: %q, expecting: key-id", footer)
+	}
+	if parsed.Issuer != claims.Issuer || parsed.Subject != claims.Subject || parsed.Audience != claims.Audience ||
+		parsed.TokenID != claims.TokenID || !parsed.ExpiresAt.Equal(claims.ExpiresAt) ||
+		!parsed.NotBefore.Equal(claims.NotBefore) || !parsed.IssuedAt.Equal(claims.IssuedAt) ||
+		parsed.Custom["role"] != "admin" || len(parsed.Custom) != 1 {
+		t.Errorf("parsed claims: %+v, expecting: %+v", parsed, claims)
+	}
+
+	if _, _, err = ParseV4Local(key, token, nil, ValidateAudience("other")); err != ErrTokenExpired {
+		t.Errorf("parsing an expired token: %v, expecting: %v", err, ErrTokenExpired)
+	}
+}
+
+func TestClaimsV4Public(t *testing.T) {
+	publicKey, privateKey, _ := crypto.GenerateEd25519KeyPair()
+	claims := &Claims{Subject: "user-42", ExpiresAt: time.Now().Add(time.Hour)}
+	token, err := claims.SignV4Public(privateKey, nil, []byte("assertion"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := ParseV4Public(publicKey, token, []byte("assertion"), ValidateSubject("user-42"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Subject != "user-42" {
+		t.Errorf("subject: %q, expecting: user-42", parsed.Subject)
+	}
+}
+
+func TestClaimsValidate(t *testing.T) {
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := Clock(func() time.Time { return now })
+	tests := []struct {
+		claims   Claims
+		options  []ValidateOption
+		expected error
+	}{
+		{Claims{}, nil, nil},
+		{Claims{}, []ValidateOption{RequireExpiration()}, ErrMissingExpiration},
+		{Claims{ExpiresAt: now.Add(-time.Second)}, nil, ErrTokenExpired},
+		{Claims{ExpiresAt: now.Add(-time.Second)}, []ValidateOption{Leeway(time.Minute)}, nil},
+		{Claims{ExpiresAt: now}, nil, nil},
+		{Claims{NotBefore: now.Add(time.Second)}, nil, ErrTokenNotYetValid},
+		{Claims{NotBefore: now.Add(time.Second)}, []ValidateOption{Leeway(time.Minute)}, nil},
+		{Claims{IssuedAt: now.Add(time.Second)}, nil, ErrInvalidIssuedAt},
+		{Claims{Audience: "a"}, []ValidateOption{ValidateAudience("b")}, ErrInvalidAudience},
+		{Claims{}, []ValidateOption{ValidateAudience("b")}, ErrInvalidAudience},
+		{Claims{Issuer: "a"}, []ValidateOption{ValidateIssuer("b")}, ErrInvalidIssuer},
+		{Claims{Subject: "a"}, []ValidateOption{ValidateSubject("b")}, ErrInvalidSubject},
+	}
+	for i, test := range tests {
+		if err := test.claims.Validate(append(test.options, clock)...); err != test.expected {
+			t.Errorf("test %d: %v, expecting: %v", i, err, test.expected)
+		}
+	}
+}
+
+func TestClaimsInvalidJSON(t *testing.T) {
+	key, _ := NewV4LocalKey()
+	for _, message := range []string{`not json`, `[]`, `null`, `{"exp":42}`, `{"exp":"tomorrow"}`, `{"sub":true}`} {
+		token, _ := EncryptV4Local(key, []byte(message), nil, nil)
+		if _, _, err := ParseV4Local(key, token, nil); !errors.Is(err, ErrInvalidClaims) {
+			t.Errorf("%s: %v, expecting: %v", message, err, ErrInvalidClaims)
+		}
+	}
+}
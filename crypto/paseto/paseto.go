@@ -0,0 +1,111 @@
+// Package paseto implements version 4 of PASETO (Platform-Agnostic SEcurity TOkens,
+// https://github.com/paseto-standard/paseto-spec), a secure alternative to JWT.
+//
+// v4.local tokens are encrypted and authenticated with a shared secret key (XChaCha20 and
+// BLAKE2b-MAC), and v4.public tokens are signed with an Ed25519 private key and verified with
+// the corresponding public key. Their payload is readable by anyone.
+//
+// Tokens may have a footer, which is authenticated but not encrypted (for example to store the ID
+// of the key used to create the token), and an implicit assertion, which is authenticated but not
+// stored in the token, and must be provided again to parse it.
+//
+// Claims can be used to create and parse tokens carrying the registered claims (exp, nbf, iat,
+// aud, iss, sub, jti) and custom claims:
+//
+//	claims := &paseto.Claims{Subject: userID, ExpiresAt: time.Now().Add(time.Hour)}
+//	token, err := claims.EncryptV4Local(key, nil, nil)
+//
+//	claims, footer, err := paseto.ParseV4Local(key, token, nil, paseto.ValidateAudience("api"))
+package paseto
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrInvalidToken is returned when a token is malformed, or is not of the expected version
+	// and purpose.
+	ErrInvalidToken = errors.New("paseto: invalid token")
+
+	// ErrInvalidTokenMAC is returned when a v4.local token can't be authenticated, because it has
+	// been modified, or the key or the implicit assertion don't match.
+	ErrInvalidTokenMAC = errors.New("paseto: invalid token authentication tag")
+
+	// ErrInvalidTokenSignature is returned when the signature of a v4.public token is not valid.
+	ErrInvalidTokenSignature = errors.New("paseto: invalid token signature")
+
+	// ErrInvalidKey is returned when a key does not have the expected size.
+	ErrInvalidKey = errors.New("paseto: invalid key")
+)
+
+// b64 is the encoding of the tokens: base64url without padding, rejecting non canonical encodings.
+var b64 = base64.RawURLEncoding.Strict()
+
+// pae implements the Pre-Authentication Encoding of the pieces: the number of pieces, then each
+// piece prefixed by its size, all encoded as 64-bit little endian integers with the most
+// significant bit cleared.
+func pae(pieces ...[]byte) []byte {
+	size := 8
+	for _, piece := range pieces {
+		size += 8 + len(piece)
+	}
+	output := make([]byte, 8, size)
+	binary.LittleEndian.PutUint64(output, uint64(len(pieces))&^(1<<63))
+	for _, piece := range pieces {
+		var length [8]byte
+		binary.LittleEndian.PutUint64(length[:], uint64(len(piece))&^(1<<63))
+		output = append(output, length[:]...)
+		output = append(output, piece...)
+	}
+	return output
+}
+
+// encodeToken returns header || base64url(payload) [|| "." || base64url(footer)].
+func encodeToken(header string, payload, footer []byte) string {
+	token := header + b64.EncodeToString(payload)
+	if len(footer) != 0 {
+		token += "." + b64.EncodeToString(footer)
+	}
+	return token
+}
+
+// decodeToken checks the header of token and returns its decoded payload and footer.
+func decodeToken(header, token string) (payload, footer []byte, err error) {
+	if !strings.HasPrefix(token, header) {
+		return nil, nil, ErrInvalidToken
+	}
+	parts := strings.Split(token[len(header):], ".")
+	if len(parts) > 2 {
+		return nil, nil, ErrInvalidToken
+	}
+	if payload, err = b64.DecodeString(parts[0]); err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+	if len(parts) == 2 {
+		// an empty footer is never encoded
+		if footer, err = b64.DecodeString(parts[1]); err != nil || len(footer) == 0 {
+			return nil, nil, ErrInvalidToken
+		}
+	}
+	return payload, footer, nil
+}
+
+// Footer returns the footer of a token, WITHOUT verifying it. It can be used to find the key
+// needed to parse the token, but must not be trusted before the token has been parsed.
+func Footer(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) < 3 || len(parts) > 4 {
+		return nil, ErrInvalidToken
+	}
+	if len(parts) == 3 {
+		return nil, nil
+	}
+	footer, err := b64.DecodeString(parts[3])
+	if err != nil || len(footer) == 0 {
+		return nil, ErrInvalidToken
+	}
+	return footer, nil
+}
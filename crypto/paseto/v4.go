@@ -0,0 +1,176 @@
+package paseto
+
+import (
+	"crypto/subtle"
+
+	"github.com/bloom42/gobox/crypto"
+	"golang.org/x/crypto/chacha20"
+)
+
+const (
+	// V4LocalHeader is the header of v4.local tokens.
+	V4LocalHeader = "v4.local."
+
+	// V4PublicHeader is the header of v4.public tokens.
+	V4PublicHeader = "v4.public."
+
+	// V4LocalKeySize is the size of the keys of v4.local tokens, in bytes.
+	V4LocalKeySize = 32
+
+	v4LocalNonceSize = 32
+	v4LocalMACSize   = 32
+)
+
+// NewV4LocalKey generates a new random key for v4.local tokens.
+func NewV4LocalKey() ([]byte, error) {
+	return crypto.RandBytes(V4LocalKeySize)
+}
+
+// EncryptV4Local returns a v4.local token with message encrypted with key. footer and
+// implicitAssertion are optional.
+func EncryptV4Local(key, message, footer, implicitAssertion []byte) (string, error) {
+	nonce, err := crypto.RandBytes(v4LocalNonceSize)
+	if err != nil {
+		return "", err
+	}
+	return encryptV4Local(key, nonce, message, footer, implicitAssertion)
+}
+
+func encryptV4Local(key, nonce, message, footer, implicitAssertion []byte) (string, error) {
+	encryptionKey, counterNonce, authenticationKey, err := splitV4LocalKey(key, nonce)
+	if err != nil {
+		return "", err
+	}
+	defer crypto.Zeroize(encryptionKey)
+	defer crypto.Zeroize(authenticationKey)
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(message))
+	cipher.XORKeyStream(ciphertext, message)
+
+	mac, err := v4LocalMAC(authenticationKey, nonce, ciphertext, footer, implicitAssertion)
+	if err != nil {
+		return "", err
+	}
+
+	payload := make([]byte, 0, len(nonce)+len(ciphertext)+len(mac))
+	payload = append(payload, nonce...)
+	payload = append(payload, ciphertext...)
+	payload = append(payload, mac...)
+	return encodeToken(V4LocalHeader, payload, footer), nil
+}
+
+// DecryptV4Local authenticates and decrypts a v4.local token with key, and returns its message
+// and footer. implicitAssertion must be the one provided to create the token.
+func DecryptV4Local(key []byte, token string, implicitAssertion []byte) (message, footer []byte, err error) {
+	payload, footer, err := decodeToken(V4LocalHeader, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(payload) < v4LocalNonceSize+v4LocalMACSize {
+		return nil, nil, ErrInvalidToken
+	}
+	nonce := payload[:v4LocalNonceSize]
+	ciphertext := payload[v4LocalNonceSize : len(payload)-v4LocalMACSize]
+	mac := payload[len(payload)-v4LocalMACSize:]
+
+	encryptionKey, counterNonce, authenticationKey, err := splitV4LocalKey(key, nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer crypto.Zeroize(encryptionKey)
+	defer crypto.Zeroize(authenticationKey)
+
+	expectedMAC, err := v4LocalMAC(authenticationKey, nonce, ciphertext, footer, implicitAssertion)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare(mac, expectedMAC) != 1 {
+		return nil, nil, ErrInvalidTokenMAC
+	}
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	message = make([]byte, len(ciphertext))
+	cipher.XORKeyStream(message, ciphertext)
+	return message, footer, nil
+}
+
+// splitV4LocalKey derives the encryption key, the XChaCha20 nonce and the authentication key
+// of a token from key and its nonce.
+func splitV4LocalKey(key, nonce []byte) (encryptionKey, counterNonce, authenticationKey []byte, err error) {
+	if len(key) != V4LocalKeySize {
+		return nil, nil, nil, ErrInvalidKey
+	}
+	hash, err := crypto.NewHash(56, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	hash.Write([]byte("paseto-encryption-key"))
+	hash.Write(nonce)
+	tmp := hash.Sum(nil)
+
+	hash, err = crypto.NewHash(crypto.HashSize256, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	hash.Write([]byte("paseto-auth-key-for-aead"))
+	hash.Write(nonce)
+	return tmp[:chacha20.KeySize], tmp[chacha20.KeySize:], hash.Sum(nil), nil
+}
+
+func v4LocalMAC(authenticationKey, nonce, ciphertext, footer, implicitAssertion []byte) ([]byte, error) {
+	hash, err := crypto.NewHash(v4LocalMACSize, authenticationKey)
+	if err != nil {
+		return nil, err
+	}
+	hash.Write(pae([]byte(V4LocalHeader), nonce, ciphertext, footer, implicitAssertion))
+	return hash.Sum(nil), nil
+}
+
+// SignV4Public returns a v4.public token with message signed with privateKey. footer and
+// implicitAssertion are optional.
+func SignV4Public(privateKey crypto.Ed25519PrivateKey, message, footer, implicitAssertion []byte) (string, error) {
+	if len(privateKey) != crypto.Ed25519PrivateKeySize {
+		return "", ErrInvalidKey
+	}
+	signature, err := privateKey.Sign(nil, pae([]byte(V4PublicHeader), message, footer, implicitAssertion), crypto.Ed25519SignerOpts)
+	if err != nil {
+		return "", err
+	}
+	payload := make([]byte, 0, len(message)+len(signature))
+	payload = append(payload, message...)
+	payload = append(payload, signature...)
+	return encodeToken(V4PublicHeader, payload, footer), nil
+}
+
+// VerifyV4Public verifies the signature of a v4.public token with publicKey, and returns its
+// message and footer. implicitAssertion must be the one provided to create the token.
+func VerifyV4Public(publicKey crypto.Ed25519PublicKey, token string, implicitAssertion []byte) (message, footer []byte, err error) {
+	if len(publicKey) != crypto.Ed25519PublicKeySize {
+		return nil, nil, ErrInvalidKey
+	}
+	payload, footer, err := decodeToken(V4PublicHeader, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(payload) < crypto.Ed25519SignatureSize {
+		return nil, nil, ErrInvalidToken
+	}
+	message = payload[:len(payload)-crypto.Ed25519SignatureSize]
+	signature := payload[len(payload)-crypto.Ed25519SignatureSize:]
+
+	valid, err := publicKey.Verify(pae([]byte(V4PublicHeader), message, footer, implicitAssertion), signature)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !valid {
+		return nil, nil, ErrInvalidTokenSignature
+	}
+	return message, footer, nil
+}
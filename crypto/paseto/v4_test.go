@@ -0,0 +1,157 @@
+package paseto
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/bloom42/gobox/crypto"
+)
+
+// testdata/v4.json contains the official test vectors
+// (https://github.com/paseto-standard/test-vectors).
+
+type testVector struct {
+	Name              string  `json:"name"`
+	ExpectFail        bool    `json:"expect-fail"`
+	Key               string  `json:"key"`
+	Nonce             string  `json:"nonce"`
+	PublicKey         string  `json:"public-key"`
+	SecretKey         string  `json:"secret-key"`
+	Token             string  `json:"token"`
+	Payload           *string `json:"payload"`
+	Footer            string  `json:"footer"`
+	ImplicitAssertion string  `json:"implicit-assertion"`
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestV4Vectors(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/v4.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors struct {
+		Tests []testVector `json:"tests"`
+	}
+	if err = json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors.Tests) == 0 {
+		t.Fatal("no test vectors found")
+	}
+
+	for _, vector := range vectors.Tests {
+		vector := vector
+		t.Run(vector.Name, func(t *testing.T) {
+			implicitAssertion := []byte(vector.ImplicitAssertion)
+			var message, footer []byte
+			var err error
+			if vector.Key != "" {
+				message, footer, err = DecryptV4Local(decodeHex(t, vector.Key), vector.Token, implicitAssertion)
+			} else {
+				message, footer, err = VerifyV4Public(decodeHex(t, vector.PublicKey), vector.Token, implicitAssertion)
+			}
+
+			if vector.ExpectFail {
+				if err == nil {
+					t.Fatal("parsing the token should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(message) != *vector.Payload {
+				t.Errorf("message: %q, expecting: %q", message, *vector.Payload)
+			}
+			if string(footer) != vector.Footer {
+				t.Errorf("footer: %q, expecting: %q", footer, vector.Footer)
+			}
+
+			var token string
+			if vector.Key != "" {
+				token, err = encryptV4Local(decodeHex(t, vector.Key), decodeHex(t, vector.Nonce), message,
+					[]byte(vector.Footer), implicitAssertion)
+			} else {
+				token, err = SignV4Public(decodeHex(t, vector.SecretKey), message, []byte(vector.Footer), implicitAssertion)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != vector.Token {
+				t.Errorf("token: %s, expecting: %s", token, vector.Token)
+			}
+		})
+	}
+}
+
+func TestV4LocalRoundTrip(t *testing.T) {
+	key, err := NewV4LocalKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte("this is a secret message")
+	token, err := EncryptV4Local(key, message, []byte("key-id"), []byte("assertion"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, footer, err := DecryptV4Local(key, token, []byte("assertion"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != string(message) || string(footer) != "key-id" {
+		t.Errorf("message: %q, footer: %q", decrypted, footer)
+	}
+	if footer, err = Footer(token); err != nil || string(footer) != "key-id" {
+		t.Errorf("Footer: %q, %v", footer, err)
+	}
+
+	if _, _, err = DecryptV4Local(key, token, []byte("other assertion")); err != ErrInvalidTokenMAC {
+		t.Errorf("decrypting with another implicit assertion: %v, expecting: %v", err, ErrInvalidTokenMAC)
+	}
+	otherKey, _ := NewV4LocalKey()
+	if _, _, err = DecryptV4Local(otherKey, token, []byte("assertion")); err != ErrInvalidTokenMAC {
+		t.Errorf("decrypting with another key: %v, expecting: %v", err, ErrInvalidTokenMAC)
+	}
+	if _, _, err = DecryptV4Local(key[:16], token, []byte("assertion")); err != ErrInvalidKey {
+		t.Errorf("decrypting with a short key: %v, expecting: %v", err, ErrInvalidKey)
+	}
+	if _, _, err = DecryptV4Local(key, "v4.local.AAAA", nil); err != ErrInvalidToken {
+		t.Errorf("decrypting a short token: %v, expecting: %v", err, ErrInvalidToken)
+	}
+}
+
+func TestV4PublicRoundTrip(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := SignV4Public(privateKey, []byte("this is a signed message"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, footer, err := VerifyV4Public(publicKey, token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(message) != "this is a signed message" || footer != nil {
+		t.Errorf("message: %q, footer: %q", message, footer)
+	}
+
+	otherPublicKey, _, _ := crypto.GenerateEd25519KeyPair()
+	if _, _, err = VerifyV4Public(otherPublicKey, token, nil); err != ErrInvalidTokenSignature {
+		t.Errorf("verifying with another key: %v, expecting: %v", err, ErrInvalidTokenSignature)
+	}
+	if _, _, err = VerifyV4Public(publicKey, token, []byte("assertion")); err != ErrInvalidTokenSignature {
+		t.Errorf("verifying with an implicit assertion: %v, expecting: %v", err, ErrInvalidTokenSignature)
+	}
+}
@@ -27,6 +27,15 @@ var (
 	ErrIncompatiblePasswordHashVersion = errors.New("crypto: incompatible version of argon2")
 )
 
+// The bounds of the parameters of the Argon2id hashes which can be verified, so verifying a hash
+// read from an untrusted source can't exhaust the memory or the CPU.
+const (
+	maxArgon2Memory      = 4 * 1024 * 1024 // KiB
+	maxArgon2Iterations  = 100
+	maxArgon2Parallelism = 64
+	maxArgon2KeyLength   = 256 // bytes
+)
+
 // DefaultHashPasswordParams provides some sane default parameters for hashing passwords.
 // You are encouraged to change the Memory, Iterations and Parallelism parameters
 // to values appropriate for the environment that your code will be running in.
@@ -75,6 +84,10 @@ type HashPasswordParams struct {
 //		$argon2id$v=19$m=65536,t=3,p=2$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG
 //
 func HashPassword(password []byte, params *HashPasswordParams) (hash string, err error) {
+	return hashArgon2id(password, params, "")
+}
+
+func hashArgon2id(password []byte, params *HashPasswordParams, pepperID string) (hash string, err error) {
 	salt, err := RandBytes(uint64(params.SaltLength))
 	if err != nil {
 		return "", err
@@ -85,7 +98,11 @@ func HashPassword(password []byte, params *HashPasswordParams) (hash string, err
 	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
 	b64Key := base64.RawStdEncoding.EncodeToString(key)
 
-	hash = fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, params.Memory, params.Iterations, params.Parallelism, b64Salt, b64Key)
+	keyID := ""
+	if pepperID != "" {
+		keyID = ",keyid=" + pepperID
+	}
+	hash = fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d%s$%s$%s", argon2.Version, params.Memory, params.Iterations, params.Parallelism, keyID, b64Salt, b64Key)
 	return hash, nil
 }
 
@@ -93,12 +110,17 @@ func HashPassword(password []byte, params *HashPasswordParams) (hash string, err
 // plain-text password and Argon2id hash, using the parameters and salt
 // contained in the hash. It returns true if they match, otherwise it returns
 // false.
+//
+// Hashes created with a pepper must be verified with PasswordPolicy.Verify.
 func VerifyPasswordHash(password []byte, hash string) bool {
-	params, salt, key, err := decodePasswordHash(hash)
-	if err != nil {
+	params, pepperID, salt, key, err := decodePasswordHash(hash)
+	if err != nil || pepperID != "" {
 		return false
 	}
+	return verifyArgon2id(password, params, salt, key)
+}
 
+func verifyArgon2id(password []byte, params *HashPasswordParams, salt, key []byte) bool {
 	otherKey := argon2.IDKey(password, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
 
 	keyLen := int32(len(key))
@@ -113,38 +135,58 @@ func VerifyPasswordHash(password []byte, hash string) bool {
 	return false
 }
 
-func decodePasswordHash(hash string) (params *HashPasswordParams, salt, key []byte, err error) {
+// decodePasswordHash decodes an Argon2id hash. pepperID is the value of the optional keyid
+// parameter, set when the password has been peppered.
+func decodePasswordHash(hash string) (params *HashPasswordParams, pepperID string, salt, key []byte, err error) {
 	vals := strings.Split(hash, "$")
-	if len(vals) != 6 {
-		return nil, nil, nil, ErrInvalidPasswordHash
+	if len(vals) != 6 || vals[1] != "argon2id" {
+		return nil, "", nil, nil, ErrInvalidPasswordHash
 	}
 
 	var version int
 	_, err = fmt.Sscanf(vals[2], "v=%d", &version)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, "", nil, nil, err
 	}
 	if version != argon2.Version {
-		return nil, nil, nil, ErrIncompatiblePasswordHashVersion
+		return nil, "", nil, nil, ErrIncompatiblePasswordHashVersion
 	}
 
 	params = &HashPasswordParams{}
-	_, err = fmt.Sscanf(vals[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	paramsAndKeyID := strings.SplitN(vals[3], ",keyid=", 2)
+	_, err = fmt.Sscanf(paramsAndKeyID[0], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, "", nil, nil, err
+	}
+	if params.Iterations < 1 || params.Iterations > maxArgon2Iterations ||
+		params.Parallelism < 1 || params.Parallelism > maxArgon2Parallelism ||
+		params.Memory < 8*uint32(params.Parallelism) || params.Memory > maxArgon2Memory {
+		return nil, "", nil, nil, ErrInvalidPasswordHash
+	}
+	if len(paramsAndKeyID) == 2 {
+		pepperID = paramsAndKeyID[1]
+		if !isValidPepperID(pepperID) {
+			return nil, "", nil, nil, ErrInvalidPasswordHash
+		}
 	}
 
 	salt, err = base64.RawStdEncoding.DecodeString(vals[4])
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, "", nil, nil, err
+	}
+	if len(salt) == 0 {
+		return nil, "", nil, nil, ErrInvalidPasswordHash
 	}
 	params.SaltLength = uint32(len(salt))
 
 	key, err = base64.RawStdEncoding.DecodeString(vals[5])
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, "", nil, nil, err
+	}
+	if len(key) == 0 || len(key) > maxArgon2KeyLength {
+		return nil, "", nil, nil, ErrInvalidPasswordHash
 	}
 	params.KeyLength = uint32(len(key))
 
-	return params, salt, key, nil
+	return params, pepperID, salt, key, nil
 }
@@ -0,0 +1,334 @@
+package crypto
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	// ErrUnknownPasswordPepper is returned by PasswordPolicy.Verify when a hash has been created
+	// with a pepper which is not the pepper of the policy.
+	ErrUnknownPasswordPepper = errors.New("crypto: unknown password pepper")
+
+	// ErrUnsupportedPasswordHash is returned by PasswordPolicy.Verify when the algorithm of a hash
+	// is not supported.
+	ErrUnsupportedPasswordHash = errors.New("crypto: unsupported password hash algorithm")
+)
+
+// The bounds of the parameters of the legacy hashes, so verifying a hash read from an untrusted
+// source can't exhaust the memory or the CPU.
+const (
+	maxScryptMemory     = 1 << 30 // 128 * N * r bytes
+	maxScryptRP         = 1 << 10
+	maxPBKDF2Iterations = 10000000
+	maxLegacyKeyLength  = 256 // bytes
+)
+
+// PasswordPolicy hashes passwords with the current Argon2id parameters, and verifies the hashes
+// created with the previous parameters and legacy algorithms, reporting which hashes should
+// be upgraded.
+//
+// The following legacy hashes can be verified, in order to migrate the existing hashes of
+// another system to Argon2id, by rehashing the password after a successful login:
+//
+//	bcrypt:           $2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy ($2b$ and $2y$ too)
+//	scrypt:           $scrypt$ln=16,r=8,p=1$<salt>$<key>
+//	PBKDF2-SHA256:    $pbkdf2-sha256$i=29000$<salt>$<key> (pbkdf2, for SHA-1, and pbkdf2-sha512 too)
+//
+// Salts and keys are encoded with base64, with or without padding, and both the standard and
+// the passlib ("." instead of "+") alphabets are accepted. The number of iterations of PBKDF2
+// may also be written without "i=", as done by passlib.
+//
+// The hashes which would be too expensive to verify are rejected with ErrInvalidPasswordHash:
+// Argon2id using more than 4 GiB of memory, 100 iterations or a parallelism of 64, scrypt using
+// more than 1 GiB of memory or with r*p above 1024, and PBKDF2 with more than 10 million
+// iterations.
+type PasswordPolicy struct {
+	// Params are the parameters of the new hashes. If nil, DefaultHashPasswordParams is used.
+	Params *HashPasswordParams
+
+	// Pepper is an optional server-side secret, mixed into the passwords before hashing them,
+	// so a leaked database of hashes can't be cracked without the pepper. It must be between
+	// 16 and 64 bytes long, and should be stored apart from the database.
+	Pepper []byte
+
+	// PepperID identifies the pepper, and is stored in the hashes (as the keyid parameter) so
+	// the pepper can be changed. It is required if Pepper is set and can only contain
+	// alphanumeric characters, "+" and "/".
+	PepperID string
+}
+
+func (policy *PasswordPolicy) params() *HashPasswordParams {
+	if policy.Params == nil {
+		return DefaultHashPasswordParams
+	}
+	return policy.Params
+}
+
+func (policy *PasswordPolicy) checkPepper() error {
+	if policy.Pepper == nil {
+		return nil
+	}
+	if len(policy.Pepper) < 16 || len(policy.Pepper) > 64 {
+		return errors.New("crypto: the password pepper must be between 16 and 64 bytes long")
+	}
+	if !isValidPepperID(policy.PepperID) {
+		return errors.New("crypto: invalid password pepper ID")
+	}
+	return nil
+}
+
+// pepper returns the keyed BLAKE2b-512 hash of password, with the pepper as key.
+func (policy *PasswordPolicy) pepper(password []byte) ([]byte, error) {
+	hash, err := NewHash(HashSize512, policy.Pepper)
+	if err != nil {
+		return nil, err
+	}
+	hash.Write(password)
+	return hash.Sum(nil), nil
+}
+
+// Hash returns an Argon2id hash of password, using the parameters and the pepper of the policy.
+func (policy *PasswordPolicy) Hash(password []byte) (string, error) {
+	if err := policy.checkPepper(); err != nil {
+		return "", err
+	}
+	if policy.Pepper == nil {
+		return hashArgon2id(password, policy.params(), "")
+	}
+	peppered, err := policy.pepper(password)
+	if err != nil {
+		return "", err
+	}
+	defer Zeroize(peppered)
+	return hashArgon2id(peppered, policy.params(), policy.PepperID)
+}
+
+// Verify reports whether password matches hash. If it does, needsRehash reports whether the
+// password should be hashed again with Hash and the stored hash replaced, as done by NeedsRehash.
+//
+// An error is returned if the hash is malformed, or can't be verified by the policy. A
+// mismatching password is not an error.
+func (policy *PasswordPolicy) Verify(password []byte, hash string) (match, needsRehash bool, err error) {
+	if err = policy.checkPepper(); err != nil {
+		return false, false, err
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		match, err = verifyLegacyPasswordHash(password, hash)
+		return match, match, err
+	}
+
+	params, pepperID, salt, key, err := decodePasswordHash(hash)
+	if err != nil {
+		return false, false, err
+	}
+	if pepperID != "" {
+		if pepperID != policy.PepperID || policy.Pepper == nil {
+			return false, false, ErrUnknownPasswordPepper
+		}
+		peppered, err := policy.pepper(password)
+		if err != nil {
+			return false, false, err
+		}
+		defer Zeroize(peppered)
+		password = peppered
+	}
+	if !verifyArgon2id(password, params, salt, key) {
+		return false, false, nil
+	}
+	return true, policy.needsRehash(params, pepperID), nil
+}
+
+// NeedsRehash reports whether hash should be replaced by a new hash created with the policy:
+// because it uses a legacy algorithm, Argon2id parameters weaker than the parameters of the
+// policy (less memory, iterations, or a shorter salt or key), or another pepper. The
+// parallelism does not make a hash stronger, so it is not taken into account.
+//
+// Malformed hashes always need to be rehashed.
+func (policy *PasswordPolicy) NeedsRehash(hash string) bool {
+	params, pepperID, _, _, err := decodePasswordHash(hash)
+	if err != nil {
+		return true
+	}
+	return policy.needsRehash(params, pepperID)
+}
+
+func (policy *PasswordPolicy) needsRehash(params *HashPasswordParams, pepperID string) bool {
+	current := policy.params()
+	if params.Memory < current.Memory || params.Iterations < current.Iterations ||
+		params.SaltLength < current.SaltLength || params.KeyLength < current.KeyLength {
+		return true
+	}
+	if policy.Pepper == nil {
+		return pepperID != ""
+	}
+	return pepperID != policy.PepperID
+}
+
+func isValidPepperID(pepperID string) bool {
+	if pepperID == "" {
+		return false
+	}
+	for _, c := range pepperID {
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && c != '+' && c != '/' {
+			return false
+		}
+	}
+	return true
+}
+
+func verifyLegacyPasswordHash(password []byte, hash string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), password)
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("%w: %s", ErrInvalidPasswordHash, err)
+		}
+		return true, nil
+	case strings.HasPrefix(hash, "$scrypt$"):
+		return verifyScryptPasswordHash(password, hash)
+	case strings.HasPrefix(hash, "$pbkdf2"):
+		return verifyPBKDF2PasswordHash(password, hash)
+	}
+	return false, ErrUnsupportedPasswordHash
+}
+
+// $scrypt$ln=<log2(N)>,r=<r>,p=<p>$<salt>$<key>
+func verifyScryptPasswordHash(password []byte, hash string) (bool, error) {
+	vals := strings.Split(hash, "$")
+	if len(vals) != 5 {
+		return false, ErrInvalidPasswordHash
+	}
+	var logN, r, p int
+	if _, err := fmt.Sscanf(vals[2], "ln=%d,r=%d,p=%d", &logN, &r, &p); err != nil {
+		return false, ErrInvalidPasswordHash
+	}
+	if logN < 1 || logN > 30 || r < 1 || p < 1 || r > maxScryptRP/p || r > maxScryptMemory>>uint(7+logN) {
+		return false, ErrInvalidPasswordHash
+	}
+	salt, key, err := decodeLegacySaltAndKey(vals[3], vals[4])
+	if err != nil {
+		return false, err
+	}
+	otherKey, err := scrypt.Key(password, salt, 1<<uint(logN), r, p, len(key))
+	if err != nil {
+		return false, fmt.Errorf("%w: %s", ErrInvalidPasswordHash, err)
+	}
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
+
+// $pbkdf2[-sha256|-sha512]$[i=]<iterations>$<salt>$<key>
+func verifyPBKDF2PasswordHash(password []byte, encodedHash string) (bool, error) {
+	vals := strings.Split(encodedHash, "$")
+	if len(vals) != 5 {
+		return false, ErrInvalidPasswordHash
+	}
+	var newHash func() hash.Hash
+	switch vals[1] {
+	case "pbkdf2":
+		newHash = sha1.New
+	case "pbkdf2-sha256":
+		newHash = sha256.New
+	case "pbkdf2-sha512":
+		newHash = sha512.New
+	default:
+		return false, ErrUnsupportedPasswordHash
+	}
+	iterations, err := strconv.Atoi(strings.TrimPrefix(vals[2], "i="))
+	if err != nil || iterations < 1 || iterations > maxPBKDF2Iterations {
+		return false, ErrInvalidPasswordHash
+	}
+	salt, key, err := decodeLegacySaltAndKey(vals[3], vals[4])
+	if err != nil {
+		return false, err
+	}
+	otherKey := pbkdf2.Key(password, salt, iterations, len(key), newHash)
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
+
+func decodeLegacySaltAndKey(encodedSalt, encodedKey string) (salt, key []byte, err error) {
+	decode := func(s string) ([]byte, error) {
+		s = strings.TrimRight(strings.Replace(s, ".", "+", -1), "=")
+		return base64.RawStdEncoding.DecodeString(s)
+	}
+	if salt, err = decode(encodedSalt); err != nil {
+		return nil, nil, ErrInvalidPasswordHash
+	}
+	if key, err = decode(encodedKey); err != nil || len(key) == 0 || len(key) > maxLegacyKeyLength {
+		return nil, nil, ErrInvalidPasswordHash
+	}
+	return salt, key, nil
+}
+
+// CalibrateHashPasswordParams returns Argon2id parameters for which hashing a password takes
+// about targetDuration on the current machine, to be used in HashPasswordParams or
+// PasswordPolicy.Params.
+//
+// As recommended by RFC 9106, the memory is maximized first: it starts at maxMemory (in
+// kibibytes) and is halved until a single iteration is faster than targetDuration, then the
+// iterations are increased until the target is reached. The salt and key lengths are the ones
+// of DefaultHashPasswordParams.
+func CalibrateHashPasswordParams(targetDuration time.Duration, maxMemory uint32, parallelism uint8) (*HashPasswordParams, error) {
+	const minMemory = 8 * 1024
+	if targetDuration <= 0 {
+		return nil, errors.New("crypto: the target duration must be positive")
+	}
+	if maxMemory < minMemory {
+		return nil, fmt.Errorf("crypto: the maximum memory must be at least %d KiB", minMemory)
+	}
+	if parallelism == 0 {
+		return nil, errors.New("crypto: the parallelism must be at least 1")
+	}
+
+	params := &HashPasswordParams{
+		Memory:      maxMemory,
+		Iterations:  1,
+		Parallelism: parallelism,
+		SaltLength:  DefaultHashPasswordParams.SaltLength,
+		KeyLength:   DefaultHashPasswordParams.KeyLength,
+	}
+	password := []byte("password calibration")
+	salt := make([]byte, params.SaltLength)
+	measure := func() time.Duration {
+		start := time.Now()
+		argon2.IDKey(password, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		return time.Since(start)
+	}
+
+	duration := measure()
+	for duration > targetDuration && params.Memory/2 >= minMemory {
+		params.Memory /= 2
+		duration = measure()
+	}
+	// the duration is roughly proportional to the iterations: estimate the count, then adjust it
+	if duration < targetDuration {
+		if duration <= 0 {
+			duration = 1
+		}
+		params.Iterations = uint32(targetDuration / duration)
+		duration = measure()
+		for duration > targetDuration && params.Iterations > 1 {
+			params.Iterations--
+			duration = measure()
+		}
+	}
+	return params, nil
+}
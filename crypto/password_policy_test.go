@@ -0,0 +1,190 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testHashPasswordParams = &HashPasswordParams{
+	Memory:      8 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestPasswordPolicyNeedsRehash(t *testing.T) {
+	policy := &PasswordPolicy{Params: testHashPasswordParams}
+	hash, err := policy.Hash([]byte("pa$$word"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyPasswordHash([]byte("pa$$word"), hash) {
+		t.Error("hash created without pepper should be verified by VerifyPasswordHash")
+	}
+
+	match, needsRehash, err := policy.Verify([]byte("pa$$word"), hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match || needsRehash {
+		t.Errorf("match: %v, needsRehash: %v, expecting: true, false", match, needsRehash)
+	}
+	if match, _, err = policy.Verify([]byte("otherPa$$word"), hash); match || err != nil {
+		t.Errorf("match: %v, err: %v, expecting: false, nil", match, err)
+	}
+
+	stronger := *testHashPasswordParams
+	stronger.Iterations++
+	policy.Params = &stronger
+	if match, needsRehash, _ = policy.Verify([]byte("pa$$word"), hash); !match || !needsRehash {
+		t.Errorf("match: %v, needsRehash: %v, expecting: true, true", match, needsRehash)
+	}
+	if !policy.NeedsRehash(hash) {
+		t.Error("hash with fewer iterations should need to be rehashed")
+	}
+
+	weaker := *testHashPasswordParams
+	weaker.Memory /= 2
+	weaker.Parallelism = 4
+	policy.Params = &weaker
+	if policy.NeedsRehash(hash) {
+		t.Error("hash with more memory should not need to be rehashed")
+	}
+	if !policy.NeedsRehash("$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy") {
+		t.Error("legacy hash should need to be rehashed")
+	}
+}
+
+func TestPasswordPolicyPepper(t *testing.T) {
+	pepper := []byte("0123456789abcdef0123456789abcdef")
+	policy := &PasswordPolicy{Params: testHashPasswordParams, Pepper: pepper, PepperID: "1"}
+
+	hash, err := policy.Hash([]byte("pa$$word"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(hash, ",keyid=1$") {
+		t.Errorf("hash %q should contain the pepper ID", hash)
+	}
+	if VerifyPasswordHash([]byte("pa$$word"), hash) {
+		t.Error("peppered hash should not be verified by VerifyPasswordHash")
+	}
+	match, needsRehash, err := policy.Verify([]byte("pa$$word"), hash)
+	if err != nil || !match || needsRehash {
+		t.Errorf("match: %v, needsRehash: %v, err: %v, expecting: true, false, nil", match, needsRehash, err)
+	}
+
+	// hashes created before the pepper was introduced must be upgraded
+	unpeppered, _ := HashPassword([]byte("pa$$word"), testHashPasswordParams)
+	match, needsRehash, err = policy.Verify([]byte("pa$$word"), unpeppered)
+	if err != nil || !match || !needsRehash {
+		t.Errorf("match: %v, needsRehash: %v, err: %v, expecting: true, true, nil", match, needsRehash, err)
+	}
+
+	newPolicy := &PasswordPolicy{Params: testHashPasswordParams, Pepper: []byte("another pepper, another pepper!!"), PepperID: "2"}
+	if _, _, err = newPolicy.Verify([]byte("pa$$word"), hash); err != ErrUnknownPasswordPepper {
+		t.Errorf("%v, expecting: %v", err, ErrUnknownPasswordPepper)
+	}
+	if _, _, err = (&PasswordPolicy{}).Verify([]byte("pa$$word"), hash); err != ErrUnknownPasswordPepper {
+		t.Errorf("%v, expecting: %v", err, ErrUnknownPasswordPepper)
+	}
+
+	if _, err = (&PasswordPolicy{Pepper: []byte("short"), PepperID: "1"}).Hash([]byte("pa$$word")); err == nil {
+		t.Error("hashing with a short pepper should fail")
+	}
+	if _, err = (&PasswordPolicy{Pepper: pepper, PepperID: "$"}).Hash([]byte("pa$$word")); err == nil {
+		t.Error("hashing with an invalid pepper ID should fail")
+	}
+}
+
+func TestPasswordPolicyLegacyHashes(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("pa$$word"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := []string{
+		string(bcryptHash),
+		"$scrypt$ln=10,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$cFLULrdG5Lf1beukYU2QXFWpLODoLgjC+isSQy0PdXo",
+		"$scrypt$ln=10,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$cFLULrdG5Lf1beukYU2QXFWpLODoLgjC.isSQy0PdXo",
+		"$pbkdf2-sha256$i=1000$MDEyMzQ1Njc4OWFiY2RlZg$LSCXKyb/gRfVgmt2edzK8PGMtJnyZO6sTtddDYGQk3U=",
+		"$pbkdf2-sha512$1000$MDEyMzQ1Njc4OWFiY2RlZg$8d8HuCOvakmGRy7UMLMSH2BwIkfAOQOoGWMlNX3zLrbgTlInGBAFYQKBVwJ1mfLcrmm6bTbnklAmz81ZoWZnJQ",
+		"$pbkdf2$1000$MDEyMzQ1Njc4OWFiY2RlZg$Q84KPqMUGLLQ1fTjszuKJgUPnpE",
+	}
+	policy := &PasswordPolicy{Params: testHashPasswordParams}
+
+	for _, hash := range hashes {
+		match, needsRehash, err := policy.Verify([]byte("pa$$word"), hash)
+		if err != nil {
+			t.Fatalf("%s: %s", hash, err)
+		}
+		if !match || !needsRehash {
+			t.Errorf("%s: match: %v, needsRehash: %v, expecting: true, true", hash, match, needsRehash)
+		}
+		if match, needsRehash, err = policy.Verify([]byte("otherPa$$word"), hash); match || needsRehash || err != nil {
+			t.Errorf("%s: match: %v, needsRehash: %v, err: %v, expecting: false, false, nil", hash, match, needsRehash, err)
+		}
+	}
+
+	if _, _, err = policy.Verify([]byte("pa$$word"), "$md5$salt$hash"); err != ErrUnsupportedPasswordHash {
+		t.Errorf("%v, expecting: %v", err, ErrUnsupportedPasswordHash)
+	}
+	invalidHashes := []string{
+		"$pbkdf2-sha256$i=x$salt$hash",
+		// too expensive hashes are rejected before being computed
+		"$pbkdf2-sha256$i=1000000000$MDEyMzQ1Njc4OWFiY2RlZg$LSCXKyb/gRfVgmt2edzK8PGMtJnyZO6sTtddDYGQk3U=",
+		"$scrypt$ln=10,r=8,p=1000000$MDEyMzQ1Njc4OWFiY2RlZg$cFLULrdG5Lf1beukYU2QXFWpLODoLgjC+isSQy0PdXo",
+		"$scrypt$ln=10,r=4611686018427387904,p=4$MDEyMzQ1Njc4OWFiY2RlZg$cFLULrdG5Lf1beukYU2QXFWpLODoLgjC+isSQy0PdXo",
+		"$scrypt$ln=24,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$cFLULrdG5Lf1beukYU2QXFWpLODoLgjC+isSQy0PdXo",
+		"$scrypt$ln=10,r=0,p=1$MDEyMzQ1Njc4OWFiY2RlZg$cFLULrdG5Lf1beukYU2QXFWpLODoLgjC+isSQy0PdXo",
+	}
+	for _, hash := range invalidHashes {
+		if _, _, err = policy.Verify([]byte("pa$$word"), hash); err != ErrInvalidPasswordHash {
+			t.Errorf("%s: %v, expecting: %v", hash, err, ErrInvalidPasswordHash)
+		}
+	}
+}
+
+func TestPasswordPolicyInvalidHashes(t *testing.T) {
+	policy := &PasswordPolicy{Params: testHashPasswordParams}
+	hashes := []string{
+		"$argon2id$v=19$m=65536,t=1,p=1$c29tZXNhbHQ$",
+		"$argon2id$v=19$m=65536,t=1,p=1$$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2id$v=19$m=65536,t=0,p=1$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2id$v=19$m=65536,t=1,p=0$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2id$v=19$m=15,t=1,p=2$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		// too expensive hashes are rejected before being computed
+		"$argon2id$v=19$m=4294967295,t=1,p=1$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2id$v=19$m=65536,t=4294967295,p=1$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2id$v=19$m=65536,t=1,p=255$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2id$v=19$m=65536,t=1,p=1$c29tZXNhbHQ$" + strings.Repeat("A", 400),
+	}
+	for _, hash := range hashes {
+		if _, _, err := policy.Verify([]byte("pa$$word"), hash); err != ErrInvalidPasswordHash {
+			t.Errorf("%s: %v, expecting: %v", hash, err, ErrInvalidPasswordHash)
+		}
+		if VerifyPasswordHash([]byte("pa$$word"), hash) {
+			t.Errorf("%s: should not match", hash)
+		}
+	}
+}
+
+func TestCalibrateHashPasswordParams(t *testing.T) {
+	params, err := CalibrateHashPasswordParams(20*time.Millisecond, 16*1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Memory < 8*1024 || params.Memory > 16*1024 || params.Iterations < 1 || params.Parallelism != 1 {
+		t.Errorf("bad params: %+v", params)
+	}
+	if _, err = HashPassword([]byte("pa$$word"), params); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = CalibrateHashPasswordParams(time.Second, 1024, 1); err == nil {
+		t.Error("calibrating with too little memory should fail")
+	}
+}
@@ -0,0 +1,180 @@
+package crypto
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// ErrSecretBufferDestroyed is returned when using a SecretBuffer after `Destroy`.
+var ErrSecretBufferDestroyed = errors.New("crypto: secret buffer has been destroyed")
+
+// SecretBuffer holds a secret (such as a key) in memory allocated outside of the Go heap, so
+// it is never moved nor copied by the garbage collector. On unix systems, the memory is locked
+// with mlock to not be swapped to disk, and surrounded by inaccessible guard pages so that overflows
+// crash the program instead of reading or corrupting other memory. On other systems, the buffer is
+// allocated on the Go heap.
+//
+// The memory is not tracked by the garbage collector: `Destroy` should be called as soon as the secret
+// is no longer needed, to zeroize and release it. A finalizer destroys forgotten buffers, but it
+// may never run. As the finalizer can run as soon as the buffer itself is unreachable, the secret
+// should be accessed with `With`, which keeps the buffer alive.
+//
+// Functions which receive the secret (`NewAEAD`, `ed25519.Sign`...) may still copy it on the Go
+// heap.
+type SecretBuffer struct {
+	mutex     sync.Mutex
+	memory    []byte
+	data      []byte
+	destroyed bool
+}
+
+// NewSecretBuffer allocates a new zeroed SecretBuffer of size bytes.
+func NewSecretBuffer(size int) (*SecretBuffer, error) {
+	if size < 1 {
+		return nil, errors.New("crypto: secret buffer size must be positive")
+	}
+	memory, data, err := allocSecretMemory(size)
+	if err != nil {
+		return nil, err
+	}
+	buffer := &SecretBuffer{memory: memory, data: data}
+	runtime.SetFinalizer(buffer, func(buffer *SecretBuffer) {
+		buffer.Destroy()
+	})
+	return buffer, nil
+}
+
+// NewSecretBufferFromBytes allocates a new SecretBuffer holding a copy of secret, and zeroizes
+// secret.
+func NewSecretBufferFromBytes(secret []byte) (*SecretBuffer, error) {
+	buffer, err := NewSecretBuffer(len(secret))
+	if err != nil {
+		return nil, err
+	}
+	copy(buffer.data, secret)
+	Zeroize(secret)
+	return buffer, nil
+}
+
+// newRandomSecretBuffer allocates a new SecretBuffer filled with random bytes.
+func newRandomSecretBuffer(size int) (*SecretBuffer, error) {
+	buffer, err := NewSecretBuffer(size)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.ReadFull(RandReader(), buffer.data); err != nil {
+		buffer.Destroy()
+		return nil, err
+	}
+	return buffer, nil
+}
+
+// Bytes returns the secret. The slice points to the memory of the buffer and must not be used
+// after `Destroy`, and not be appended to. It is nil once the buffer is destroyed.
+//
+// The slice doesn't keep the buffer alive: if the buffer becomes unreachable, the finalizer
+// releases the memory while the slice may still be in use. Prefer `With`, or call
+// `runtime.KeepAlive(buffer)` after the last use of the slice.
+func (buffer *SecretBuffer) Bytes() []byte {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.data
+}
+
+// With calls fn with the secret, keeping the buffer alive and preventing its destruction until fn
+// returns. The slice must not be retained nor appended to, and fn must not call the methods of the
+// buffer. It returns ErrSecretBufferDestroyed if the buffer has been destroyed.
+func (buffer *SecretBuffer) With(fn func(secret []byte)) error {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	if buffer.destroyed {
+		return ErrSecretBufferDestroyed
+	}
+	fn(buffer.data)
+	runtime.KeepAlive(buffer)
+	return nil
+}
+
+// Size returns the size of the secret in bytes.
+func (buffer *SecretBuffer) Size() int {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return len(buffer.data)
+}
+
+// Destroyed reports whether the buffer has been destroyed.
+func (buffer *SecretBuffer) Destroyed() bool {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.destroyed
+}
+
+// Destroy zeroizes and releases the memory of the buffer. It can be called several times.
+func (buffer *SecretBuffer) Destroy() error {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	if buffer.destroyed {
+		return nil
+	}
+	Zeroize(buffer.data)
+	err := freeSecretMemory(buffer.memory, buffer.data)
+	buffer.memory = nil
+	buffer.data = nil
+	buffer.destroyed = true
+	runtime.SetFinalizer(buffer, nil)
+	return err
+}
+
+// SignEd25519 signs message with the Ed25519 private key held by the buffer, as created by
+// `GenerateSecretEd25519KeyPair`. crypto/ed25519 doesn't support keys outside of the Go heap,
+// so the key is copied for the duration of the signature, then zeroized.
+func (buffer *SecretBuffer) SignEd25519(message []byte) ([]byte, error) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	if buffer.destroyed {
+		return nil, ErrSecretBufferDestroyed
+	}
+	if len(buffer.data) != Ed25519PrivateKeySize {
+		return nil, errors.New("crypto: Invalid Ed25519 private key size")
+	}
+	privateKey := make(Ed25519PrivateKey, Ed25519PrivateKeySize)
+	copy(privateKey, buffer.data)
+	defer Zeroize(privateKey)
+	return privateKey.Sign(RandReader(), message, Ed25519SignerOpts)
+}
+
+// NewSecretAEADKey generates a new random secret key for `NewAEAD`, held in a SecretBuffer.
+func NewSecretAEADKey() (*SecretBuffer, error) {
+	return newRandomSecretBuffer(AEADKeySize)
+}
+
+// DeriveSecretKeyFromPassword is like `DeriveKeyFromPassword`, but the key is held in a
+// SecretBuffer. The intermediate key on the Go heap is zeroized.
+func DeriveSecretKeyFromPassword(password, salt []byte, params *DeriveKeyFromPasswordParams) (*SecretBuffer, error) {
+	key, err := DeriveKeyFromPassword(password, salt, params)
+	if err != nil {
+		return nil, err
+	}
+	return NewSecretBufferFromBytes(key)
+}
+
+// GenerateSecretEd25519KeyPair generates a public/private Ed25519 key pair, with the private key
+// held in a SecretBuffer. Use `SecretBuffer.SignEd25519` to sign with it. The key generated on
+// the Go heap is zeroized.
+func GenerateSecretEd25519KeyPair() (Ed25519PublicKey, *SecretBuffer, error) {
+	publicKey, privateKey, err := GenerateEd25519KeyPair()
+	if err != nil {
+		return nil, nil, err
+	}
+	buffer, err := NewSecretBufferFromBytes(privateKey)
+	if err != nil {
+		Zeroize(privateKey)
+		return nil, nil, err
+	}
+	return publicKey, buffer, nil
+}
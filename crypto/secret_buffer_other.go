@@ -0,0 +1,14 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package crypto
+
+// allocSecretMemory allocates the buffer on the Go heap: memory locking and guard pages are
+// not implemented on this system.
+func allocSecretMemory(size int) (memory, data []byte, err error) {
+	data = make([]byte, size)
+	return data, data, nil
+}
+
+func freeSecretMemory(memory, data []byte) error {
+	return nil
+}
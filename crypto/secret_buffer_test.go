@@ -0,0 +1,146 @@
+package crypto
+
+import (
+	"bytes"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"unsafe"
+)
+
+func TestSecretBuffer(t *testing.T) {
+	for _, size := range []int{1, 32, 4096, 5000} {
+		buffer, err := NewSecretBuffer(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buffer.Size() != size || len(buffer.Bytes()) != size {
+			t.Errorf("size: %d, expecting: %d", buffer.Size(), size)
+		}
+		if !bytes.Equal(buffer.Bytes(), make([]byte, size)) {
+			t.Error("new buffer is not zeroed")
+		}
+		data := buffer.Bytes()
+		for i := range data {
+			data[i] = 42
+		}
+
+		if err = buffer.Destroy(); err != nil {
+			t.Fatal(err)
+		}
+		if !buffer.Destroyed() || buffer.Bytes() != nil || buffer.Size() != 0 {
+			t.Error("buffer should be destroyed")
+		}
+		if err = buffer.Destroy(); err != nil {
+			t.Errorf("destroying twice: %v", err)
+		}
+	}
+
+	if _, err := NewSecretBuffer(0); err == nil {
+		t.Error("allocating an empty buffer should fail")
+	}
+}
+
+func TestSecretBufferFromBytes(t *testing.T) {
+	secret := []byte("this is a secret")
+	buffer, err := NewSecretBufferFromBytes(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buffer.Destroy()
+
+	if string(buffer.Bytes()) != "this is a secret" {
+		t.Errorf("buffer: %q", buffer.Bytes())
+	}
+	if !bytes.Equal(secret, make([]byte, len(secret))) {
+		t.Error("the source secret should be zeroized")
+	}
+}
+
+func TestSecretBufferWith(t *testing.T) {
+	buffer, err := NewSecretBufferFromBytes([]byte("this is a secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var secret string
+	err = buffer.With(func(data []byte) {
+		// the buffer must not be finalized while in use, even if it is no longer referenced
+		runtime.GC()
+		runtime.GC()
+		secret = string(data)
+	})
+	if err != nil || secret != "this is a secret" {
+		t.Errorf("secret: %q, err: %v", secret, err)
+	}
+
+	buffer.Destroy()
+	if err = buffer.With(func([]byte) { t.Error("fn should not be called") }); err != ErrSecretBufferDestroyed {
+		t.Errorf("%v, expecting: %v", err, ErrSecretBufferDestroyed)
+	}
+}
+
+func TestSecretBufferGuardPage(t *testing.T) {
+	buffer, err := NewSecretBuffer(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buffer.Destroy()
+	if len(buffer.memory) == len(buffer.data) {
+		t.Skip("guard pages are not implemented on " + runtime.GOOS)
+	}
+
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if recover() == nil {
+			t.Error("writing after the end of the buffer should fault")
+		}
+	}()
+	data := buffer.Bytes()
+	// the byte after the end of the buffer, on the guard page
+	*(*byte)(unsafe.Pointer(uintptr(unsafe.Pointer(&data[0])) + uintptr(len(data)))) = 1
+}
+
+func TestSecretKeys(t *testing.T) {
+	key, err := NewSecretAEADKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Destroy()
+	if key.Size() != AEADKeySize || bytes.Equal(key.Bytes(), make([]byte, AEADKeySize)) {
+		t.Errorf("AEAD key: %x", key.Bytes())
+	}
+	ciphertext, nonce, err := AEADEncrypt(key.Bytes(), []byte("message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := AEADDecrypt(key.Bytes(), nonce, ciphertext, nil); err != nil || string(plaintext) != "message" {
+		t.Errorf("decrypting with a secret key: %q, %v", plaintext, err)
+	}
+
+	params := &DeriveKeyFromPasswordParams{Memory: 1024, Iterations: 1, Parallelism: 1, KeySize: KeySize256}
+	derivedKey, err := DeriveSecretKeyFromPassword([]byte("password"), []byte("saltsaltsaltsalt"), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer derivedKey.Destroy()
+	expectedKey, _ := DeriveKeyFromPassword([]byte("password"), []byte("saltsaltsaltsalt"), params)
+	if !bytes.Equal(derivedKey.Bytes(), expectedKey) {
+		t.Error("derived keys don't match")
+	}
+
+	publicKey, privateKeyBuffer, err := GenerateSecretEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := privateKeyBuffer.SignEd25519([]byte("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid, _ := publicKey.Verify([]byte("message"), signature); !valid {
+		t.Error("signature is not valid")
+	}
+	privateKeyBuffer.Destroy()
+	if _, err = privateKeyBuffer.SignEd25519([]byte("message")); err != ErrSecretBufferDestroyed {
+		t.Errorf("using a destroyed buffer: %v, expecting: %v", err, ErrSecretBufferDestroyed)
+	}
+}
@@ -0,0 +1,46 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package crypto
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocSecretMemory maps size bytes, rounded up to the page size, between two guard pages. The
+// data is placed at the end of its pages, so overflows fault on the second guard page.
+//
+//	guard page | unused, data | guard page
+func allocSecretMemory(size int) (memory, data []byte, err error) {
+	pageSize := os.Getpagesize()
+	dataPagesSize := (size + pageSize - 1) / pageSize * pageSize
+
+	memory, err = unix.Mmap(-1, 0, pageSize+dataPagesSize+pageSize,
+		unix.PROT_NONE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("crypto: allocating secret buffer: %w", err)
+	}
+	dataPages := memory[pageSize : pageSize+dataPagesSize]
+	if err = unix.Mprotect(dataPages, unix.PROT_READ|unix.PROT_WRITE); err != nil {
+		unix.Munmap(memory)
+		return nil, nil, fmt.Errorf("crypto: allocating secret buffer: %w", err)
+	}
+	if err = unix.Mlock(dataPages); err != nil {
+		unix.Munmap(memory)
+		return nil, nil, fmt.Errorf("crypto: locking secret buffer (RLIMIT_MEMLOCK may be too low): %w", err)
+	}
+
+	data = dataPages[dataPagesSize-size:]
+	return memory, data, nil
+}
+
+func freeSecretMemory(memory, data []byte) error {
+	pageSize := os.Getpagesize()
+	dataPages := memory[pageSize : len(memory)-pageSize]
+	if err := unix.Munlock(dataPages); err != nil {
+		return err
+	}
+	return unix.Munmap(memory)
+}
@@ -0,0 +1,36 @@
+package shamir
+
+// Arithmetic in GF(2^8) with the AES polynomial x^8 + x^4 + x^3 + x + 1, implemented without
+// lookup tables nor branches depending on the values, to avoid leaking the secret through timing.
+
+func add(a, b byte) byte {
+	return a ^ b
+}
+
+func mul(a, b byte) byte {
+	result := byte(0)
+	for i := 0; i < 8; i++ {
+		// result ^= a if the lowest bit of b is set
+		result ^= a & -(b & 1)
+		b >>= 1
+		// a *= x, reduced by the polynomial if the highest bit was set
+		a = (a << 1) ^ (0x1b & -(a >> 7))
+	}
+	return result
+}
+
+// inverse returns a^-1 = a^254, and 0 for 0.
+func inverse(a byte) byte {
+	// a^254 = a^(2 + 4 + 8 + 16 + 32 + 64 + 128)
+	result := byte(1)
+	square := a
+	for i := 0; i < 7; i++ {
+		square = mul(square, square)
+		result = mul(result, square)
+	}
+	return result
+}
+
+func div(a, b byte) byte {
+	return mul(a, inverse(b))
+}
@@ -0,0 +1,212 @@
+// Package shamir implements Shamir's secret sharing over GF(256), to split a secret (such as a
+// root key generated by crypto.NewAEADKey) among n operators, so that any k of them can recover
+// it while k - 1 of them learn nothing about it.
+//
+//	shares, err := shamir.Split(rootKey, 5, 3)
+//	// give one share to each operator, then with any 3 of them:
+//	rootKey, err := shamir.Combine([][]byte{shares[1], shares[3], shares[4]})
+//
+// Each byte of the secret is shared with a random polynomial of degree k - 1, whose constant term
+// is the byte. Shares are encoded as:
+//
+//	version (1 byte) || split ID (8 bytes) || threshold (1 byte) || x (1 byte) || y (secret size) || checksum (8 bytes)
+//
+// where the split ID is random and identifies the shares of the same split, and the checksum is
+// a BLAKE2b hash of the rest of the share, to detect mistyped or corrupted shares. When more than
+// k shares are combined, the extra shares are checked to be consistent with the others.
+package shamir
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bloom42/gobox/crypto"
+)
+
+const (
+	// Version is the version of the encoding of the shares.
+	Version byte = 1
+
+	// MaxShares is the maximum number of shares of a secret.
+	MaxShares = 255
+
+	splitIDSize  = 8
+	checksumSize = 8
+	headerSize   = 1 + splitIDSize + 1 + 1
+	// Overhead is the difference between the size of a share and the size of the secret.
+	Overhead = headerSize + checksumSize
+)
+
+var (
+	// ErrInvalidShare is returned (wrapped) by Combine when a share is malformed or its checksum
+	// doesn't match.
+	ErrInvalidShare = errors.New("shamir: invalid share")
+
+	// ErrShareMismatch is returned by Combine when the shares come from different splits, or
+	// are inconsistent with each other.
+	ErrShareMismatch = errors.New("shamir: shares do not belong to the same secret")
+
+	// ErrDuplicateShare is returned by Combine when the same share is provided several times.
+	ErrDuplicateShare = errors.New("shamir: duplicate share")
+
+	// ErrNotEnoughShares is returned by Combine when fewer shares than the threshold are provided.
+	ErrNotEnoughShares = errors.New("shamir: not enough shares")
+)
+
+// Split splits secret in n shares, any k of which are needed to recover it with Combine.
+// 2 <= k <= n <= MaxShares.
+func Split(secret []byte, n, k int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("shamir: empty secret")
+	}
+	if k < 2 || k > n || n > MaxShares {
+		return nil, errors.New("shamir: invalid parameters: 2 <= k <= n <= 255 is required")
+	}
+
+	splitID, err := crypto.RandBytes(splitIDSize)
+	if err != nil {
+		return nil, err
+	}
+	shares := make([][]byte, n)
+	for i := range shares {
+		share := make([]byte, headerSize, Overhead+len(secret))
+		share[0] = Version
+		copy(share[1:], splitID)
+		share[1+splitIDSize] = byte(k)
+		// x = 0 is the secret
+		share[headerSize-1] = byte(i + 1)
+		shares[i] = share
+	}
+
+	// the coefficients of the polynomial of each byte, the constant term being the byte
+	coefficients := make([]byte, k)
+	defer crypto.Zeroize(coefficients)
+	for _, b := range secret {
+		coefficients[0] = b
+		if _, err = io.ReadFull(crypto.RandReader(), coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for i, share := range shares {
+			shares[i] = append(share, evaluate(coefficients, byte(i+1)))
+		}
+	}
+
+	for i, share := range shares {
+		sum, err := checksum(share)
+		if err != nil {
+			return nil, err
+		}
+		shares[i] = append(share, sum...)
+	}
+	return shares, nil
+}
+
+// Combine recovers the secret from at least k of its shares.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, ErrNotEnoughShares
+	}
+
+	for i, share := range shares {
+		if err := checkShare(share); err != nil {
+			return nil, fmt.Errorf("%w: share %d: %s", ErrInvalidShare, i+1, err)
+		}
+	}
+	first := shares[0]
+	threshold := int(first[1+splitIDSize])
+	seen := map[byte]bool{}
+	for _, share := range shares {
+		if len(share) != len(first) || !bytes.Equal(share[:headerSize-1], first[:headerSize-1]) {
+			return nil, ErrShareMismatch
+		}
+		x := share[headerSize-1]
+		if seen[x] {
+			return nil, ErrDuplicateShare
+		}
+		seen[x] = true
+	}
+	if len(shares) < threshold {
+		return nil, fmt.Errorf("%w: %d shares are needed", ErrNotEnoughShares, threshold)
+	}
+
+	xs := make([]byte, threshold)
+	ys := make([]byte, threshold)
+	secret := make([]byte, len(first)-Overhead)
+	for i := range secret {
+		for j := 0; j < threshold; j++ {
+			xs[j] = shares[j][headerSize-1]
+			ys[j] = shares[j][headerSize+i]
+		}
+		secret[i] = interpolate(xs, ys, 0)
+		// the extra shares must be on the same polynomial
+		for _, share := range shares[threshold:] {
+			if interpolate(xs, ys, share[headerSize-1]) != share[headerSize+i] {
+				crypto.Zeroize(secret)
+				return nil, ErrShareMismatch
+			}
+		}
+	}
+	crypto.Zeroize(ys)
+	return secret, nil
+}
+
+func checkShare(share []byte) error {
+	if len(share) <= Overhead {
+		return errors.New("share is too short")
+	}
+	if share[0] != Version {
+		return fmt.Errorf("unsupported version: %d", share[0])
+	}
+	sum, err := checksum(share[:len(share)-checksumSize])
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(sum, share[len(share)-checksumSize:]) != 1 {
+		return errors.New("checksum mismatch")
+	}
+	threshold := share[1+splitIDSize]
+	if threshold < 2 || share[headerSize-1] == 0 {
+		return errors.New("malformed header")
+	}
+	return nil
+}
+
+func checksum(data []byte) ([]byte, error) {
+	hash, err := crypto.NewHash(checksumSize, nil)
+	if err != nil {
+		return nil, err
+	}
+	hash.Write(data)
+	return hash.Sum(nil), nil
+}
+
+// evaluate returns the value at x of the polynomial with the given coefficients, using Horner's
+// method.
+func evaluate(coefficients []byte, x byte) byte {
+	result := byte(0)
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = add(mul(result, x), coefficients[i])
+	}
+	return result
+}
+
+// interpolate returns the value at x of the polynomial of degree len(xs) - 1 going through the
+// points (xs[i], ys[i]), using Lagrange interpolation.
+func interpolate(xs, ys []byte, x byte) byte {
+	result := byte(0)
+	for i := range xs {
+		basis := byte(1)
+		for j := range xs {
+			if i == j {
+				continue
+			}
+			// (x - xs[j]) / (xs[i] - xs[j]), subtraction being addition in GF(256)
+			basis = mul(basis, div(add(x, xs[j]), add(xs[i], xs[j])))
+		}
+		result = add(result, mul(basis, ys[i]))
+	}
+	return result
+}
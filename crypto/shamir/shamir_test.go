@@ -0,0 +1,171 @@
+package shamir
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bloom42/gobox/crypto"
+)
+
+// combinations calls f with each combination of k indexes among n.
+func combinations(n, k int, f func(indexes []int)) {
+	indexes := make([]int, k)
+	var rec func(start, depth int)
+	rec = func(start, depth int) {
+		if depth == k {
+			f(indexes)
+			return
+		}
+		for i := start; i < n; i++ {
+			indexes[depth] = i
+			rec(i+1, depth+1)
+		}
+	}
+	rec(0, 0)
+}
+
+func TestSplitCombineAllCombinations(t *testing.T) {
+	for n := 2; n <= 7; n++ {
+		for k := 2; k <= n; k++ {
+			secret, err := crypto.NewAEADKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			shares, err := Split(secret, n, k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(shares) != n {
+				t.Fatalf("%d shares, expecting: %d", len(shares), n)
+			}
+
+			for size := k; size <= n; size++ {
+				combinations(n, size, func(indexes []int) {
+					subset := make([][]byte, 0, size)
+					for _, i := range indexes {
+						subset = append(subset, shares[i])
+					}
+					combined, err := Combine(subset)
+					if err != nil {
+						t.Fatalf("%d-of-%d, shares %v: %s", k, n, indexes, err)
+					}
+					if !bytes.Equal(secret, combined) {
+						t.Fatalf("%d-of-%d, shares %v: bad secret", k, n, indexes)
+					}
+				})
+			}
+			combinations(n, k-1, func(indexes []int) {
+				subset := make([][]byte, 0, k-1)
+				for _, i := range indexes {
+					subset = append(subset, shares[i])
+				}
+				if _, err := Combine(subset); !errors.Is(err, ErrNotEnoughShares) {
+					t.Fatalf("%d-of-%d, shares %v: %v, expecting: %v", k, n, indexes, err, ErrNotEnoughShares)
+				}
+			})
+		}
+	}
+}
+
+// Fewer shares than the threshold must not reveal the secret: for any value of the secret, there
+// is a polynomial going through k - 1 shares.
+func TestPartialSharesRevealNothing(t *testing.T) {
+	shares, err := Split([]byte{42}, 3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xs := []byte{shares[0][headerSize-1], shares[1][headerSize-1], 0}
+	ys := []byte{shares[0][headerSize], shares[1][headerSize], 0}
+	seen := map[byte]bool{}
+	for candidate := 0; candidate < 256; candidate++ {
+		ys[2] = byte(candidate)
+		// the polynomial through the 2 shares and (0, candidate) has candidate as secret
+		if interpolate(xs, ys, 0) != byte(candidate) {
+			t.Fatalf("no polynomial for the candidate secret %d", candidate)
+		}
+		seen[interpolate(xs, ys, 3)] = true
+	}
+	if len(seen) != 256 {
+		t.Errorf("the third share takes %d values, expecting: 256", len(seen))
+	}
+}
+
+func TestCombineErrors(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+	shares, _ := Split(secret, 5, 3)
+	otherShares, _ := Split(secret, 5, 3)
+
+	corrupted := append([]byte{}, shares[0]...)
+	corrupted[headerSize] ^= 1
+	if _, err := Combine([][]byte{corrupted, shares[1], shares[2]}); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("corrupted share: %v, expecting: %v", err, ErrInvalidShare)
+	}
+	if _, err := Combine([][]byte{shares[0][:Overhead], shares[1], shares[2]}); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("truncated share: %v, expecting: %v", err, ErrInvalidShare)
+	}
+	if _, err := Combine([][]byte{shares[0], shares[1], otherShares[2]}); err != ErrShareMismatch {
+		t.Errorf("share of another split: %v, expecting: %v", err, ErrShareMismatch)
+	}
+	if _, err := Combine([][]byte{shares[0], shares[1], shares[1]}); err != ErrDuplicateShare {
+		t.Errorf("duplicate share: %v, expecting: %v", err, ErrDuplicateShare)
+	}
+	if _, err := Combine(nil); err != ErrNotEnoughShares {
+		t.Errorf("no shares: %v, expecting: %v", err, ErrNotEnoughShares)
+	}
+
+	// an extra share with a valid checksum but inconsistent with the others
+	forged := append([]byte{}, shares[3]...)
+	forged[headerSize] ^= 1
+	sum, _ := checksum(forged[:len(forged)-checksumSize])
+	copy(forged[len(forged)-checksumSize:], sum)
+	if _, err := Combine([][]byte{shares[0], shares[1], shares[2], forged}); err != ErrShareMismatch {
+		t.Errorf("inconsistent extra share: %v, expecting: %v", err, ErrShareMismatch)
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	for _, params := range [][2]int{{1, 1}, {3, 1}, {2, 3}, {256, 2}} {
+		if _, err := Split([]byte("secret"), params[0], params[1]); err == nil {
+			t.Errorf("n = %d, k = %d should fail", params[0], params[1])
+		}
+	}
+	if _, err := Split(nil, 3, 2); err == nil {
+		t.Error("splitting an empty secret should fail")
+	}
+	if shares, err := Split([]byte("secret"), MaxShares, MaxShares); err != nil || len(shares) != MaxShares {
+		t.Errorf("255-of-255: %v", err)
+	}
+}
+
+func TestGF256(t *testing.T) {
+	// reference multiplication, with branches
+	slowMul := func(a, b byte) byte {
+		result := byte(0)
+		for b != 0 {
+			if b&1 != 0 {
+				result ^= a
+			}
+			if a&0x80 != 0 {
+				a = a<<1 ^ 0x1b
+			} else {
+				a <<= 1
+			}
+			b >>= 1
+		}
+		return result
+	}
+	for a := 0; a < 256; a++ {
+		for b := 0; b < 256; b++ {
+			if mul(byte(a), byte(b)) != slowMul(byte(a), byte(b)) {
+				t.Fatalf("mul(%d, %d) = %d, expecting: %d", a, b, mul(byte(a), byte(b)), slowMul(byte(a), byte(b)))
+			}
+		}
+		if a != 0 && mul(byte(a), inverse(byte(a))) != 1 {
+			t.Fatalf("%d * inverse(%d) != 1", a, a)
+		}
+	}
+	if mul(0x57, 0x83) != 0xc1 {
+		t.Error("0x57 * 0x83 != 0xc1")
+	}
+}
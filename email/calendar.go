@@ -0,0 +1,437 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// iTIP methods (RFC 5546) of calendars
+const (
+	CalendarMethodPublish = "PUBLISH"
+	CalendarMethodRequest = "REQUEST"
+	CalendarMethodReply   = "REPLY"
+	CalendarMethodCancel  = "CANCEL"
+)
+
+// Statuses of calendar events (RFC 5545 section 3.8.1.11)
+const (
+	CalendarEventConfirmed = "CONFIRMED"
+	CalendarEventTentative = "TENTATIVE"
+	CalendarEventCancelled = "CANCELLED"
+)
+
+// Participation roles of calendar attendees (RFC 5545 section 3.2.16)
+const (
+	CalendarRoleChair          = "CHAIR"
+	CalendarRoleRequired       = "REQ-PARTICIPANT"
+	CalendarRoleOptional       = "OPT-PARTICIPANT"
+	CalendarRoleNonParticipant = "NON-PARTICIPANT"
+)
+
+// Participation statuses of calendar attendees (RFC 5545 section 3.2.12)
+const (
+	CalendarAttendeeNeedsAction = "NEEDS-ACTION"
+	CalendarAttendeeAccepted    = "ACCEPTED"
+	CalendarAttendeeDeclined    = "DECLINED"
+	CalendarAttendeeTentative   = "TENTATIVE"
+)
+
+const (
+	defaultCalendarProductID = "-//bloom42//gobox email//EN"
+	icalendarDateTimeFormat  = "20060102T150405"
+	icalendarDateFormat      = "20060102"
+	icalendarMaxLineLength   = 75
+)
+
+// ErrInvalidCalendar is returned (wrapped) when a Calendar can't be serialized
+var ErrInvalidCalendar = errors.New("email: invalid calendar")
+
+// Calendar is an iCalendar (RFC 5545) object, to be sent with Email.Calendar.
+//
+// The time zones of the events are the locations of their Start and End times: a VTIMEZONE
+// component is generated from the Go time zone database for each location (except UTC and
+// Local, for which the times are sent in UTC).
+type Calendar struct {
+	// Method is the iTIP method of the calendar. Defaults to CalendarMethodRequest
+	Method string
+	// ProductID identifies the product which created the calendar. Defaults to
+	// "-//bloom42//gobox email//EN"
+	ProductID string
+	Events    []CalendarEvent
+}
+
+// CalendarEvent is an event (VEVENT) of a Calendar
+type CalendarEvent struct {
+	// UID is the unique and persistent identifier of the event, such as "<id>@<domain>". It is
+	// required, and must be the same in the updates and cancellation of the event.
+	UID string
+	// Sequence must be incremented for each update of the event
+	Sequence int
+	// Status is CalendarEventConfirmed, CalendarEventTentative or CalendarEventCancelled.
+	// Optional
+	Status      string
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	// Start is required. If AllDay is true, only the dates of Start and End are used, and End
+	// is exclusive (End defaults to the day following Start).
+	Start  time.Time
+	End    time.Time
+	AllDay bool
+	// RecurrenceRule is the RRULE of recurring events, such as "FREQ=WEEKLY;COUNT=10"
+	RecurrenceRule string
+	// Organizer is required for the CalendarMethodRequest and CalendarMethodCancel methods
+	Organizer mail.Address
+	Attendees []CalendarAttendee
+	// Timestamp is the time at which the event was created or updated. Defaults to now
+	Timestamp time.Time
+}
+
+// CalendarAttendee is an attendee of a CalendarEvent
+type CalendarAttendee struct {
+	Address mail.Address
+	// Role defaults to CalendarRoleRequired
+	Role string
+	// Status defaults to CalendarAttendeeNeedsAction
+	Status string
+	// RSVP requests a reply from the attendee
+	RSVP bool
+}
+
+func (calendar *Calendar) method() string {
+	if calendar.Method == "" {
+		return CalendarMethodRequest
+	}
+	return strings.ToUpper(calendar.Method)
+}
+
+// Bytes returns the calendar in the iCalendar format
+func (calendar *Calendar) Bytes() ([]byte, error) {
+	if len(calendar.Events) == 0 {
+		return nil, fmt.Errorf("%w: no event", ErrInvalidCalendar)
+	}
+	method := calendar.method()
+	if !isICalendarToken(method) {
+		return nil, fmt.Errorf("%w: invalid method %q", ErrInvalidCalendar, method)
+	}
+	productID := calendar.ProductID
+	if productID == "" {
+		productID = defaultCalendarProductID
+	}
+
+	// the time zones of the events, with the period during which they are used
+	locations := map[string]*time.Location{}
+	var firstTime, lastTime time.Time
+	for i, event := range calendar.Events {
+		if event.UID == "" {
+			return nil, fmt.Errorf("%w: event %d has no UID", ErrInvalidCalendar, i)
+		}
+		if event.Start.IsZero() {
+			return nil, fmt.Errorf("%w: event %s has no start", ErrInvalidCalendar, event.UID)
+		}
+		if !event.End.IsZero() && event.End.Before(event.Start) {
+			return nil, fmt.Errorf("%w: event %s ends before its start", ErrInvalidCalendar, event.UID)
+		}
+		if event.Organizer.Address == "" && (method == CalendarMethodRequest || method == CalendarMethodCancel) {
+			return nil, fmt.Errorf("%w: event %s has no organizer", ErrInvalidCalendar, event.UID)
+		}
+		if err := validateICalendarEvent(event); err != nil {
+			return nil, fmt.Errorf("%w: event %s: %s", ErrInvalidCalendar, event.UID, err)
+		}
+		if event.AllDay {
+			continue
+		}
+		for _, t := range []time.Time{event.Start, event.End} {
+			if t.IsZero() {
+				continue
+			}
+			if location := icalendarLocation(t); location != nil {
+				locations[location.String()] = location
+			}
+			if firstTime.IsZero() || t.Before(firstTime) {
+				firstTime = t
+			}
+			if t.After(lastTime) {
+				lastTime = t
+			}
+		}
+	}
+
+	var buffer bytes.Buffer
+	writeICalendarLine(&buffer, "BEGIN:VCALENDAR")
+	writeICalendarLine(&buffer, "PRODID:"+escapeICalendarText(productID))
+	writeICalendarLine(&buffer, "VERSION:2.0")
+	writeICalendarLine(&buffer, "CALSCALE:GREGORIAN")
+	writeICalendarLine(&buffer, "METHOD:"+method)
+
+	locationNames := make([]string, 0, len(locations))
+	for name := range locations {
+		locationNames = append(locationNames, name)
+	}
+	sort.Strings(locationNames)
+	for _, name := range locationNames {
+		// the observances of the year before the first event, until the year after the last event
+		from := time.Date(firstTime.Year()-1, time.January, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(lastTime.Year()+2, time.January, 1, 0, 0, 0, 0, time.UTC)
+		writeICalendarTimeZone(&buffer, locations[name], from, to)
+	}
+
+	now := time.Now()
+	for _, event := range calendar.Events {
+		timestamp := event.Timestamp
+		if timestamp.IsZero() {
+			timestamp = now
+		}
+		writeICalendarLine(&buffer, "BEGIN:VEVENT")
+		writeICalendarLine(&buffer, "UID:"+escapeICalendarText(event.UID))
+		writeICalendarLine(&buffer, "SEQUENCE:"+strconv.Itoa(event.Sequence))
+		writeICalendarLine(&buffer, "DTSTAMP:"+timestamp.UTC().Format(icalendarDateTimeFormat)+"Z")
+		if event.AllDay {
+			end := event.End
+			if end.IsZero() || !end.After(event.Start) {
+				end = event.Start.AddDate(0, 0, 1)
+			}
+			writeICalendarLine(&buffer, "DTSTART;VALUE=DATE:"+event.Start.Format(icalendarDateFormat))
+			writeICalendarLine(&buffer, "DTEND;VALUE=DATE:"+end.Format(icalendarDateFormat))
+		} else {
+			writeICalendarLine(&buffer, "DTSTART"+formatICalendarTime(event.Start))
+			if !event.End.IsZero() {
+				writeICalendarLine(&buffer, "DTEND"+formatICalendarTime(event.End))
+			}
+		}
+		if event.RecurrenceRule != "" {
+			writeICalendarLine(&buffer, "RRULE:"+strings.TrimPrefix(event.RecurrenceRule, "RRULE:"))
+		}
+		if event.Status != "" {
+			writeICalendarLine(&buffer, "STATUS:"+strings.ToUpper(event.Status))
+		}
+		for _, property := range []struct{ name, value string }{
+			{"SUMMARY", event.Summary},
+			{"DESCRIPTION", event.Description},
+			{"LOCATION", event.Location},
+		} {
+			if property.value != "" {
+				writeICalendarLine(&buffer, property.name+":"+escapeICalendarText(property.value))
+			}
+		}
+		if event.URL != "" {
+			writeICalendarLine(&buffer, "URL:"+event.URL)
+		}
+		if event.Organizer.Address != "" {
+			writeICalendarLine(&buffer, "ORGANIZER"+formatICalendarCommonName(event.Organizer)+":mailto:"+event.Organizer.Address)
+		}
+		for _, attendee := range event.Attendees {
+			role := attendee.Role
+			if role == "" {
+				role = CalendarRoleRequired
+			}
+			status := attendee.Status
+			if status == "" {
+				status = CalendarAttendeeNeedsAction
+			}
+			writeICalendarLine(&buffer, "ATTENDEE"+formatICalendarCommonName(attendee.Address)+
+				";ROLE="+strings.ToUpper(role)+";PARTSTAT="+strings.ToUpper(status)+
+				";RSVP="+strings.ToUpper(strconv.FormatBool(attendee.RSVP))+":mailto:"+attendee.Address.Address)
+		}
+		writeICalendarLine(&buffer, "END:VEVENT")
+	}
+	writeICalendarLine(&buffer, "END:VCALENDAR")
+	return buffer.Bytes(), nil
+}
+
+// validateICalendarEvent checks the values of event which are written without being escaped, so
+// they can't inject properties: the parameters (Role and Status of attendees) and Status must be
+// tokens, and the other values must not contain control characters (such as CR and LF).
+func validateICalendarEvent(event CalendarEvent) error {
+	if event.Status != "" && !isICalendarToken(event.Status) {
+		return fmt.Errorf("invalid status %q", event.Status)
+	}
+	for _, property := range []struct{ name, value string }{
+		{"recurrence rule", event.RecurrenceRule},
+		{"URL", event.URL},
+		{"organizer address", event.Organizer.Address},
+	} {
+		if hasICalendarControlChars(property.value) {
+			return fmt.Errorf("invalid %s %q", property.name, property.value)
+		}
+	}
+	for _, attendee := range event.Attendees {
+		if hasICalendarControlChars(attendee.Address.Address) {
+			return fmt.Errorf("invalid attendee address %q", attendee.Address.Address)
+		}
+		if attendee.Role != "" && !isICalendarToken(attendee.Role) {
+			return fmt.Errorf("invalid attendee role %q", attendee.Role)
+		}
+		if attendee.Status != "" && !isICalendarToken(attendee.Status) {
+			return fmt.Errorf("invalid attendee status %q", attendee.Status)
+		}
+	}
+	return nil
+}
+
+// hasICalendarControlChars reports whether s contains a control character, which can't be
+// written in an iCalendar value without escaping.
+func hasICalendarControlChars(s string) bool {
+	for _, r := range s {
+		if r < ' ' || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// isICalendarToken reports whether s is an iana-token or a x-name (RFC 5545 section 3.1).
+func isICalendarToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// icalendarLocation returns the location of t, or nil if t must be sent in UTC.
+func icalendarLocation(t time.Time) *time.Location {
+	location := t.Location()
+	if location == time.UTC || location == time.Local || location.String() == "UTC" || location.String() == "" {
+		return nil
+	}
+	return location
+}
+
+// formatICalendarTime formats t as the parameters and value of a DATE-TIME property.
+func formatICalendarTime(t time.Time) string {
+	location := icalendarLocation(t)
+	if location == nil {
+		return ":" + t.UTC().Format(icalendarDateTimeFormat) + "Z"
+	}
+	return ";TZID=" + location.String() + ":" + t.Format(icalendarDateTimeFormat)
+}
+
+// formatICalendarCommonName formats the CN parameter of ORGANIZER and ATTENDEE properties.
+func formatICalendarCommonName(address mail.Address) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '"' || r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, address.Name)
+	if name == "" {
+		return ""
+	}
+	return `;CN="` + name + `"`
+}
+
+// icalendarTransition is a change of the offset of a time zone
+type icalendarTransition struct {
+	at         time.Time
+	offsetFrom int
+	offsetTo   int
+	name       string
+}
+
+// writeICalendarTimeZone writes the VTIMEZONE component of location, with the observances
+// starting between from and to.
+func writeICalendarTimeZone(buffer *bytes.Buffer, location *time.Location, from, to time.Time) {
+	var transitions []icalendarTransition
+	_, offset := from.In(location).Zone()
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		name, nextOffset := next.In(location).Zone()
+		if nextOffset == offset {
+			continue
+		}
+		// find the second of the transition
+		low, high := day, next
+		for high.Sub(low) > time.Second {
+			middle := low.Add(high.Sub(low) / 2)
+			if _, middleOffset := middle.In(location).Zone(); middleOffset == offset {
+				low = middle
+			} else {
+				high = middle
+			}
+		}
+		transitions = append(transitions, icalendarTransition{at: high, offsetFrom: offset, offsetTo: nextOffset, name: name})
+		offset = nextOffset
+	}
+
+	writeICalendarLine(buffer, "BEGIN:VTIMEZONE")
+	writeICalendarLine(buffer, "TZID:"+location.String())
+	if len(transitions) == 0 {
+		name, offset := from.In(location).Zone()
+		transitions = append(transitions, icalendarTransition{
+			at:         time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC).Add(-time.Duration(offset) * time.Second),
+			offsetFrom: offset,
+			offsetTo:   offset,
+			name:       name,
+		})
+	}
+	for _, transition := range transitions {
+		component := "STANDARD"
+		if transition.offsetTo > transition.offsetFrom {
+			component = "DAYLIGHT"
+		}
+		// the onset of the observance is in the local time before the transition
+		onset := transition.at.Add(time.Duration(transition.offsetFrom) * time.Second).UTC()
+		writeICalendarLine(buffer, "BEGIN:"+component)
+		writeICalendarLine(buffer, "DTSTART:"+onset.Format(icalendarDateTimeFormat))
+		writeICalendarLine(buffer, "TZOFFSETFROM:"+formatICalendarOffset(transition.offsetFrom))
+		writeICalendarLine(buffer, "TZOFFSETTO:"+formatICalendarOffset(transition.offsetTo))
+		if transition.name != "" {
+			writeICalendarLine(buffer, "TZNAME:"+escapeICalendarText(transition.name))
+		}
+		writeICalendarLine(buffer, "END:"+component)
+	}
+	writeICalendarLine(buffer, "END:VTIMEZONE")
+}
+
+// formatICalendarOffset formats an UTC offset, in seconds, as (+|-)HHMM[SS]
+func formatICalendarOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	formatted := fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset/60%60)
+	if offset%60 != 0 {
+		formatted += fmt.Sprintf("%02d", offset%60)
+	}
+	return formatted
+}
+
+// escapeICalendarText escapes a TEXT value (RFC 5545 section 3.3.11)
+func escapeICalendarText(text string) string {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", `\n`)
+	return replacer.Replace(text)
+}
+
+// writeICalendarLine writes a content line, folded at 75 octets (RFC 5545 section 3.1)
+func writeICalendarLine(buffer *bytes.Buffer, line string) {
+	limit := icalendarMaxLineLength
+	for len(line) > limit {
+		cut := limit
+		// don't split UTF-8 sequences
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		buffer.WriteString(line[:cut])
+		buffer.WriteString("\r\n ")
+		line = line[cut:]
+		// the leading space of continuation lines counts in the limit
+		limit = icalendarMaxLineLength - 1
+	}
+	buffer.WriteString(line)
+	buffer.WriteString("\r\n")
+}
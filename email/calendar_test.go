@@ -0,0 +1,134 @@
+package email
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendar(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	calendar := Calendar{
+		Events: []CalendarEvent{{
+			UID:            "123@example.com",
+			Sequence:       1,
+			Status:         CalendarEventConfirmed,
+			Summary:        "Planning, review; retro",
+			Description:    "First line\nSecond line, which is long enough to be folded at seventy five octets: éééé",
+			Location:       `Room \1`,
+			Start:          time.Date(2024, time.March, 28, 10, 0, 0, 0, paris),
+			End:            time.Date(2024, time.March, 28, 11, 30, 0, 0, paris),
+			RecurrenceRule: "FREQ=WEEKLY;COUNT=4",
+			Organizer:      mail.Address{Name: `Alice "A"`, Address: "alice@example.com"},
+			Attendees: []CalendarAttendee{
+				{Address: mail.Address{Name: "Bob", Address: "bob@example.org"}, RSVP: true},
+				{Address: mail.Address{Address: "carol@example.org"}, Role: CalendarRoleOptional, Status: CalendarAttendeeAccepted},
+			},
+			Timestamp: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+		}},
+	}
+	data, err := calendar.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ics := string(data)
+
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line too long: %q", line)
+		}
+	}
+	unfolded := strings.Replace(ics, "\r\n ", "", -1)
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\nPRODID:-//bloom42//gobox email//EN\r\nVERSION:2.0\r\n",
+		"METHOD:REQUEST\r\n",
+		// the observances of Europe/Paris around the event
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Paris\r\n",
+		"BEGIN:DAYLIGHT\r\nDTSTART:20240331T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nTZNAME:CEST\r\nEND:DAYLIGHT\r\n",
+		"BEGIN:STANDARD\r\nDTSTART:20241027T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\nEND:STANDARD\r\n",
+		"UID:123@example.com\r\nSEQUENCE:1\r\nDTSTAMP:20240301T120000Z\r\n",
+		"DTSTART;TZID=Europe/Paris:20240328T100000\r\nDTEND;TZID=Europe/Paris:20240328T113000\r\n",
+		"RRULE:FREQ=WEEKLY;COUNT=4\r\nSTATUS:CONFIRMED\r\n",
+		`SUMMARY:Planning\, review\; retro` + "\r\n",
+		`DESCRIPTION:First line\nSecond line\, which is long enough to be folded at seventy five octets: éééé` + "\r\n",
+		`LOCATION:Room \\1` + "\r\n",
+		`ORGANIZER;CN="Alice A":mailto:alice@example.com` + "\r\n",
+		`ATTENDEE;CN="Bob";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:bob@example.org` + "\r\n",
+		`ATTENDEE;ROLE=OPT-PARTICIPANT;PARTSTAT=ACCEPTED;RSVP=FALSE:mailto:carol@example.org` + "\r\n",
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(unfolded, expected) {
+			t.Errorf("calendar doesn't contain %q:\n%s", expected, ics)
+		}
+	}
+}
+
+func TestCalendarTimes(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip(err)
+	}
+	calendar := Calendar{
+		Method: CalendarMethodPublish,
+		Events: []CalendarEvent{
+			{UID: "utc", Start: time.Date(2024, time.May, 2, 8, 0, 0, 0, time.UTC)},
+			{UID: "all-day", Start: time.Date(2024, time.May, 2, 0, 0, 0, 0, tokyo), AllDay: true},
+			{UID: "tokyo", Start: time.Date(2024, time.May, 2, 9, 0, 0, 0, tokyo), End: time.Date(2024, time.May, 2, 10, 0, 0, 0, tokyo)},
+		},
+	}
+	data, err := calendar.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ics := string(data)
+	for _, expected := range []string{
+		"METHOD:PUBLISH\r\n",
+		"UID:utc\r\n",
+		"DTSTART:20240502T080000Z\r\n",
+		"DTSTART;VALUE=DATE:20240502\r\nDTEND;VALUE=DATE:20240503\r\n",
+		// time zones without daylight saving time have a single observance
+		"BEGIN:VTIMEZONE\r\nTZID:Asia/Tokyo\r\nBEGIN:STANDARD\r\nDTSTART:19700101T000000\r\nTZOFFSETFROM:+0900\r\nTZOFFSETTO:+0900\r\nTZNAME:JST\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\n",
+		"DTSTART;TZID=Asia/Tokyo:20240502T090000\r\n",
+	} {
+		if !strings.Contains(ics, expected) {
+			t.Errorf("calendar doesn't contain %q:\n%s", expected, ics)
+		}
+	}
+}
+
+func TestCalendarInvalid(t *testing.T) {
+	start := time.Date(2024, time.May, 2, 8, 0, 0, 0, time.UTC)
+	organizer := mail.Address{Address: "alice@example.com"}
+	calendars := []Calendar{
+		{},
+		{Events: []CalendarEvent{{Start: start, Organizer: organizer}}},
+		{Events: []CalendarEvent{{UID: "a", Organizer: organizer}}},
+		{Events: []CalendarEvent{{UID: "a", Start: start, End: start.Add(-time.Hour), Organizer: organizer}}},
+		{Method: CalendarMethodCancel, Events: []CalendarEvent{{UID: "a", Start: start}}},
+		// values which would inject properties
+		{Method: "REQUEST\r\nX-INJECTED:1", Events: []CalendarEvent{{UID: "a", Start: start, Organizer: organizer}}},
+		{Events: []CalendarEvent{{UID: "a", Start: start, Organizer: organizer, Status: "CONFIRMED\r\nX-INJECTED:1"}}},
+		{Events: []CalendarEvent{{UID: "a", Start: start, Organizer: organizer, RecurrenceRule: "FREQ=DAILY\nX-INJECTED:1"}}},
+		{Events: []CalendarEvent{{UID: "a", Start: start, Organizer: organizer, URL: "https://example.com/\r\nX-INJECTED:1"}}},
+		{Events: []CalendarEvent{{UID: "a", Start: start, Organizer: mail.Address{Address: "alice@example.com\r\nX-INJECTED:1"}}}},
+		{Events: []CalendarEvent{{UID: "a", Start: start, Organizer: organizer, Attendees: []CalendarAttendee{
+			{Address: mail.Address{Address: "bob@example.com\nX-INJECTED:1"}},
+		}}}},
+		{Events: []CalendarEvent{{UID: "a", Start: start, Organizer: organizer, Attendees: []CalendarAttendee{
+			{Address: mail.Address{Address: "bob@example.com"}, Role: "CHAIR;X-INJECTED=1"},
+		}}}},
+		{Events: []CalendarEvent{{UID: "a", Start: start, Organizer: organizer, Attendees: []CalendarAttendee{
+			{Address: mail.Address{Address: "bob@example.com"}, Status: "ACCEPTED\r\nX-INJECTED:1"},
+		}}}},
+	}
+	for _, calendar := range calendars {
+		if _, err := calendar.Bytes(); !errors.Is(err, ErrInvalidCalendar) {
+			t.Errorf("%+v: %v", calendar, err)
+		}
+	}
+}
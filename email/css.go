@@ -0,0 +1,525 @@
+package email
+
+import (
+	"sort"
+	"strings"
+)
+
+// cssDeclaration is a CSS property declaration, such as `color: red !important`
+type cssDeclaration struct {
+	Property  string
+	Value     string
+	Important bool
+}
+
+// cssRule is a style rule with a single selector, which can be inlined
+type cssRule struct {
+	Selector     cssSelector
+	Declarations []cssDeclaration
+	// Order is the position of the rule in the style sheets
+	Order int
+}
+
+// cssSelector is a complex selector: compound selectors separated by combinators, such as
+// `table.content > tr td`. Only the type, universal, class, id and attribute selectors, and the
+// descendant and child combinators are supported.
+type cssSelector struct {
+	// Compounds are in reverse order: the compound selector matching the element comes first
+	Compounds []cssCompoundSelector
+	// Combinators[i] is the combinator between Compounds[i] and Compounds[i+1]: ' ' or '>'
+	Combinators []byte
+	Specificity [3]int
+}
+
+type cssCompoundSelector struct {
+	// Tag is empty for the universal selector
+	Tag        string
+	ID         string
+	Classes    []string
+	Attributes []cssAttributeSelector
+}
+
+type cssAttributeSelector struct {
+	Name string
+	// Operator is "" (presence), "=", "~=", "^=", "$=" or "*="
+	Operator string
+	Value    string
+}
+
+// inlineCSS moves the rules of the <style> elements of document into the style attributes of
+// the elements they apply to, as many email clients ignore style sheets. The rules which can't
+// be inlined (at-rules such as @media, pseudo-classes...) are kept in their <style> element.
+func inlineCSS(document string) string {
+	tokens := tokenizeHTML(document)
+	var rules []cssRule
+	removedTokens := map[int]bool{}
+
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].Type != htmlStartTagToken || tokens[i].Name != "style" || tokens[i].SelfClosing {
+			continue
+		}
+		if media, ok := tokens[i].attribute("media"); ok && !strings.EqualFold(strings.TrimSpace(media), "all") &&
+			!strings.EqualFold(strings.TrimSpace(media), "screen") {
+			continue
+		}
+		styleSheet := ""
+		contentToken := -1
+		if i+1 < len(tokens) && tokens[i+1].Type == htmlTextToken {
+			contentToken = i + 1
+			styleSheet = tokens[i+1].Raw
+		}
+		var remaining string
+		rules, remaining = parseCSS(styleSheet, rules)
+		if strings.TrimSpace(remaining) != "" {
+			if contentToken >= 0 {
+				tokens[contentToken].Raw = remaining
+			}
+			continue
+		}
+		// remove the whole <style> element
+		removedTokens[i] = true
+		end := i + 1
+		if contentToken >= 0 {
+			removedTokens[contentToken] = true
+			end = contentToken + 1
+		}
+		if end < len(tokens) && tokens[end].Type == htmlEndTagToken && tokens[end].Name == "style" {
+			removedTokens[end] = true
+		}
+	}
+	if len(rules) == 0 {
+		return document
+	}
+
+	for _, element := range htmlElements(tokens) {
+		token := &tokens[element.Token]
+		if removedTokens[element.Token] || isInHTMLHead(tokens, element) {
+			continue
+		}
+		var matchingRules []cssRule
+		for _, rule := range rules {
+			if rule.Selector.matches(tokens, element) {
+				matchingRules = append(matchingRules, rule)
+			}
+		}
+		if len(matchingRules) == 0 {
+			continue
+		}
+		sort.SliceStable(matchingRules, func(i, j int) bool {
+			a, b := matchingRules[i].Selector.Specificity, matchingRules[j].Selector.Specificity
+			if a != b {
+				return a[0] < b[0] || a[0] == b[0] && (a[1] < b[1] || a[1] == b[1] && a[2] < b[2])
+			}
+			return matchingRules[i].Order < matchingRules[j].Order
+		})
+
+		// the cascade: declarations of the style attribute override the rules, but not the
+		// important declarations of the rules
+		var declarations []cssDeclaration
+		for _, rule := range matchingRules {
+			for _, declaration := range rule.Declarations {
+				if !declaration.Important {
+					declarations = append(declarations, declaration)
+				}
+			}
+		}
+		style, _ := token.attribute("style")
+		declarations = append(declarations, parseCSSDeclarations(style)...)
+		for _, rule := range matchingRules {
+			for _, declaration := range rule.Declarations {
+				if declaration.Important {
+					declarations = append(declarations, declaration)
+				}
+			}
+		}
+		token.setAttribute("style", formatCSSDeclarations(declarations))
+	}
+
+	var inlined strings.Builder
+	for i := range tokens {
+		if !removedTokens[i] {
+			inlined.WriteString(tokens[i].String())
+		}
+	}
+	return inlined.String()
+}
+
+// parseCSS appends the rules of styleSheet which can be inlined to rules, and returns the
+// remaining style sheet.
+func parseCSS(styleSheet string, rules []cssRule) ([]cssRule, string) {
+	styleSheet = removeCSSComments(styleSheet)
+	var remaining strings.Builder
+	for offset := 0; offset < len(styleSheet); {
+		rest := strings.TrimLeft(styleSheet[offset:], " \t\r\n\f")
+		offset = len(styleSheet) - len(rest)
+		if rest == "" {
+			break
+		}
+
+		if rest[0] == '@' {
+			// at-rules are kept as is
+			end := strings.IndexAny(rest, ";{")
+			if end >= 0 && rest[end] == '{' {
+				end = matchingCSSBrace(rest, end)
+			}
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			remaining.WriteString(rest[:end+1] + "\n")
+			offset += end + 1
+			continue
+		}
+
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			break
+		}
+		end := matchingCSSBrace(rest, open)
+		if end < 0 {
+			end = len(rest) - 1
+		}
+		block := rest[open+1 : end]
+		declarations := parseCSSDeclarations(block)
+		offset += end + 1
+
+		for _, selectorText := range strings.Split(rest[:open], ",") {
+			selectorText = strings.TrimSpace(selectorText)
+			if selectorText == "" {
+				continue
+			}
+			selector, ok := parseCSSSelector(selectorText)
+			if !ok {
+				remaining.WriteString(selectorText + " {" + block + "}\n")
+				continue
+			}
+			rules = append(rules, cssRule{Selector: selector, Declarations: declarations, Order: len(rules)})
+		}
+	}
+	return rules, remaining.String()
+}
+
+func removeCSSComments(styleSheet string) string {
+	var cleaned strings.Builder
+	for {
+		start := strings.Index(styleSheet, "/*")
+		if start < 0 {
+			cleaned.WriteString(styleSheet)
+			return cleaned.String()
+		}
+		cleaned.WriteString(styleSheet[:start])
+		end := strings.Index(styleSheet[start+2:], "*/")
+		if end < 0 {
+			return cleaned.String()
+		}
+		styleSheet = styleSheet[start+2+end+2:]
+	}
+}
+
+// matchingCSSBrace returns the index of the brace closing the one at open, or -1.
+func matchingCSSBrace(styleSheet string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(styleSheet); i++ {
+		c := styleSheet[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseCSSDeclarations(block string) []cssDeclaration {
+	var declarations []cssDeclaration
+	for _, declaration := range splitCSSDeclarations(block) {
+		colon := strings.IndexByte(declaration, ':')
+		if colon < 0 {
+			continue
+		}
+		property := strings.ToLower(strings.TrimSpace(declaration[:colon]))
+		value := strings.TrimSpace(declaration[colon+1:])
+		important := false
+		if bang := strings.LastIndexByte(value, '!'); bang >= 0 &&
+			strings.EqualFold(strings.TrimSpace(value[bang+1:]), "important") {
+			important = true
+			value = strings.TrimSpace(value[:bang])
+		}
+		if property == "" || value == "" {
+			continue
+		}
+		declarations = append(declarations, cssDeclaration{Property: property, Value: value, Important: important})
+	}
+	return declarations
+}
+
+// splitCSSDeclarations splits block on the semicolons which are not quoted or in parentheses,
+// such as in `background: url("a;b")`.
+func splitCSSDeclarations(block string) []string {
+	var declarations []string
+	var quote byte
+	depth := 0
+	start := 0
+	for i := 0; i < len(block); i++ {
+		c := block[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == ';' && depth == 0:
+			declarations = append(declarations, block[start:i])
+			start = i + 1
+		}
+	}
+	return append(declarations, block[start:])
+}
+
+// formatCSSDeclarations formats declarations as a style attribute. When a property is declared
+// several times, the last declaration wins.
+func formatCSSDeclarations(declarations []cssDeclaration) string {
+	var properties []string
+	values := map[string]cssDeclaration{}
+	for _, declaration := range declarations {
+		if _, ok := values[declaration.Property]; !ok {
+			properties = append(properties, declaration.Property)
+		}
+		values[declaration.Property] = declaration
+	}
+	formatted := make([]string, 0, len(properties))
+	for _, property := range properties {
+		declaration := values[property]
+		value := declaration.Value
+		if declaration.Important {
+			value += " !important"
+		}
+		formatted = append(formatted, property+": "+value)
+	}
+	return strings.Join(formatted, "; ")
+}
+
+// parseCSSSelector parses a complex selector. It returns false if the selector is not supported.
+func parseCSSSelector(text string) (cssSelector, bool) {
+	var selector cssSelector
+	var compounds []cssCompoundSelector
+	var combinators []byte
+	i := 0
+	for {
+		compound, next, ok := parseCSSCompoundSelector(text, i)
+		if !ok {
+			return selector, false
+		}
+		compounds = append(compounds, compound)
+		selector.Specificity[0] += boolToInt(compound.ID != "")
+		selector.Specificity[1] += len(compound.Classes) + len(compound.Attributes)
+		selector.Specificity[2] += boolToInt(compound.Tag != "")
+
+		i = next
+		combinator := byte(' ')
+		for i < len(text) && (isHTMLSpace(text[i]) || text[i] == '>') {
+			if text[i] == '>' {
+				combinator = '>'
+			}
+			i++
+		}
+		if i >= len(text) {
+			break
+		}
+		combinators = append(combinators, combinator)
+	}
+
+	// reverse the compounds, to match elements from the right
+	for left, right := 0, len(compounds)-1; left < right; left, right = left+1, right-1 {
+		compounds[left], compounds[right] = compounds[right], compounds[left]
+	}
+	for left, right := 0, len(combinators)-1; left < right; left, right = left+1, right-1 {
+		combinators[left], combinators[right] = combinators[right], combinators[left]
+	}
+	selector.Compounds = compounds
+	selector.Combinators = combinators
+	return selector, true
+}
+
+func parseCSSCompoundSelector(text string, i int) (cssCompoundSelector, int, bool) {
+	var compound cssCompoundSelector
+	start := i
+	if i < len(text) && text[i] == '*' {
+		i++
+	} else {
+		name, next := parseCSSIdentifier(text, i)
+		compound.Tag = strings.ToLower(name)
+		i = next
+	}
+	for i < len(text) && !isHTMLSpace(text[i]) && text[i] != '>' {
+		switch text[i] {
+		case '.':
+			name, next := parseCSSIdentifier(text, i+1)
+			if name == "" {
+				return compound, i, false
+			}
+			compound.Classes = append(compound.Classes, name)
+			i = next
+		case '#':
+			name, next := parseCSSIdentifier(text, i+1)
+			if name == "" || compound.ID != "" {
+				return compound, i, false
+			}
+			compound.ID = name
+			i = next
+		case '[':
+			end := strings.IndexByte(text[i:], ']')
+			if end < 0 {
+				return compound, i, false
+			}
+			attribute, ok := parseCSSAttributeSelector(text[i+1 : i+end])
+			if !ok {
+				return compound, i, false
+			}
+			compound.Attributes = append(compound.Attributes, attribute)
+			i += end + 1
+		default:
+			// pseudo-classes, pseudo-elements and the other combinators are not supported
+			return compound, i, false
+		}
+	}
+	return compound, i, i > start
+}
+
+func parseCSSAttributeSelector(text string) (cssAttributeSelector, bool) {
+	var attribute cssAttributeSelector
+	operator := strings.IndexByte(text, '=')
+	if operator < 0 {
+		attribute.Name = strings.ToLower(strings.TrimSpace(text))
+		return attribute, attribute.Name != ""
+	}
+	value := strings.TrimSpace(text[operator+1:])
+	if operator > 0 && strings.IndexByte("~^$*", text[operator-1]) >= 0 {
+		operator--
+	}
+	attribute.Name = strings.ToLower(strings.TrimSpace(text[:operator]))
+	attribute.Operator = strings.TrimSpace(text[operator : len(text)-len(value)])
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	attribute.Value = value
+	return attribute, attribute.Name != ""
+}
+
+func parseCSSIdentifier(text string, i int) (string, int) {
+	start := i
+	for i < len(text) {
+		c := text[i]
+		if !(isASCIILetter(c) || c >= '0' && c <= '9' || c == '-' || c == '_' || c >= 0x80) {
+			break
+		}
+		i++
+	}
+	return text[start:i], i
+}
+
+func (selector *cssSelector) matches(tokens []htmlToken, element *htmlElement) bool {
+	return selector.matchesFrom(tokens, element, 0)
+}
+
+// matchesFrom returns true if element matches the compound selector i, and its ancestors match
+// the following compound selectors.
+func (selector *cssSelector) matchesFrom(tokens []htmlToken, element *htmlElement, i int) bool {
+	if !selector.Compounds[i].matches(&tokens[element.Token]) {
+		return false
+	}
+	if i == len(selector.Compounds)-1 {
+		return true
+	}
+	if selector.Combinators[i] == '>' {
+		return element.Parent != nil && selector.matchesFrom(tokens, element.Parent, i+1)
+	}
+	for ancestor := element.Parent; ancestor != nil; ancestor = ancestor.Parent {
+		if selector.matchesFrom(tokens, ancestor, i+1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (compound *cssCompoundSelector) matches(token *htmlToken) bool {
+	if compound.Tag != "" && compound.Tag != token.Name {
+		return false
+	}
+	if compound.ID != "" {
+		if id, _ := token.attribute("id"); id != compound.ID {
+			return false
+		}
+	}
+	if len(compound.Classes) > 0 {
+		classAttribute, _ := token.attribute("class")
+		classes := strings.Fields(classAttribute)
+		for _, class := range compound.Classes {
+			if !containsString(classes, class) {
+				return false
+			}
+		}
+	}
+	for _, attribute := range compound.Attributes {
+		value, ok := token.attribute(attribute.Name)
+		if !ok {
+			return false
+		}
+		switch attribute.Operator {
+		case "=":
+			ok = value == attribute.Value
+		case "~=":
+			ok = containsString(strings.Fields(value), attribute.Value)
+		case "^=":
+			ok = attribute.Value != "" && strings.HasPrefix(value, attribute.Value)
+		case "$=":
+			ok = attribute.Value != "" && strings.HasSuffix(value, attribute.Value)
+		case "*=":
+			ok = attribute.Value != "" && strings.Contains(value, attribute.Value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func isInHTMLHead(tokens []htmlToken, element *htmlElement) bool {
+	for ; element != nil; element = element.Parent {
+		if tokens[element.Token].Name == "head" {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
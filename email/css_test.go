@@ -0,0 +1,61 @@
+package email
+
+import (
+	"testing"
+)
+
+func TestInlineCSS(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		expected string
+	}{
+		{
+			name:     "no style",
+			document: `<p class="a">text</p>`,
+			expected: `<p class="a">text</p>`,
+		},
+		{
+			name:     "specificity and order",
+			document: `<style>#id { color: red } p.a { color: blue; margin: 0 } p { color: green } .a { color: black }</style><p id="id" class="a">x</p><p class="a">y</p>`,
+			expected: `<p id="id" class="a" style="color: red; margin: 0">x</p><p class="a" style="color: blue; margin: 0">y</p>`,
+		},
+		{
+			name:     "style attribute and important",
+			document: `<style>p { color: red !important; margin: 0 }</style><p style="color: blue; margin: 1px">x</p>`,
+			expected: `<p style="margin: 1px; color: red !important">x</p>`,
+		},
+		{
+			name:     "combinators",
+			document: `<style>table td { padding: 0 } div > span { color: red }</style><table><tr><td>a</td></tr></table><div><span>b</span><p><span>c</span></p></div>`,
+			expected: `<table><tr><td style="padding: 0">a</td></tr></table><div><span style="color: red">b</span><p><span>c</span></p></div>`,
+		},
+		{
+			name:     "attribute selectors and selector lists",
+			document: `<style>a[href^="https"], [data-x] { color: red } a[target=_blank] { border: 0 }</style><a href="https://a" target="_blank">a</a><a href="http://b">b</a><i data-x>c</i>`,
+			expected: `<a href="https://a" target="_blank" style="color: red; border: 0">a</a><a href="http://b">b</a><i data-x="" style="color: red">c</i>`,
+		},
+		{
+			name:     "unsupported rules are kept",
+			document: `<style>/* comment */ a:hover { color: red } @media (max-width: 600px) { p { margin: 0 } } p { color: blue }</style><p>x</p>`,
+			expected: `<style>a:hover { color: red }` + "\n" + `@media (max-width: 600px) { p { margin: 0 } }` + "\n" + `</style><p style="color: blue">x</p>`,
+		},
+		{
+			name:     "quoted values",
+			document: `<style>p { font-family: "Helvetica Neue", Arial; background: url("a;b.png") }</style><p>x</p>`,
+			expected: `<p style="font-family: &#34;Helvetica Neue&#34;, Arial; background: url(&#34;a;b.png&#34;)">x</p>`,
+		},
+		{
+			name:     "print style sheets are ignored",
+			document: `<style media="print">p { color: red }</style><p>x</p>`,
+			expected: `<style media="print">p { color: red }</style><p>x</p>`,
+		},
+	}
+
+	for _, test := range tests {
+		inlined := inlineCSS(test.document)
+		if inlined != test.expected {
+			t.Errorf("%s:\n%s\nexpected:\n%s", test.name, inlined, test.expected)
+		}
+	}
+}
@@ -0,0 +1,606 @@
+package email
+
+import (
+	"bytes"
+	stdcrypto "crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloom42/gobox/crypto"
+)
+
+// DKIM canonicalization algorithms (RFC 6376 section 3.4)
+const (
+	DKIMCanonicalizationSimple  = "simple"
+	DKIMCanonicalizationRelaxed = "relaxed"
+)
+
+const (
+	dkimAlgorithmRSASHA256     = "rsa-sha256"
+	dkimAlgorithmEd25519SHA256 = "ed25519-sha256"
+	dkimSignatureHeader        = "DKIM-Signature"
+	dkimMaxLineLength          = 72
+)
+
+// DefaultDKIMHeaders are the headers signed by default, when present in the message.
+var DefaultDKIMHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-Id", "In-Reply-To", "References",
+	"MIME-Version", "Content-Type", "Content-Transfer-Encoding", "List-Unsubscribe",
+	"List-Unsubscribe-Post",
+}
+
+var (
+	// ErrDKIMNoSignature is returned by VerifyDKIM when the message is not signed.
+	ErrDKIMNoSignature = errors.New("email: no DKIM signature")
+
+	// ErrDKIMInvalidSignature is returned (wrapped) when a DKIM signature doesn't match the
+	// message, or is malformed.
+	ErrDKIMInvalidSignature = errors.New("email: invalid DKIM signature")
+)
+
+// DKIMOptions configures the DKIM signature of messages.
+type DKIMOptions struct {
+	// Domain is the signing domain (d= tag).
+	Domain string
+	// Selector is the selector of the public key (s= tag), published in the TXT record
+	// <Selector>._domainkey.<Domain>.
+	Selector string
+	// PrivateKey is a *rsa.PrivateKey (rsa-sha256), a crypto.Ed25519PrivateKey or an
+	// ed25519.PrivateKey (ed25519-sha256).
+	PrivateKey interface{}
+
+	// HeaderCanonicalization and BodyCanonicalization are DKIMCanonicalizationSimple or
+	// DKIMCanonicalizationRelaxed (the default).
+	HeaderCanonicalization string
+	BodyCanonicalization   string
+	// Headers are the headers to sign. Defaults to DefaultDKIMHeaders. From is always signed.
+	Headers []string
+	// Expiration, if not zero, sets the expiration of the signature (x= tag) after the signing
+	// time.
+	Expiration time.Duration
+}
+
+// DKIMRecord returns the content of the DNS TXT record to publish at
+// <selector>._domainkey.<domain> for the public key of privateKey.
+func DKIMRecord(privateKey interface{}) (string, error) {
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			return "", err
+		}
+		return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der), nil
+	case crypto.Ed25519PrivateKey:
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(key.Public()), nil
+	case ed25519.PrivateKey:
+		return DKIMRecord(crypto.Ed25519PrivateKey(key))
+	default:
+		return "", fmt.Errorf("email: unsupported DKIM private key type: %T", privateKey)
+	}
+}
+
+// SignDKIM signs message, in the format generated by `Email.Bytes`, and returns it with a
+// DKIM-Signature header prepended. Line endings are normalized to CRLF.
+func SignDKIM(message []byte, options DKIMOptions) ([]byte, error) {
+	var algorithm string
+	switch options.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		algorithm = dkimAlgorithmRSASHA256
+	case crypto.Ed25519PrivateKey, ed25519.PrivateKey:
+		algorithm = dkimAlgorithmEd25519SHA256
+	default:
+		return nil, fmt.Errorf("email: unsupported DKIM private key type: %T", options.PrivateKey)
+	}
+	if options.Domain == "" || options.Selector == "" {
+		return nil, errors.New("email: DKIM domain and selector are required")
+	}
+	headerCanonicalization, err := dkimCanonicalization(options.HeaderCanonicalization)
+	if err != nil {
+		return nil, err
+	}
+	bodyCanonicalization, err := dkimCanonicalization(options.BodyCanonicalization)
+	if err != nil {
+		return nil, err
+	}
+
+	message = normalizeCRLF(message)
+	headers, body, err := splitDKIMMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	headerNames := options.Headers
+	if headerNames == nil {
+		headerNames = DefaultDKIMHeaders
+	}
+	signedHeaderNames := []string{"From"}
+	for _, name := range headerNames {
+		if !strings.EqualFold(name, "From") && findDKIMHeader(headers, name) != "" {
+			signedHeaderNames = append(signedHeaderNames, name)
+		}
+	}
+	if findDKIMHeader(headers, "From") == "" {
+		return nil, errors.New("email: DKIM requires a From header")
+	}
+
+	bodyHash := sha256.Sum256(canonicalizeDKIMBody(body, bodyCanonicalization))
+	now := time.Now()
+	tags := []string{
+		"v=1",
+		"a=" + algorithm,
+		"c=" + headerCanonicalization + "/" + bodyCanonicalization,
+		"d=" + options.Domain,
+		"s=" + options.Selector,
+		"t=" + strconv.FormatInt(now.Unix(), 10),
+	}
+	if options.Expiration != 0 {
+		tags = append(tags, "x="+strconv.FormatInt(now.Add(options.Expiration).Unix(), 10))
+	}
+	tags = append(tags,
+		"h="+strings.ToLower(strings.Join(signedHeaderNames, ":")),
+		"bh="+base64.StdEncoding.EncodeToString(bodyHash[:]),
+		"b=",
+	)
+	signatureHeader := foldDKIMHeader(dkimSignatureHeader+": ", tags)
+
+	hash := dkimHeadersHash(headers, signedHeaderNames, signatureHeader, headerCanonicalization)
+	var signature []byte
+	switch key := options.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(crypto.RandReader(), key, stdcrypto.SHA256, hash)
+	case crypto.Ed25519PrivateKey:
+		signature, err = key.Sign(crypto.RandReader(), hash, stdcrypto.Hash(0))
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signedMessage := bytes.NewBufferString(signatureHeader)
+	signedMessage.WriteString(foldDKIMValue(base64.StdEncoding.EncodeToString(signature), len("b=")))
+	signedMessage.WriteString("\r\n")
+	signedMessage.Write(message)
+	return signedMessage.Bytes(), nil
+}
+
+// DKIMVerification is the result of the verification of a DKIM signature.
+type DKIMVerification struct {
+	Domain   string
+	Selector string
+	// Err is nil if the signature is valid.
+	Err error
+}
+
+// VerifyDKIM verifies the DKIM signatures of message. The public keys are retrieved with
+// lookupTXT, which defaults to net.LookupTXT. ErrDKIMNoSignature is returned if the message has
+// no DKIM signature.
+func VerifyDKIM(message []byte, lookupTXT func(name string) ([]string, error)) ([]DKIMVerification, error) {
+	if lookupTXT == nil {
+		lookupTXT = net.LookupTXT
+	}
+	message = normalizeCRLF(message)
+	headers, body, err := splitDKIMMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	var verifications []DKIMVerification
+	for i, header := range headers {
+		if !strings.EqualFold(dkimHeaderName(header), dkimSignatureHeader) {
+			continue
+		}
+		tags, err := parseDKIMTags(header[strings.IndexByte(header, ':')+1:])
+		verification := DKIMVerification{Domain: tags["d"], Selector: tags["s"]}
+		if err == nil {
+			otherHeaders := append(append([]string{}, headers[:i]...), headers[i+1:]...)
+			err = verifyDKIMSignature(header, tags, otherHeaders, body, lookupTXT)
+		}
+		verification.Err = err
+		verifications = append(verifications, verification)
+	}
+	if len(verifications) == 0 {
+		return nil, ErrDKIMNoSignature
+	}
+	return verifications, nil
+}
+
+func verifyDKIMSignature(signatureHeader string, tags map[string]string, headers []string, body []byte,
+	lookupTXT func(name string) ([]string, error)) error {
+	for _, tag := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if _, ok := tags[tag]; !ok {
+			return fmt.Errorf("%w: missing %s= tag", ErrDKIMInvalidSignature, tag)
+		}
+	}
+	if tags["v"] != "1" {
+		return fmt.Errorf("%w: unsupported version: %s", ErrDKIMInvalidSignature, tags["v"])
+	}
+	headerCanonicalization, bodyCanonicalization := DKIMCanonicalizationSimple, DKIMCanonicalizationSimple
+	if c, ok := tags["c"]; ok {
+		parts := strings.SplitN(c, "/", 2)
+		headerCanonicalization = parts[0]
+		if len(parts) == 2 {
+			bodyCanonicalization = parts[1]
+		}
+	}
+	if _, err := dkimCanonicalization(headerCanonicalization); err != nil {
+		return fmt.Errorf("%w: %s", ErrDKIMInvalidSignature, err)
+	}
+	if _, err := dkimCanonicalization(bodyCanonicalization); err != nil {
+		return fmt.Errorf("%w: %s", ErrDKIMInvalidSignature, err)
+	}
+	var signedHeaderNames []string
+	signsFrom := false
+	for _, name := range strings.Split(tags["h"], ":") {
+		name = strings.TrimSpace(name)
+		signedHeaderNames = append(signedHeaderNames, name)
+		signsFrom = signsFrom || strings.EqualFold(name, "From")
+	}
+	if !signsFrom {
+		return fmt.Errorf("%w: the From header is not signed", ErrDKIMInvalidSignature)
+	}
+	if expiration, ok := tags["x"]; ok {
+		timestamp, err := strconv.ParseInt(expiration, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: invalid x= tag", ErrDKIMInvalidSignature)
+		}
+		if time.Now().Unix() > timestamp {
+			return fmt.Errorf("%w: the signature has expired", ErrDKIMInvalidSignature)
+		}
+	}
+
+	canonicalBody := canonicalizeDKIMBody(body, bodyCanonicalization)
+	if length, ok := tags["l"]; ok {
+		bodyLength, err := strconv.Atoi(length)
+		if err != nil || bodyLength < 0 || bodyLength > len(canonicalBody) {
+			return fmt.Errorf("%w: invalid l= tag", ErrDKIMInvalidSignature)
+		}
+		canonicalBody = canonicalBody[:bodyLength]
+	}
+	bodyHash := sha256.Sum256(canonicalBody)
+	expectedBodyHash, err := base64.StdEncoding.DecodeString(removeDKIMWhitespace(tags["bh"]))
+	if err != nil || !bytes.Equal(bodyHash[:], expectedBodyHash) {
+		return fmt.Errorf("%w: the body hash doesn't match", ErrDKIMInvalidSignature)
+	}
+	signature, err := base64.StdEncoding.DecodeString(removeDKIMWhitespace(tags["b"]))
+	if err != nil {
+		return fmt.Errorf("%w: malformed b= tag", ErrDKIMInvalidSignature)
+	}
+
+	publicKey, err := lookupDKIMPublicKey(tags["s"], tags["d"], lookupTXT)
+	if err != nil {
+		return err
+	}
+	hash := dkimHeadersHash(headers, signedHeaderNames, removeDKIMSignatureValue(signatureHeader), headerCanonicalization)
+	switch tags["a"] {
+	case dkimAlgorithmRSASHA256:
+		rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: the key is not a RSA key", ErrDKIMInvalidSignature)
+		}
+		if err = rsa.VerifyPKCS1v15(rsaPublicKey, stdcrypto.SHA256, hash, signature); err != nil {
+			return fmt.Errorf("%w: %s", ErrDKIMInvalidSignature, err)
+		}
+	case dkimAlgorithmEd25519SHA256:
+		ed25519PublicKey, ok := publicKey.(crypto.Ed25519PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: the key is not an Ed25519 key", ErrDKIMInvalidSignature)
+		}
+		if valid, _ := ed25519PublicKey.Verify(hash, signature); !valid {
+			return fmt.Errorf("%w: the signature doesn't match", ErrDKIMInvalidSignature)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported algorithm: %s", ErrDKIMInvalidSignature, tags["a"])
+	}
+	return nil
+}
+
+func lookupDKIMPublicKey(selector, domain string, lookupTXT func(name string) ([]string, error)) (interface{}, error) {
+	records, err := lookupTXT(selector + "._domainkey." + domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: no DKIM key found for %s", ErrDKIMInvalidSignature, domain)
+	}
+	tags, err := parseDKIMTags(strings.Join(records, ""))
+	if err != nil {
+		return nil, err
+	}
+	if version, ok := tags["v"]; ok && version != "DKIM1" {
+		return nil, fmt.Errorf("%w: unsupported key record version: %s", ErrDKIMInvalidSignature, version)
+	}
+	data, err := base64.StdEncoding.DecodeString(removeDKIMWhitespace(tags["p"]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed public key", ErrDKIMInvalidSignature)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: the key has been revoked", ErrDKIMInvalidSignature)
+	}
+
+	switch keyType := tags["k"]; keyType {
+	case "", "rsa":
+		publicKey, err := x509.ParsePKIXPublicKey(data)
+		if err != nil {
+			if publicKey, err = x509.ParsePKCS1PublicKey(data); err != nil {
+				return nil, fmt.Errorf("%w: malformed RSA public key", ErrDKIMInvalidSignature)
+			}
+		}
+		return publicKey, nil
+	case "ed25519":
+		if len(data) != crypto.Ed25519PublicKeySize {
+			return nil, fmt.Errorf("%w: malformed Ed25519 public key", ErrDKIMInvalidSignature)
+		}
+		return crypto.Ed25519PublicKey(data), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type: %s", ErrDKIMInvalidSignature, keyType)
+	}
+}
+
+func dkimCanonicalization(canonicalization string) (string, error) {
+	switch canonicalization {
+	case "":
+		return DKIMCanonicalizationRelaxed, nil
+	case DKIMCanonicalizationSimple, DKIMCanonicalizationRelaxed:
+		return canonicalization, nil
+	default:
+		return "", fmt.Errorf("email: unsupported DKIM canonicalization: %s", canonicalization)
+	}
+}
+
+// normalizeCRLF converts the bare LF line endings to CRLF, as done by SMTP clients.
+func normalizeCRLF(message []byte) []byte {
+	normalized := make([]byte, 0, len(message))
+	for i, b := range message {
+		if b == '\n' && (i == 0 || message[i-1] != '\r') {
+			normalized = append(normalized, '\r')
+		}
+		normalized = append(normalized, b)
+	}
+	return normalized
+}
+
+// splitDKIMMessage returns the headers, including their continuation lines and CRLF, and the body
+// of message.
+func splitDKIMMessage(message []byte) (headers []string, body []byte, err error) {
+	end := bytes.Index(message, []byte("\r\n\r\n"))
+	if end < 0 {
+		if bytes.HasSuffix(message, []byte("\r\n")) {
+			end = len(message) - 2
+		} else {
+			return nil, nil, errors.New("email: malformed message: no end of headers")
+		}
+	} else {
+		body = message[end+4:]
+	}
+	for _, line := range strings.SplitAfter(string(message[:end+2]), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(headers) == 0 {
+				return nil, nil, errors.New("email: malformed message: continuation line without header")
+			}
+			headers[len(headers)-1] += line
+			continue
+		}
+		headers = append(headers, line)
+	}
+	return headers, body, nil
+}
+
+func dkimHeaderName(header string) string {
+	colon := strings.IndexByte(header, ':')
+	if colon < 0 {
+		return ""
+	}
+	return strings.TrimRight(header[:colon], " \t")
+}
+
+func findDKIMHeader(headers []string, name string) string {
+	for i := len(headers) - 1; i >= 0; i-- {
+		if strings.EqualFold(dkimHeaderName(headers[i]), name) {
+			return headers[i]
+		}
+	}
+	return ""
+}
+
+// dkimHeadersHash returns the hash of the signed headers and of the signature header (without
+// its b= value and trailing CRLF).
+func dkimHeadersHash(headers []string, signedHeaderNames []string, signatureHeader string, canonicalization string) []byte {
+	hash := sha256.New()
+	// each instance of a header name selects the next instance of the header, from the bottom
+	used := make(map[int]bool)
+	for _, name := range signedHeaderNames {
+		for i := len(headers) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(dkimHeaderName(headers[i]), name) {
+				used[i] = true
+				hash.Write([]byte(canonicalizeDKIMHeader(headers[i], canonicalization)))
+				break
+			}
+		}
+	}
+	canonicalSignature := canonicalizeDKIMHeader(signatureHeader, canonicalization)
+	hash.Write([]byte(strings.TrimSuffix(canonicalSignature, "\r\n")))
+	return hash.Sum(nil)
+}
+
+func canonicalizeDKIMHeader(header string, canonicalization string) string {
+	if canonicalization == DKIMCanonicalizationSimple {
+		return header
+	}
+	colon := strings.IndexByte(header, ':')
+	name := strings.ToLower(strings.TrimRight(header[:colon], " \t"))
+	value := strings.Replace(header[colon+1:], "\r\n", "", -1)
+	value = strings.Join(strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == '\t' }), " ")
+	return name + ":" + value + "\r\n"
+}
+
+func canonicalizeDKIMBody(body []byte, canonicalization string) []byte {
+	lines := strings.SplitAfter(string(body), "\r\n")
+	if canonicalization == DKIMCanonicalizationRelaxed {
+		for i, line := range lines {
+			hasCRLF := strings.HasSuffix(line, "\r\n")
+			line = strings.TrimSuffix(line, "\r\n")
+			var canonicalLine strings.Builder
+			previousWhitespace := false
+			for _, r := range line {
+				if r == ' ' || r == '\t' {
+					previousWhitespace = true
+					continue
+				}
+				if previousWhitespace {
+					canonicalLine.WriteByte(' ')
+				}
+				previousWhitespace = false
+				canonicalLine.WriteRune(r)
+			}
+			if hasCRLF {
+				canonicalLine.WriteString("\r\n")
+			}
+			lines[i] = canonicalLine.String()
+		}
+	}
+
+	canonicalBody := strings.Join(lines, "")
+	// remove the empty lines at the end of the body, and terminate the last line with CRLF
+	for strings.HasSuffix(canonicalBody, "\r\n\r\n") {
+		canonicalBody = strings.TrimSuffix(canonicalBody, "\r\n")
+	}
+	if canonicalBody == "\r\n" && canonicalization == DKIMCanonicalizationRelaxed {
+		canonicalBody = ""
+	}
+	if canonicalBody != "" && !strings.HasSuffix(canonicalBody, "\r\n") {
+		canonicalBody += "\r\n"
+	}
+	if canonicalBody == "" && canonicalization == DKIMCanonicalizationSimple {
+		canonicalBody = "\r\n"
+	}
+	return []byte(canonicalBody)
+}
+
+func parseDKIMTags(list string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(list, ";") {
+		tag = strings.TrimSpace(strings.Replace(tag, "\r\n", "", -1))
+		if tag == "" {
+			continue
+		}
+		parts := strings.SplitN(tag, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%w: malformed tag: %q", ErrDKIMInvalidSignature, tag)
+		}
+		name := strings.TrimSpace(parts[0])
+		if _, ok := tags[name]; ok {
+			return nil, fmt.Errorf("%w: duplicate tag: %s", ErrDKIMInvalidSignature, name)
+		}
+		tags[name] = strings.TrimSpace(parts[1])
+	}
+	return tags, nil
+}
+
+func removeDKIMWhitespace(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+// removeDKIMSignatureValue removes the value of the b= tag of a DKIM-Signature header,
+// including its whitespace.
+func removeDKIMSignatureValue(header string) string {
+	colon := strings.IndexByte(header, ':')
+	tags := strings.Split(header[colon+1:], ";")
+	for i, tag := range tags {
+		name := strings.SplitN(tag, "=", 2)[0]
+		if strings.TrimSpace(name) == "b" {
+			trailing := ""
+			if strings.HasSuffix(tag, "\r\n") && i == len(tags)-1 {
+				trailing = "\r\n"
+			}
+			tags[i] = tag[:strings.IndexByte(tag, '=')+1] + trailing
+		}
+	}
+	return header[:colon+1] + strings.Join(tags, ";")
+}
+
+// foldDKIMHeader formats the DKIM-Signature header with the given tags, folding lines longer
+// than dkimMaxLineLength.
+func foldDKIMHeader(prefix string, tags []string) string {
+	var header strings.Builder
+	header.WriteString(prefix)
+	lineLength := len(prefix)
+	for i, tag := range tags {
+		if i < len(tags)-1 {
+			tag += ";"
+		}
+		if lineLength > len(prefix) && lineLength+1+len(tag) > dkimMaxLineLength {
+			header.WriteString("\r\n ")
+			lineLength = 1
+		} else if i > 0 {
+			header.WriteString(" ")
+			lineLength++
+		}
+		header.WriteString(tag)
+		lineLength += len(tag)
+	}
+	return header.String()
+}
+
+// foldDKIMValue folds a base64 value starting at the given column.
+func foldDKIMValue(value string, column int) string {
+	var folded strings.Builder
+	for len(value) > 0 {
+		size := dkimMaxLineLength - column
+		if size > len(value) {
+			size = len(value)
+		}
+		folded.WriteString("\r\n ")
+		folded.WriteString(value[:size])
+		value = value[size:]
+		column = 1
+	}
+	return folded.String()
+}
+
+// DKIMTransport is a Transport which signs emails with DKIM before sending them with another
+// Transport.
+type DKIMTransport struct {
+	transport Transport
+	options   DKIMOptions
+}
+
+// NewDKIMTransport returns a new DKIMTransport which signs emails with options and sends them
+// with transport.
+func NewDKIMTransport(transport Transport, options DKIMOptions) *DKIMTransport {
+	return &DKIMTransport{
+		transport: transport,
+		options:   options,
+	}
+}
+
+// Send signs and sends the email.
+func (transport *DKIMTransport) Send(from string, to []string, message []byte) error {
+	signedMessage, err := SignDKIM(message, transport.options)
+	if err != nil {
+		return err
+	}
+	return transport.transport.Send(from, to, signedMessage)
+}
+
+// Close closes the underlying Transport.
+func (transport *DKIMTransport) Close() error {
+	return transport.transport.Close()
+}
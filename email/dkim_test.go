@@ -0,0 +1,240 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bloom42/gobox/crypto"
+)
+
+// RFC 8463 Appendix A
+const rfc8463Message = `DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;
+ d=football.example.com; i=@football.example.com;
+ q=dns/txt; s=brisbane; t=1528637909; h=from : to :
+ subject : date : message-id : from : subject : date;
+ bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;
+ b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus
+ Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==
+DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed;
+ d=football.example.com; i=@football.example.com;
+ q=dns/txt; s=test; t=1528637909; h=from : to : subject :
+ date : message-id : from : subject : date;
+ bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;
+ b=F45dVWDfMbQDGHJFlXUNB2HKfbCeLRyhDXgFpEL8GwpsRe0IeIixNTe3
+ DhCVlUrSjV4BwcVcOF6+FF3Zo9Rpo1tFOeS9mPYQTnGdaSGsgeefOsk2Jz
+ dA+L10TeYt9BgDfQNZtKdN1WO//KgIqXP7OdEFE4LjFYNcUxZQ4FADY+8=
+From: Joe SixPack <joe@football.example.com>
+To: Suzie Q <suzie@shopping.example.net>
+Subject: Is dinner ready?
+Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)
+Message-ID: <20030712040037.46341.5F8J@football.example.com>
+
+Hi.
+
+We lost the game.  Are you hungry yet?
+
+Joe.
+`
+
+var rfc8463Records = map[string]string{
+	"brisbane._domainkey.football.example.com": "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=",
+	"test._domainkey.football.example.com": "v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDkHlOQoBTzWRiGs5V6NpP3idY6Wk08a5qhd" +
+		"R6wy5bdOKb2jLQiY/J16JYi0Qvx/byYzCNb3W91y3FutACDfzwQ/BC/e/8uBsCR+yz1Lxj+PL6lHvqMKrM3rG4hstT5QjvHO9Pzox" +
+		"ZyVYLzBfO2EeC3Ip3G+2kryOTIKT+l/K4w3QIDAQAB",
+}
+
+func lookupTXTFromMap(records map[string]string) func(name string) ([]string, error) {
+	return func(name string) ([]string, error) {
+		record, ok := records[name]
+		if !ok {
+			return nil, errors.New("no such host")
+		}
+		// DNS TXT records are split in strings of at most 255 bytes
+		var strs []string
+		for len(record) > 255 {
+			strs = append(strs, record[:255])
+			record = record[255:]
+		}
+		return append(strs, record), nil
+	}
+}
+
+func TestVerifyDKIMRFC8463(t *testing.T) {
+	verifications, err := VerifyDKIM([]byte(rfc8463Message), lookupTXTFromMap(rfc8463Records))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifications) != 2 {
+		t.Fatalf("verifications: %+v", verifications)
+	}
+	for _, verification := range verifications {
+		if verification.Domain != "football.example.com" || verification.Err != nil {
+			t.Errorf("verification: %+v", verification)
+		}
+	}
+
+	tampered := strings.Replace(rfc8463Message, "Subject: Is dinner ready?", "Subject: Is lunch ready?", 1)
+	verifications, err = VerifyDKIM([]byte(tampered), lookupTXTFromMap(rfc8463Records))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, verification := range verifications {
+		if !errors.Is(verification.Err, ErrDKIMInvalidSignature) {
+			t.Errorf("tampered header: %+v", verification)
+		}
+	}
+}
+
+func TestSignDKIM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := crypto.GenerateEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := Email{
+		From:    mail.Address{Name: "Alice", Address: "alice@example.com"},
+		To:      []mail.Address{{Address: "bob@example.org"}},
+		Subject: "Hello   world, this is a long subject which will be folded",
+		Text:    []byte("hello world  \n\n\n"),
+		HTML:    []byte("<p>hello world</p>"),
+	}
+	message, err := email.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := map[string]interface{}{"rsa": rsaKey, "ed25519": ed25519Key}
+	canonicalizations := []string{DKIMCanonicalizationSimple, DKIMCanonicalizationRelaxed}
+	for keyName, key := range keys {
+		record, err := DKIMRecord(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lookupTXT := lookupTXTFromMap(map[string]string{"selector._domainkey.example.com": record})
+
+		for _, headerCanonicalization := range canonicalizations {
+			for _, bodyCanonicalization := range canonicalizations {
+				options := DKIMOptions{
+					Domain:                 "example.com",
+					Selector:               "selector",
+					PrivateKey:             key,
+					HeaderCanonicalization: headerCanonicalization,
+					BodyCanonicalization:   bodyCanonicalization,
+					Expiration:             time.Hour,
+				}
+				name := keyName + " " + headerCanonicalization + "/" + bodyCanonicalization
+				signed, err := SignDKIM(message, options)
+				if err != nil {
+					t.Fatalf("%s: %s", name, err)
+				}
+				signatureHeader := string(signed[:len(signed)-len(message)])
+				for _, line := range strings.Split(signatureHeader, "\r\n") {
+					if len(line) > 78 {
+						t.Errorf("%s: line too long: %q", name, line)
+					}
+				}
+
+				verifications, err := VerifyDKIM(signed, lookupTXT)
+				if err != nil || len(verifications) != 1 || verifications[0].Err != nil {
+					t.Errorf("%s: verifications: %+v, %v", name, verifications, err)
+				}
+
+				tampered := bytes.Replace(signed, []byte("bob@example.org"), []byte("eve@example.org"), 1)
+				verifications, err = VerifyDKIM(tampered, lookupTXT)
+				if err != nil || !errors.Is(verifications[0].Err, ErrDKIMInvalidSignature) {
+					t.Errorf("%s: tampered header: %+v, %v", name, verifications, err)
+				}
+				tampered = bytes.Replace(signed, []byte("<p>hello world</p>"), []byte("<p>hello w0rld</p>"), 1)
+				verifications, err = VerifyDKIM(tampered, lookupTXT)
+				if err != nil || !errors.Is(verifications[0].Err, ErrDKIMInvalidSignature) {
+					t.Errorf("%s: tampered body: %+v, %v", name, verifications, err)
+				}
+			}
+		}
+	}
+}
+
+func TestSignDKIMHeaders(t *testing.T) {
+	_, key, err := crypto.GenerateEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := DKIMRecord(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookupTXT := lookupTXTFromMap(map[string]string{"s._domainkey.example.com": record})
+	message := []byte("From: alice@example.com\nTo: bob@example.org\nX-Mailer: test\nSubject: hi\n\nhello\n")
+
+	signed, err := SignDKIM(message, DKIMOptions{
+		Domain:     "example.com",
+		Selector:   "s",
+		PrivateKey: key,
+		Headers:    []string{"Subject", "X-Mailer", "Cc"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(signed, []byte("h=from:subject:x-mailer;")) {
+		t.Errorf("signed headers: %s", signed)
+	}
+	// the To header is not signed
+	tampered := bytes.Replace(signed, []byte("bob@example.org"), []byte("eve@example.org"), 1)
+	verifications, err := VerifyDKIM(tampered, lookupTXT)
+	if err != nil || verifications[0].Err != nil {
+		t.Errorf("verifications: %+v, %v", verifications, err)
+	}
+	tampered = bytes.Replace(signed, []byte("X-Mailer: test"), []byte("X-Mailer: tset"), 1)
+	verifications, err = VerifyDKIM(tampered, lookupTXT)
+	if err != nil || verifications[0].Err == nil {
+		t.Errorf("tampered X-Mailer: %+v, %v", verifications, err)
+	}
+
+	if _, err = SignDKIM([]byte("To: bob@example.org\n\nhello\n"), DKIMOptions{Domain: "example.com", Selector: "s", PrivateKey: key}); err == nil {
+		t.Error("signing a message without From header should fail")
+	}
+	if _, err = VerifyDKIM(message, lookupTXT); err != ErrDKIMNoSignature {
+		t.Errorf("unsigned message: %v", err)
+	}
+}
+
+func TestDKIMTransport(t *testing.T) {
+	_, key, err := crypto.GenerateEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := DKIMRecord(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := NewSinkTransport()
+	mailer := NewMailerWithTransport(NewDKIMTransport(sink, DKIMOptions{Domain: "example.com", Selector: "s", PrivateKey: key}))
+	defer mailer.Close()
+
+	err = mailer.Send(Email{
+		From:    mail.Address{Address: "alice@example.com"},
+		To:      []mail.Address{{Address: "bob@example.org"}},
+		Subject: "Hello",
+		Text:    []byte("hello world"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := sink.Messages()
+	if len(messages) != 1 || !bytes.HasPrefix(messages[0].Message, []byte("DKIM-Signature: ")) {
+		t.Fatalf("messages: %+v", messages)
+	}
+	verifications, err := VerifyDKIM(messages[0].Message, lookupTXTFromMap(map[string]string{"s._domainkey.example.com": record}))
+	if err != nil || verifications[0].Err != nil {
+		t.Errorf("verifications: %+v, %v", verifications, err)
+	}
+}
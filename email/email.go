@@ -11,8 +11,8 @@ import (
 	"mime/multipart"
 	"mime/quotedprintable"
 	"net/mail"
-	"net/smtp"
 	"net/textproto"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -47,92 +47,163 @@ type Email struct {
 	HTML        []byte // Html message
 	Headers     textproto.MIMEHeader
 	Attachments []Attachment
+	// Calendar, if not nil, is sent as a text/calendar alternative of the message, for example to
+	// invite the recipients to an event
+	Calendar *Calendar
 	// ReadReceipt []string
 }
 
 // Bytes returns the content of the email in the bytes form
 func (email *Email) Bytes() ([]byte, error) {
 	buffer := bytes.NewBuffer([]byte{})
-	hasAttachements := len(email.Attachments) > 0
-	isAlternative := len(email.Text) > 0 && len(email.HTML) > 0
-	var multipartWriter *multipart.Writer
 
 	headers, err := email.headers()
 	if err != nil {
 		return nil, err
 	}
-
-	if hasAttachements || isAlternative {
-		multipartWriter = multipart.NewWriter(buffer)
-	}
-	switch {
-	case hasAttachements:
-		headers.Set("Content-Type", "multipart/mixed;\r\n boundary="+multipartWriter.Boundary())
-	case isAlternative:
-		headers.Set("Content-Type", "multipart/alternative;\r\n boundary="+multipartWriter.Boundary())
-	case len(email.HTML) > 0:
-		headers.Set("Content-Type", "text/html; charset=UTF-8")
-		headers.Set("Content-Transfer-Encoding", "quoted-printable")
-	default:
-		headers.Set("Content-Type", "text/plain; charset=UTF-8")
-		headers.Set("Content-Transfer-Encoding", "quoted-printable")
-	}
-	headersToBytes(buffer, headers)
-	_, err = io.WriteString(buffer, "\r\n")
+	root, err := email.mimeTree()
 	if err != nil {
 		return nil, err
 	}
+	if err = writeMIMEPart(buffer, root, nil, headers); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
 
-	// Check to see if there is a Text or HTML field
-	if len(email.Text) > 0 || len(email.HTML) > 0 {
-		var subWriter *multipart.Writer
+// mimePart is an entity of the MIME tree of an email
+type mimePart struct {
+	header textproto.MIMEHeader
+	// content is the content of leaf entities, encoded according to their
+	// Content-Transfer-Encoding header when written
+	content []byte
+	// multipartType is the subtype of multipart entities (mixed, alternative or related)
+	multipartType string
+	// multipartParams are the parameters of the Content-Type of multipart entities, in addition
+	// to the boundary
+	multipartParams string
+	parts           []*mimePart
+}
 
-		if hasAttachements && isAlternative {
-			// Create the multipart alternative part
-			subWriter = multipart.NewWriter(buffer)
-			header := textproto.MIMEHeader{
-				"Content-Type": {"multipart/alternative;\r\n boundary=" + subWriter.Boundary()},
-			}
-			if _, err := multipartWriter.CreatePart(header); err != nil {
-				return nil, err
-			}
+// mimeTree returns the MIME structure of the email:
+//
+//	multipart/mixed, if there are attachments
+//	  multipart/alternative, if there are several alternatives
+//	    text/plain
+//	    multipart/related, if there are inline attachments
+//	      text/html
+//	      inline attachments
+//	    text/calendar
+//	  attachments
+func (email *Email) mimeTree() (*mimePart, error) {
+	var alternatives []*mimePart
+	var attachments []*mimePart
+	var inlineAttachments []*mimePart
+
+	for i := range email.Attachments {
+		attachment := &mimePart{header: email.Attachments[i].header(), content: email.Attachments[i].Content}
+		if email.Attachments[i].ContentID != "" && len(email.HTML) > 0 {
+			inlineAttachments = append(inlineAttachments, attachment)
 		} else {
-			subWriter = multipartWriter
+			attachments = append(attachments, attachment)
 		}
-		// Create the body sections
-		if len(email.Text) > 0 {
-			// Write the text
-			if err := writeMessage(buffer, email.Text, hasAttachements || isAlternative, "text/plain", subWriter); err != nil {
-				return nil, err
-			}
-		}
-		if len(email.HTML) > 0 {
-			// Write the HTML
-			if err := writeMessage(buffer, email.HTML, hasAttachements || isAlternative, "text/html", subWriter); err != nil {
-				return nil, err
-			}
-		}
-		if hasAttachements && isAlternative {
-			if err := subWriter.Close(); err != nil {
-				return nil, err
+	}
+
+	if len(email.Text) > 0 {
+		alternatives = append(alternatives, newTextPart("text/plain", email.Text))
+	}
+	if len(email.HTML) > 0 {
+		htmlPart := newTextPart("text/html", email.HTML)
+		if len(inlineAttachments) > 0 {
+			htmlPart = &mimePart{
+				header:          textproto.MIMEHeader{},
+				multipartType:   "related",
+				multipartParams: `; type="text/html"`,
+				parts:           append([]*mimePart{htmlPart}, inlineAttachments...),
 			}
 		}
+		alternatives = append(alternatives, htmlPart)
 	}
-	// Create attachment part, if necessary
-	for _, a := range email.Attachments {
-		ap, err := multipartWriter.CreatePart(a.Header)
+	if email.Calendar != nil {
+		calendar, err := email.Calendar.Bytes()
 		if err != nil {
 			return nil, err
 		}
-		// Write the base64Wrapped content to the part
-		base64Wrap(ap, a.Content)
+		alternatives = append(alternatives, &mimePart{
+			header: textproto.MIMEHeader{
+				"Content-Type":              {"text/calendar; charset=UTF-8; method=" + email.Calendar.method()},
+				"Content-Transfer-Encoding": {"base64"},
+			},
+			content: calendar,
+		})
 	}
-	if hasAttachements || isAlternative {
-		if err := multipartWriter.Close(); err != nil {
-			return nil, err
+
+	var body *mimePart
+	switch len(alternatives) {
+	case 0:
+		if len(attachments) == 0 {
+			body = newTextPart("text/plain", nil)
+		}
+	case 1:
+		body = alternatives[0]
+	default:
+		body = &mimePart{header: textproto.MIMEHeader{}, multipartType: "alternative", parts: alternatives}
+	}
+	if len(attachments) > 0 {
+		parts := attachments
+		if body != nil {
+			parts = append([]*mimePart{body}, attachments...)
 		}
+		body = &mimePart{header: textproto.MIMEHeader{}, multipartType: "mixed", parts: parts}
 	}
-	return buffer.Bytes(), nil
+	return body, nil
+}
+
+func newTextPart(mediaType string, content []byte) *mimePart {
+	return &mimePart{
+		header: textproto.MIMEHeader{
+			"Content-Type":              {mediaType + "; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		},
+		content: content,
+	}
+}
+
+// writeMIMEPart writes part to buffer, as a part of parent if it's not nil, or as the root
+// entity of the email with the given headers.
+func writeMIMEPart(buffer *bytes.Buffer, part *mimePart, parent *multipart.Writer, headers textproto.MIMEHeader) error {
+	var multipartWriter *multipart.Writer
+	if part.multipartType != "" {
+		multipartWriter = multipart.NewWriter(buffer)
+		part.header.Set("Content-Type", "multipart/"+part.multipartType+part.multipartParams+
+			";\r\n boundary="+multipartWriter.Boundary())
+	}
+
+	if parent == nil {
+		for key, values := range part.header {
+			headers[key] = values
+		}
+		headersToBytes(buffer, headers)
+		if _, err := io.WriteString(buffer, "\r\n"); err != nil {
+			return err
+		}
+	} else if _, err := parent.CreatePart(part.header); err != nil {
+		return err
+	}
+
+	if multipartWriter == nil {
+		if part.header.Get("Content-Transfer-Encoding") == "quoted-printable" {
+			return writeQuotedPrintable(buffer, part.content)
+		}
+		base64Wrap(buffer, part.content)
+		return nil
+	}
+	for _, child := range part.parts {
+		if err := writeMIMEPart(buffer, child, multipartWriter, nil); err != nil {
+			return err
+		}
+	}
+	return multipartWriter.Close()
 }
 
 func (email *Email) headers() (textproto.MIMEHeader, error) {
@@ -173,22 +244,51 @@ func (email *Email) headers() (textproto.MIMEHeader, error) {
 // Based on the mime/multipart.FileHeader struct, Attachment contains the name, MIMEHeader, and content of the attachment in question
 type Attachment struct {
 	Filename string
-	Header   textproto.MIMEHeader
-	Content  []byte
+	// Header are the headers of the attachment part. The Content-Type (guessed from the extension
+	// of Filename) and Content-Disposition headers are set if missing.
+	Header  textproto.MIMEHeader
+	Content []byte
+	// ContentID, if not empty, makes the attachment an inline part of the HTML message, which can
+	// be referenced with "cid:<ContentID>", for example <img src="cid:logo@example.com">
+	ContentID string
 }
 
-// Mailer are used to send email
-type Mailer struct {
-	smtpAuth    smtp.Auth
-	smtpAddress string
+// header returns the headers of the attachment part
+func (attachment *Attachment) header() textproto.MIMEHeader {
+	header := textproto.MIMEHeader{}
+	for key, values := range attachment.Header {
+		header[key] = values
+	}
+	if header.Get("Content-Type") == "" {
+		contentType := mime.TypeByExtension(filepath.Ext(attachment.Filename))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header.Set("Content-Type", contentType)
+	}
+	if header.Get("Content-Disposition") == "" {
+		disposition := "attachment"
+		if attachment.ContentID != "" {
+			disposition = "inline"
+		}
+		if attachment.Filename != "" {
+			if withFilename := mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}); withFilename != "" {
+				disposition = withFilename
+			}
+		}
+		header.Set("Content-Disposition", disposition)
+	}
+	if attachment.ContentID != "" {
+		header.Set("Content-ID", "<"+attachment.ContentID+">")
+	}
+	// the content of attachments is always encoded with base64
+	header.Set("Content-Transfer-Encoding", "base64")
+	return header
 }
 
-// SMTPConfig is used to configure an email
-type SMTPConfig struct {
-	Host     string
-	Port     uint16
-	Username string
-	Password string
+// Mailer are used to send email
+type Mailer struct {
+	transport Transport
 }
 
 // Send an email
@@ -218,16 +318,22 @@ func (mailer *Mailer) Send(email Email) error {
 		toAddresses[i] = recipient.Address
 	}
 
-	return smtp.SendMail(mailer.smtpAddress, mailer.smtpAuth, email.From.Address, toAddresses, rawEmail)
+	return mailer.transport.Send(email.From.Address, toAddresses, rawEmail)
+}
+
+// Close closes the transport of the mailer.
+func (mailer *Mailer) Close() error {
+	return mailer.transport.Close()
 }
 
-// NewMailer returns a new mailer
+// NewMailer returns a new mailer sending emails with a SMTPTransport
 func NewMailer(config SMTPConfig) Mailer {
-	smtpAuth := smtp.PlainAuth("", config.Username, config.Password, config.Host)
-	return Mailer{
-		smtpAuth:    smtpAuth,
-		smtpAddress: fmt.Sprintf("%s:%d", config.Host, config.Port),
-	}
+	return NewMailerWithTransport(NewSMTPTransport(config))
+}
+
+// NewMailerWithTransport returns a new mailer sending emails with the given transport
+func NewMailerWithTransport(transport Transport) Mailer {
+	return Mailer{transport: transport}
 }
 
 // InitDefaultMailer set the default, global mailer
@@ -236,6 +342,13 @@ func InitDefaultMailer(config SMTPConfig) {
 	defaultMailer = &mailer
 }
 
+// InitDefaultMailerWithTransport set the default, global mailer, sending emails with the given
+// transport
+func InitDefaultMailerWithTransport(transport Transport) {
+	mailer := NewMailerWithTransport(transport)
+	defaultMailer = &mailer
+}
+
 // Send an email using the default mailer
 func Send(email Email) error {
 	if defaultMailer == nil {
@@ -291,20 +404,9 @@ func generateMessageID() (string, error) {
 	return msgid, nil
 }
 
-func writeMessage(buffer io.Writer, msg []byte, multipart bool, mediaType string, w *multipart.Writer) error {
-	if multipart {
-		header := textproto.MIMEHeader{
-			"Content-Type":              {mediaType + "; charset=UTF-8"},
-			"Content-Transfer-Encoding": {"quoted-printable"},
-		}
-		if _, err := w.CreatePart(header); err != nil {
-			return err
-		}
-	}
-
+func writeQuotedPrintable(buffer io.Writer, content []byte) error {
 	qp := quotedprintable.NewWriter(buffer)
-	// Write the text
-	if _, err := qp.Write(msg); err != nil {
+	if _, err := qp.Write(content); err != nil {
 		return err
 	}
 	return qp.Close()
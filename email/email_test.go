@@ -1,7 +1,15 @@
 package email
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestSendCompiles verifies that the email package compiles
@@ -12,3 +20,140 @@ func TestSendCompiles(t *testing.T) {
 	mail := Email{}
 	mailer.Send(mail)
 }
+
+// mimeStructure returns the structure of a MIME entity, such as
+// "multipart/alternative[text/plain,text/html]"
+func mimeStructure(t *testing.T, contentType string, body io.Reader) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return mediaType
+	}
+	var parts []string
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, mimeStructure(t, part.Header.Get("Content-Type"), part))
+	}
+	return mediaType + "[" + strings.Join(parts, ",") + "]"
+}
+
+func TestEmailBytesStructure(t *testing.T) {
+	logo := Attachment{Filename: "logo.png", Content: []byte("\x89PNG"), ContentID: "logo@example.com"}
+	document := Attachment{Filename: "document.pdf", Content: []byte("%PDF")}
+	calendar := &Calendar{Events: []CalendarEvent{{
+		UID:       "event@example.com",
+		Start:     time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC),
+		Organizer: mail.Address{Address: "from@example.com"},
+	}}}
+
+	tests := []struct {
+		email    Email
+		expected string
+	}{
+		{Email{Text: []byte("text")}, "text/plain"},
+		{Email{HTML: []byte("html")}, "text/html"},
+		{Email{Text: []byte("text"), HTML: []byte("html")}, "multipart/alternative[text/plain,text/html]"},
+		{
+			Email{Text: []byte("text"), Attachments: []Attachment{document}},
+			"multipart/mixed[text/plain,application/pdf]",
+		},
+		{
+			Email{HTML: []byte(`<img src="cid:logo@example.com">`), Attachments: []Attachment{logo}},
+			"multipart/related[text/html,image/png]",
+		},
+		{
+			// without HTML, inline attachments are regular attachments
+			Email{Text: []byte("text"), Attachments: []Attachment{logo}},
+			"multipart/mixed[text/plain,image/png]",
+		},
+		{
+			Email{Text: []byte("text"), Calendar: calendar},
+			"multipart/alternative[text/plain,text/calendar]",
+		},
+		{
+			Email{
+				Text:        []byte("text"),
+				HTML:        []byte(`<img src="cid:logo@example.com">`),
+				Attachments: []Attachment{logo, document},
+				Calendar:    calendar,
+			},
+			"multipart/mixed[multipart/alternative[text/plain,multipart/related[text/html,image/png],text/calendar],application/pdf]",
+		},
+	}
+
+	for _, test := range tests {
+		test.email.From = mail.Address{Address: "from@example.com"}
+		message, err := test.email.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := mail.ReadMessage(bytes.NewReader(message))
+		if err != nil {
+			t.Fatal(err)
+		}
+		structure := mimeStructure(t, parsed.Header.Get("Content-Type"), parsed.Body)
+		if structure != test.expected {
+			t.Errorf("structure: %s, expected: %s", structure, test.expected)
+		}
+	}
+}
+
+func TestEmailBytesInlineAttachment(t *testing.T) {
+	email := Email{
+		From: mail.Address{Address: "from@example.com"},
+		HTML: []byte(`<img src="cid:logo@example.com">`),
+		Attachments: []Attachment{
+			{Filename: "logo.png", Content: []byte("\x89PNG\r\n"), ContentID: "logo@example.com"},
+			{Filename: "résumé.pdf", Content: []byte("%PDF")},
+		},
+	}
+	message, err := email.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(bytes.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Attachments) != 2 {
+		t.Fatalf("attachments: %+v", parsed.Attachments)
+	}
+	inline := parsed.Attachments[0]
+	if inline.ContentID != "logo@example.com" || inline.Header.Get("Content-Type") != "image/png" ||
+		!strings.HasPrefix(inline.Header.Get("Content-Disposition"), "inline") ||
+		!bytes.Equal(inline.Content, email.Attachments[0].Content) {
+		t.Errorf("inline attachment: %+v", inline)
+	}
+	attachment := parsed.Attachments[1]
+	if attachment.ContentID != "" || attachment.Filename != "résumé.pdf" ||
+		!strings.HasPrefix(attachment.Header.Get("Content-Disposition"), "attachment") {
+		t.Errorf("attachment: %+v", attachment)
+	}
+
+	// the parsed email keeps its structure when sent again
+	message, err = parsed.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reparsed, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(reparsed.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	structure := mimeStructure(t, reparsed.Header.Get("Content-Type"), bytes.NewReader(body))
+	if structure != "multipart/mixed[multipart/related[text/html,image/png],application/pdf]" {
+		t.Errorf("structure: %s", structure)
+	}
+}
@@ -0,0 +1,21 @@
+// +build gofuzz
+
+package email
+
+import (
+	"bytes"
+)
+
+// Fuzz is the entrypoint of go-fuzz (https://github.com/dvyukov/go-fuzz) for Parse:
+//
+//	go-fuzz-build github.com/bloom42/gobox/email && go-fuzz -bin email-fuzz.zip
+func Fuzz(data []byte) int {
+	email, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	if _, err = email.Bytes(); err != nil {
+		panic(err)
+	}
+	return 1
+}
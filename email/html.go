@@ -0,0 +1,442 @@
+package email
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// This file contains a minimal HTML tokenizer, used to inline CSS and to convert HTML emails to
+// text. It is tolerant of malformed documents, but is not a complete HTML5 parser.
+
+type htmlTokenType int
+
+const (
+	htmlTextToken htmlTokenType = iota
+	htmlStartTagToken
+	htmlEndTagToken
+	// comments, doctypes and processing instructions
+	htmlCommentToken
+)
+
+type htmlAttribute struct {
+	Name  string
+	Value string
+}
+
+type htmlToken struct {
+	Type htmlTokenType
+	// Raw is the source of the token
+	Raw string
+	// Name is the lower case name of the tag of start and end tags
+	Name        string
+	Attributes  []htmlAttribute
+	SelfClosing bool
+}
+
+func (token *htmlToken) attribute(name string) (string, bool) {
+	for _, attribute := range token.Attributes {
+		if attribute.Name == name {
+			return attribute.Value, true
+		}
+	}
+	return "", false
+}
+
+func (token *htmlToken) setAttribute(name, value string) {
+	for i, attribute := range token.Attributes {
+		if attribute.Name == name {
+			token.Attributes[i].Value = value
+			return
+		}
+	}
+	token.Attributes = append(token.Attributes, htmlAttribute{Name: name, Value: value})
+}
+
+// String renders the token, from its name and attributes for tags.
+func (token *htmlToken) String() string {
+	if token.Type != htmlStartTagToken {
+		return token.Raw
+	}
+	var tag strings.Builder
+	tag.WriteString("<" + token.Name)
+	for _, attribute := range token.Attributes {
+		tag.WriteString(" " + attribute.Name + `="` + html.EscapeString(attribute.Value) + `"`)
+	}
+	if token.SelfClosing {
+		tag.WriteString(" /")
+	}
+	tag.WriteString(">")
+	return tag.String()
+}
+
+// htmlVoidElements are the elements which have no end tag
+var htmlVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true,
+	"wbr": true,
+}
+
+// htmlRawTextElements are the elements whose content is not parsed
+var htmlRawTextElements = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true,
+}
+
+func tokenizeHTML(document string) []htmlToken {
+	var tokens []htmlToken
+	for offset := 0; offset < len(document); {
+		token, next := nextHTMLToken(document, offset)
+		tokens = append(tokens, token)
+		offset = next
+
+		if token.Type == htmlStartTagToken && htmlRawTextElements[token.Name] && !token.SelfClosing {
+			end := indexFold(document[offset:], "</"+token.Name)
+			if end < 0 {
+				end = len(document) - offset
+			}
+			if end > 0 {
+				tokens = append(tokens, htmlToken{Type: htmlTextToken, Raw: document[offset : offset+end]})
+			}
+			offset += end
+		}
+	}
+	return tokens
+}
+
+func nextHTMLToken(document string, offset int) (htmlToken, int) {
+	rest := document[offset:]
+	if strings.HasPrefix(rest, "<!--") {
+		end := strings.Index(rest[4:], "-->")
+		if end < 0 {
+			return htmlToken{Type: htmlCommentToken, Raw: rest}, len(document)
+		}
+		return htmlToken{Type: htmlCommentToken, Raw: rest[:end+7]}, offset + end + 7
+	}
+	if strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?") {
+		end := strings.IndexByte(rest, '>')
+		if end < 0 {
+			return htmlToken{Type: htmlCommentToken, Raw: rest}, len(document)
+		}
+		return htmlToken{Type: htmlCommentToken, Raw: rest[:end+1]}, offset + end + 1
+	}
+	if strings.HasPrefix(rest, "</") && len(rest) > 2 && isASCIILetter(rest[2]) {
+		end := strings.IndexByte(rest, '>')
+		if end < 0 {
+			end = len(rest) - 1
+		}
+		name := rest[2:end]
+		if i := strings.IndexAny(name, " \t\r\n/"); i >= 0 {
+			name = name[:i]
+		}
+		return htmlToken{Type: htmlEndTagToken, Raw: rest[:end+1], Name: strings.ToLower(name)}, offset + end + 1
+	}
+	if strings.HasPrefix(rest, "<") && len(rest) > 1 && isASCIILetter(rest[1]) {
+		return parseHTMLStartTag(document, offset)
+	}
+
+	// text, until the next tag
+	end := strings.IndexByte(rest[1:], '<')
+	if end < 0 {
+		return htmlToken{Type: htmlTextToken, Raw: rest}, len(document)
+	}
+	return htmlToken{Type: htmlTextToken, Raw: rest[:end+1]}, offset + end + 1
+}
+
+func parseHTMLStartTag(document string, offset int) (htmlToken, int) {
+	token := htmlToken{Type: htmlStartTagToken}
+	i := offset + 1
+	start := i
+	for i < len(document) && !isHTMLSpace(document[i]) && document[i] != '>' && document[i] != '/' {
+		i++
+	}
+	token.Name = strings.ToLower(document[start:i])
+
+	for i < len(document) {
+		for i < len(document) && isHTMLSpace(document[i]) {
+			i++
+		}
+		if i >= len(document) {
+			break
+		}
+		if document[i] == '>' {
+			i++
+			token.Raw = document[offset:i]
+			return token, i
+		}
+		if document[i] == '/' {
+			i++
+			if i < len(document) && document[i] == '>' {
+				token.SelfClosing = true
+			}
+			continue
+		}
+
+		start = i
+		for i < len(document) && !isHTMLSpace(document[i]) && document[i] != '>' && document[i] != '=' &&
+			!(document[i] == '/' && i+1 < len(document) && document[i+1] == '>') {
+			i++
+		}
+		attribute := htmlAttribute{Name: strings.ToLower(document[start:i])}
+		for i < len(document) && isHTMLSpace(document[i]) {
+			i++
+		}
+		if i < len(document) && document[i] == '=' {
+			i++
+			for i < len(document) && isHTMLSpace(document[i]) {
+				i++
+			}
+			if i < len(document) && (document[i] == '"' || document[i] == '\'') {
+				quote := document[i]
+				end := strings.IndexByte(document[i+1:], quote)
+				if end < 0 {
+					end = len(document) - i - 1
+				}
+				attribute.Value = html.UnescapeString(document[i+1 : i+1+end])
+				i += end + 2
+			} else {
+				start = i
+				for i < len(document) && !isHTMLSpace(document[i]) && document[i] != '>' {
+					i++
+				}
+				attribute.Value = html.UnescapeString(document[start:i])
+			}
+		}
+		if attribute.Name != "" {
+			if _, exists := token.attribute(attribute.Name); !exists {
+				token.Attributes = append(token.Attributes, attribute)
+			}
+		}
+	}
+	if i > len(document) {
+		i = len(document)
+	}
+	token.Raw = document[offset:i]
+	return token, i
+}
+
+// htmlElement is an element of the tree of a tokenized document
+type htmlElement struct {
+	Parent *htmlElement
+	// Token is the index of the start tag of the element
+	Token int
+}
+
+// htmlElements returns the elements of the tokenized document, in document order. End tags
+// without matching start tags are ignored, and unclosed elements are closed by the end tag of
+// their parents.
+func htmlElements(tokens []htmlToken) []*htmlElement {
+	var elements []*htmlElement
+	var stack []*htmlElement
+	for i, token := range tokens {
+		switch token.Type {
+		case htmlStartTagToken:
+			var parent *htmlElement
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			element := &htmlElement{Parent: parent, Token: i}
+			elements = append(elements, element)
+			if !htmlVoidElements[token.Name] && !token.SelfClosing {
+				stack = append(stack, element)
+			}
+		case htmlEndTagToken:
+			for j := len(stack) - 1; j >= 0; j-- {
+				if tokens[stack[j].Token].Name == token.Name {
+					stack = stack[:j]
+					break
+				}
+			}
+		}
+	}
+	return elements
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// indexFold is strings.Index, ignoring the ASCII case.
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// htmlBlockElements are the elements which are rendered on their own lines by htmlToText, with
+// the number of line breaks separating them from the surrounding text.
+var htmlBlockElements = map[string]int{
+	"address": 1, "article": 1, "aside": 1, "center": 1, "dd": 1, "div": 1, "dl": 1, "dt": 1,
+	"figcaption": 1, "figure": 1, "footer": 1, "form": 1, "header": 1, "li": 1, "main": 1, "nav": 1,
+	"section": 1, "tr": 1,
+	"blockquote": 2, "h1": 2, "h2": 2, "h3": 2, "h4": 2, "h5": 2, "h6": 2, "hr": 2, "ol": 2, "p": 2,
+	"pre": 2, "table": 2, "ul": 2,
+}
+
+// htmlHiddenElements are the elements whose content is not rendered by htmlToText
+var htmlHiddenElements = map[string]bool{
+	"head": true, "script": true, "style": true, "template": true, "title": true,
+}
+
+// htmlTextWriter writes text, collapsing whitespace and line breaks
+type htmlTextWriter struct {
+	text strings.Builder
+	// pendingBreaks and pendingSpace are written before the next text
+	pendingBreaks int
+	pendingSpace  bool
+	// links are the texts of the links being written
+	links []*strings.Builder
+}
+
+func (writer *htmlTextWriter) writeText(text string, preformatted bool) {
+	if preformatted {
+		writer.writeString(text)
+		return
+	}
+	if text != "" && isHTMLSpace(text[0]) {
+		writer.pendingSpace = true
+	}
+	for i, word := range strings.Fields(text) {
+		if i > 0 {
+			writer.pendingSpace = true
+		}
+		writer.writeString(word)
+	}
+	if text != "" && isHTMLSpace(text[len(text)-1]) {
+		writer.pendingSpace = true
+	}
+}
+
+func (writer *htmlTextWriter) writeString(text string) {
+	if text == "" {
+		return
+	}
+	if writer.text.Len() > 0 {
+		if writer.pendingBreaks > 0 {
+			writer.text.WriteString(strings.Repeat("\n", writer.pendingBreaks))
+		} else if writer.pendingSpace {
+			writer.text.WriteString(" ")
+		}
+	}
+	writer.pendingBreaks = 0
+	writer.pendingSpace = false
+	writer.text.WriteString(text)
+	for _, link := range writer.links {
+		link.WriteString(text)
+	}
+}
+
+func (writer *htmlTextWriter) lineBreak(breaks int) {
+	if breaks > writer.pendingBreaks {
+		writer.pendingBreaks = breaks
+	}
+}
+
+// htmlToText converts an HTML document to a readable plain text alternative: the content of the
+// body is kept with its paragraphs, list items are prefixed, images are replaced by their alt
+// text and the targets of links are written after their text.
+func htmlToText(document string) string {
+	tokens := tokenizeHTML(document)
+	writer := &htmlTextWriter{}
+	var hidden []string
+	var lists []int // the index of the next item of ordered lists, or -1 for unordered lists
+	var links []string
+	preformatted := 0
+
+	for i := range tokens {
+		token := &tokens[i]
+		if len(hidden) > 0 {
+			switch {
+			case token.Type == htmlStartTagToken && token.Name == hidden[len(hidden)-1] && !token.SelfClosing:
+				hidden = append(hidden, token.Name)
+			case token.Type == htmlEndTagToken && token.Name == hidden[len(hidden)-1]:
+				hidden = hidden[:len(hidden)-1]
+			}
+			continue
+		}
+
+		switch token.Type {
+		case htmlTextToken:
+			writer.writeText(html.UnescapeString(token.Raw), preformatted > 0)
+
+		case htmlStartTagToken:
+			if htmlHiddenElements[token.Name] && !token.SelfClosing {
+				hidden = append(hidden, token.Name)
+				continue
+			}
+			writer.lineBreak(htmlBlockElements[token.Name])
+			switch token.Name {
+			case "br":
+				writer.text.WriteString("\n")
+				writer.pendingSpace = false
+			case "hr":
+				writer.writeString("----------")
+				writer.lineBreak(2)
+			case "pre":
+				preformatted++
+			case "ul":
+				lists = append(lists, -1)
+			case "ol":
+				lists = append(lists, 1)
+			case "li":
+				prefix := "- "
+				if len(lists) > 0 && lists[len(lists)-1] > 0 {
+					prefix = strconv.Itoa(lists[len(lists)-1]) + ". "
+					lists[len(lists)-1]++
+				}
+				if len(lists) > 1 {
+					prefix = strings.Repeat("  ", len(lists)-1) + prefix
+				}
+				writer.writeString(prefix)
+			case "td", "th":
+				writer.pendingSpace = true
+			case "img":
+				alt, _ := token.attribute("alt")
+				writer.writeText(alt, false)
+			case "a":
+				href, _ := token.attribute("href")
+				links = append(links, href)
+				writer.links = append(writer.links, &strings.Builder{})
+			}
+
+		case htmlEndTagToken:
+			switch token.Name {
+			case "pre":
+				if preformatted > 0 {
+					preformatted--
+				}
+			case "ul", "ol":
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+			case "a":
+				if len(links) > 0 {
+					href, text := links[len(links)-1], writer.links[len(writer.links)-1].String()
+					links, writer.links = links[:len(links)-1], writer.links[:len(writer.links)-1]
+					if href != "" && !strings.HasPrefix(href, "#") && !strings.HasPrefix(href, "cid:") &&
+						strings.TrimPrefix(href, "mailto:") != strings.TrimSpace(text) {
+						if text != "" {
+							writer.pendingSpace = true
+							writer.writeString("(" + href + ")")
+						} else {
+							writer.writeString(href)
+						}
+					}
+				}
+			}
+			writer.lineBreak(htmlBlockElements[token.Name])
+		}
+	}
+
+	lines := strings.Split(writer.text.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")) + "\n"
+}
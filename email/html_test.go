@@ -0,0 +1,46 @@
+package email
+
+import (
+	"testing"
+)
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		expected string
+	}{
+		{
+			name:     "document",
+			document: "<!DOCTYPE html><html><head><title>Title</title><style>p { color: red }</style></head><body><h1>Hello  &amp;\n welcome</h1><p>First<br>line</p><!-- comment --><p>Second</p></body></html>",
+			expected: "Hello & welcome\n\nFirst\nline\n\nSecond\n",
+		},
+		{
+			name:     "lists",
+			document: "<ul><li>one</li><li>two<ol><li>a</li><li>b</li></ol></li></ul><p>end</p>",
+			expected: "- one\n- two\n\n  1. a\n  2. b\n\nend\n",
+		},
+		{
+			name:     "links and images",
+			document: `<p><a href="https://example.com">Example</a> <a href="https://example.com/x">https://example.com/x</a> <a href="mailto:a@example.com">a@example.com</a> <a href="#top">top</a> <a href="https://example.com/logo"><img src="cid:logo" alt="Logo"></a> <a href="https://example.com/y"><img src="y.png"></a></p>`,
+			expected: "Example (https://example.com) https://example.com/x a@example.com top Logo (https://example.com/logo) https://example.com/y\n",
+		},
+		{
+			name:     "tables and rules",
+			document: "<table><tr><th>Item</th><th>Price</th></tr><tr><td>Book</td><td>10 €</td></tr></table><hr><pre>  keep\n   spaces</pre>",
+			expected: "Item Price\nBook 10 €\n\n----------\n\n  keep\n   spaces\n",
+		},
+		{
+			name:     "malformed",
+			document: "<p>unclosed <b>bold <i a='1' b=2 c>text</p> 1 < 2 <div",
+			expected: "unclosed bold text\n\n1 < 2\n",
+		},
+	}
+
+	for _, test := range tests {
+		text := htmlToText(test.document)
+		if text != test.expected {
+			t.Errorf("%s: %q, expected %q", test.name, text, test.expected)
+		}
+	}
+}
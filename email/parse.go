@@ -0,0 +1,417 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// maxMultipartDepth is the maximum nesting of multipart entities parsed by Parse. Deeper
+// entities are kept as attachments.
+const maxMultipartDepth = 20
+
+// ErrInvalidMessage is returned by Parse when the message has no header
+var ErrInvalidMessage = errors.New("email: invalid message: no header found")
+
+// parsedHeaders are the headers which are parsed into the fields of Email, and thus are not
+// copied to Email.Headers
+var parsedHeaders = map[string]bool{
+	"From":                      true,
+	"To":                        true,
+	"Cc":                        true,
+	"Bcc":                       true,
+	"Reply-To":                  true,
+	"Subject":                   true,
+	"Mime-Version":              true,
+	"Content-Type":              true,
+	"Content-Transfer-Encoding": true,
+	"Content-Disposition":       true,
+}
+
+// Parse parses a raw RFC 5322 message into an Email.
+//
+// Quoted-printable and base64 contents, as well as RFC 2047 encoded-word headers, are decoded.
+// Multipart entities are walked recursively: the first text/plain and text/html parts which are
+// not attachments become Text and HTML, and all the other parts become Attachments, with their
+// decoded Content and their Content-Type, Content-Disposition and Content-ID headers. The
+// ContentID of inline parts is set. The headers which don't map to a field of Email
+// (Date, Message-Id, In-Reply-To...) are kept, decoded, in Headers.
+//
+// Parse is tolerant of malformed messages: invalid header lines end the header, invalid
+// encodings are decoded on a best effort basis and truncated multipart entities are kept.
+// Text parts are converted to UTF-8 from the utf-8, us-ascii, iso-8859-1 and windows-1252
+// charsets, and are kept as is for the other charsets.
+func Parse(reader io.Reader) (*Email, error) {
+	message, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	header, body := parseHeader(message)
+	if len(header) == 0 {
+		return nil, ErrInvalidMessage
+	}
+
+	parser := newParser()
+	email := &Email{
+		ReplyTo: parser.parseAddressList(header.Get("Reply-To")),
+		To:      parser.parseAddressList(header.Get("To")),
+		Cc:      parser.parseAddressList(header.Get("Cc")),
+		Bcc:     parser.parseAddressList(header.Get("Bcc")),
+		Subject: parser.decodeHeader(header.Get("Subject")),
+		Headers: textproto.MIMEHeader{},
+	}
+	if from := parser.parseAddressList(header.Get("From")); len(from) > 0 {
+		email.From = from[0]
+	}
+	for key, values := range header {
+		if parsedHeaders[key] {
+			continue
+		}
+		for _, value := range values {
+			email.Headers.Add(key, parser.decodeHeader(value))
+		}
+	}
+
+	parser.email = email
+	parser.parseEntity(header, body, 0)
+	return email, nil
+}
+
+type parser struct {
+	email        *Email
+	wordDecoder  *mime.WordDecoder
+	addressParse *mail.AddressParser
+}
+
+func newParser() *parser {
+	wordDecoder := &mime.WordDecoder{
+		CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+			content, err := ioutil.ReadAll(input)
+			if err != nil {
+				return nil, err
+			}
+			return bytes.NewReader(decodeCharset(charset, content)), nil
+		},
+	}
+	return &parser{
+		wordDecoder:  wordDecoder,
+		addressParse: &mail.AddressParser{WordDecoder: wordDecoder},
+	}
+}
+
+func (parser *parser) parseEntity(header textproto.MIMEHeader, body []byte, depth int) {
+	mediaType, params := parseMediaType(header.Get("Content-Type"))
+	if mediaType == "" {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if params["boundary"] == "" {
+			// without boundary, the parts can't be found: the best we can do is to show the raw body
+			mediaType = "text/plain"
+		} else if depth < maxMultipartDepth {
+			for _, part := range splitMultipart(body, params["boundary"]) {
+				partHeader, partBody := parseHeader(part)
+				parser.parseEntity(partHeader, partBody, depth+1)
+			}
+			return
+		}
+	}
+
+	content := decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body)
+	disposition, dispositionParams := parseMediaType(header.Get("Content-Disposition"))
+	filename := parser.decodeHeader(dispositionParams["filename"])
+	if filename == "" {
+		filename = parser.decodeHeader(params["name"])
+	}
+
+	if disposition != "attachment" && filename == "" {
+		switch {
+		case mediaType == "text/plain" && parser.email.Text == nil:
+			parser.email.Text = decodeCharset(params["charset"], content)
+			return
+		case mediaType == "text/html" && parser.email.HTML == nil:
+			parser.email.HTML = decodeCharset(params["charset"], content)
+			return
+		}
+	}
+
+	attachmentHeader := textproto.MIMEHeader{}
+	if contentType := header.Get("Content-Type"); contentType != "" {
+		attachmentHeader.Set("Content-Type", contentType)
+	} else {
+		attachmentHeader.Set("Content-Type", mediaType)
+	}
+	if contentDisposition := header.Get("Content-Disposition"); contentDisposition != "" {
+		attachmentHeader.Set("Content-Disposition", contentDisposition)
+	}
+	attachment := Attachment{
+		Filename: filename,
+		Header:   attachmentHeader,
+		Content:  content,
+	}
+	if contentID := parser.decodeHeader(header.Get("Content-Id")); contentID != "" {
+		attachmentHeader.Set("Content-ID", contentID)
+		if disposition != "attachment" {
+			attachment.ContentID = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(contentID), "<"), ">")
+		}
+	}
+	parser.email.Attachments = append(parser.email.Attachments, attachment)
+}
+
+// decodeHeader decodes the RFC 2047 encoded-words of value. Line breaks are replaced by spaces,
+// so decoded values can't inject headers.
+func (parser *parser) decodeHeader(value string) string {
+	decoded, err := parser.wordDecoder.DecodeHeader(value)
+	if err != nil {
+		decoded = value
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return ' '
+		}
+		return r
+	}, decoded)
+}
+
+// parseAddressList parses list, skipping the invalid addresses.
+func (parser *parser) parseAddressList(list string) []mail.Address {
+	if strings.TrimSpace(list) == "" {
+		return nil
+	}
+	addresses, err := parser.addressParse.ParseList(list)
+	if err != nil {
+		// parse the addresses one by one, which fails for quoted display names containing commas
+		addresses = nil
+		for _, address := range strings.Split(list, ",") {
+			if parsedAddress, err := parser.addressParse.Parse(address); err == nil {
+				addresses = append(addresses, parsedAddress)
+			}
+		}
+	}
+	ret := make([]mail.Address, 0, len(addresses))
+	for _, address := range addresses {
+		ret = append(ret, *address)
+	}
+	return ret
+}
+
+// parseHeader parses the header of an entity and returns it with the body of the entity. Lines
+// which are neither a header field nor a continuation line end the header.
+func parseHeader(entity []byte) (textproto.MIMEHeader, []byte) {
+	header := textproto.MIMEHeader{}
+	var lastKey string
+	offset := 0
+	// skip the "From " line of mbox files
+	if bytes.HasPrefix(entity, []byte("From ")) {
+		offset = nextLine(entity, 0)
+	}
+	for offset < len(entity) {
+		next := nextLine(entity, offset)
+		line := bytes.TrimRight(entity[offset:next], "\r\n")
+		if len(line) == 0 {
+			return header, entity[next:]
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if lastKey != "" {
+				values := header[lastKey]
+				values[len(values)-1] = strings.TrimSpace(values[len(values)-1] + " " + string(bytes.TrimSpace(line)))
+			}
+			offset = next
+			continue
+		}
+		colon := bytes.IndexByte(line, ':')
+		if colon <= 0 {
+			break
+		}
+		key := string(bytes.TrimRight(line[:colon], " \t"))
+		if strings.ContainsAny(key, " \t") {
+			break
+		}
+		lastKey = textproto.CanonicalMIMEHeaderKey(key)
+		header.Add(lastKey, string(bytes.TrimSpace(line[colon+1:])))
+		offset = next
+	}
+	return header, entity[offset:]
+}
+
+// nextLine returns the offset of the line following the one starting at offset.
+func nextLine(data []byte, offset int) int {
+	end := bytes.IndexByte(data[offset:], '\n')
+	if end < 0 {
+		return len(data)
+	}
+	return offset + end + 1
+}
+
+// parseMediaType parses a Content-Type or Content-Disposition header, falling back to a lenient
+// parsing of the parameters when the header is invalid.
+func parseMediaType(value string) (string, map[string]string) {
+	mediaType, params, err := mime.ParseMediaType(value)
+	if err == nil {
+		return mediaType, params
+	}
+	parts := strings.Split(value, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(parts[0]))
+	params = map[string]string{}
+	for _, param := range parts[1:] {
+		keyValue := strings.SplitN(param, "=", 2)
+		if len(keyValue) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(keyValue[0]))
+		if _, ok := params[key]; !ok {
+			params[key] = strings.Trim(strings.TrimSpace(keyValue[1]), `"`)
+		}
+	}
+	return mediaType, params
+}
+
+// splitMultipart returns the parts of a multipart body. The preamble and the epilogue are
+// ignored, and the last part is kept if the close delimiter is missing.
+func splitMultipart(body []byte, boundary string) [][]byte {
+	delimiter := []byte("--" + boundary)
+	var parts [][]byte
+	start := -1
+	for offset := 0; offset < len(body); {
+		next := nextLine(body, offset)
+		line := bytes.TrimRight(body[offset:next], " \t\r\n")
+		if bytes.HasPrefix(line, delimiter) {
+			rest := line[len(delimiter):]
+			if len(rest) == 0 || bytes.Equal(rest, []byte("--")) {
+				if start >= 0 {
+					// the line break preceding the delimiter is part of the delimiter
+					end := offset
+					if end > start && body[end-1] == '\n' {
+						end--
+						if end > start && body[end-1] == '\r' {
+							end--
+						}
+					}
+					parts = append(parts, body[start:end])
+				}
+				if len(rest) != 0 {
+					return parts
+				}
+				start = next
+			}
+		}
+		offset = next
+	}
+	if start >= 0 && start < len(body) {
+		parts = append(parts, body[start:])
+	}
+	return parts
+}
+
+func decodeTransferEncoding(encoding string, content []byte) []byte {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return decodeBase64(content)
+	case "quoted-printable":
+		return decodeQuotedPrintable(content)
+	default:
+		return content
+	}
+}
+
+// decodeBase64 decodes content, ignoring the characters outside of the base64 alphabet and the
+// incomplete trailing characters.
+func decodeBase64(content []byte) []byte {
+	cleaned := make([]byte, 0, len(content))
+	for _, c := range content {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/' {
+			cleaned = append(cleaned, c)
+		} else if c == '=' {
+			break
+		}
+	}
+	if len(cleaned)%4 == 1 {
+		cleaned = cleaned[:len(cleaned)-1]
+	}
+	decoded := make([]byte, base64.RawStdEncoding.DecodedLen(len(cleaned)))
+	n, _ := base64.RawStdEncoding.Decode(decoded, cleaned)
+	return decoded[:n]
+}
+
+// decodeQuotedPrintable decodes content, keeping the invalid escape sequences as is.
+func decodeQuotedPrintable(content []byte) []byte {
+	decoded := make([]byte, 0, len(content))
+	for offset := 0; offset < len(content); {
+		next := nextLine(content, offset)
+		line := content[offset:next]
+		var lineBreak []byte
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			line, lineBreak = line[:len(line)-2], line[len(line)-2:]
+		} else if bytes.HasSuffix(line, []byte("\n")) {
+			line, lineBreak = line[:len(line)-1], line[len(line)-1:]
+		}
+		// trailing whitespace is added by transport and must be removed (RFC 2045 section 6.7)
+		line = bytes.TrimRight(line, " \t")
+		if bytes.HasSuffix(line, []byte("=")) {
+			// soft line break
+			line, lineBreak = line[:len(line)-1], nil
+		}
+
+		for i := 0; i < len(line); i++ {
+			if line[i] == '=' && i+2 < len(line) && isHexDigit(line[i+1]) && isHexDigit(line[i+2]) {
+				decoded = append(decoded, unhex(line[i+1])<<4|unhex(line[i+2]))
+				i += 2
+				continue
+			}
+			decoded = append(decoded, line[i])
+		}
+		decoded = append(decoded, lineBreak...)
+		offset = next
+	}
+	return decoded
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	default:
+		return c - '0'
+	}
+}
+
+// windows1252 are the characters of windows-1252 which differ from iso-8859-1 (0x80 to 0x9f).
+// The undefined characters are mapped to the unicode replacement character.
+var windows1252 = [32]rune{
+	'€', '\ufffd', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\ufffd', 'Ž', '\ufffd',
+	'\ufffd', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\ufffd', 'ž', 'Ÿ',
+}
+
+// decodeCharset converts content from charset to UTF-8. The contents with an unknown charset
+// are returned as is.
+func decodeCharset(charset string, content []byte) []byte {
+	var isWindows1252 bool
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "iso-8859-1", "iso8859-1", "latin1", "l1":
+	case "windows-1252", "cp1252":
+		isWindows1252 = true
+	default:
+		return content
+	}
+	decoded := make([]byte, 0, len(content))
+	for _, c := range content {
+		r := rune(c)
+		if isWindows1252 && c >= 0x80 && c < 0xa0 {
+			r = windows1252[c-0x80]
+		}
+		decoded = append(decoded, string(r)...)
+	}
+	return decoded
+}
@@ -0,0 +1,272 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+const testNestedMessage = `Return-Path: <bounces@example.com>
+From: =?UTF-8?Q?Andr=C3=A9_Pirard?= <andre@example.com>
+To: "Doe, John" <john@example.org>, jane@example.org
+Cc: invalid address, bob@example.org
+Subject: =?ISO-8859-1?B?SWYgeW91IGNhbiByZWFkIHRoaXMgeW8=?=
+ =?ISO-8859-2?B?dSB1bmRlcnN0YW5kIHRoZSBleGFtcGxlLg==?=
+Date: Fri, 11 Jul 2003 21:00:37 -0700
+Message-ID: <1234@example.com>
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="outer"
+
+This is the preamble.
+--outer
+Content-Type: multipart/related; boundary=related
+
+--related
+Content-Type: multipart/alternative; boundary="alternative"
+
+--alternative
+Content-Type: text/plain; charset=iso-8859-1
+Content-Transfer-Encoding: quoted-printable
+
+Caf=E9 cr=E8me, a long line which is soft=
+ broken.
+--alternative
+Content-Type: text/html; charset="utf-8"
+Content-Transfer-Encoding: base64
+
+PHA+Q2Fmw6kgPGltZyBzcmM9ImNpZDpsb2dvQGV4YW1wbGUuY29tIj48L3A+
+--alternative--
+--related
+Content-Type: image/png
+Content-Transfer-Encoding: base64
+Content-ID: <logo@example.com>
+Content-Disposition: inline
+
+iVBORw0KGgo=
+--related--
+--outer
+Content-Type: application/pdf; name="=?UTF-8?Q?r=C3=A9sum=C3=A9.pdf?="
+Content-Disposition: attachment
+Content-Transfer-Encoding: base64
+
+JVBERi0xLjQK
+--outer--
+This is the epilogue.
+`
+
+func TestParse(t *testing.T) {
+	email, err := Parse(strings.NewReader(testNestedMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if email.From.Name != "André Pirard" || email.From.Address != "andre@example.com" {
+		t.Errorf("From: %v", email.From)
+	}
+	expectedTo := []mail.Address{{Name: "Doe, John", Address: "john@example.org"}, {Address: "jane@example.org"}}
+	if len(email.To) != 2 || email.To[0] != expectedTo[0] || email.To[1] != expectedTo[1] {
+		t.Errorf("To: %v", email.To)
+	}
+	if len(email.Cc) != 1 || email.Cc[0].Address != "bob@example.org" {
+		t.Errorf("Cc: %v", email.Cc)
+	}
+	if email.Subject != "If you can read this you understand the example." {
+		t.Errorf("Subject: %q", email.Subject)
+	}
+	if email.Headers.Get("Message-Id") != "<1234@example.com>" || email.Headers.Get("Date") == "" {
+		t.Errorf("Headers: %v", email.Headers)
+	}
+	if email.Headers.Get("Content-Type") != "" || email.Headers.Get("From") != "" {
+		t.Errorf("parsed headers should not be kept in Headers: %v", email.Headers)
+	}
+
+	if string(email.Text) != "Café crème, a long line which is soft broken." {
+		t.Errorf("Text: %q", email.Text)
+	}
+	if string(email.HTML) != `<p>Café <img src="cid:logo@example.com"></p>` {
+		t.Errorf("HTML: %q", email.HTML)
+	}
+
+	if len(email.Attachments) != 2 {
+		t.Fatalf("Attachments: %+v", email.Attachments)
+	}
+	logo := email.Attachments[0]
+	if logo.Header.Get("Content-ID") != "<logo@example.com>" || logo.Header.Get("Content-Type") != "image/png" ||
+		!bytes.Equal(logo.Content, []byte("\x89PNG\r\n\x1a\n")) {
+		t.Errorf("inline attachment: %+v", logo)
+	}
+	if logo.ContentID != "logo@example.com" {
+		t.Errorf("ContentID: %q", logo.ContentID)
+	}
+	pdf := email.Attachments[1]
+	if pdf.Filename != "résumé.pdf" || string(pdf.Content) != "%PDF-1.4\n" {
+		t.Errorf("attachment: %+v", pdf)
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	email := Email{
+		From:    mail.Address{Name: "Zoë", Address: "zoe@example.com"},
+		To:      []mail.Address{{Name: "Jürgen", Address: "jurgen@example.org"}},
+		Subject: "Ünïcode subject",
+		Text:    []byte("héllo = world\r\n"),
+		HTML:    []byte("<p>héllo</p>"),
+		Attachments: []Attachment{{
+			Filename: "data.bin",
+			Header: map[string][]string{
+				"Content-Type":              {"application/octet-stream"},
+				"Content-Disposition":       {`attachment; filename="data.bin"`},
+				"Content-Transfer-Encoding": {"base64"},
+			},
+			Content: bytes.Repeat([]byte{0, 1, 2, 255}, 100),
+		}},
+	}
+	message, err := email.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(bytes.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.From != email.From || len(parsed.To) != 1 || parsed.To[0] != email.To[0] || parsed.Subject != email.Subject {
+		t.Errorf("headers: %+v", parsed)
+	}
+	if !bytes.Equal(parsed.Text, email.Text) || !bytes.Equal(parsed.HTML, email.HTML) {
+		t.Errorf("Text: %q, HTML: %q", parsed.Text, parsed.HTML)
+	}
+	if len(parsed.Attachments) != 1 || parsed.Attachments[0].Filename != "data.bin" ||
+		!bytes.Equal(parsed.Attachments[0].Content, email.Attachments[0].Content) {
+		t.Errorf("Attachments: %+v", parsed.Attachments)
+	}
+
+	// the parsed email can be sent again
+	if _, err = parsed.Bytes(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		text    string
+		html    string
+	}{
+		{
+			name:    "LF line endings and no Content-Type",
+			message: "From: a@example.com\nSubject: hello\n\nhello world\n",
+			text:    "hello world\n",
+		},
+		{
+			name:    "mbox From line and invalid header line",
+			message: "From a@example.com Fri Jul 11 21:00:37 2003\nFrom: a@example.com\nthis is the body\n",
+			text:    "this is the body\n",
+		},
+		{
+			name:    "invalid quoted-printable and charset",
+			message: "Content-Type: text/plain; charset=x-unknown\nContent-Transfer-Encoding: Quoted-Printable\n\n100% =ZZ =4\n",
+			text:    "100% =ZZ =4\n",
+		},
+		{
+			name:    "invalid base64",
+			message: "Content-Type: text/plain\nContent-Transfer-Encoding: base64\n\naGVs bG8g*\nd29y bGQ=\n===garbage",
+			text:    "hello world",
+		},
+		{
+			name:    "windows-1252",
+			message: "Content-Type: text/plain; charset=windows-1252\n\n\x93quoted\x94 \x80\n",
+			text:    "“quoted” €\n",
+		},
+		{
+			name:    "multipart without boundary",
+			message: "Content-Type: multipart/mixed\n\nraw body\n",
+			text:    "raw body\n",
+		},
+		{
+			name:    "truncated multipart and invalid Content-Type parameters",
+			message: "Content-Type: multipart/alternative; boundary=b; charset\n\n--b\nContent-Type: text/plain\n\ntext\n--b\nContent-Type: text/html\n\n<p>truncated",
+			text:    "text",
+			html:    "<p>truncated",
+		},
+		{
+			name:    "boundary prefix",
+			message: "Content-Type: multipart/mixed; boundary=b\n\n--b\n\ntext\n--bb\n--b--\n",
+			text:    "text\n--bb",
+		},
+	}
+
+	for _, test := range tests {
+		email, err := Parse(strings.NewReader(test.message))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if string(email.Text) != test.text || string(email.HTML) != test.html {
+			t.Errorf("%s: Text: %q, HTML: %q", test.name, email.Text, email.HTML)
+		}
+	}
+
+	if _, err := Parse(strings.NewReader("not an email")); err != ErrInvalidMessage {
+		t.Errorf("parsing a message without header: %v", err)
+	}
+
+	// decoded headers can't inject new headers when the email is serialized again
+	email, err := Parse(strings.NewReader("Subject: =?UTF-8?Q?hello=0D=0ABcc:_eve@example.com?=\n\nhello\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.ContainsAny(email.Subject, "\r\n") {
+		t.Errorf("Subject: %q", email.Subject)
+	}
+
+	// deeply nested multipart entities
+	var nested strings.Builder
+	nested.WriteString("Content-Type: multipart/mixed; boundary=b0\n\n")
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&nested, "--b%d\nContent-Type: multipart/mixed; boundary=b%d\n\n", i, i+1)
+	}
+	email, err = Parse(strings.NewReader(nested.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(email.Attachments) != 1 || !strings.HasPrefix(email.Attachments[0].Header.Get("Content-Type"), "multipart/mixed") {
+		t.Errorf("deeply nested entities should be kept as an attachment: %d attachments", len(email.Attachments))
+	}
+}
+
+// TestParseMutations parses randomly mutated messages, which must not panic. Fuzzing can be run
+// with go-fuzz, see Fuzz.
+func TestParseMutations(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	tokens := []string{"\n", "\r\n", "--", "--outer", "--alternative--", ":", ";", "=", "=?", "?=", "=?UTF-8?B?", " ", "\""}
+
+	for i := 0; i < 2000; i++ {
+		message := []byte(testNestedMessage)
+		for j := 0; j < 1+rng.Intn(10) && len(message) > 0; j++ {
+			position := rng.Intn(len(message))
+			switch rng.Intn(4) {
+			case 0:
+				message = append(message[:position], message[position+rng.Intn(len(message)-position):]...)
+			case 1:
+				message[position] = byte(rng.Intn(256))
+			case 2:
+				token := tokens[rng.Intn(len(tokens))]
+				message = append(message[:position], append([]byte(token), message[position:]...)...)
+			case 3:
+				message = message[:position]
+			}
+		}
+
+		email, err := Parse(bytes.NewReader(message))
+		if err != nil {
+			continue
+		}
+		if _, err = email.Bytes(); err != nil {
+			t.Errorf("serializing the parsed message %q: %s", message, err)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+package email
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSMode defines how a SMTPTransport secures its connections.
+type TLSMode int
+
+const (
+	// TLSOpportunistic upgrades the connection with STARTTLS if the server supports it, and
+	// sends the emails in clear text otherwise. It is the default.
+	TLSOpportunistic TLSMode = iota
+	// TLSRequireSTARTTLS upgrades the connection with STARTTLS, and fails if the server doesn't
+	// support it.
+	TLSRequireSTARTTLS
+	// TLSImplicit connects with TLS from the start (usually on port 465).
+	TLSImplicit
+	// TLSDisabled never uses TLS. It should only be used with local servers.
+	TLSDisabled
+)
+
+// SMTP authentication mechanisms
+const (
+	SMTPAuthPlain   = "PLAIN"
+	SMTPAuthLogin   = "LOGIN"
+	SMTPAuthCRAMMD5 = "CRAM-MD5"
+	SMTPAuthXOAuth2 = "XOAUTH2"
+)
+
+const (
+	defaultSMTPMaxConnections           = 4
+	defaultSMTPMaxMessagesPerConnection = 100
+	defaultSMTPIdleTimeout              = 30 * time.Second
+	defaultSMTPTimeout                  = 30 * time.Second
+)
+
+var (
+	// ErrSTARTTLSNotSupported is returned when TLSRequireSTARTTLS is used with a server which
+	// doesn't support STARTTLS.
+	ErrSTARTTLSNotSupported = errors.New("email: the SMTP server doesn't support STARTTLS")
+
+	// ErrTransportClosed is returned when sending an email with a closed Transport.
+	ErrTransportClosed = errors.New("email: transport is closed")
+)
+
+// SMTPConfig is used to configure an email
+type SMTPConfig struct {
+	Host     string
+	Port     uint16
+	Username string
+	Password string
+
+	// TLSMode defaults to TLSOpportunistic.
+	TLSMode TLSMode
+	// TLSConfig is used for implicit TLS and STARTTLS. Its ServerName defaults to Host.
+	TLSConfig *tls.Config
+
+	// AuthMechanism is one of SMTPAuthPlain, SMTPAuthLogin, SMTPAuthCRAMMD5 and SMTPAuthXOAuth2.
+	// By default, the first mechanism supported by the server among PLAIN, LOGIN and CRAM-MD5 is
+	// used, or XOAUTH2 if OAuth2Token is set. There is no authentication without Username.
+	AuthMechanism string
+	// OAuth2Token returns the OAuth2 access token used by XOAUTH2, instead of Password.
+	OAuth2Token func() (string, error)
+
+	// LocalName is the host name sent with EHLO. Defaults to "localhost".
+	LocalName string
+	// MaxConnections is the maximum number of connections opened at the same time. Defaults to 4.
+	MaxConnections int
+	// MaxMessagesPerConnection is the number of emails sent before a connection is renewed.
+	// Defaults to 100.
+	MaxMessagesPerConnection int
+	// IdleTimeout is the duration after which an idle connection is closed, in the background.
+	// Defaults to 30 seconds.
+	IdleTimeout time.Duration
+	// Timeout is the timeout of connecting, and of each email. Defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+// SMTPTransport is a Transport sending emails to a SMTP server. It keeps a pool of
+// authenticated connections, which are reused by the next emails.
+type SMTPTransport struct {
+	config  SMTPConfig
+	address string
+
+	slots  chan struct{}
+	mutex  sync.Mutex
+	idle   []*smtpConn
+	reaper *time.Timer
+	closed bool
+}
+
+type smtpConn struct {
+	conn     net.Conn
+	client   *smtp.Client
+	messages int
+	lastUsed time.Time
+}
+
+// NewSMTPTransport returns a new SMTPTransport. Connections are opened when sending emails.
+func NewSMTPTransport(config SMTPConfig) *SMTPTransport {
+	if config.LocalName == "" {
+		config.LocalName = "localhost"
+	}
+	if config.MaxConnections < 1 {
+		config.MaxConnections = defaultSMTPMaxConnections
+	}
+	if config.MaxMessagesPerConnection < 1 {
+		config.MaxMessagesPerConnection = defaultSMTPMaxMessagesPerConnection
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaultSMTPIdleTimeout
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultSMTPTimeout
+	}
+	if config.TLSConfig == nil {
+		config.TLSConfig = &tls.Config{}
+	}
+	config.TLSConfig = config.TLSConfig.Clone()
+	if config.TLSConfig.ServerName == "" {
+		config.TLSConfig.ServerName = config.Host
+	}
+
+	return &SMTPTransport{
+		config:  config,
+		address: net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port))),
+		slots:   make(chan struct{}, config.MaxConnections),
+	}
+}
+
+// Send sends an email, with a connection of the pool, or a new one if none is idle. It waits
+// if MaxConnections emails are being sent.
+func (transport *SMTPTransport) Send(from string, to []string, message []byte) error {
+	transport.slots <- struct{}{}
+	defer func() { <-transport.slots }()
+
+	conn, err := transport.getConn()
+	if err != nil {
+		return err
+	}
+
+	conn.conn.SetDeadline(time.Now().Add(transport.config.Timeout))
+	err = conn.send(from, to, message)
+	if err != nil {
+		// the connection can be reused after a rejection of the server. It is closed after other
+		// errors (network, timeout...), as its state is unknown
+		var protocolErr *textproto.Error
+		if !errors.As(err, &protocolErr) || conn.client.Reset() != nil {
+			conn.client.Close()
+			return err
+		}
+	}
+	conn.messages++
+	transport.putConn(conn)
+	return err
+}
+
+func (conn *smtpConn) send(from string, to []string, message []byte) error {
+	if err := conn.client.Mail(from); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err := conn.client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	writer, err := conn.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(message); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// getConn returns an idle connection, after checking that it is still alive, or a new one.
+func (transport *SMTPTransport) getConn() (*smtpConn, error) {
+	for {
+		transport.mutex.Lock()
+		if transport.closed {
+			transport.mutex.Unlock()
+			return nil, ErrTransportClosed
+		}
+		if len(transport.idle) == 0 {
+			transport.mutex.Unlock()
+			return transport.dial()
+		}
+		conn := transport.idle[len(transport.idle)-1]
+		transport.idle = transport.idle[:len(transport.idle)-1]
+		transport.mutex.Unlock()
+
+		if time.Since(conn.lastUsed) < transport.config.IdleTimeout {
+			conn.conn.SetDeadline(time.Now().Add(transport.config.Timeout))
+			if conn.client.Noop() == nil {
+				return conn, nil
+			}
+		}
+		conn.client.Close()
+	}
+}
+
+func (transport *SMTPTransport) putConn(conn *smtpConn) {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	if transport.closed || conn.messages >= transport.config.MaxMessagesPerConnection {
+		transport.quit(conn)
+		return
+	}
+	conn.lastUsed = time.Now()
+	transport.idle = append(transport.idle, conn)
+	if transport.reaper == nil {
+		transport.reaper = time.AfterFunc(transport.config.IdleTimeout, transport.closeIdleConns)
+	}
+}
+
+// closeIdleConns closes the connections which have been idle for IdleTimeout, and schedules
+// the next call while connections are idle.
+func (transport *SMTPTransport) closeIdleConns() {
+	transport.mutex.Lock()
+	var expired []*smtpConn
+	var next time.Duration
+	idle := transport.idle[:0]
+	for _, conn := range transport.idle {
+		remaining := transport.config.IdleTimeout - time.Since(conn.lastUsed)
+		if remaining <= 0 {
+			expired = append(expired, conn)
+			continue
+		}
+		if next == 0 || remaining < next {
+			next = remaining
+		}
+		idle = append(idle, conn)
+	}
+	for i := len(idle); i < len(transport.idle); i++ {
+		transport.idle[i] = nil
+	}
+	transport.idle = idle
+	transport.reaper = nil
+	if len(idle) != 0 && !transport.closed {
+		transport.reaper = time.AfterFunc(next, transport.closeIdleConns)
+	}
+	transport.mutex.Unlock()
+
+	for _, conn := range expired {
+		transport.quit(conn)
+	}
+}
+
+// quit ends the SMTP session of conn and closes it.
+func (transport *SMTPTransport) quit(conn *smtpConn) {
+	conn.conn.SetDeadline(time.Now().Add(transport.config.Timeout))
+	conn.client.Quit()
+	conn.client.Close()
+}
+
+func (transport *SMTPTransport) dial() (*smtpConn, error) {
+	config := transport.config
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	var conn net.Conn
+	var err error
+	if config.TLSMode == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", transport.address, config.TLSConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", transport.address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(config.Timeout))
+
+	client, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err = transport.setupClient(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &smtpConn{conn: conn, client: client}, nil
+}
+
+// setupClient secures the connection according to the TLS mode, and authenticates.
+func (transport *SMTPTransport) setupClient(client *smtp.Client) error {
+	config := transport.config
+	if err := client.Hello(config.LocalName); err != nil {
+		return err
+	}
+
+	if config.TLSMode == TLSOpportunistic || config.TLSMode == TLSRequireSTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(config.TLSConfig); err != nil {
+				return err
+			}
+		} else if config.TLSMode == TLSRequireSTARTTLS {
+			return ErrSTARTTLSNotSupported
+		}
+	}
+
+	if config.Username == "" {
+		return nil
+	}
+	_, mechanisms := client.Extension("AUTH")
+	auth, err := transport.auth(strings.Fields(mechanisms))
+	if err != nil {
+		return err
+	}
+	return client.Auth(auth)
+}
+
+func (transport *SMTPTransport) auth(serverMechanisms []string) (smtp.Auth, error) {
+	config := transport.config
+	mechanism := config.AuthMechanism
+	if mechanism == "" && config.OAuth2Token != nil {
+		mechanism = SMTPAuthXOAuth2
+	}
+	if mechanism == "" {
+		for _, supported := range []string{SMTPAuthPlain, SMTPAuthLogin, SMTPAuthCRAMMD5} {
+			for _, serverMechanism := range serverMechanisms {
+				if strings.EqualFold(serverMechanism, supported) {
+					mechanism = supported
+					break
+				}
+			}
+			if mechanism != "" {
+				break
+			}
+		}
+	}
+
+	switch mechanism {
+	case SMTPAuthPlain:
+		return smtp.PlainAuth("", config.Username, config.Password, config.Host), nil
+	case SMTPAuthLogin:
+		return &loginAuth{username: config.Username, password: config.Password, host: config.Host}, nil
+	case SMTPAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(config.Username, config.Password), nil
+	case SMTPAuthXOAuth2:
+		token := config.Password
+		if config.OAuth2Token != nil {
+			var err error
+			if token, err = config.OAuth2Token(); err != nil {
+				return nil, err
+			}
+		}
+		return &xoauth2Auth{username: config.Username, token: token, host: config.Host}, nil
+	case "":
+		return nil, fmt.Errorf("email: no supported SMTP authentication mechanism among: %s", strings.Join(serverMechanisms, " "))
+	default:
+		return nil, fmt.Errorf("email: unsupported SMTP authentication mechanism: %s", mechanism)
+	}
+}
+
+// Close closes the idle connections. The connections in use are closed once their email is sent.
+func (transport *SMTPTransport) Close() error {
+	transport.mutex.Lock()
+	idle := transport.idle
+	transport.idle = nil
+	transport.closed = true
+	if transport.reaper != nil {
+		transport.reaper.Stop()
+		transport.reaper = nil
+	}
+	transport.mutex.Unlock()
+
+	for _, conn := range idle {
+		transport.quit(conn)
+	}
+	return nil
+}
+
+// isLocalhost and checkSMTPAuthTLS mirror the checks of smtp.PlainAuth: credentials are
+// only sent over TLS, or to localhost.
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+func checkSMTPAuthTLS(server *smtp.ServerInfo, host string) error {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return errors.New("email: unencrypted connection")
+	}
+	if server.Name != host {
+		return errors.New("email: wrong host name")
+	}
+	return nil
+}
+
+// loginAuth implements the LOGIN authentication mechanism.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (auth *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if err := checkSMTPAuthTLS(server, auth.host); err != nil {
+		return "", nil, err
+	}
+	return SMTPAuthLogin, nil, nil
+}
+
+func (auth *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(auth.username), nil
+	case "password:":
+		return []byte(auth.password), nil
+	default:
+		return nil, fmt.Errorf("email: unexpected LOGIN challenge: %q", fromServer)
+	}
+}
+
+// xoauth2Auth implements the XOAUTH2 authentication mechanism of Google and Microsoft.
+type xoauth2Auth struct {
+	username, token, host string
+}
+
+func (auth *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if err := checkSMTPAuthTLS(server, auth.host); err != nil {
+		return "", nil, err
+	}
+	return SMTPAuthXOAuth2, []byte("user=" + auth.username + "\x01auth=Bearer " + auth.token + "\x01\x01"), nil
+}
+
+func (auth *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// the server sends a JSON error, and expects an empty response before failing
+		return []byte{}, nil
+	}
+	return nil, nil
+}
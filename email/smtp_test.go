@@ -0,0 +1,402 @@
+package email
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSMTPMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTPServer is a minimal SMTP server, supporting STARTTLS, implicit TLS and the PLAIN, LOGIN,
+// CRAM-MD5 and XOAUTH2 authentication mechanisms. It must be closed with Close.
+type fakeSMTPServer struct {
+	listener        net.Listener
+	tlsConfig       *tls.Config
+	startTLS        bool
+	authMechanisms  []string
+	username        string
+	password        string
+	rejectRecipient string
+
+	mutex       sync.Mutex
+	connections int
+	closed      int
+	messages    []fakeSMTPMessage
+}
+
+func newTestTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(certificate)
+	server = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client = &tls.Config{RootCAs: roots}
+	return
+}
+
+func startFakeSMTPServer(t *testing.T, server *fakeSMTPServer, implicitTLS bool) SMTPConfig {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var clientTLSConfig *tls.Config
+	if server.startTLS || implicitTLS {
+		server.tlsConfig, clientTLSConfig = newTestTLSConfigs(t)
+	}
+	if implicitTLS {
+		listener = tls.NewListener(listener, server.tlsConfig)
+	}
+	server.listener = listener
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mutex.Lock()
+			server.connections++
+			server.mutex.Unlock()
+			go server.serve(conn)
+		}
+	}()
+
+	return SMTPConfig{
+		Host:      "127.0.0.1",
+		Port:      uint16(listener.Addr().(*net.TCPAddr).Port),
+		Username:  server.username,
+		Password:  server.password,
+		TLSConfig: clientTLSConfig,
+		Timeout:   5 * time.Second,
+	}
+}
+
+func (server *fakeSMTPServer) serve(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		server.mutex.Lock()
+		server.closed++
+		server.mutex.Unlock()
+	}()
+	_, isTLS := conn.(*tls.Conn)
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP fake")
+	var message fakeSMTPMessage
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, argument := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			command, argument = line[:i], line[i+1:]
+		}
+
+		switch strings.ToUpper(command) {
+		case "EHLO":
+			lines := []string{"localhost"}
+			if server.startTLS && !isTLS {
+				lines = append(lines, "STARTTLS")
+			}
+			if len(server.authMechanisms) > 0 {
+				lines = append(lines, "AUTH "+strings.Join(server.authMechanisms, " "))
+			}
+			for _, extension := range lines[:len(lines)-1] {
+				text.PrintfLine("250-%s", extension)
+			}
+			text.PrintfLine("250 %s", lines[len(lines)-1])
+		case "STARTTLS":
+			text.PrintfLine("220 ready to start TLS")
+			conn = tls.Server(conn, server.tlsConfig)
+			text = textproto.NewConn(conn)
+			isTLS = true
+		case "AUTH":
+			if server.authenticate(text, argument) {
+				text.PrintfLine("235 authenticated")
+			} else {
+				text.PrintfLine("535 authentication failed")
+			}
+		case "MAIL":
+			message = fakeSMTPMessage{from: strings.Trim(strings.TrimPrefix(argument, "FROM:"), "<>")}
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			recipient := strings.Trim(strings.TrimPrefix(argument, "TO:"), "<>")
+			if recipient == server.rejectRecipient {
+				text.PrintfLine("550 no such user")
+				continue
+			}
+			message.to = append(message.to, recipient)
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := ioutil.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			message.data = string(data)
+			server.mutex.Lock()
+			server.messages = append(server.messages, message)
+			server.mutex.Unlock()
+			text.PrintfLine("250 OK")
+		case "RSET", "NOOP":
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func (server *fakeSMTPServer) authenticate(text *textproto.Conn, argument string) bool {
+	readResponse := func(challenge string) string {
+		text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+		line, _ := text.ReadLine()
+		response, _ := base64.StdEncoding.DecodeString(line)
+		return string(response)
+	}
+
+	parts := strings.SplitN(argument, " ", 2)
+	initialResponse := ""
+	if len(parts) == 2 {
+		decoded, _ := base64.StdEncoding.DecodeString(parts[1])
+		initialResponse = string(decoded)
+	}
+	switch parts[0] {
+	case SMTPAuthPlain:
+		return initialResponse == "\x00"+server.username+"\x00"+server.password
+	case SMTPAuthLogin:
+		username := readResponse("Username:")
+		password := readResponse("Password:")
+		return username == server.username && password == server.password
+	case SMTPAuthCRAMMD5:
+		challenge := "<1234.5678@localhost>"
+		response := readResponse(challenge)
+		mac := hmac.New(md5.New, []byte(server.password))
+		mac.Write([]byte(challenge))
+		return response == server.username+" "+hex.EncodeToString(mac.Sum(nil))
+	case SMTPAuthXOAuth2:
+		return initialResponse == "user="+server.username+"\x01auth=Bearer "+server.password+"\x01\x01"
+	}
+	return false
+}
+
+func (server *fakeSMTPServer) Close() {
+	server.listener.Close()
+}
+
+func (server *fakeSMTPServer) stats() (connections int, messages []fakeSMTPMessage) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.connections, append([]fakeSMTPMessage{}, server.messages...)
+}
+
+func TestSMTPTransportPool(t *testing.T) {
+	server := &fakeSMTPServer{startTLS: true, authMechanisms: []string{"PLAIN", "LOGIN"}, username: "user", password: "secret"}
+	config := startFakeSMTPServer(t, server, false)
+	defer server.Close()
+	config.TLSMode = TLSRequireSTARTTLS
+	config.MaxConnections = 2
+	transport := NewSMTPTransport(config)
+	defer transport.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := transport.Send("from@example.com", []string{"to@example.com"}, []byte("Subject: test\r\n\r\nhello\r\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	connections, messages := server.stats()
+	if connections != 1 || len(messages) != 3 {
+		t.Fatalf("%d connections, %d messages, expecting: 1, 3", connections, len(messages))
+	}
+	if messages[0].from != "from@example.com" || messages[0].to[0] != "to@example.com" || messages[0].data != "Subject: test\n\nhello\n" {
+		t.Errorf("message: %+v", messages[0])
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- transport.Send("from@example.com", []string{fmt.Sprintf("to%d@example.com", i)}, []byte("hello\r\n"))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	connections, messages = server.stats()
+	if connections > 2 || len(messages) != 23 {
+		t.Errorf("%d connections, %d messages, expecting: <= 2, 23", connections, len(messages))
+	}
+
+	transport.Close()
+	if err := transport.Send("from@example.com", []string{"to@example.com"}, []byte("hello\r\n")); err != ErrTransportClosed {
+		t.Errorf("sending with a closed transport: %v, expecting: %v", err, ErrTransportClosed)
+	}
+}
+
+func TestSMTPTransportMaxMessagesPerConnection(t *testing.T) {
+	server := &fakeSMTPServer{}
+	config := startFakeSMTPServer(t, server, false)
+	defer server.Close()
+	config.MaxMessagesPerConnection = 2
+	transport := NewSMTPTransport(config)
+	defer transport.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := transport.Send("from@example.com", []string{"to@example.com"}, []byte("hello\r\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if connections, _ := server.stats(); connections != 3 {
+		t.Errorf("%d connections, expecting: 3", connections)
+	}
+}
+
+func TestSMTPTransportIdleTimeout(t *testing.T) {
+	server := &fakeSMTPServer{}
+	config := startFakeSMTPServer(t, server, false)
+	defer server.Close()
+	config.IdleTimeout = 50 * time.Millisecond
+	transport := NewSMTPTransport(config)
+	defer transport.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := transport.Send("from@example.com", []string{"to@example.com"}, []byte("hello\r\n")); err != nil {
+			t.Fatal(err)
+		}
+		// the idle connection is closed without waiting for the next email
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			server.mutex.Lock()
+			closed := server.closed
+			server.mutex.Unlock()
+			if closed == i+1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%d connections closed, expecting: %d", closed, i+1)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if connections, _ := server.stats(); connections != 2 {
+		t.Errorf("%d connections, expecting: 2", connections)
+	}
+}
+
+func TestSMTPTransportRejectedRecipient(t *testing.T) {
+	server := &fakeSMTPServer{rejectRecipient: "unknown@example.com"}
+	transport := NewSMTPTransport(startFakeSMTPServer(t, server, false))
+	defer server.Close()
+	defer transport.Close()
+
+	err := transport.Send("from@example.com", []string{"unknown@example.com"}, []byte("hello\r\n"))
+	var protocolErr *textproto.Error
+	if !errors.As(err, &protocolErr) || protocolErr.Code != 550 {
+		t.Fatalf("%v, expecting: a 550 error", err)
+	}
+	if err = transport.Send("from@example.com", []string{"to@example.com"}, []byte("hello\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if connections, messages := server.stats(); connections != 1 || len(messages) != 1 {
+		t.Errorf("%d connections, %d messages, expecting: 1, 1", connections, len(messages))
+	}
+}
+
+func TestSMTPTransportTLSModes(t *testing.T) {
+	// no STARTTLS
+	server := &fakeSMTPServer{}
+	config := startFakeSMTPServer(t, server, false)
+	defer server.Close()
+	config.TLSMode = TLSRequireSTARTTLS
+	if err := NewSMTPTransport(config).Send("from@example.com", []string{"to@example.com"}, []byte("hello\r\n")); err != ErrSTARTTLSNotSupported {
+		t.Errorf("%v, expecting: %v", err, ErrSTARTTLSNotSupported)
+	}
+	config.TLSMode = TLSOpportunistic
+	if err := NewSMTPTransport(config).Send("from@example.com", []string{"to@example.com"}, []byte("hello\r\n")); err != nil {
+		t.Errorf("opportunistic TLS without STARTTLS: %v", err)
+	}
+
+	// implicit TLS
+	server = &fakeSMTPServer{authMechanisms: []string{"PLAIN"}, username: "user", password: "secret"}
+	config = startFakeSMTPServer(t, server, true)
+	defer server.Close()
+	config.TLSMode = TLSImplicit
+	if err := NewSMTPTransport(config).Send("from@example.com", []string{"to@example.com"}, []byte("hello\r\n")); err != nil {
+		t.Errorf("implicit TLS: %v", err)
+	}
+	config.TLSConfig = nil
+	if err := NewSMTPTransport(config).Send("from@example.com", []string{"to@example.com"}, []byte("hello\r\n")); err == nil {
+		t.Error("implicit TLS with an untrusted certificate should fail")
+	}
+}
+
+func TestSMTPTransportAuth(t *testing.T) {
+	for _, mechanism := range []string{SMTPAuthPlain, SMTPAuthLogin, SMTPAuthCRAMMD5, SMTPAuthXOAuth2} {
+		t.Run(mechanism, func(t *testing.T) {
+			server := &fakeSMTPServer{startTLS: true, authMechanisms: []string{mechanism}, username: "user", password: "secret"}
+			config := startFakeSMTPServer(t, server, false)
+			defer server.Close()
+			if mechanism == SMTPAuthXOAuth2 {
+				config.Password = ""
+				config.OAuth2Token = func() (string, error) { return "secret", nil }
+			}
+			if err := NewSMTPTransport(config).Send("from@example.com", []string{"to@example.com"}, []byte("hello\r\n")); err != nil {
+				t.Fatal(err)
+			}
+
+			config.Password = "wrong"
+			config.OAuth2Token = nil
+			config.AuthMechanism = mechanism
+			if err := NewSMTPTransport(config).Send("from@example.com", []string{"to@example.com"}, []byte("hello\r\n")); err == nil {
+				t.Error("authenticating with a wrong password should fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	templateExtension = ".html"
+	// templateLayoutName is the name of the layout template file, which includes the content of
+	// the emails with {{template "content" .}}
+	templateLayoutName = "layout"
+	// templatePartialsDir is the directory of the partial templates
+	templatePartialsDir = "partials"
+)
+
+// ErrTemplateNotFound is returned by Templates.Render when the requested template doesn't exist
+var ErrTemplateNotFound = errors.New("email: template not found")
+
+// TemplatesConfig is the configuration of Templates
+type TemplatesConfig struct {
+	// Dir is the directory containing the templates
+	Dir string
+	// DefaultLocale is the locale used when a template has no variant for the requested locale.
+	DefaultLocale string
+	// Funcs are added to the functions available in the templates
+	Funcs template.FuncMap
+}
+
+// Templates renders emails from a set of html/template templates. The templates directory is
+// organized as follows:
+//
+//	layout.html         the layout, optional, including the content with {{template "content" .}}
+//	partials/*.html     partials, included with {{template "<file name without .html>" .}}
+//	<name>.html         the content of the email <name> (without dots), with an optional
+//	                    {{define "subject"}}
+//	<name>.<locale>.html, layout.<locale>.html, partials/*.<locale>.html
+//	                    the variants for the given locale (for example "fr" or "pt-BR")
+//
+// For a given locale, the most specific variant of each file is used: the variant for the
+// locale, then for its language, then for the default locale, then the file without locale.
+//
+// The rendered HTML is post-processed: the CSS rules of <style> elements are inlined into the
+// style attributes of the elements, and a plain text alternative is generated.
+type Templates struct {
+	defaultLocale string
+	// templates are the parsed templates, by name and then by locale
+	templates map[string]map[string]*template.Template
+}
+
+// templateFile is a template file of the templates directory
+type templateFile struct {
+	// name is the path of the file, relative to the templates directory, without the locale and
+	// the extension
+	name    string
+	locale  string
+	content string
+}
+
+// NewTemplates loads and parses the templates of config.Dir
+func NewTemplates(config TemplatesConfig) (*Templates, error) {
+	// files by name and by locale
+	files := map[string]map[string]templateFile{}
+	locales := map[string]bool{"": true}
+	err := filepath.Walk(config.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != templateExtension {
+			return nil
+		}
+		relativePath, err := filepath.Rel(config.Dir, path)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		file := templateFile{
+			name:    filepath.ToSlash(strings.TrimSuffix(relativePath, templateExtension)),
+			content: string(content),
+		}
+		if dot := strings.LastIndexByte(file.name, '.'); dot > strings.LastIndexByte(file.name, '/') {
+			file.name, file.locale = file.name[:dot], normalizeLocale(file.name[dot+1:])
+		}
+		if files[file.name] == nil {
+			files[file.name] = map[string]templateFile{}
+		}
+		files[file.name][file.locale] = file
+		locales[file.locale] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var partials []string
+	for name := range files {
+		if strings.HasPrefix(name, templatePartialsDir+"/") {
+			partials = append(partials, name)
+		}
+	}
+	sort.Strings(partials)
+
+	templates := &Templates{
+		defaultLocale: normalizeLocale(config.DefaultLocale),
+		templates:     map[string]map[string]*template.Template{},
+	}
+	for name, variants := range files {
+		if name == templateLayoutName || strings.HasPrefix(name, templatePartialsDir+"/") {
+			continue
+		}
+		templates.templates[name] = map[string]*template.Template{}
+		for locale := range locales {
+			content, ok := templates.resolve(variants, locale)
+			if !ok {
+				continue
+			}
+			tmpl, err := template.New("content").Funcs(config.Funcs).Parse(content.content)
+			if err != nil {
+				return nil, err
+			}
+			if layout, ok := templates.resolve(files[templateLayoutName], locale); ok {
+				if _, err = tmpl.New(templateLayoutName).Parse(layout.content); err != nil {
+					return nil, err
+				}
+			}
+			for _, partialName := range partials {
+				partial, ok := templates.resolve(files[partialName], locale)
+				if !ok {
+					continue
+				}
+				if _, err = tmpl.New(strings.TrimPrefix(partialName, templatePartialsDir+"/")).Parse(partial.content); err != nil {
+					return nil, err
+				}
+			}
+			templates.templates[name][locale] = tmpl
+		}
+	}
+	return templates, nil
+}
+
+// Render renders the template name for locale with data, and returns an Email with the Subject,
+// HTML and Text fields set.
+func (templates *Templates) Render(name, locale string, data interface{}) (Email, error) {
+	var email Email
+	variants, ok := templates.templates[name]
+	if !ok {
+		return email, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	var tmpl *template.Template
+	for _, candidate := range templates.localeCandidates(locale) {
+		if tmpl, ok = variants[candidate]; ok {
+			break
+		}
+	}
+	if tmpl == nil {
+		return email, fmt.Errorf("%w: %s (%s)", ErrTemplateNotFound, name, locale)
+	}
+
+	var buffer bytes.Buffer
+	if subject := tmpl.Lookup("subject"); subject != nil {
+		if err := subject.Execute(&buffer, data); err != nil {
+			return email, err
+		}
+		email.Subject = strings.Join(strings.Fields(html.UnescapeString(buffer.String())), " ")
+		buffer.Reset()
+	}
+	body := tmpl
+	if layout := tmpl.Lookup(templateLayoutName); layout != nil {
+		body = layout
+	}
+	if err := body.Execute(&buffer, data); err != nil {
+		return email, err
+	}
+
+	document := inlineCSS(buffer.String())
+	email.HTML = []byte(document)
+	email.Text = []byte(htmlToText(document))
+	return email, nil
+}
+
+// resolve returns the most specific variant of a file for locale.
+func (templates *Templates) resolve(variants map[string]templateFile, locale string) (templateFile, bool) {
+	for _, candidate := range templates.localeCandidates(locale) {
+		if file, ok := variants[candidate]; ok {
+			return file, true
+		}
+	}
+	return templateFile{}, false
+}
+
+// localeCandidates returns the locales to try, in order, for locale.
+func (templates *Templates) localeCandidates(locale string) []string {
+	var candidates []string
+	for _, l := range []string{normalizeLocale(locale), templates.defaultLocale} {
+		if l == "" {
+			continue
+		}
+		candidates = append(candidates, l)
+		if dash := strings.IndexByte(l, '-'); dash > 0 {
+			candidates = append(candidates, l[:dash])
+		}
+	}
+	return append(candidates, "")
+}
+
+// normalizeLocale returns the lower case locale, with dashes (pt_BR -> pt-br)
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(locale), "_", "-", -1))
+}
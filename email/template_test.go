@@ -0,0 +1,118 @@
+package email
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type welcomeData struct {
+	App  string
+	Name string
+	URL  string
+}
+
+func TestTemplates(t *testing.T) {
+	templates, err := NewTemplates(TemplatesConfig{Dir: "testdata/templates", DefaultLocale: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := welcomeData{App: "Bloom & Co", Name: "<Zoë>", URL: "https://example.com/confirm?token=a&b=c"}
+
+	email, err := templates.Render("welcome", "en-US", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Subject != "Welcome to Bloom & Co, <Zoë>!" {
+		t.Errorf("Subject: %q", email.Subject)
+	}
+	html := string(email.HTML)
+	for _, expected := range []string{
+		"Hello &lt;Zoë&gt;,",
+		`<body style="font-family: Helvetica, Arial, sans-serif; color: #333333">`,
+		// the !important declaration overrides the style attribute
+		`style="background-color: #1a73e8; padding: 8px 16px; color: #ffffff !important"`,
+		// partial
+		`<p class="footer" style="margin: 0 0 16px; font-size: 12px">You received this email`,
+		// rules which can't be inlined are kept
+		"a:hover { text-decoration: underline; }",
+		"@media only screen and (max-width: 600px)",
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("HTML doesn't contain %q:\n%s", expected, html)
+		}
+	}
+	if strings.Contains(html, "p { margin") {
+		t.Errorf("inlined rules should be removed:\n%s", html)
+	}
+	expectedText := "Hello <Zoë>,\n\nThanks for signing up. Please confirm your email address:\n\n" +
+		"Confirm my email (https://example.com/confirm?token=a&b=c)\n\n" +
+		"You received this email because you signed up to Bloom & Co.\n"
+	if string(email.Text) != expectedText {
+		t.Errorf("Text: %q", email.Text)
+	}
+
+	// the fr variant is used for fr_CA, with the fr variant of the partial
+	email, err = templates.Render("welcome", "fr_CA", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Subject != "Bienvenue sur Bloom & Co, <Zoë> !" || !strings.Contains(string(email.Text), "Vous recevez cet email") {
+		t.Errorf("fr: %q\n%s", email.Subject, email.Text)
+	}
+
+	// the default locale is used for unknown locales
+	email, err = templates.Render("welcome", "de", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(email.Subject, "Welcome") {
+		t.Errorf("de: %q", email.Subject)
+	}
+
+	if _, err = templates.Render("unknown", "en", data); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("rendering an unknown template: %v", err)
+	}
+}
+
+func TestTemplatesWithoutLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "email-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "reset.fr.html"), []byte(`<p>{{ upper .Name }}</p>`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	templates, err := NewTemplates(TemplatesConfig{
+		Dir:   dir,
+		Funcs: map[string]interface{}{"upper": strings.ToUpper},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	email, err := templates.Render("reset", "fr", welcomeData{Name: "zoë"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Subject != "" || string(email.HTML) != "<p>ZOË</p>" || string(email.Text) != "ZOË\n" {
+		t.Errorf("email: %+v", email)
+	}
+	// there is no variant for the en locale, and no default locale
+	if _, err = templates.Render("reset", "en", welcomeData{}); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("rendering a missing locale: %v", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "invalid.html"), []byte(`{{ .Name `), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewTemplates(TemplatesConfig{Dir: dir}); err == nil {
+		t.Error("parsing an invalid template should fail")
+	}
+}
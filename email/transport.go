@@ -0,0 +1,87 @@
+package email
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Transport sends raw emails (as generated by `Email.Bytes`) to the given recipients.
+// Transports must be safe for concurrent use.
+type Transport interface {
+	Send(from string, to []string, message []byte) error
+	Close() error
+}
+
+// SinkMessage is an email received by a SinkTransport.
+type SinkMessage struct {
+	From    string
+	To      []string
+	Message []byte
+	Time    time.Time
+}
+
+// SinkTransport is a Transport which keeps the emails in memory, and optionally writes them to
+// a directory, instead of sending them. It should be used for tests and local development.
+type SinkTransport struct {
+	mutex    sync.Mutex
+	messages []SinkMessage
+	dir      string
+}
+
+// NewSinkTransport returns a new SinkTransport which keeps the emails in memory.
+func NewSinkTransport() *SinkTransport {
+	return &SinkTransport{}
+}
+
+// NewFileSinkTransport returns a new SinkTransport which also writes each email to dir, as a
+// .eml file which can be opened with a mail client.
+func NewFileSinkTransport(dir string) (*SinkTransport, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &SinkTransport{dir: dir}, nil
+}
+
+// Send stores the email.
+func (sink *SinkTransport) Send(from string, to []string, message []byte) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	sinkMessage := SinkMessage{
+		From:    from,
+		To:      append([]string{}, to...),
+		Message: append([]byte{}, message...),
+		Time:    time.Now(),
+	}
+	if sink.dir != "" {
+		fileName := fmt.Sprintf("%s-%04d.eml", sinkMessage.Time.UTC().Format("20060102T150405.000000000Z"), len(sink.messages)+1)
+		if err := ioutil.WriteFile(filepath.Join(sink.dir, fileName), message, 0600); err != nil {
+			return err
+		}
+	}
+	sink.messages = append(sink.messages, sinkMessage)
+	return nil
+}
+
+// Messages returns the emails sent so far, in order.
+func (sink *SinkTransport) Messages() []SinkMessage {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	return append([]SinkMessage{}, sink.messages...)
+}
+
+// Reset removes the emails kept in memory.
+func (sink *SinkTransport) Reset() {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.messages = nil
+}
+
+// Close does nothing.
+func (sink *SinkTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,53 @@
+package email
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSinkTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "email-sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sink, err := NewFileSinkTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailer := NewMailerWithTransport(sink)
+
+	err = mailer.Send(Email{
+		From:    mail.Address{Address: "from@example.com"},
+		To:      []mail.Address{{Address: "to@example.com"}},
+		Bcc:     []mail.Address{{Address: "bcc@example.com"}},
+		Subject: "Hello",
+		Text:    []byte("hello world"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := sink.Messages()
+	if len(messages) != 1 || messages[0].From != "from@example.com" || len(messages[0].To) != 2 {
+		t.Fatalf("messages: %+v", messages)
+	}
+	if !bytes.Contains(messages[0].Message, []byte("Subject: Hello\r\n")) {
+		t.Errorf("message: %s", messages[0].Message)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || !strings.HasSuffix(files[0].Name(), ".eml") {
+		t.Errorf("files: %v", files)
+	}
+
+	sink.Reset()
+	if len(sink.Messages()) != 0 {
+		t.Error("messages should be reset")
+	}
+}
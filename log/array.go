@@ -19,6 +19,7 @@ var arrayPool = &sync.Pool{
 type array struct {
 	buf             []byte
 	timeFieldFormat string
+	encoder         Encoder
 }
 
 func putArray(a *array) {
@@ -40,6 +41,7 @@ func (e *Event) arr() *array {
 	a := arrayPool.Get().(*array)
 	a.buf = a.buf[:0]
 	a.timeFieldFormat = e.timeFieldFormat
+	a.encoder = e.encoder
 	return a
 }
 
@@ -49,11 +51,11 @@ func (*array) MarshalLogArray(*array) {
 }
 
 func (a *array) write(dst []byte) []byte {
-	dst = enc.AppendArrayStart(dst)
+	dst = a.encoder.AppendArrayStart(dst)
 	if len(a.buf) > 0 {
 		dst = append(append(dst, a.buf...))
 	}
-	dst = enc.AppendArrayEnd(dst)
+	dst = a.encoder.AppendArrayEnd(dst)
 	putArray(a)
 	return dst
 }
@@ -61,30 +63,30 @@ func (a *array) write(dst []byte) []byte {
 // Object marshals an object that implement the ObjectMarshaler
 // interface and append append it to the array.
 func (a *array) Object(obj ObjectMarshaler) *array {
-	e := newDict()
+	e := newEvent(nil, 0, a.encoder)
 	e.timeFieldFormat = a.timeFieldFormat
 	obj.MarshalLogObject(e)
-	e.buf = enc.AppendEndMarker(e.buf)
-	a.buf = append(enc.AppendArrayDelim(a.buf), e.buf...)
+	e.buf = a.encoder.AppendEndMarker(e.buf)
+	a.buf = append(a.encoder.AppendArrayDelim(a.buf), e.buf...)
 	putEvent(e)
 	return a
 }
 
 // Str append append the val as a string to the array.
 func (a *array) Str(val string) *array {
-	a.buf = enc.AppendString(enc.AppendArrayDelim(a.buf), val)
+	a.buf = a.encoder.AppendString(a.encoder.AppendArrayDelim(a.buf), val)
 	return a
 }
 
 // Bytes append append the val as a string to the array.
 func (a *array) Bytes(val []byte) *array {
-	a.buf = enc.AppendBytes(enc.AppendArrayDelim(a.buf), val)
+	a.buf = a.encoder.AppendBytes(a.encoder.AppendArrayDelim(a.buf), val)
 	return a
 }
 
 // Hex append append the val as a hex string to the array.
 func (a *array) Hex(val []byte) *array {
-	a.buf = enc.AppendHex(enc.AppendArrayDelim(a.buf), val)
+	a.buf = a.encoder.AppendHex(a.encoder.AppendArrayDelim(a.buf), val)
 	return a
 }
 
@@ -93,17 +95,17 @@ func (a *array) Err(err error) *array {
 	marshaled := ErrorMarshalFunc(err)
 	switch m := marshaled.(type) {
 	case ObjectMarshaler:
-		e := newEvent(nil, 0)
+		e := newEvent(nil, 0, a.encoder)
 		e.buf = e.buf[:0]
 		e.appendObject(m)
-		a.buf = append(enc.AppendArrayDelim(a.buf), e.buf...)
+		a.buf = append(a.encoder.AppendArrayDelim(a.buf), e.buf...)
 		putEvent(e)
 	case error:
-		a.buf = enc.AppendString(enc.AppendArrayDelim(a.buf), m.Error())
+		a.buf = a.encoder.AppendString(a.encoder.AppendArrayDelim(a.buf), m.Error())
 	case string:
-		a.buf = enc.AppendString(enc.AppendArrayDelim(a.buf), m)
+		a.buf = a.encoder.AppendString(a.encoder.AppendArrayDelim(a.buf), m)
 	default:
-		a.buf = enc.AppendInterface(enc.AppendArrayDelim(a.buf), m)
+		a.buf = a.encoder.AppendInterface(a.encoder.AppendArrayDelim(a.buf), m)
 	}
 
 	return a
@@ -111,91 +113,91 @@ func (a *array) Err(err error) *array {
 
 // Bool append append the val as a bool to the array.
 func (a *array) Bool(b bool) *array {
-	a.buf = enc.AppendBool(enc.AppendArrayDelim(a.buf), b)
+	a.buf = a.encoder.AppendBool(a.encoder.AppendArrayDelim(a.buf), b)
 	return a
 }
 
 // Int append append i as a int to the array.
 func (a *array) Int(i int) *array {
-	a.buf = enc.AppendInt(enc.AppendArrayDelim(a.buf), i)
+	a.buf = a.encoder.AppendInt(a.encoder.AppendArrayDelim(a.buf), i)
 	return a
 }
 
 // Int8 append append i as a int8 to the array.
 func (a *array) Int8(i int8) *array {
-	a.buf = enc.AppendInt8(enc.AppendArrayDelim(a.buf), i)
+	a.buf = a.encoder.AppendInt8(a.encoder.AppendArrayDelim(a.buf), i)
 	return a
 }
 
 // Int16 append append i as a int16 to the array.
 func (a *array) Int16(i int16) *array {
-	a.buf = enc.AppendInt16(enc.AppendArrayDelim(a.buf), i)
+	a.buf = a.encoder.AppendInt16(a.encoder.AppendArrayDelim(a.buf), i)
 	return a
 }
 
 // Int32 append append i as a int32 to the array.
 func (a *array) Int32(i int32) *array {
-	a.buf = enc.AppendInt32(enc.AppendArrayDelim(a.buf), i)
+	a.buf = a.encoder.AppendInt32(a.encoder.AppendArrayDelim(a.buf), i)
 	return a
 }
 
 // Int64 append append i as a int64 to the array.
 func (a *array) Int64(i int64) *array {
-	a.buf = enc.AppendInt64(enc.AppendArrayDelim(a.buf), i)
+	a.buf = a.encoder.AppendInt64(a.encoder.AppendArrayDelim(a.buf), i)
 	return a
 }
 
 // Uint append append i as a uint to the array.
 func (a *array) Uint(i uint) *array {
-	a.buf = enc.AppendUint(enc.AppendArrayDelim(a.buf), i)
+	a.buf = a.encoder.AppendUint(a.encoder.AppendArrayDelim(a.buf), i)
 	return a
 }
 
 // Uint8 append append i as a uint8 to the array.
 func (a *array) Uint8(i uint8) *array {
-	a.buf = enc.AppendUint8(enc.AppendArrayDelim(a.buf), i)
+	a.buf = a.encoder.AppendUint8(a.encoder.AppendArrayDelim(a.buf), i)
 	return a
 }
 
 // Uint16 append append i as a uint16 to the array.
 func (a *array) Uint16(i uint16) *array {
-	a.buf = enc.AppendUint16(enc.AppendArrayDelim(a.buf), i)
+	a.buf = a.encoder.AppendUint16(a.encoder.AppendArrayDelim(a.buf), i)
 	return a
 }
 
 // Uint32 append append i as a uint32 to the array.
 func (a *array) Uint32(i uint32) *array {
-	a.buf = enc.AppendUint32(enc.AppendArrayDelim(a.buf), i)
+	a.buf = a.encoder.AppendUint32(a.encoder.AppendArrayDelim(a.buf), i)
 	return a
 }
 
 // Uint64 append append i as a uint64 to the array.
 func (a *array) Uint64(i uint64) *array {
-	a.buf = enc.AppendUint64(enc.AppendArrayDelim(a.buf), i)
+	a.buf = a.encoder.AppendUint64(a.encoder.AppendArrayDelim(a.buf), i)
 	return a
 }
 
 // Float32 append append f as a float32 to the array.
 func (a *array) Float32(f float32) *array {
-	a.buf = enc.AppendFloat32(enc.AppendArrayDelim(a.buf), f)
+	a.buf = a.encoder.AppendFloat32(a.encoder.AppendArrayDelim(a.buf), f)
 	return a
 }
 
 // Float64 append append f as a float64 to the array.
 func (a *array) Float64(f float64) *array {
-	a.buf = enc.AppendFloat64(enc.AppendArrayDelim(a.buf), f)
+	a.buf = a.encoder.AppendFloat64(a.encoder.AppendArrayDelim(a.buf), f)
 	return a
 }
 
 // Time append append t formated as string using log.TimeFieldFormat.
 func (a *array) Time(t time.Time) *array {
-	a.buf = enc.AppendTime(enc.AppendArrayDelim(a.buf), t, a.timeFieldFormat)
+	a.buf = a.encoder.AppendTime(a.encoder.AppendArrayDelim(a.buf), t, a.timeFieldFormat)
 	return a
 }
 
 // Dur append append d to the array.
 func (a *array) Dur(d time.Duration) *array {
-	a.buf = enc.AppendDuration(enc.AppendArrayDelim(a.buf), d, DurationFieldUnit, DurationFieldInteger)
+	a.buf = a.encoder.AppendDuration(a.encoder.AppendArrayDelim(a.buf), d, DurationFieldUnit, DurationFieldInteger)
 	return a
 }
 
@@ -204,24 +206,24 @@ func (a *array) Interface(i interface{}) *array {
 	if obj, ok := i.(ObjectMarshaler); ok {
 		return a.Object(obj)
 	}
-	a.buf = enc.AppendInterface(enc.AppendArrayDelim(a.buf), i)
+	a.buf = a.encoder.AppendInterface(a.encoder.AppendArrayDelim(a.buf), i)
 	return a
 }
 
 // IPAddr adds IPv4 or IPv6 address to the array
 func (a *array) IPAddr(ip net.IP) *array {
-	a.buf = enc.AppendIPAddr(enc.AppendArrayDelim(a.buf), ip)
+	a.buf = a.encoder.AppendIPAddr(a.encoder.AppendArrayDelim(a.buf), ip)
 	return a
 }
 
 // IPPrefix adds IPv4 or IPv6 Prefix (IP + mask) to the array
 func (a *array) IPPrefix(pfx net.IPNet) *array {
-	a.buf = enc.AppendIPPrefix(enc.AppendArrayDelim(a.buf), pfx)
+	a.buf = a.encoder.AppendIPPrefix(a.encoder.AppendArrayDelim(a.buf), pfx)
 	return a
 }
 
 // MACAddr adds a MAC (Ethernet) address to the array
 func (a *array) MACAddr(ha net.HardwareAddr) *array {
-	a.buf = enc.AppendMACAddr(enc.AppendArrayDelim(a.buf), ha)
+	a.buf = a.encoder.AppendMACAddr(a.encoder.AppendArrayDelim(a.buf), ha)
 	return a
 }
@@ -7,7 +7,7 @@ import (
 )
 
 func TestArray(t *testing.T) {
-	ev := &Event{timeFieldFormat: DefaultTimeFieldFormat}
+	ev := &Event{timeFieldFormat: DefaultTimeFieldFormat, encoder: EncoderJSON()}
 	a := ev.arr().
 		Bool(true).
 		Int(1).
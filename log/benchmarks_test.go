@@ -84,6 +84,43 @@ func BenchmarkLogFields(b *testing.B) {
 	})
 }
 
+func BenchmarkEncoders(b *testing.B) {
+	encoders := []struct {
+		name    string
+		encoder Encoder
+	}{
+		{"JSON", EncoderJSON()},
+		{"CBOR", EncoderCBOR()},
+	}
+	for _, e := range encoders {
+		b.Run(e.name+"/Info", func(b *testing.B) {
+			logger := New(SetWriter(ioutil.Discard), SetEncoder(e.encoder))
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					logger.Info(fakeMessage)
+				}
+			})
+		})
+		b.Run(e.name+"/Fields", func(b *testing.B) {
+			logger := New(SetWriter(ioutil.Discard), SetEncoder(e.encoder))
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					logger.Info(fakeMessage,
+						String("string", "four!"),
+						Time("time", time.Time{}),
+						Int("int", 123),
+						Float32("float", -2.203230293249593),
+						Ints("ints", []int{1, 2, 3}),
+						Err("error", errExample),
+					)
+				}
+			})
+		})
+	}
+}
+
 type obj struct {
 	Pub  string
 	Tag  string `json:"tag"`
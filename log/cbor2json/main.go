@@ -0,0 +1,43 @@
+// Command cbor2json converts the output of a logger using the CBOR encoder to JSON lines.
+//
+// usage: cbor2json [file]
+//
+// If file is not provided, the standard input is read.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bloom42/gobox/log"
+)
+
+func main() {
+	var in io.Reader = os.Stdin
+	switch len(os.Args) {
+	case 1:
+	case 2:
+		file, err := os.Open(os.Args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		in = file
+	default:
+		fmt.Printf("usage: %v [file]\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	err := log.CBORToJSON(out, in)
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -77,7 +77,7 @@ func SetHooks(hooks ...Hook) LoggerOption {
 // SetFields update logger's context fields
 func SetFields(fields ...Field) LoggerOption {
 	return func(logger *Logger) {
-		e := newEvent(logger.writer, logger.level)
+		e := newEvent(logger.writer, logger.level, logger.encoder)
 		e.buf = nil
 		copyInternalLoggerFieldsToEvent(logger, e)
 		for i := range fields {
@@ -93,11 +93,47 @@ func SetFields(fields ...Field) LoggerOption {
 			logger.timestamp = e.timestamp
 		}
 		if e.buf != nil {
-			logger.context = enc.AppendObjectData(logger.context, e.buf)
+			logger.context = logger.encoder.AppendObjectData(logger.context, e.buf)
 		}
 	}
 }
 
+// SetEncoder update logger's encoder (see EncoderJSON and EncoderCBOR).
+// The context fields, which are stored encoded, are converted to the new encoder.
+func SetEncoder(encoder Encoder) LoggerOption {
+	return func(logger *Logger) {
+		if len(logger.context) > 0 && !sameEncoding(logger.encoder, encoder) {
+			context, err := transcodeFields(encoder, logger.encoder, logger.context)
+			if err != nil {
+				// keep the encoder matching the context rather than corrupting the output
+				handleWriterError(err)
+				return
+			}
+			logger.context = context
+		}
+		logger.encoder = encoder
+	}
+}
+
+// SetRedactRules update logger's redaction rules. The fields matching a rule are redacted
+// before being encoded, and the first matching rule applies. As context fields are stored
+// encoded, it must be set before SetFields.
+//
+//	log.SetRedactRules(
+//		log.RedactKeys(log.RedactMask, "*password*", "authorization"),
+//		log.RedactJWT(log.RedactMask),
+//		log.RedactEmail(log.RedactHash),
+//	)
+func SetRedactRules(rules ...RedactRule) LoggerOption {
+	return func(logger *Logger) {
+		if len(rules) == 0 {
+			logger.redactor = nil
+			return
+		}
+		logger.redactor = newRedactor(rules)
+	}
+}
+
 // SetFormatter update logger's formatter.
 func SetFormatter(formatter Formatter) LoggerOption {
 	return func(logger *Logger) {
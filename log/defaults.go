@@ -21,6 +21,19 @@ const (
 	// DefaultErrorStackFieldName is the default field name used for error stacks.
 	DefaultErrorStackFieldName = "stack"
 
+	// DefaultTraceIDFieldName is the default field name used for the trace ID field.
+	DefaultTraceIDFieldName = "trace_id"
+
+	// DefaultSpanIDFieldName is the default field name used for the span ID field.
+	DefaultSpanIDFieldName = "span_id"
+
+	// DefaultSuppressedFieldName is the default field name used by SamplerDedup for the number of
+	// suppressed events.
+	DefaultSuppressedFieldName = "suppressed"
+
+	// DefaultRedactedValue is the value replacing the redacted fields with the RedactMask action.
+	DefaultRedactedValue = "[REDACTED]"
+
 	// DefaultTimeFieldFormat defines the time format of the Time field type.
 	// If set to an empty string, the time is formatted as an UNIX timestamp
 	// as integer.
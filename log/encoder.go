@@ -1,6 +1,8 @@
 package log
 
 import (
+	"bytes"
+	"encoding/json"
 	"net"
 	"time"
 )
@@ -55,3 +57,104 @@ type Encoder interface {
 	AppendUints64(dst []byte, vals []uint64) []byte
 	AppendUints8(dst []byte, vals []uint8) []byte
 }
+
+// binaryEncoder is implemented by encoders which do not produce JSON (e.g. CBOR).
+// Formatters use it to convert events to JSON before prettifying them.
+type binaryEncoder interface {
+	// AppendEmbeddedJSON appends the already encoded JSON j to dst.
+	AppendEmbeddedJSON(dst []byte, j []byte) []byte
+	// AppendJSON decodes the encoded object src and appends it to dst as JSON.
+	AppendJSON(dst []byte, src []byte) ([]byte, error)
+}
+
+// toJSON returns buf, encoded with encoder, as JSON.
+func toJSON(encoder Encoder, buf []byte) ([]byte, error) {
+	if be, ok := encoder.(binaryEncoder); ok {
+		return be.AppendJSON(nil, buf)
+	}
+	return buf, nil
+}
+
+// sameEncoding returns true if a and b produce the same format, so that data encoded with one
+// can be appended to data encoded with the other.
+func sameEncoding(a, b Encoder) bool {
+	_, aBinary := a.(binaryEncoder)
+	_, bBinary := b.(binaryEncoder)
+	return aBinary == bBinary
+}
+
+// transcode appends the object src, encoded with from, to dst, encoded with to.
+func transcode(dst []byte, to, from Encoder, src []byte) ([]byte, error) {
+	j, err := toJSON(from, src)
+	if err != nil {
+		return dst, err
+	}
+	if _, ok := to.(binaryEncoder); !ok {
+		return append(dst, j...), nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(j))
+	decoder.UseNumber()
+	return appendJSONValue(dst, to, decoder)
+}
+
+// transcodeFields converts fields, the encoded fields of an object without its markers (as
+// stored in the context of a Logger), from the encoder from to the encoder to.
+func transcodeFields(to, from Encoder, fields []byte) ([]byte, error) {
+	src := from.AppendEndMarker(append(from.AppendBeginMarker(nil), fields...))
+	begin := len(to.AppendBeginMarker(nil))
+	end := len(to.AppendEndMarker(nil))
+	obj, err := transcode(nil, to, from, src)
+	if err != nil {
+		return nil, err
+	}
+	return obj[begin : len(obj)-end], nil
+}
+
+// appendJSONValue reads the next JSON value from decoder and appends it to dst with encoder.
+func appendJSONValue(dst []byte, encoder Encoder, decoder *json.Decoder) ([]byte, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return dst, err
+	}
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '{' {
+			dst = encoder.AppendBeginMarker(dst)
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return dst, err
+				}
+				dst = encoder.AppendKey(dst, key.(string))
+				if dst, err = appendJSONValue(dst, encoder, decoder); err != nil {
+					return dst, err
+				}
+			}
+			_, err = decoder.Token()
+			return encoder.AppendEndMarker(dst), err
+		}
+		dst = encoder.AppendArrayStart(dst)
+		for i := 0; decoder.More(); i++ {
+			if i > 0 {
+				dst = encoder.AppendArrayDelim(dst)
+			}
+			if dst, err = appendJSONValue(dst, encoder, decoder); err != nil {
+				return dst, err
+			}
+		}
+		_, err = decoder.Token()
+		return encoder.AppendArrayEnd(dst), err
+	case string:
+		return encoder.AppendString(dst, token), nil
+	case json.Number:
+		if i, err := token.Int64(); err == nil {
+			return encoder.AppendInt64(dst, i), nil
+		}
+		f, err := token.Float64()
+		return encoder.AppendFloat64(dst, f), err
+	case bool:
+		return encoder.AppendBool(dst, token), nil
+	default:
+		return encoder.AppendNil(dst), nil
+	}
+}
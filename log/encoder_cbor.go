@@ -0,0 +1,45 @@
+package log
+
+// encoder_cbor.go file contains bindings to generate
+// CBOR encoded byte stream.
+
+import (
+	"io"
+
+	"github.com/bloom42/gobox/log/internal/cbor"
+)
+
+var (
+	_ Encoder       = (*cbor.Encoder)(nil)
+	_ binaryEncoder = (*cbor.Encoder)(nil)
+)
+
+// EncoderCBOR returns an encoder producing CBOR (RFC 8949) instead of JSON.
+// Each event is encoded as a self-delimited map, so the output of a logger
+// is a stream of CBOR data items which can be converted back to JSON lines with CBORToJSON.
+//
+// CBOR is more compact and cheaper to produce than JSON, but not human readable:
+// use FormatterConsole, FormatterCLI or FormatterLogfmt to get readable output.
+func EncoderCBOR() Encoder {
+	return cbor.Encoder{}
+}
+
+// CBORToJSON reads a stream of CBOR encoded events from r and writes them to w as JSON,
+// one event per line.
+func CBORToJSON(w io.Writer, r io.Reader) error {
+	d := cbor.NewDecoder(r)
+	buf := make([]byte, 0, 500)
+	for {
+		var err error
+		buf, err = d.AppendNext(buf[:0])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(append(buf, '\n')); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncoderCBOR(t *testing.T) {
+	fields := func(logger Logger) []Field {
+		return []Field{
+			String("string", "foo \"bar\"\n"),
+			Strings("strings", []string{"a", "b"}),
+			Bytes("bytes", []byte("baz")),
+			Hex("hex", []byte{0x12, 0xef}),
+			RawJSON("json", []byte(`{"some":"json"}`)),
+			Err("error", errors.New("some error")),
+			Bool("bool", true),
+			Int("int", -1),
+			Ints("ints", []int{1, -2, 300000}),
+			Uint64("uint64", 1<<63),
+			Float32("float32", 1.5),
+			Float64("float64", -11.98122),
+			Time("time", time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)),
+			Duration("dur", time.Second),
+			Any("any", map[string]int{"n": 1}),
+			IP("ip", net.IP{192, 168, 0, 10}),
+			Dict("dict", logger.NewDict(String("foo", "bar"), Int("n", 2))),
+			Object("obj", obj{Pub: "a", Tag: "b", priv: 3}),
+		}
+	}
+
+	jsonOut := &bytes.Buffer{}
+	jsonLogger := New(SetWriter(jsonOut), SetFields(Timestamp(false), String("context", "ctx")))
+	cborOut := &bytes.Buffer{}
+	cborLogger := New(SetWriter(cborOut), SetEncoder(EncoderCBOR()), SetFields(Timestamp(false), String("context", "ctx")))
+
+	for _, logger := range []Logger{jsonLogger, cborLogger} {
+		logger.Info("hello", fields(logger)...)
+		logger.Warn("world")
+	}
+
+	if bytes.Equal(jsonOut.Bytes(), cborOut.Bytes()) {
+		t.Fatal("CBOR output is the same as JSON output")
+	}
+	if cborOut.Len() >= jsonOut.Len() {
+		t.Errorf("CBOR output (%d bytes) is larger than JSON output (%d bytes)", cborOut.Len(), jsonOut.Len())
+	}
+
+	converted := &bytes.Buffer{}
+	if err := CBORToJSON(converted, cborOut); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := converted.String(), jsonOut.String(); got != want {
+		t.Errorf("invalid converted output:\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+func TestEncoderCBORFormatter(t *testing.T) {
+	formatters := map[string]Formatter{
+		"cli":     FormatterCLI(),
+		"console": FormatterConsole(),
+		"logfmt":  FormatterLogfmt(),
+	}
+	for name, formatter := range formatters {
+		jsonOut := &bytes.Buffer{}
+		jsonLogger := New(SetWriter(jsonOut), SetFormatter(formatter), SetFields(Timestamp(false)))
+		jsonLogger.Info("hello", String("foo", "bar"), Int("n", 1))
+		cborOut := &bytes.Buffer{}
+		cborLogger := New(SetWriter(cborOut), SetEncoder(EncoderCBOR()), SetFormatter(formatter), SetFields(Timestamp(false)))
+		cborLogger.Info("hello", String("foo", "bar"), Int("n", 1))
+
+		if got, want := cborOut.String(), jsonOut.String(); got != want {
+			t.Errorf("%s: invalid output:\ngot:  %q\nwant: %q", name, got, want)
+		}
+	}
+}
+
+func TestEncoderCBOREventFields(t *testing.T) {
+	event := newEvent(nil, DebugLevel, EncoderCBOR())
+	event.Append(String("foo", "bar"), Int("n", 1))
+
+	fields, err := event.Fields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields["foo"] != "bar" || fields["n"] != 1.0 {
+		t.Errorf("invalid fields: %v", fields)
+	}
+}
+
+func TestCBORToJSONMalformed(t *testing.T) {
+	err := CBORToJSON(&bytes.Buffer{}, strings.NewReader("\xbf\x63foo"))
+	if err == nil {
+		t.Error("expected an error on truncated input")
+	}
+}
+
+func TestEncoderCBORGlobalDict(t *testing.T) {
+	jsonOut := &bytes.Buffer{}
+	jsonLogger := New(SetWriter(jsonOut), SetFields(Timestamp(false)))
+	cborOut := &bytes.Buffer{}
+	cborLogger := New(SetWriter(cborOut), SetEncoder(EncoderCBOR()), SetFields(Timestamp(false)))
+
+	// dicts created with another encoder are converted
+	cborDict := func() *Event { return cborLogger.NewDict(String("foo", "bar"), Ints("n", []int{1, 2})) }
+	jsonLogger.Info("hello", Dict("dict", cborDict()), Dict("empty", cborLogger.NewDict()))
+	cborLogger.Info("hello", Dict("dict", NewDict(String("foo", "bar"), Ints("n", []int{1, 2}))), Dict("empty", NewDict()))
+
+	converted := &bytes.Buffer{}
+	if err := CBORToJSON(converted, cborOut); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"level":"info","dict":{"foo":"bar","n":[1,2]},"empty":{},"message":"hello"}` + "\n"
+	if got := converted.String(); got != want {
+		t.Errorf("invalid converted output:\ngot:  %v\nwant: %v", got, want)
+	}
+	if got := jsonOut.String(); got != want {
+		t.Errorf("invalid JSON output:\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+func TestEncoderCBORSetEncoderContext(t *testing.T) {
+	jsonOut := &bytes.Buffer{}
+	base := New(SetWriter(jsonOut), SetFields(Timestamp(false), String("context", "ctx"), Float64("f", 1.5)))
+	cborOut := &bytes.Buffer{}
+	cborLogger := base.Clone(SetWriter(cborOut), SetEncoder(EncoderCBOR()), SetFields(Bool("b", true)))
+	cborLogger.Info("hello", Int("n", 1))
+	// and back to JSON
+	jsonLogger := cborLogger.Clone(SetWriter(jsonOut), SetEncoder(EncoderJSON()))
+	jsonLogger.Info("hello", Int("n", 1))
+
+	converted := &bytes.Buffer{}
+	if err := CBORToJSON(converted, cborOut); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"level":"info","context":"ctx","f":1.5,"b":true,"n":1,"message":"hello"}` + "\n"
+	if got := converted.String(); got != want {
+		t.Errorf("invalid converted output:\ngot:  %v\nwant: %v", got, want)
+	}
+	if got := jsonOut.String(); got != want {
+		t.Errorf("invalid JSON output:\ngot:  %v\nwant: %v", got, want)
+	}
+}
@@ -7,14 +7,11 @@ import (
 	"github.com/bloom42/gobox/log/internal/json"
 )
 
-var (
-	_ Encoder = (*json.Encoder)(nil)
+var _ Encoder = (*json.Encoder)(nil)
 
-	enc = json.Encoder{}
-)
-
-func appendJSON(dst []byte, j []byte) []byte {
-	return append(dst, j...)
+// EncoderJSON returns the JSON encoder, which is the default encoder of loggers.
+func EncoderJSON() Encoder {
+	return json.Encoder{}
 }
 
 func decodeIfBinaryToString(in []byte) string {
@@ -1,9 +1,8 @@
 package log
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"io"
 	"net"
 	"sync"
 	"time"
@@ -37,6 +36,8 @@ type Event struct {
 	formatter            Formatter
 	timestampFunc        func() time.Time
 	encoder              Encoder
+	ctx                  context.Context
+	redactor             *redactor
 }
 
 func putEvent(e *Event) {
@@ -65,11 +66,14 @@ type ArrayMarshaler interface {
 	MarshalLogArray(*array)
 }
 
-func newEvent(w LevelWriter, level Level) *Event {
+func newEvent(w LevelWriter, level Level, encoder Encoder) *Event {
 	e := eventPool.Get().(*Event)
 	e.buf = e.buf[:0]
 	e.ch = nil
-	e.buf = enc.AppendBeginMarker(e.buf)
+	e.ctx = nil
+	e.redactor = nil
+	e.encoder = encoder
+	e.buf = encoder.AppendBeginMarker(e.buf)
 	e.w = w
 	e.level = level
 	return e
@@ -81,6 +85,15 @@ func (e *Event) Enabled() bool {
 	return e.level != Disabled
 }
 
+// Ctx returns the context the event was logged with using one of the *Ctx methods
+// of Logger, or context.Background().
+func (e *Event) Ctx() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
 // Append the given fields to the event
 func (e *Event) Append(fields ...Field) {
 	for i := range fields {
@@ -93,10 +106,13 @@ func (e *Event) Append(fields ...Field) {
 func (e *Event) Fields() (map[string]interface{}, error) {
 	var fields map[string]interface{}
 
-	r := io.MultiReader(bytes.NewReader(e.buf), bytes.NewReader([]byte{'}', '\n'}))
+	buf := e.encoder.AppendEndMarker(append([]byte(nil), e.buf...))
+	buf, err := toJSON(e.encoder, buf)
+	if err != nil {
+		return nil, err
+	}
 
-	d := json.NewDecoder(r)
-	err := d.Decode(&fields)
+	err = json.Unmarshal(buf, &fields)
 	if err != nil {
 		return nil, err
 	}
@@ -111,26 +127,42 @@ func (e *Event) discard() {
 
 // Fields is a helper function to use a map to set fields using type assertion.
 func (e *Event) fields(fields map[string]interface{}) {
+	if e.redactor != nil {
+		fields = e.redactor.redactMap(fields)
+	}
 	e.buf = e.appendFields(e.buf, fields)
 }
 
 // Dict adds the field key with a dict to the event context.
 // Use log.Dict() to create the dictionary.
 func (e *Event) dict(key string, dict *Event) {
-	dict.buf = enc.AppendEndMarker(dict.buf)
-	e.buf = append(enc.AppendKey(e.buf, key), dict.buf...)
+	dict.buf = dict.encoder.AppendEndMarker(dict.buf)
+	if !sameEncoding(dict.encoder, e.encoder) {
+		// the dict was created by a logger with another encoder (e.g. the global logger)
+		buf, err := transcode(nil, e.encoder, dict.encoder, dict.buf)
+		if err != nil {
+			putEvent(dict)
+			return
+		}
+		dict.buf = buf
+	}
+	if e.appendKey(key, func() interface{} { return dict.buf }) {
+		e.buf = append(e.buf, dict.buf...)
+	}
 	putEvent(dict)
 }
 
-func newDict() *Event {
-	return newEvent(nil, 0)
+func (e *Event) newDict() *Event {
+	return newEvent(nil, 0, e.encoder)
 }
 
 // Array adds the field key with an array to the event context.
 // Use Event.Arr() to create the array or pass a type that
 // implement the ArrayMarshaler interface.
 func (e *Event) array(key string, arr ArrayMarshaler) {
-	e.buf = enc.AppendKey(e.buf, key)
+	if !e.appendKey(key, func() interface{} { return arr }) {
+		return
+	}
 	var a *array
 	if aa, ok := arr.(*array); ok {
 		a = aa
@@ -142,15 +174,16 @@ func (e *Event) array(key string, arr ArrayMarshaler) {
 }
 
 func (e *Event) appendObject(obj ObjectMarshaler) {
-	e.buf = enc.AppendBeginMarker(e.buf)
+	e.buf = e.encoder.AppendBeginMarker(e.buf)
 	obj.MarshalLogObject(e)
-	e.buf = enc.AppendEndMarker(e.buf)
+	e.buf = e.encoder.AppendEndMarker(e.buf)
 }
 
 // Object marshals an object that implement the ObjectMarshaler interface.
 func (e *Event) object(key string, obj ObjectMarshaler) {
-	e.buf = enc.AppendKey(e.buf, key)
-	e.appendObject(obj)
+	if e.appendKey(key, func() interface{} { return obj }) {
+		e.appendObject(obj)
+	}
 }
 
 // embedObject marshals an object that implement the ObjectMarshaler interface.
@@ -160,12 +193,29 @@ func (e *Event) embedObject(obj ObjectMarshaler) {
 
 // String adds the field key with val as a string to the *Event context.
 func (e *Event) string(key, val string) {
-	e.buf = enc.AppendString(enc.AppendKey(e.buf, key), val)
+	if e.appendKey(key, func() interface{} { return val }) {
+		e.buf = e.encoder.AppendString(e.buf, val)
+	}
+}
+
+// text adds the field key with val, a free form text such as an error message, as a string
+// to the *Event context. Unlike string, the value rules of the redactor are applied to each
+// word of val.
+func (e *Event) text(key, val string) {
+	if val, keep := e.redactText(key, val); keep {
+		e.buf = e.encoder.AppendString(e.encoder.AppendKey(e.buf, key), val)
+	}
 }
 
 // Strings adds the field key with vals as a []string to the *Event context.
 func (e *Event) strings(key string, vals []string) {
-	e.buf = enc.AppendStrings(enc.AppendKey(e.buf, key), vals)
+	if !e.appendKey(key, func() interface{} { return vals }) {
+		return
+	}
+	if e.redactor != nil {
+		vals = e.redactor.redactStrings(key, vals)
+	}
+	e.buf = e.encoder.AppendStrings(e.buf, vals)
 }
 
 // Bytes adds the field key with val as a string to the *Event context.
@@ -173,12 +223,16 @@ func (e *Event) strings(key string, vals []string) {
 // Runes outside of normal ASCII ranges will be hex-encoded in the resulting
 // JSON.
 func (e *Event) bytes(key string, val []byte) {
-	e.buf = enc.AppendBytes(enc.AppendKey(e.buf, key), val)
+	if e.appendKey(key, func() interface{} { return string(val) }) {
+		e.buf = e.encoder.AppendBytes(e.buf, val)
+	}
 }
 
 // Hex adds the field key with val as a hex string to the *Event context.
 func (e *Event) hex(key string, val []byte) {
-	e.buf = enc.AppendHex(enc.AppendKey(e.buf, key), val)
+	if e.appendKey(key, func() interface{} { return val }) {
+		e.buf = e.encoder.AppendHex(e.buf, val)
+	}
 }
 
 // RawJSON adds already encoded JSON to the log line under key.
@@ -186,7 +240,18 @@ func (e *Event) hex(key string, val []byte) {
 // No sanity check is performed on b; it must not contain carriage returns and
 // be valid JSON.
 func (e *Event) rawJSON(key string, b []byte) {
-	e.buf = appendJSON(enc.AppendKey(e.buf, key), b)
+	if e.redactor != nil {
+		var keep bool
+		if b, keep = e.redactJSON(key, b); !keep {
+			return
+		}
+	}
+	e.buf = e.encoder.AppendKey(e.buf, key)
+	if be, ok := e.encoder.(binaryEncoder); ok {
+		e.buf = be.AppendEmbeddedJSON(e.buf, b)
+	} else {
+		e.buf = append(e.buf, b...)
+	}
 }
 
 // error adds the field key with serialized err to the *Event context.
@@ -197,9 +262,9 @@ func (e *Event) error(key string, err error) {
 	case ObjectMarshaler:
 		e.object(key, m)
 	case error:
-		e.string(key, m.Error())
+		e.text(key, m.Error())
 	case string:
-		e.string(key, m)
+		e.text(key, m)
 	default:
 		e.iinterface(key, m)
 	}
@@ -214,9 +279,13 @@ func (e *Event) errors(key string, errs []error) {
 		case ObjectMarshaler:
 			arr = arr.Object(m)
 		case error:
-			arr = arr.Err(m)
+			if msg, keep := e.redactText(key, m.Error()); keep {
+				arr = arr.Str(msg)
+			}
 		case string:
-			arr = arr.Str(m)
+			if msg, keep := e.redactText(key, m); keep {
+				arr = arr.Str(msg)
+			}
 		default:
 			arr = arr.Interface(m)
 		}
@@ -255,141 +324,204 @@ func (e *Event) enableStack(enable bool) {
 	e.stack = enable
 }
 
+// appendKey appends key to the *Event context and returns true. If a redaction rule applies
+// to the field, the redacted field is appended instead and false is returned: the value must
+// then not be appended. value is only called when the event has redaction rules.
+func (e *Event) appendKey(key string, value func() interface{}) bool {
+	if e.redactor != nil && e.redact(key, value()) {
+		return false
+	}
+	e.buf = e.encoder.AppendKey(e.buf, key)
+	return true
+}
+
 // Bool adds the field key with val as a bool to the *Event context.
 func (e *Event) bool(key string, b bool) {
-	e.buf = enc.AppendBool(enc.AppendKey(e.buf, key), b)
+	if e.appendKey(key, func() interface{} { return b }) {
+		e.buf = e.encoder.AppendBool(e.buf, b)
+	}
 }
 
 // Bools adds the field key with val as a []bool to the *Event context.
 func (e *Event) bools(key string, b []bool) {
-	e.buf = enc.AppendBools(enc.AppendKey(e.buf, key), b)
+	if e.appendKey(key, func() interface{} { return b }) {
+		e.buf = e.encoder.AppendBools(e.buf, b)
+	}
 }
 
 // Int adds the field key with i as a int to the *Event context.
 func (e *Event) int(key string, i int) {
-	e.buf = enc.AppendInt(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendInt(e.buf, i)
+	}
 }
 
 // Ints adds the field key with i as a []int to the *Event context.
 func (e *Event) ints(key string, i []int) {
-	e.buf = enc.AppendInts(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendInts(e.buf, i)
+	}
 }
 
 // Int8 adds the field key with i as a int8 to the *Event context.
 func (e *Event) int8(key string, i int8) {
-	e.buf = enc.AppendInt8(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendInt8(e.buf, i)
+	}
 }
 
 // Ints8 adds the field key with i as a []int8 to the *Event context.
 func (e *Event) ints8(key string, i []int8) {
-	e.buf = enc.AppendInts8(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendInts8(e.buf, i)
+	}
 }
 
 // Int16 adds the field key with i as a int16 to the *Event context.
 func (e *Event) int16(key string, i int16) {
-	e.buf = enc.AppendInt16(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendInt16(e.buf, i)
+	}
 }
 
 // Ints16 adds the field key with i as a []int16 to the *Event context.
 func (e *Event) ints16(key string, i []int16) {
-	e.buf = enc.AppendInts16(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendInts16(e.buf, i)
+	}
 }
 
 // Int32 adds the field key with i as a int32 to the *Event context.
 func (e *Event) int32(key string, i int32) {
-	e.buf = enc.AppendInt32(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendInt32(e.buf, i)
+	}
 }
 
 // Ints32 adds the field key with i as a []int32 to the *Event context.
 func (e *Event) ints32(key string, i []int32) {
-	e.buf = enc.AppendInts32(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendInts32(e.buf, i)
+	}
 }
 
 // Int64 adds the field key with i as a int64 to the *Event context.
 func (e *Event) int64(key string, i int64) {
-	e.buf = enc.AppendInt64(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendInt64(e.buf, i)
+	}
 }
 
 // Ints64 adds the field key with i as a []int64 to the *Event context.
 func (e *Event) ints64(key string, i []int64) {
-	e.buf = enc.AppendInts64(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendInts64(e.buf, i)
+	}
 }
 
 // Uint adds the field key with i as a uint to the *Event context.
 func (e *Event) uint(key string, i uint) {
-	e.buf = enc.AppendUint(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendUint(e.buf, i)
+	}
 }
 
 // Uints adds the field key with i as a []int to the *Event context.
 func (e *Event) uints(key string, i []uint) {
-	e.buf = enc.AppendUints(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendUints(e.buf, i)
+	}
 }
 
 // Uint8 adds the field key with i as a uint8 to the *Event context.
 func (e *Event) uint8(key string, i uint8) {
-	e.buf = enc.AppendUint8(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendUint8(e.buf, i)
+	}
 }
 
 // Uints8 adds the field key with i as a []int8 to the *Event context.
 func (e *Event) uints8(key string, i []uint8) {
-	e.buf = enc.AppendUints8(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendUints8(e.buf, i)
+	}
 }
 
 // Uint16 adds the field key with i as a uint16 to the *Event context.
 func (e *Event) uint16(key string, i uint16) {
-	e.buf = enc.AppendUint16(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendUint16(e.buf, i)
+	}
 }
 
 // Uints16 adds the field key with i as a []int16 to the *Event context.
 func (e *Event) uints16(key string, i []uint16) {
-	e.buf = enc.AppendUints16(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendUints16(e.buf, i)
+	}
 }
 
 // Uint32 adds the field key with i as a uint32 to the *Event context.
 func (e *Event) uint32(key string, i uint32) {
-	e.buf = enc.AppendUint32(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendUint32(e.buf, i)
+	}
 }
 
 // Uints32 adds the field key with i as a []int32 to the *Event context.
 func (e *Event) uints32(key string, i []uint32) {
-	e.buf = enc.AppendUints32(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendUints32(e.buf, i)
+	}
 }
 
 // Uint64 adds the field key with i as a uint64 to the *Event context.
 func (e *Event) uint64(key string, i uint64) {
-	e.buf = enc.AppendUint64(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendUint64(e.buf, i)
+	}
 }
 
 // Uints64 adds the field key with i as a []int64 to the *Event context.
 func (e *Event) uints64(key string, i []uint64) {
-	e.buf = enc.AppendUints64(enc.AppendKey(e.buf, key), i)
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendUints64(e.buf, i)
+	}
 }
 
 // Float32 adds the field key with f as a float32 to the *Event context.
 func (e *Event) float32(key string, f float32) {
-	e.buf = enc.AppendFloat32(enc.AppendKey(e.buf, key), f)
+	if e.appendKey(key, func() interface{} { return f }) {
+		e.buf = e.encoder.AppendFloat32(e.buf, f)
+	}
 }
 
 // Floats32 adds the field key with f as a []float32 to the *Event context.
 func (e *Event) floats32(key string, f []float32) {
-	e.buf = enc.AppendFloats32(enc.AppendKey(e.buf, key), f)
+	if e.appendKey(key, func() interface{} { return f }) {
+		e.buf = e.encoder.AppendFloats32(e.buf, f)
+	}
 }
 
 // Float64 adds the field key with f as a float64 to the *Event context.
 func (e *Event) float64(key string, f float64) {
-	e.buf = enc.AppendFloat64(enc.AppendKey(e.buf, key), f)
+	if e.appendKey(key, func() interface{} { return f }) {
+		e.buf = e.encoder.AppendFloat64(e.buf, f)
+	}
 }
 
 // Floats64 adds the field key with f as a []float64 to the *Event context.
 func (e *Event) floats64(key string, f []float64) {
-	e.buf = enc.AppendFloats64(enc.AppendKey(e.buf, key), f)
+	if e.appendKey(key, func() interface{} { return f }) {
+		e.buf = e.encoder.AppendFloats64(e.buf, f)
+	}
 }
 
 // Timestamp adds the current local time as UNIX timestamp to the *Event context with the
 // logger.TimestampFieldName key.
 // func (e *Event) Timestamp() {
 // 	e.timestamp = false
-// 	e.buf = enc.AppendTime(enc.AppendKey(e.buf, e.timestampFieldName), e.timestampFunc(), e.timeFieldFormat)
+// 	e.buf = e.encoder.AppendTime(e.encoder.AppendKey(e.buf, e.timestampFieldName), e.timestampFunc(), e.timeFieldFormat)
 // 	return e
 // }
 func (e *Event) enableTimestamp(enable bool) {
@@ -398,34 +530,52 @@ func (e *Event) enableTimestamp(enable bool) {
 
 // Time adds the field key with t formated as string using log.TimeFieldFormat.
 func (e *Event) time(key string, t time.Time) {
-	e.buf = enc.AppendTime(enc.AppendKey(e.buf, key), t, e.timeFieldFormat)
+	if e.appendKey(key, func() interface{} { return t }) {
+		e.buf = e.encoder.AppendTime(e.buf, t, e.timeFieldFormat)
+	}
 }
 
 // Times adds the field key with t formated as string using log.TimeFieldFormat.
 func (e *Event) times(key string, t []time.Time) {
-	e.buf = enc.AppendTimes(enc.AppendKey(e.buf, key), t, e.timeFieldFormat)
+	if e.appendKey(key, func() interface{} { return t }) {
+		e.buf = e.encoder.AppendTimes(e.buf, t, e.timeFieldFormat)
+	}
 }
 
 // Duration adds the field key with duration d stored as log.DurationFieldUnit.
 // If log.DurationFieldInteger is true, durations are rendered as integer
 // instead of float.
 func (e *Event) duration(key string, d time.Duration) {
-	e.buf = enc.AppendDuration(enc.AppendKey(e.buf, key), d, DurationFieldUnit, DurationFieldInteger)
+	if e.appendKey(key, func() interface{} { return d }) {
+		e.buf = e.encoder.AppendDuration(e.buf, d, DurationFieldUnit, DurationFieldInteger)
+	}
 }
 
 // Durations adds the field key with duration d stored as log.DurationFieldUnit.
 // If log.DurationFieldInteger is true, durations are rendered as integer
 // instead of float.
 func (e *Event) durations(key string, d []time.Duration) {
-	e.buf = enc.AppendDurations(enc.AppendKey(e.buf, key), d, DurationFieldUnit, DurationFieldInteger)
+	if e.appendKey(key, func() interface{} { return d }) {
+		e.buf = e.encoder.AppendDurations(e.buf, d, DurationFieldUnit, DurationFieldInteger)
+	}
 }
 
 // Interface adds the field key with i marshaled using reflection.
 func (e *Event) iinterface(key string, i interface{}) {
 	if obj, ok := i.(ObjectMarshaler); ok {
 		e.object(key, obj)
+		return
+	}
+	if e.redactor != nil {
+		// redact the values nested in i
+		if j, err := json.Marshal(i); err == nil {
+			e.rawJSON(key, j)
+			return
+		}
+	}
+	if e.appendKey(key, func() interface{} { return i }) {
+		e.buf = e.encoder.AppendInterface(e.buf, i)
 	}
-	e.buf = enc.AppendInterface(enc.AppendKey(e.buf, key), i)
 }
 
 // enableCaller adds the file:line of the caller with the log.CallerFieldName key.
@@ -435,15 +585,21 @@ func (e *Event) enableCaller(enable bool) {
 
 // ip adds IPv4 or IPv6 Address to the event
 func (e *Event) ip(key string, ip net.IP) {
-	e.buf = enc.AppendIPAddr(enc.AppendKey(e.buf, key), ip)
+	if e.appendKey(key, func() interface{} { return ip }) {
+		e.buf = e.encoder.AppendIPAddr(e.buf, ip)
+	}
 }
 
 // ipNet adds IPv4 or IPv6 Prefix (address and mask) to the event
 func (e *Event) ipNet(key string, pfx net.IPNet) {
-	e.buf = enc.AppendIPPrefix(enc.AppendKey(e.buf, key), pfx)
+	if e.appendKey(key, func() interface{} { return pfx }) {
+		e.buf = e.encoder.AppendIPPrefix(e.buf, pfx)
+	}
 }
 
 // hardwareAddr adds MAC address to the event
 func (e *Event) hardwareAddr(key string, ha net.HardwareAddr) {
-	e.buf = enc.AppendMACAddr(enc.AppendKey(e.buf, key), ha)
+	if e.appendKey(key, func() interface{} { return ha }) {
+		e.buf = e.encoder.AppendMACAddr(e.buf, ha)
+	}
 }
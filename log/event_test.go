@@ -10,7 +10,7 @@ func TestEvent_Fields(t *testing.T) {
 		"hostname": "localhost",
 		"latency":  3000.0,
 	}
-	event := newEvent(nil, DebugLevel)
+	event := newEvent(nil, DebugLevel, EncoderJSON())
 
 	for key, value := range fields {
 		event.Append(Any(key, value))
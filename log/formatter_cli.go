@@ -15,9 +15,13 @@ func FormatterCLI() Formatter {
 		var event map[string]interface{}
 		var ret = new(bytes.Buffer)
 
-		d := json.NewDecoder(bytes.NewReader(ev.buf))
+		buf, err := toJSON(ev.encoder, ev.buf)
+		if err != nil {
+			return ret.Bytes(), err
+		}
+		d := json.NewDecoder(bytes.NewReader(buf))
 		d.UseNumber()
-		err := d.Decode(&event)
+		err = d.Decode(&event)
 		if err != nil {
 			return ret.Bytes(), err
 		}
@@ -1,5 +1,7 @@
 package log
 
+import "context"
+
 var globalLogger = New(SetCallerSkipFrameCount(4))
 
 // SetGlobalLogger update the global logger
@@ -61,6 +63,48 @@ func Log(message string, fields ...Field) {
 	globalLogger.Log(message, fields...)
 }
 
+// LogWithLevelCtx logs a new message with the given level. ctx is made available to hooks.
+func LogWithLevelCtx(ctx context.Context, level Level, message string, fields ...Field) {
+	globalLogger.LogWithLevelCtx(ctx, level, message, fields...)
+}
+
+// DebugCtx logs a new message with debug level. ctx is made available to hooks.
+func DebugCtx(ctx context.Context, message string, fields ...Field) {
+	globalLogger.DebugCtx(ctx, message, fields...)
+}
+
+// InfoCtx logs a new message with info level. ctx is made available to hooks.
+func InfoCtx(ctx context.Context, message string, fields ...Field) {
+	globalLogger.InfoCtx(ctx, message, fields...)
+}
+
+// WarnCtx logs a new message with warn level. ctx is made available to hooks.
+func WarnCtx(ctx context.Context, message string, fields ...Field) {
+	globalLogger.WarnCtx(ctx, message, fields...)
+}
+
+// ErrorCtx logs a message with error level. ctx is made available to hooks.
+func ErrorCtx(ctx context.Context, message string, fields ...Field) {
+	globalLogger.ErrorCtx(ctx, message, fields...)
+}
+
+// FatalCtx logs a new message with fatal level. ctx is made available to hooks.
+// The os.Exit(1) function is then called, which terminates the program immediately.
+func FatalCtx(ctx context.Context, message string, fields ...Field) {
+	globalLogger.FatalCtx(ctx, message, fields...)
+}
+
+// PanicCtx logs a new message with panic level. ctx is made available to hooks.
+// The panic() function is then called, which stops the ordinary flow of a goroutine.
+func PanicCtx(ctx context.Context, message string, fields ...Field) {
+	globalLogger.PanicCtx(ctx, message, fields...)
+}
+
+// LogCtx logs a new message with no level. ctx is made available to hooks.
+func LogCtx(ctx context.Context, message string, fields ...Field) {
+	globalLogger.LogCtx(ctx, message, fields...)
+}
+
 // Append the fields to the internal logger's context.
 // It does not create a noew copy of the logger and rely on a mutex to enable thread safety,
 // so `Config(Clone(fields...))` often is preferable.
@@ -0,0 +1,65 @@
+// Package cbor provides a CBOR (RFC 8949) encoder for log events and a
+// converter from CBOR to JSON.
+package cbor
+
+import "math"
+
+// Encoder is the CBOR encoder
+type Encoder struct{}
+
+const (
+	majorOffset = 5
+
+	majorTypeUnsignedInt    byte = 0 << majorOffset
+	majorTypeNegativeInt    byte = 1 << majorOffset
+	majorTypeByteString     byte = 2 << majorOffset
+	majorTypeUtf8String     byte = 3 << majorOffset
+	majorTypeArray          byte = 4 << majorOffset
+	majorTypeMap            byte = 5 << majorOffset
+	majorTypeTags           byte = 6 << majorOffset
+	majorTypeSimpleAndFloat byte = 7 << majorOffset
+
+	maskOutAdditionalType byte = (7 << majorOffset)
+	maskOutMajorType      byte = 31
+
+	additionalMax                 = 23
+	additionalTypeIntUint8   byte = 24
+	additionalTypeIntUint16  byte = 25
+	additionalTypeIntUint32  byte = 26
+	additionalTypeIntUint64  byte = 27
+	additionalTypeIndefinite byte = 31
+
+	additionalTypeBoolFalse byte = 20
+	additionalTypeBoolTrue  byte = 21
+	additionalTypeNull      byte = 22
+	additionalTypeUndefined byte = 23
+	additionalTypeFloat16   byte = 25
+	additionalTypeFloat32   byte = 26
+	additionalTypeFloat64   byte = 27
+	additionalTypeBreak     byte = 31
+
+	// tagEmbeddedJSON marks a byte string holding JSON data
+	// (https://www.iana.org/assignments/cbor-tags/cbor-tags.xhtml).
+	tagEmbeddedJSON = 262
+)
+
+// AppendKey appends a new key to the output CBOR.
+func (e Encoder) AppendKey(dst []byte, key string) []byte {
+	return e.AppendString(dst, key)
+}
+
+func appendTypeHeader(dst []byte, major byte, n uint64) []byte {
+	switch {
+	case n <= additionalMax:
+		return append(dst, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(dst, major|additionalTypeIntUint8, byte(n))
+	case n <= math.MaxUint16:
+		return append(dst, major|additionalTypeIntUint16, byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		return append(dst, major|additionalTypeIntUint32, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	default:
+		return append(dst, major|additionalTypeIntUint64,
+			byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32), byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
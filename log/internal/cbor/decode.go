@@ -0,0 +1,367 @@
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/bloom42/gobox/log/internal/json"
+)
+
+// maxDepth limits the nesting of arrays, maps and tags to protect against
+// malicious inputs.
+const maxDepth = 1000
+
+var (
+	// ErrMalformed is returned when the input is not valid CBOR.
+	ErrMalformed = errors.New("cbor: malformed input")
+
+	errBreak = errors.New("cbor: unexpected break")
+
+	jsonEnc = json.Encoder{}
+)
+
+// Decoder converts a stream of CBOR data items to JSON.
+type Decoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder returns a new Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Decoder{r: br}
+}
+
+// AppendNext decodes the next data item of the stream and appends it to dst as JSON.
+// io.EOF is returned when there is no more data item.
+func (d *Decoder) AppendNext(dst []byte) ([]byte, error) {
+	if _, err := d.r.Peek(1); err != nil {
+		return dst, err
+	}
+	dst, err := d.appendItem(dst, 0)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return dst, err
+}
+
+// AppendJSON decodes the single CBOR data item src and appends it to dst as JSON.
+func (Encoder) AppendJSON(dst []byte, src []byte) ([]byte, error) {
+	d := NewDecoder(bytes.NewReader(src))
+	return d.AppendNext(dst)
+}
+
+func (d *Decoder) appendItem(dst []byte, depth int) ([]byte, error) {
+	if depth > maxDepth {
+		return dst, fmt.Errorf("%w: maximum nesting depth exceeded", ErrMalformed)
+	}
+
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return dst, err
+	}
+	major := b & maskOutAdditionalType
+	info := b & maskOutMajorType
+
+	switch major {
+	case majorTypeUnsignedInt:
+		n, err := d.readUint(info)
+		if err != nil {
+			return dst, err
+		}
+		return strconv.AppendUint(dst, n, 10), nil
+	case majorTypeNegativeInt:
+		n, err := d.readUint(info)
+		if err != nil {
+			return dst, err
+		}
+		if n <= math.MaxInt64 {
+			return strconv.AppendInt(dst, -1-int64(n), 10), nil
+		}
+		v := new(big.Int).SetUint64(n)
+		v.Add(v, big.NewInt(1)).Neg(v)
+		return v.Append(dst, 10), nil
+	case majorTypeByteString:
+		s, err := d.readString(major, info)
+		if err != nil {
+			return dst, err
+		}
+		return jsonEnc.AppendBytes(dst, s), nil
+	case majorTypeUtf8String:
+		s, err := d.readString(major, info)
+		if err != nil {
+			return dst, err
+		}
+		return jsonEnc.AppendBytes(dst, s), nil
+	case majorTypeArray:
+		return d.appendArray(dst, info, depth)
+	case majorTypeMap:
+		return d.appendMap(dst, info, depth)
+	case majorTypeTags:
+		tag, err := d.readUint(info)
+		if err != nil {
+			return dst, err
+		}
+		if tag == tagEmbeddedJSON {
+			return d.appendEmbeddedJSON(dst)
+		}
+		// other tags only add semantic to the tagged item, which is kept as is
+		return d.appendItem(dst, depth+1)
+	default:
+		return d.appendSimpleOrFloat(dst, info)
+	}
+}
+
+func (d *Decoder) appendArray(dst []byte, info byte, depth int) ([]byte, error) {
+	dst = append(dst, '[')
+	if info == additionalTypeIndefinite {
+		for i := 0; ; i++ {
+			if d.nextIsBreak() {
+				d.r.ReadByte()
+				break
+			}
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			var err error
+			if dst, err = d.appendItem(dst, depth+1); err != nil {
+				return dst, err
+			}
+		}
+		return append(dst, ']'), nil
+	}
+
+	n, err := d.readUint(info)
+	if err != nil {
+		return dst, err
+	}
+	for i := uint64(0); i < n; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		if dst, err = d.appendItem(dst, depth+1); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, ']'), nil
+}
+
+func (d *Decoder) appendMap(dst []byte, info byte, depth int) ([]byte, error) {
+	dst = append(dst, '{')
+	if info == additionalTypeIndefinite {
+		for i := 0; ; i++ {
+			if d.nextIsBreak() {
+				d.r.ReadByte()
+				break
+			}
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			var err error
+			if dst, err = d.appendKeyValue(dst, depth); err != nil {
+				return dst, err
+			}
+		}
+		return append(dst, '}'), nil
+	}
+
+	n, err := d.readUint(info)
+	if err != nil {
+		return dst, err
+	}
+	for i := uint64(0); i < n; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		if dst, err = d.appendKeyValue(dst, depth); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+func (d *Decoder) appendKeyValue(dst []byte, depth int) ([]byte, error) {
+	start := len(dst)
+	dst, err := d.appendItem(dst, depth+1)
+	if err != nil {
+		return dst, err
+	}
+	if dst[start] != '"' {
+		// JSON keys must be strings
+		key := string(dst[start:])
+		dst = jsonEnc.AppendString(dst[:start], key)
+	}
+	dst = append(dst, ':')
+	return d.appendItem(dst, depth+1)
+}
+
+func (d *Decoder) appendEmbeddedJSON(dst []byte) ([]byte, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return dst, err
+	}
+	if b&maskOutAdditionalType != majorTypeByteString {
+		return dst, fmt.Errorf("%w: embedded JSON is not a byte string", ErrMalformed)
+	}
+	s, err := d.readString(majorTypeByteString, b&maskOutMajorType)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, s...), nil
+}
+
+func (d *Decoder) appendSimpleOrFloat(dst []byte, info byte) ([]byte, error) {
+	switch info {
+	case additionalTypeBoolFalse:
+		return append(dst, "false"...), nil
+	case additionalTypeBoolTrue:
+		return append(dst, "true"...), nil
+	case additionalTypeNull, additionalTypeUndefined:
+		return append(dst, "null"...), nil
+	case additionalTypeFloat16:
+		n, err := d.readUint(additionalTypeIntUint16)
+		if err != nil {
+			return dst, err
+		}
+		return jsonEnc.AppendFloat32(dst, float16ToFloat32(uint16(n))), nil
+	case additionalTypeFloat32:
+		n, err := d.readUint(additionalTypeIntUint32)
+		if err != nil {
+			return dst, err
+		}
+		return jsonEnc.AppendFloat32(dst, math.Float32frombits(uint32(n))), nil
+	case additionalTypeFloat64:
+		n, err := d.readUint(additionalTypeIntUint64)
+		if err != nil {
+			return dst, err
+		}
+		return jsonEnc.AppendFloat64(dst, math.Float64frombits(n)), nil
+	case additionalTypeBreak:
+		return dst, errBreak
+	default:
+		if info < additionalTypeBoolFalse {
+			// unassigned simple values
+			return jsonEnc.AppendString(dst, "simple("+strconv.Itoa(int(info))+")"), nil
+		}
+		if info == additionalTypeIntUint8 {
+			v, err := d.r.ReadByte()
+			if err != nil {
+				return dst, err
+			}
+			return jsonEnc.AppendString(dst, "simple("+strconv.Itoa(int(v))+")"), nil
+		}
+		return dst, fmt.Errorf("%w: invalid simple value %d", ErrMalformed, info)
+	}
+}
+
+func (d *Decoder) nextIsBreak() bool {
+	b, err := d.r.Peek(1)
+	return err == nil && b[0] == majorTypeSimpleAndFloat|additionalTypeBreak
+}
+
+// readUint reads the argument of a data item.
+func (d *Decoder) readUint(info byte) (uint64, error) {
+	var size int
+	switch {
+	case info <= additionalMax:
+		return uint64(info), nil
+	case info == additionalTypeIntUint8:
+		size = 1
+	case info == additionalTypeIntUint16:
+		size = 2
+	case info == additionalTypeIntUint32:
+		size = 4
+	case info == additionalTypeIntUint64:
+		size = 8
+	default:
+		return 0, fmt.Errorf("%w: invalid additional information %d", ErrMalformed, info)
+	}
+
+	var n uint64
+	for i := 0; i < size; i++ {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n = n<<8 | uint64(b)
+	}
+	return n, nil
+}
+
+// readString reads a (possibly indefinite-length) byte or text string.
+func (d *Decoder) readString(major, info byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if info != additionalTypeIndefinite {
+		n, err := d.readUint(info)
+		if err != nil {
+			return nil, err
+		}
+		if err = d.readN(&buf, n); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	// indefinite-length strings are a sequence of definite-length chunks of the same major type
+	for !d.nextIsBreak() {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		chunkInfo := b & maskOutMajorType
+		if b&maskOutAdditionalType != major || chunkInfo == additionalTypeIndefinite {
+			return nil, fmt.Errorf("%w: invalid indefinite-length string chunk", ErrMalformed)
+		}
+		n, err := d.readUint(chunkInfo)
+		if err != nil {
+			return nil, err
+		}
+		if err = d.readN(&buf, n); err != nil {
+			return nil, err
+		}
+	}
+	d.r.ReadByte()
+	return buf.Bytes(), nil
+}
+
+// readN reads n bytes into buf without allocating them upfront, as n comes from the input.
+func (d *Decoder) readN(buf *bytes.Buffer, n uint64) error {
+	if n > math.MaxInt64 {
+		return fmt.Errorf("%w: string too long", ErrMalformed)
+	}
+	copied, err := io.CopyN(buf, d.r, int64(n))
+	if err == io.EOF && uint64(copied) < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h) & 0x3ff
+
+	switch exp {
+	case 0:
+		// zero or subnormal
+		f := float32(mant) / (1 << 24)
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	case 0x1f:
+		// infinity or NaN
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	default:
+		return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+	}
+}
@@ -0,0 +1,117 @@
+package cbor
+
+import (
+	stdhex "encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendJSON(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"00", "0"},
+		{"1bffffffffffffffff", "18446744073709551615"},
+		{"3903e7", "-1000"},
+		{"3bffffffffffffffff", "-18446744073709551616"},
+		{"f4", "false"},
+		{"f6", "null"},
+		{"f97e00", `"NaN"`},
+		{"f93c00", "1"},
+		{"f9c400", "-4"},
+		{"fa47c35000", "100000"},
+		{"fb3ff199999999999a", "1.1"},
+		{"6449455446", `"IETF"`},
+		{"62225c", `"\"\\"`},
+		{"4449455446", `"IETF"`},
+		{"7f657374726561646d696e67ff", `"streaming"`},
+		{"9f018202039f0405ffff", "[1,[2,3],[4,5]]"},
+		{"a201020304", `{"1":2,"3":4}`},
+		{"bf6346756ef563416d7421ff", `{"Fun":true,"Amt":-2}`},
+		{"c074323031332d30332d32315432303a30343a30305a", `"2013-03-21T20:04:00Z"`},
+		{"d90106477b226e223a317d", `{"n":1}`},
+	}
+	for _, tt := range tests {
+		input, _ := stdhex.DecodeString(tt.input)
+		got, err := enc.AppendJSON(nil, input)
+		if err != nil {
+			t.Errorf("AppendJSON(%s): %v", tt.input, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("AppendJSON(%s): got %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestAppendJSONRoundTrip(t *testing.T) {
+	dst := enc.AppendBeginMarker(nil)
+	dst = enc.AppendString(enc.AppendKey(dst, "str"), "a\tb")
+	dst = enc.AppendInts64(enc.AppendKey(dst, "ints"), []int64{math.MaxInt64, math.MinInt64})
+	dst = enc.AppendFloat64(enc.AppendKey(dst, "inf"), math.Inf(1))
+	dst = enc.AppendDuration(enc.AppendKey(dst, "dur"), time.Second, time.Millisecond, true)
+	dst = enc.AppendHex(enc.AppendKey(dst, "hex"), []byte{0xca, 0xfe})
+	dst = enc.AppendKey(dst, "arr")
+	dst = enc.AppendArrayStart(dst)
+	dst = enc.AppendBool(enc.AppendArrayDelim(dst), false)
+	dst = enc.AppendNil(enc.AppendArrayDelim(dst))
+	dst = enc.AppendArrayEnd(dst)
+	dst = enc.AppendEndMarker(dst)
+
+	got, err := enc.AppendJSON(nil, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"str":"a\tb","ints":[9223372036854775807,-9223372036854775808],"inf":"+Inf","dur":1000,"hex":"cafe","arr":[false,null]}`
+	if string(got) != want {
+		t.Errorf("got:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestDecoderMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"truncated map", "bf6346756e"},
+		{"truncated int", "1a0000"},
+		{"unexpected break", "ff"},
+		{"invalid additional information", "1c"},
+		{"huge string length", "5bffffffffffffffff"},
+		{"huge truncated string", "5a7fffffff00"},
+		{"invalid string chunk", "5f6161ff"},
+		{"embedded JSON not bytes", "d901066161"},
+		{"too deep", strings.Repeat("81", maxDepth+2) + "00"},
+	}
+	for _, tt := range tests {
+		input, _ := stdhex.DecodeString(tt.input)
+		if _, err := enc.AppendJSON(nil, input); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestDecoderStream(t *testing.T) {
+	input, _ := stdhex.DecodeString("bf616101ffbf616202ff")
+	d := NewDecoder(strings.NewReader(string(input)))
+
+	var got []string
+	for {
+		buf, err := d.AppendNext(nil)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(buf))
+	}
+	if len(got) != 2 || got[0] != `{"a":1}` || got[1] != `{"b":2}` {
+		t.Errorf("invalid decoded stream: %v", got)
+	}
+}
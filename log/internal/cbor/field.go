@@ -0,0 +1,88 @@
+package cbor
+
+import "bytes"
+
+// RawField returns the encoded value of the field key of the map src, which doesn't need
+// to be terminated, or nil if src has no such field. Nested maps are not searched.
+func (e Encoder) RawField(src []byte, key string) []byte {
+	if len(src) == 0 || src[0] != majorTypeMap|additionalTypeIndefinite {
+		return nil
+	}
+	encodedKey := e.AppendString(nil, key)
+	i := 1
+	for i < len(src) && src[i] != majorTypeSimpleAndFloat|additionalTypeBreak {
+		keyEnd := itemEnd(src, i)
+		end := itemEnd(src, keyEnd)
+		if end < 0 {
+			return nil
+		}
+		if bytes.Equal(src[i:keyEnd], encodedKey) {
+			return src[keyEnd:end]
+		}
+		i = end
+	}
+	return nil
+}
+
+// itemEnd returns the index following the data item starting at src[i], or -1 if the item
+// is not complete or malformed.
+func itemEnd(src []byte, i int) int {
+	if i < 0 || i >= len(src) {
+		return -1
+	}
+	major := src[i] & maskOutAdditionalType
+	info := src[i] & maskOutMajorType
+	i++
+
+	var n uint64
+	switch {
+	case info <= additionalMax:
+		n = uint64(info)
+	case info <= additionalTypeIntUint64:
+		size := 1 << (info - additionalTypeIntUint8)
+		if len(src)-i < size {
+			return -1
+		}
+		for _, b := range src[i : i+size] {
+			n = n<<8 | uint64(b)
+		}
+		i += size
+	case info == additionalTypeIndefinite:
+		if major != majorTypeByteString && major != majorTypeUtf8String && major != majorTypeArray && major != majorTypeMap {
+			return -1
+		}
+		for i < len(src) && src[i] != majorTypeSimpleAndFloat|additionalTypeBreak {
+			if i = itemEnd(src, i); i < 0 {
+				return -1
+			}
+		}
+		if i >= len(src) {
+			return -1
+		}
+		return i + 1
+	default:
+		return -1
+	}
+
+	switch major {
+	case majorTypeByteString, majorTypeUtf8String:
+		if uint64(len(src)-i) < n {
+			return -1
+		}
+		return i + int(n)
+	case majorTypeArray, majorTypeMap:
+		if major == majorTypeMap {
+			n *= 2
+		}
+		for ; n > 0; n-- {
+			if i = itemEnd(src, i); i < 0 {
+				return -1
+			}
+		}
+		return i
+	case majorTypeTags:
+		return itemEnd(src, i)
+	default:
+		return i
+	}
+}
@@ -0,0 +1,53 @@
+package cbor
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRawField(t *testing.T) {
+	var src []byte
+	src = enc.AppendBeginMarker(src)
+	src = enc.AppendString(enc.AppendKey(src, "level"), "info")
+	src = enc.AppendKey(src, "nested")
+	src = enc.AppendBeginMarker(src)
+	src = enc.AppendInts(enc.AppendKey(src, "level"), []int{1, -300, 70000})
+	src = enc.AppendEndMarker(src)
+	src = enc.AppendTime(enc.AppendKey(src, "time"), time.Unix(1600000000, 0), "")
+	src = enc.AppendFloat64(enc.AppendKey(src, "float"), 1.5)
+	src = enc.AppendBytes(enc.AppendKey(src, "bytes"), bytes.Repeat([]byte("x"), 300))
+	src = enc.AppendEmbeddedJSON(enc.AppendKey(src, "json"), []byte(`{"a":1}`))
+	src = enc.AppendUint64(enc.AppendKey(src, "last"), 1<<40)
+
+	tests := []struct {
+		key  string
+		want []byte
+	}{
+		{"level", enc.AppendString(nil, "info")},
+		{"nested", enc.AppendEndMarker(enc.AppendInts(enc.AppendKey(enc.AppendBeginMarker(nil), "level"), []int{1, -300, 70000}))},
+		{"time", enc.AppendTime(nil, time.Unix(1600000000, 0), "")},
+		{"float", enc.AppendFloat64(nil, 1.5)},
+		{"bytes", enc.AppendBytes(nil, bytes.Repeat([]byte("x"), 300))},
+		{"json", enc.AppendEmbeddedJSON(nil, []byte(`{"a":1}`))},
+		{"last", enc.AppendUint64(nil, 1<<40)},
+		{"missing", nil},
+	}
+	for _, test := range tests {
+		for _, terminated := range []bool{false, true} {
+			buf := src
+			if terminated {
+				buf = enc.AppendEndMarker(append([]byte(nil), src...))
+			}
+			if got := enc.RawField(buf, test.key); !bytes.Equal(got, test.want) {
+				t.Errorf("RawField(%q) = %x, want: %x", test.key, got, test.want)
+			}
+		}
+	}
+
+	for _, src := range [][]byte{nil, enc.AppendString(nil, "string"), src[:len(src)-1], {0xbf, 0x61, 'l', 0x1c}} {
+		if got := enc.RawField(src, "last"); got != nil {
+			t.Errorf("RawField(%x) = %x, want: nil", src, got)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package cbor
+
+const hex = "0123456789abcdef"
+
+// AppendStrings encodes the input strings to CBOR and
+// appends the encoded array to the input byte slice.
+func (e Encoder) AppendStrings(dst []byte, vals []string) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, val := range vals {
+		dst = e.AppendString(dst, val)
+	}
+	return dst
+}
+
+// AppendString encodes the input string to a CBOR text string and appends
+// it to the input byte slice.
+func (Encoder) AppendString(dst []byte, s string) []byte {
+	dst = appendTypeHeader(dst, majorTypeUtf8String, uint64(len(s)))
+	return append(dst, s...)
+}
+
+// AppendBytes encodes the input bytes to a CBOR byte string and appends
+// it to the input byte slice.
+func (Encoder) AppendBytes(dst, s []byte) []byte {
+	dst = appendTypeHeader(dst, majorTypeByteString, uint64(len(s)))
+	return append(dst, s...)
+}
+
+// AppendHex encodes the input bytes to a hex text string and appends
+// it to the input byte slice.
+func (Encoder) AppendHex(dst, s []byte) []byte {
+	dst = appendTypeHeader(dst, majorTypeUtf8String, uint64(len(s)*2))
+	for _, v := range s {
+		dst = append(dst, hex[v>>4], hex[v&0x0f])
+	}
+	return dst
+}
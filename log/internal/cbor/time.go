@@ -0,0 +1,44 @@
+package cbor
+
+import (
+	"time"
+)
+
+// AppendTime formats the input time with the given format
+// and appends the encoded text string to the input byte slice.
+// If format is empty, the time is encoded as a UNIX timestamp integer.
+func (e Encoder) AppendTime(dst []byte, t time.Time, format string) []byte {
+	if format == "" {
+		return e.AppendInt64(dst, t.Unix())
+	}
+	return e.AppendString(dst, t.Format(format))
+}
+
+// AppendTimes converts the input times with the given format
+// and appends the encoded array to the input byte slice.
+func (e Encoder) AppendTimes(dst []byte, vals []time.Time, format string) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, t := range vals {
+		dst = e.AppendTime(dst, t, format)
+	}
+	return dst
+}
+
+// AppendDuration formats the input duration with the given unit & format
+// and appends the encoded value to the input byte slice.
+func (e Encoder) AppendDuration(dst []byte, d time.Duration, unit time.Duration, useInt bool) []byte {
+	if useInt {
+		return e.AppendInt64(dst, int64(d/unit))
+	}
+	return e.AppendFloat64(dst, float64(d)/float64(unit))
+}
+
+// AppendDurations formats the input durations with the given unit & format
+// and appends the encoded array to the input byte slice.
+func (e Encoder) AppendDurations(dst []byte, vals []time.Duration, unit time.Duration, useInt bool) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, d := range vals {
+		dst = e.AppendDuration(dst, d, unit, useInt)
+	}
+	return dst
+}
@@ -0,0 +1,305 @@
+package cbor
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+)
+
+// AppendNil inserts a 'Nil' object into the dst byte array.
+func (Encoder) AppendNil(dst []byte) []byte {
+	return append(dst, majorTypeSimpleAndFloat|additionalTypeNull)
+}
+
+// AppendBeginMarker inserts a map start into the dst byte array.
+func (Encoder) AppendBeginMarker(dst []byte) []byte {
+	return append(dst, majorTypeMap|additionalTypeIndefinite)
+}
+
+// AppendEndMarker inserts a map end into the dst byte array.
+func (Encoder) AppendEndMarker(dst []byte) []byte {
+	return append(dst, majorTypeSimpleAndFloat|additionalTypeBreak)
+}
+
+// AppendLineBreak is a noop: CBOR data items are self-delimiting.
+func (Encoder) AppendLineBreak(dst []byte) []byte {
+	return dst
+}
+
+// AppendArrayStart adds markers to indicate the start of an array.
+func (Encoder) AppendArrayStart(dst []byte) []byte {
+	return append(dst, majorTypeArray|additionalTypeIndefinite)
+}
+
+// AppendArrayEnd adds markers to indicate the end of an array.
+func (Encoder) AppendArrayEnd(dst []byte) []byte {
+	return append(dst, majorTypeSimpleAndFloat|additionalTypeBreak)
+}
+
+// AppendArrayDelim is a noop: CBOR array elements are self-delimiting.
+func (Encoder) AppendArrayDelim(dst []byte) []byte {
+	return dst
+}
+
+// AppendBool encodes the input bool to CBOR and
+// appends it to the input byte slice.
+func (Encoder) AppendBool(dst []byte, val bool) []byte {
+	if val {
+		return append(dst, majorTypeSimpleAndFloat|additionalTypeBoolTrue)
+	}
+	return append(dst, majorTypeSimpleAndFloat|additionalTypeBoolFalse)
+}
+
+// AppendBools encodes the input bools to CBOR and
+// appends the encoded array to the input byte slice.
+func (e Encoder) AppendBools(dst []byte, vals []bool) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, val := range vals {
+		dst = e.AppendBool(dst, val)
+	}
+	return dst
+}
+
+// AppendInt encodes the input int to CBOR and
+// appends it to the input byte slice.
+func (e Encoder) AppendInt(dst []byte, val int) []byte {
+	return e.AppendInt64(dst, int64(val))
+}
+
+// AppendInts encodes the input ints to CBOR and
+// appends the encoded array to the input byte slice.
+func (e Encoder) AppendInts(dst []byte, vals []int) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, val := range vals {
+		dst = e.AppendInt64(dst, int64(val))
+	}
+	return dst
+}
+
+// AppendInt8 encodes the input int8 to CBOR and
+// appends it to the input byte slice.
+func (e Encoder) AppendInt8(dst []byte, val int8) []byte {
+	return e.AppendInt64(dst, int64(val))
+}
+
+// AppendInts8 encodes the input int8s to CBOR and
+// appends the encoded array to the input byte slice.
+func (e Encoder) AppendInts8(dst []byte, vals []int8) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, val := range vals {
+		dst = e.AppendInt64(dst, int64(val))
+	}
+	return dst
+}
+
+// AppendInt16 encodes the input int16 to CBOR and
+// appends it to the input byte slice.
+func (e Encoder) AppendInt16(dst []byte, val int16) []byte {
+	return e.AppendInt64(dst, int64(val))
+}
+
+// AppendInts16 encodes the input int16s to CBOR and
+// appends the encoded array to the input byte slice.
+func (e Encoder) AppendInts16(dst []byte, vals []int16) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, val := range vals {
+		dst = e.AppendInt64(dst, int64(val))
+	}
+	return dst
+}
+
+// AppendInt32 encodes the input int32 to CBOR and
+// appends it to the input byte slice.
+func (e Encoder) AppendInt32(dst []byte, val int32) []byte {
+	return e.AppendInt64(dst, int64(val))
+}
+
+// AppendInts32 encodes the input int32s to CBOR and
+// appends the encoded array to the input byte slice.
+func (e Encoder) AppendInts32(dst []byte, vals []int32) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, val := range vals {
+		dst = e.AppendInt64(dst, int64(val))
+	}
+	return dst
+}
+
+// AppendInt64 encodes the input int64 to CBOR and
+// appends it to the input byte slice.
+func (Encoder) AppendInt64(dst []byte, val int64) []byte {
+	if val < 0 {
+		return appendTypeHeader(dst, majorTypeNegativeInt, uint64(-(val + 1)))
+	}
+	return appendTypeHeader(dst, majorTypeUnsignedInt, uint64(val))
+}
+
+// AppendInts64 encodes the input int64s to CBOR and
+// appends the encoded array to the input byte slice.
+func (e Encoder) AppendInts64(dst []byte, vals []int64) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, val := range vals {
+		dst = e.AppendInt64(dst, val)
+	}
+	return dst
+}
+
+// AppendUint encodes the input uint to CBOR and
+// appends it to the input byte slice.
+func (e Encoder) AppendUint(dst []byte, val uint) []byte {
+	return e.AppendUint64(dst, uint64(val))
+}
+
+// AppendUints encodes the input uints to CBOR and
+// appends the encoded array to the input byte slice.
+func (e Encoder) AppendUints(dst []byte, vals []uint) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, val := range vals {
+		dst = e.AppendUint64(dst, uint64(val))
+	}
+	return dst
+}
+
+// AppendUint8 encodes the input uint8 to CBOR and
+// appends it to the input byte slice.
+func (e Encoder) AppendUint8(dst []byte, val uint8) []byte {
+	return e.AppendUint64(dst, uint64(val))
+}
+
+// AppendUints8 encodes the input uint8s to CBOR and
+// appends the encoded array to the input byte slice.
+func (e Encoder) AppendUints8(dst []byte, vals []uint8) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, val := range vals {
+		dst = e.AppendUint64(dst, uint64(val))
+	}
+	return dst
+}
+
+// AppendUint16 encodes the input uint16 to CBOR and
+// appends it to the input byte slice.
+func (e Encoder) AppendUint16(dst []byte, val uint16) []byte {
+	return e.AppendUint64(dst, uint64(val))
+}
+
+// AppendUints16 encodes the input uint16s to CBOR and
+// appends the encoded array to the input byte slice.
+func (e Encoder) AppendUints16(dst []byte, vals []uint16) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, val := range vals {
+		dst = e.AppendUint64(dst, uint64(val))
+	}
+	return dst
+}
+
+// AppendUint32 encodes the input uint32 to CBOR and
+// appends it to the input byte slice.
+func (e Encoder) AppendUint32(dst []byte, val uint32) []byte {
+	return e.AppendUint64(dst, uint64(val))
+}
+
+// AppendUints32 encodes the input uint32s to CBOR and
+// appends the encoded array to the input byte slice.
+func (e Encoder) AppendUints32(dst []byte, vals []uint32) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, val := range vals {
+		dst = e.AppendUint64(dst, uint64(val))
+	}
+	return dst
+}
+
+// AppendUint64 encodes the input uint64 to CBOR and
+// appends it to the input byte slice.
+func (Encoder) AppendUint64(dst []byte, val uint64) []byte {
+	return appendTypeHeader(dst, majorTypeUnsignedInt, val)
+}
+
+// AppendUints64 encodes the input uint64s to CBOR and
+// appends the encoded array to the input byte slice.
+func (e Encoder) AppendUints64(dst []byte, vals []uint64) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, val := range vals {
+		dst = e.AppendUint64(dst, val)
+	}
+	return dst
+}
+
+// AppendFloat32 encodes the input float32 to CBOR and
+// appends it to the input byte slice.
+func (Encoder) AppendFloat32(dst []byte, val float32) []byte {
+	n := math.Float32bits(val)
+	return append(dst, majorTypeSimpleAndFloat|additionalTypeFloat32,
+		byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+// AppendFloats32 encodes the input float32s to CBOR and
+// appends the encoded array to the input byte slice.
+func (e Encoder) AppendFloats32(dst []byte, vals []float32) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, val := range vals {
+		dst = e.AppendFloat32(dst, val)
+	}
+	return dst
+}
+
+// AppendFloat64 encodes the input float64 to CBOR and
+// appends it to the input byte slice.
+func (Encoder) AppendFloat64(dst []byte, val float64) []byte {
+	n := math.Float64bits(val)
+	return append(dst, majorTypeSimpleAndFloat|additionalTypeFloat64,
+		byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32), byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+// AppendFloats64 encodes the input float64s to CBOR and
+// appends the encoded array to the input byte slice.
+func (e Encoder) AppendFloats64(dst []byte, vals []float64) []byte {
+	dst = appendTypeHeader(dst, majorTypeArray, uint64(len(vals)))
+	for _, val := range vals {
+		dst = e.AppendFloat64(dst, val)
+	}
+	return dst
+}
+
+// AppendInterface marshals the input interface to JSON and
+// appends it to the input byte slice as embedded JSON.
+func (e Encoder) AppendInterface(dst []byte, i interface{}) []byte {
+	marshaled, err := json.Marshal(i)
+	if err != nil {
+		return e.AppendString(dst, fmt.Sprintf("marshaling error: %v", err))
+	}
+	return e.AppendEmbeddedJSON(dst, marshaled)
+}
+
+// AppendEmbeddedJSON appends the already encoded JSON j to the input byte slice,
+// as a tagged byte string.
+func (Encoder) AppendEmbeddedJSON(dst []byte, j []byte) []byte {
+	dst = appendTypeHeader(dst, majorTypeTags, tagEmbeddedJSON)
+	dst = appendTypeHeader(dst, majorTypeByteString, uint64(len(j)))
+	return append(dst, j...)
+}
+
+// AppendObjectData takes in an object that is already in a byte array
+// and adds it to the dst.
+func (Encoder) AppendObjectData(dst []byte, o []byte) []byte {
+	// BeginMarker is present in the dst, which
+	// should not be copied when appending to existing data.
+	if len(o) > 0 && o[0] == majorTypeMap|additionalTypeIndefinite {
+		o = o[1:]
+	}
+	return append(dst, o...)
+}
+
+// AppendIPAddr adds IPv4 or IPv6 address to dst.
+func (e Encoder) AppendIPAddr(dst []byte, ip net.IP) []byte {
+	return e.AppendString(dst, ip.String())
+}
+
+// AppendIPPrefix adds IPv4 or IPv6 Prefix (address & mask) to dst.
+func (e Encoder) AppendIPPrefix(dst []byte, pfx net.IPNet) []byte {
+	return e.AppendString(dst, pfx.String())
+}
+
+// AppendMACAddr adds MAC address to dst.
+func (e Encoder) AppendMACAddr(dst []byte, ha net.HardwareAddr) []byte {
+	return e.AppendString(dst, ha.String())
+}
@@ -0,0 +1,58 @@
+package cbor
+
+import (
+	"bytes"
+	stdhex "encoding/hex"
+	"math"
+	"testing"
+	"time"
+)
+
+var enc = Encoder{}
+
+func TestAppendType(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{"AppendInt(0)", enc.AppendInt([]byte{}, 0), "00"},
+		{"AppendInt(23)", enc.AppendInt([]byte{}, 23), "17"},
+		{"AppendInt(24)", enc.AppendInt([]byte{}, 24), "1818"},
+		{"AppendInt(-1)", enc.AppendInt([]byte{}, -1), "20"},
+		{"AppendInt(-1000)", enc.AppendInt([]byte{}, -1000), "3903e7"},
+		{"AppendInt64(math.MinInt64)", enc.AppendInt64([]byte{}, math.MinInt64), "3b7fffffffffffffff"},
+		{"AppendUint16(math.MaxUint16)", enc.AppendUint16([]byte{}, math.MaxUint16), "19ffff"},
+		{"AppendUint32(math.MaxUint32)", enc.AppendUint32([]byte{}, math.MaxUint32), "1affffffff"},
+		{"AppendUint64(math.MaxUint64)", enc.AppendUint64([]byte{}, math.MaxUint64), "1bffffffffffffffff"},
+		{"AppendFloat32(1.5)", enc.AppendFloat32([]byte{}, 1.5), "fa3fc00000"},
+		{"AppendFloat64(1.1)", enc.AppendFloat64([]byte{}, 1.1), "fb3ff199999999999a"},
+		{"AppendBool(true)", enc.AppendBool([]byte{}, true), "f5"},
+		{"AppendNil()", enc.AppendNil([]byte{}), "f6"},
+		{"AppendString(\"IETF\")", enc.AppendString([]byte{}, "IETF"), "6449455446"},
+		{"AppendBytes(\"IETF\")", enc.AppendBytes([]byte{}, []byte("IETF")), "4449455446"},
+		{"AppendInts([1,2,3])", enc.AppendInts([]byte{}, []int{1, 2, 3}), "83010203"},
+		{"AppendStrings([])", enc.AppendStrings([]byte{}, []string{}), "80"},
+		{"AppendEmbeddedJSON({})", enc.AppendEmbeddedJSON([]byte{}, []byte("{}")), "d90106427b7d"},
+		{"AppendTime(0, \"\")", enc.AppendTime([]byte{}, time.Unix(1000, 0), ""), "1903e8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stdhex.EncodeToString(tt.got); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendObjectData(t *testing.T) {
+	context := enc.AppendString(enc.AppendKey(nil, "foo"), "bar")
+	dst := enc.AppendBeginMarker(nil)
+	dst = enc.AppendObjectData(dst, append(enc.AppendBeginMarker(nil), context...))
+	dst = enc.AppendEndMarker(dst)
+
+	want := append(append([]byte{0xbf}, context...), 0xff)
+	if !bytes.Equal(dst, want) {
+		t.Errorf("got %x, want %x", dst, want)
+	}
+}
@@ -0,0 +1,102 @@
+package json
+
+import "bytes"
+
+// RawField returns the encoded value of the field key of the object src, which doesn't need
+// to be terminated, or nil if src has no such field. Nested objects are not searched.
+func (e Encoder) RawField(src []byte, key string) []byte {
+	if len(src) == 0 || src[0] != '{' {
+		return nil
+	}
+	encodedKey := e.AppendString(nil, key)
+	i := 1
+	for {
+		i = skipSpaces(src, i, true)
+		if i >= len(src) || src[i] == '}' {
+			return nil
+		}
+		keyEnd := valueEnd(src, i)
+		if keyEnd < 0 {
+			return nil
+		}
+		fieldKey := src[i:keyEnd]
+		i = skipSpaces(src, keyEnd, false)
+		if i >= len(src) || src[i] != ':' {
+			return nil
+		}
+		i = skipSpaces(src, i+1, false)
+		end := valueEnd(src, i)
+		if end < 0 {
+			return nil
+		}
+		if bytes.Equal(fieldKey, encodedKey) {
+			return src[i:end]
+		}
+		i = end
+	}
+}
+
+// skipSpaces returns the index of the first byte of src, from i, which is not a space
+// (or a comma if commas is true).
+func skipSpaces(src []byte, i int, commas bool) int {
+	for ; i < len(src); i++ {
+		switch src[i] {
+		case ' ', '\t', '\n', '\r':
+		case ',':
+			if !commas {
+				return i
+			}
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// valueEnd returns the index following the JSON value starting at src[i], or -1 if the
+// value is not complete.
+func valueEnd(src []byte, i int) int {
+	if i >= len(src) {
+		return -1
+	}
+	switch src[i] {
+	case '"':
+		for j := i + 1; j < len(src); j++ {
+			switch src[j] {
+			case '\\':
+				j++
+			case '"':
+				return j + 1
+			}
+		}
+		return -1
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(src); j++ {
+			switch src[j] {
+			case '"':
+				end := valueEnd(src, j)
+				if end < 0 {
+					return -1
+				}
+				j = end - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return j + 1
+				}
+			}
+		}
+		return -1
+	default:
+		for j := i; j < len(src); j++ {
+			switch src[j] {
+			case ',', '}', ']', ' ', '\t', '\n', '\r':
+				return j
+			}
+		}
+		return len(src)
+	}
+}
@@ -0,0 +1,31 @@
+package json
+
+import "testing"
+
+func TestRawField(t *testing.T) {
+	src := []byte(`{"level":"info","a\"b":{"x":"}","y":[1,{"z":"]"}]}, "n" : -1.5e3,"list":[],"s":"a,b\\","last":true`)
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"level", `"info"`},
+		{`a"b`, `{"x":"}","y":[1,{"z":"]"}]}`},
+		{"n", `-1.5e3`},
+		{"list", `[]`},
+		{"s", `"a,b\\"`},
+		{"last", `true`},
+		{"x", ""},
+		{"missing", ""},
+	}
+	for _, test := range tests {
+		if got := string(enc.RawField(src, test.key)); got != test.want {
+			t.Errorf("RawField(%q) = %s, want: %s", test.key, got, test.want)
+		}
+	}
+
+	for _, src := range []string{"", `"string"`, `{"a":"unterminated`, `{"a"`} {
+		if got := enc.RawField([]byte(src), "a"); got != nil {
+			t.Errorf("RawField(%q) = %s, want: nil", src, got)
+		}
+	}
+}
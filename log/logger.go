@@ -1,14 +1,13 @@
 package log
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"runtime"
 	"strconv"
 	"sync"
 	"time"
-
-	"github.com/bloom42/gobox/log/internal/json"
 )
 
 // A Logger represents an active logging object that generates lines
@@ -36,6 +35,7 @@ type Logger struct {
 	timestampFunc        func() time.Time
 	contextMutex         *sync.Mutex
 	encoder              Encoder
+	redactor             *redactor
 }
 
 // New creates a root logger with given options. If the output writer implements
@@ -59,7 +59,7 @@ func New(options ...LoggerOption) Logger {
 		timeFieldFormat:      DefaultTimeFieldFormat,
 		timestampFunc:        DefaultTimestampFunc,
 		contextMutex:         &sync.Mutex{},
-		encoder:              json.Encoder{},
+		encoder:              EncoderJSON(),
 	}
 	return logger.Clone(options...)
 }
@@ -90,52 +90,94 @@ func (l *Logger) GetLevel() Level {
 
 // LogWithLevel logs a new message with the given level.
 func (l *Logger) LogWithLevel(level Level, message string, fields ...Field) {
-	l.logEvent(level, message, nil, fields)
+	l.logEvent(nil, level, message, nil, fields)
 }
 
 // Debug logs a new message with debug level.
 func (l *Logger) Debug(message string, fields ...Field) {
-	l.logEvent(DebugLevel, message, nil, fields)
+	l.logEvent(nil, DebugLevel, message, nil, fields)
 }
 
 // Info logs a new message with info level.
 func (l *Logger) Info(message string, fields ...Field) {
-	l.logEvent(InfoLevel, message, nil, fields)
+	l.logEvent(nil, InfoLevel, message, nil, fields)
 }
 
 // Warn logs a new message with warn level.
 func (l *Logger) Warn(message string, fields ...Field) {
-	l.logEvent(WarnLevel, message, nil, fields)
+	l.logEvent(nil, WarnLevel, message, nil, fields)
 }
 
 // Error logs a message with error level.
 func (l *Logger) Error(message string, fields ...Field) {
-	l.logEvent(ErrorLevel, message, nil, fields)
+	l.logEvent(nil, ErrorLevel, message, nil, fields)
 }
 
 // Fatal logs a new message with fatal level. The os.Exit(1) function
 // is then called, which terminates the program immediately.
 func (l *Logger) Fatal(message string, fields ...Field) {
-	l.logEvent(FatalLevel, message, func(msg string) { os.Exit(1) }, fields)
+	l.logEvent(nil, FatalLevel, message, func(msg string) { os.Exit(1) }, fields)
 }
 
 // Panic logs a new message with panic level. The panic() function
 // is then called, which stops the ordinary flow of a goroutine.
 func (l *Logger) Panic(message string, fields ...Field) {
-	l.logEvent(PanicLevel, message, func(msg string) { panic(msg) }, fields)
+	l.logEvent(nil, PanicLevel, message, func(msg string) { panic(msg) }, fields)
 }
 
 // Log logs a new message with no level. Setting GlobalLevel to Disabled
 // will still disable events produced by this method.
 func (l *Logger) Log(message string, fields ...Field) {
-	l.logEvent(NoLevel, message, nil, fields)
+	l.logEvent(nil, NoLevel, message, nil, fields)
+}
+
+// LogWithLevelCtx logs a new message with the given level. ctx is made available to hooks.
+func (l *Logger) LogWithLevelCtx(ctx context.Context, level Level, message string, fields ...Field) {
+	l.logEvent(ctx, level, message, nil, fields)
+}
+
+// DebugCtx logs a new message with debug level. ctx is made available to hooks.
+func (l *Logger) DebugCtx(ctx context.Context, message string, fields ...Field) {
+	l.logEvent(ctx, DebugLevel, message, nil, fields)
+}
+
+// InfoCtx logs a new message with info level. ctx is made available to hooks.
+func (l *Logger) InfoCtx(ctx context.Context, message string, fields ...Field) {
+	l.logEvent(ctx, InfoLevel, message, nil, fields)
+}
+
+// WarnCtx logs a new message with warn level. ctx is made available to hooks.
+func (l *Logger) WarnCtx(ctx context.Context, message string, fields ...Field) {
+	l.logEvent(ctx, WarnLevel, message, nil, fields)
+}
+
+// ErrorCtx logs a message with error level. ctx is made available to hooks.
+func (l *Logger) ErrorCtx(ctx context.Context, message string, fields ...Field) {
+	l.logEvent(ctx, ErrorLevel, message, nil, fields)
+}
+
+// FatalCtx logs a new message with fatal level. ctx is made available to hooks.
+// The os.Exit(1) function is then called, which terminates the program immediately.
+func (l *Logger) FatalCtx(ctx context.Context, message string, fields ...Field) {
+	l.logEvent(ctx, FatalLevel, message, func(msg string) { os.Exit(1) }, fields)
+}
+
+// PanicCtx logs a new message with panic level. ctx is made available to hooks.
+// The panic() function is then called, which stops the ordinary flow of a goroutine.
+func (l *Logger) PanicCtx(ctx context.Context, message string, fields ...Field) {
+	l.logEvent(ctx, PanicLevel, message, func(msg string) { panic(msg) }, fields)
+}
+
+// LogCtx logs a new message with no level. ctx is made available to hooks.
+func (l *Logger) LogCtx(ctx context.Context, message string, fields ...Field) {
+	l.logEvent(ctx, NoLevel, message, nil, fields)
 }
 
 // NewDict creates an Event to be used with the Dict method.
 // Call usual field methods like Str, Int etc to add fields to this
 // event and give it as argument the *Event.Dict method.
 func (l *Logger) NewDict(fields ...Field) *Event {
-	e := newEvent(nil, 0)
+	e := newEvent(nil, 0, l.encoder)
 	copyInternalLoggerFieldsToEvent(l, e)
 	e.Append(fields...)
 	return e
@@ -158,19 +200,20 @@ func (l Logger) Write(p []byte) (n int, err error) {
 	return
 }
 
-func (l *Logger) logEvent(level Level, message string, done func(string), fields []Field) {
+func (l *Logger) logEvent(ctx context.Context, level Level, message string, done func(string), fields []Field) {
 	enabled := l.should(level)
 	if !enabled {
 		return
 	}
-	e := newEvent(l.writer, level)
+	e := newEvent(l.writer, level, l.encoder)
+	e.ctx = ctx
 	e.ch = l.hooks
 	copyInternalLoggerFieldsToEvent(l, e)
 	if level != NoLevel {
 		e.string(e.levelFieldName, level.String())
 	}
 	if l.context != nil && len(l.context) > 0 {
-		e.buf = enc.AppendObjectData(e.buf, l.context)
+		e.buf = e.encoder.AppendObjectData(e.buf, l.context)
 	}
 
 	for i := range fields {
@@ -200,22 +243,22 @@ func writeEvent(e *Event, msg string, done func(string)) {
 		var err error
 
 		if e.timestamp {
-			e.buf = enc.AppendTime(enc.AppendKey(e.buf, e.timestampFieldName), e.timestampFunc(), e.timeFieldFormat)
+			e.buf = e.encoder.AppendTime(e.encoder.AppendKey(e.buf, e.timestampFieldName), e.timestampFunc(), e.timeFieldFormat)
 		}
 
 		if msg != "" {
-			e.buf = enc.AppendString(enc.AppendKey(e.buf, e.messageFieldName), msg)
+			e.buf = e.encoder.AppendString(e.encoder.AppendKey(e.buf, e.messageFieldName), msg)
 		}
 		if e.caller {
 			_, file, line, ok := runtime.Caller(e.callerSkipFrameCount)
 			if ok {
-				e.buf = enc.AppendString(enc.AppendKey(e.buf, e.callerFieldName), file+":"+strconv.Itoa(line))
+				e.buf = e.encoder.AppendString(e.encoder.AppendKey(e.buf, e.callerFieldName), file+":"+strconv.Itoa(line))
 			}
 		}
 
 		// end json payload
-		e.buf = enc.AppendEndMarker(e.buf)
-		e.buf = enc.AppendLineBreak(e.buf)
+		e.buf = e.encoder.AppendEndMarker(e.buf)
+		e.buf = e.encoder.AppendLineBreak(e.buf)
 		if e.formatter != nil {
 			e.buf, err = e.formatter(e)
 		}
@@ -251,7 +294,7 @@ func (l *Logger) should(lvl Level) bool {
 // It does not create a noew copy of the logger and rely on a mutex to enable thread safety,
 // so `Clone(Fields(fields...))` often is preferable.
 func (l *Logger) Append(fields ...Field) {
-	e := newEvent(l.writer, l.level)
+	e := newEvent(l.writer, l.level, l.encoder)
 	e.buf = nil
 	copyInternalLoggerFieldsToEvent(l, e)
 	for i := range fields {
@@ -268,7 +311,7 @@ func (l *Logger) Append(fields ...Field) {
 		l.timestamp = e.timestamp
 	}
 	if e.buf != nil {
-		l.context = enc.AppendObjectData(l.context, e.buf)
+		l.context = l.encoder.AppendObjectData(l.context, e.buf)
 	}
 	l.contextMutex.Unlock()
 }
@@ -287,4 +330,5 @@ func copyInternalLoggerFieldsToEvent(l *Logger, e *Event) {
 	e.formatter = l.formatter
 	e.timestampFunc = l.timestampFunc
 	e.encoder = l.encoder
+	e.redactor = l.redactor
 }
@@ -1,3 +1,4 @@
-// Package loghttp provides an helper middleware to log HTTP requests
+// Package loghttp provides an helper middleware to log HTTP requests, and an http.RoundTripper
+// to log outgoing requests.
 // See https://github.com/bloom42/gobox/log/tree/master/examples/http for a working example
 package loghttp
@@ -3,11 +3,17 @@ package loghttp
 import (
 	"bufio"
 	"errors"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bloom42/gobox/log"
+	"github.com/bloom42/gobox/log/pkgerrors"
 	"github.com/bloom42/gobox/uuid"
 )
 
@@ -17,6 +23,9 @@ type ctxKeyRequestID int
 // RequestIDCtxKey is the key that holds the unique request ID in a request context.
 const RequestIDCtxKey ctxKeyRequestID = 0
 
+// TraceparentHeader is the W3C Trace Context header parsed by Handler.
+const TraceparentHeader = "traceparent"
+
 type httpHandler struct {
 	logger             log.Logger
 	message            string
@@ -30,6 +39,15 @@ type httpHandler struct {
 	statusField        string
 	durationField      string
 	requestIDField     string
+	traceIDField       string
+	spanIDField        string
+	ttfbField          string
+	requestHeaders     []string
+	responseHeaders    []string
+	requestBody        bodyCaptureConfig
+	responseBody       bodyCaptureConfig
+	recoverPanics      bool
+	combinedLog        io.Writer
 }
 
 // HandlerOption are used to configure a HTTPHandler.
@@ -112,28 +130,93 @@ func RequestID(requestIDFieldName string) HandlerOption {
 	}
 }
 
-// Handler is a helper middleware to log HTTP requests
+// TraceID is used to updated HTTPHandler's trace ID field name. Set an empty string to disable the field.
+func TraceID(traceIDFieldName string) HandlerOption {
+	return func(handler *httpHandler) {
+		handler.traceIDField = traceIDFieldName
+	}
+}
+
+// SpanID is used to updated HTTPHandler's span ID field name. Set an empty string to disable the field.
+func SpanID(spanIDFieldName string) HandlerOption {
+	return func(handler *httpHandler) {
+		handler.spanIDField = spanIDFieldName
+	}
+}
+
+// TimeToFirstByte is used to updated HTTPHandler's time to first byte field name, which holds
+// the number of milliseconds before the handler started to write the response.
+// Disabled by default.
+func TimeToFirstByte(ttfbFieldName string) HandlerOption {
+	return func(handler *httpHandler) {
+		handler.ttfbField = ttfbFieldName
+	}
+}
+
+// RequestHeaders enables the capture of the given request headers in the request_headers field.
+func RequestHeaders(headers ...string) HandlerOption {
+	return func(handler *httpHandler) {
+		handler.requestHeaders = headers
+	}
+}
+
+// ResponseHeaders enables the capture of the given response headers in the response_headers field.
+func ResponseHeaders(headers ...string) HandlerOption {
+	return func(handler *httpHandler) {
+		handler.responseHeaders = headers
+	}
+}
+
+// RequestBody enables the capture of the first maxSize bytes of the request body in the
+// request_body field, if its content type is in contentTypes. Content types ending with a
+// '/' match all their subtypes. If contentTypes is empty, DefaultBodyContentTypes is used.
+// Only the part of the body read by the handler is captured.
+func RequestBody(maxSize int, contentTypes ...string) HandlerOption {
+	return func(handler *httpHandler) {
+		handler.requestBody = newBodyCaptureConfig(maxSize, contentTypes)
+	}
+}
+
+// ResponseBody enables the capture of the first maxSize bytes of the response body in the
+// response_body field, if its content type is in contentTypes. See RequestBody.
+func ResponseBody(maxSize int, contentTypes ...string) HandlerOption {
+	return func(handler *httpHandler) {
+		handler.responseBody = newBodyCaptureConfig(maxSize, contentTypes)
+	}
+}
+
+// Recover enables the recovery of the panics of the handler: the panic and the stack of the
+// goroutine are logged with the error level, and a 500 response is sent if the handler did
+// not start to write its response. http.ErrAbortHandler is not recovered.
+func Recover(enable bool) HandlerOption {
+	return func(handler *httpHandler) {
+		handler.recoverPanics = enable
+	}
+}
+
+// CombinedLogFormat makes the handler write the access logs to w using the Apache Combined
+// Log Format instead of logging JSON events. A single Write call is made per request.
+// The logger is still used for panics and is available to the handler (see Handler).
+func CombinedLogFormat(w io.Writer) HandlerOption {
+	return func(handler *httpHandler) {
+		handler.combinedLog = w
+	}
+}
+
+// Handler is a helper middleware to log HTTP requests.
+// If the request has a valid traceparent header, the parsed log.TraceContext is associated
+// with the request context so it can be retrieved with log.TraceContextFromCtx.
+//
+// A child logger, holding the request ID and trace fields, is associated with the request
+// context and can be retrieved with log.FromCtx.
 func Handler(logger log.Logger, options ...HandlerOption) func(next http.Handler) http.Handler {
 	logger = logger.Clone()
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 
-			// store a copy of the logger
-			handler := httpHandler{
-				logger:             logger,
-				message:            "access",
-				urlField:           "url",
-				methodField:        "method",
-				schemeField:        "scheme",
-				hostField:          "host",
-				remoteAddressField: "remote_address",
-				userAgentField:     "user_agent",
-				sizeField:          "size",
-				statusField:        "status",
-				durationField:      "duration",
-				requestIDField:     "request_id",
-			}
+			// store a copy of the logger, so appended fields don't leak between requests
+			handler := newHTTPHandler(logger.Clone(), "access")
 			for _, option := range options {
 				option(&handler)
 			}
@@ -143,6 +226,9 @@ func Handler(logger log.Logger, options ...HandlerOption) func(next http.Handler
 				written:        0,
 				status:         200,
 			}
+			if handler.responseBody.maxSize > 0 {
+				resWrapper.body = &bodyCapture{config: handler.responseBody}
+			}
 
 			if f, ok := w.(http.Flusher); ok {
 				resWrapper.Flusher = f
@@ -189,7 +275,42 @@ func Handler(logger log.Logger, options ...HandlerOption) func(next http.Handler
 				handler.logger.Append(log.String(handler.userAgentField, r.Header.Get("user-agent")))
 			}
 
-			next.ServeHTTP(resWrapper, r)
+			var childFields []log.Field
+			if traceparent := r.Header.Get(TraceparentHeader); traceparent != "" {
+				if tc, err := log.ParseTraceparent(traceparent); err == nil {
+					r = r.WithContext(tc.ToCtx(r.Context()))
+					if handler.traceIDField != "" {
+						field := log.String(handler.traceIDField, tc.TraceIDString())
+						handler.logger.Append(field)
+						childFields = append(childFields, field)
+					}
+					if handler.spanIDField != "" {
+						field := log.String(handler.spanIDField, tc.SpanIDString())
+						handler.logger.Append(field)
+						childFields = append(childFields, field)
+					}
+				}
+			}
+
+			if len(handler.requestHeaders) != 0 {
+				handler.logger.Append(headersField(&handler.logger, "request_headers", r.Header, handler.requestHeaders))
+			}
+
+			var reqBody *bodyCapture
+			if handler.requestBody.maxSize > 0 && r.Body != nil && handler.requestBody.allows(r.Header.Get("Content-Type")) {
+				reqBody = &bodyCapture{ReadCloser: r.Body, config: handler.requestBody}
+				r.Body = reqBody
+			}
+
+			if handler.requestIDField != "" {
+				if requestID := requestIDFromCtx(r); requestID != "" {
+					childFields = append(childFields, log.String(handler.requestIDField, requestID))
+				}
+			}
+			child := logger.Clone(log.SetFields(childFields...))
+			r = r.WithContext(child.ToCtx(r.Context()))
+
+			handler.serve(next, resWrapper, r, &child)
 
 			if handler.sizeField != "" {
 				handler.logger.Append(log.Int(handler.sizeField, resWrapper.written))
@@ -209,13 +330,27 @@ func Handler(logger log.Logger, options ...HandlerOption) func(next http.Handler
 			}
 
 			if handler.requestIDField != "" {
-				requestID := ""
-				if rid, ok := r.Context().Value(RequestIDCtxKey).(string); ok {
-					requestID = rid
-				} else if rid, ok := r.Context().Value(RequestIDCtxKey).(uuid.UUID); ok {
-					requestID = rid.String()
-				}
-				handler.logger.Append(log.String(handler.requestIDField, requestID))
+				handler.logger.Append(log.String(handler.requestIDField, requestIDFromCtx(r)))
+			}
+
+			if handler.ttfbField != "" && !resWrapper.firstByte.IsZero() {
+				handler.logger.Append(log.Int64(handler.ttfbField, resWrapper.firstByte.Sub(start).Nanoseconds()/1000000))
+			}
+
+			if len(handler.responseHeaders) != 0 {
+				handler.logger.Append(headersField(&handler.logger, "response_headers", resWrapper.Header(), handler.responseHeaders))
+			}
+
+			if reqBody != nil {
+				handler.logger.Append(reqBody.fields("request_body")...)
+			}
+			if resWrapper.body != nil && resWrapper.body.allowed {
+				handler.logger.Append(resWrapper.body.fields("response_body")...)
+			}
+
+			if handler.combinedLog != nil {
+				handler.writeCombinedLog(r, start, status, resWrapper.written)
+				return
 			}
 
 			switch {
@@ -230,25 +365,108 @@ func Handler(logger log.Logger, options ...HandlerOption) func(next http.Handler
 	}
 }
 
+func newHTTPHandler(logger log.Logger, message string) httpHandler {
+	return httpHandler{
+		logger:             logger,
+		message:            message,
+		urlField:           "url",
+		methodField:        "method",
+		schemeField:        "scheme",
+		hostField:          "host",
+		remoteAddressField: "remote_address",
+		userAgentField:     "user_agent",
+		sizeField:          "size",
+		statusField:        "status",
+		durationField:      "duration",
+		requestIDField:     "request_id",
+		traceIDField:       log.DefaultTraceIDFieldName,
+		spanIDField:        log.DefaultSpanIDFieldName,
+	}
+}
+
+// serve calls next, recovering its panics if enabled.
+func (handler *httpHandler) serve(next http.Handler, w *responseWrapper, r *http.Request, logger *log.Logger) {
+	if handler.recoverPanics {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			// skip this function and runtime.gopanic
+			logger.Error("panic", log.String("panic", fmt.Sprint(rec)), log.Any("stack", pkgerrors.MarshalCallers(2)))
+			if w.firstByte.IsZero() {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			} else {
+				// the response is incomplete
+				w.status = http.StatusInternalServerError
+			}
+		}()
+	}
+	next.ServeHTTP(w, r)
+}
+
+func requestIDFromCtx(r *http.Request) string {
+	if rid, ok := r.Context().Value(RequestIDCtxKey).(string); ok {
+		return rid
+	} else if rid, ok := r.Context().Value(RequestIDCtxKey).(uuid.UUID); ok {
+		return rid.String()
+	}
+	return ""
+}
+
+func headersField(logger *log.Logger, key string, header http.Header, names []string) log.Field {
+	fields := make([]log.Field, 0, len(names))
+	for _, name := range names {
+		if values := header[textproto.CanonicalMIMEHeaderKey(name)]; len(values) == 1 {
+			fields = append(fields, log.String(http.CanonicalHeaderKey(name), values[0]))
+		} else if len(values) > 1 {
+			fields = append(fields, log.Strings(http.CanonicalHeaderKey(name), values))
+		}
+	}
+	return log.Dict(key, logger.NewDict(fields...))
+}
+
 type responseWrapper struct {
 	http.ResponseWriter
 	http.Flusher
 	http.CloseNotifier
 	http.Hijacker
 
-	written int
-	status  int
+	written   int
+	status    int
+	firstByte time.Time
+	body      *bodyCapture
 }
 
 // WriteHeader wrapper to capture status code.
 func (w *responseWrapper) WriteHeader(code int) {
+	if w.firstByte.IsZero() {
+		w.firstByte = time.Now()
+	}
 	w.status = code
 	w.ResponseWriter.WriteHeader(code)
 }
 
 // Write wrapper to capture response size.
 func (w *responseWrapper) Write(b []byte) (int, error) {
+	if w.firstByte.IsZero() {
+		w.firstByte = time.Now()
+	}
+	if w.body != nil && !w.body.sniffed && len(b) != 0 {
+		contentType := w.Header().Get("Content-Type")
+		if contentType == "" {
+			contentType = http.DetectContentType(b)
+		}
+		w.body.allowed = w.body.config.allows(contentType)
+		w.body.sniffed = true
+	}
 	n, err := w.ResponseWriter.Write(b)
+	if w.body != nil && w.body.allowed {
+		w.body.capture(b[:n])
+	}
 	w.written += n
 	return n, err
 }
@@ -273,3 +491,138 @@ func (w *responseWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	}
 	return nil, nil, errors.New("loghttp: http.Hijecker not implemented")
 }
+
+// DefaultBodyContentTypes are the content types of the bodies captured by RequestBody and
+// ResponseBody when no content type is provided.
+var DefaultBodyContentTypes = []string{
+	"application/json",
+	"application/x-www-form-urlencoded",
+	"application/xml",
+	"text/",
+}
+
+type bodyCaptureConfig struct {
+	maxSize      int
+	contentTypes []string
+}
+
+func newBodyCaptureConfig(maxSize int, contentTypes []string) bodyCaptureConfig {
+	if len(contentTypes) == 0 {
+		contentTypes = DefaultBodyContentTypes
+	}
+	return bodyCaptureConfig{maxSize: maxSize, contentTypes: contentTypes}
+}
+
+// allows reports whether bodies of the given content type must be captured.
+func (config bodyCaptureConfig) allows(contentType string) bool {
+	if i := strings.IndexByte(contentType, ';'); i != -1 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if contentType == "" {
+		return false
+	}
+	for _, allowed := range config.contentTypes {
+		if strings.HasSuffix(allowed, "/") {
+			if strings.HasPrefix(contentType, allowed) {
+				return true
+			}
+		} else if contentType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyCapture keeps the first maxSize bytes of a body. It wraps the request body, and is fed
+// by responseWrapper for the response body.
+type bodyCapture struct {
+	io.ReadCloser
+	config    bodyCaptureConfig
+	buf       []byte
+	truncated bool
+	sniffed   bool
+	allowed   bool
+}
+
+func (b *bodyCapture) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.capture(p[:n])
+	return n, err
+}
+
+func (b *bodyCapture) capture(p []byte) {
+	if remaining := b.config.maxSize - len(b.buf); len(p) > remaining {
+		p = p[:remaining]
+		b.truncated = true
+	}
+	b.buf = append(b.buf, p...)
+}
+
+func (b *bodyCapture) fields(key string) []log.Field {
+	fields := []log.Field{log.String(key, string(b.buf))}
+	if b.truncated {
+		fields = append(fields, log.Bool(key+"_truncated", true))
+	}
+	return fields
+}
+
+// writeCombinedLog writes an access log line in the Apache Combined Log Format:
+// host ident authuser [date] "request line" status size "referer" "user agent"
+func (handler *httpHandler) writeCombinedLog(r *http.Request, start time.Time, status, size int) {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	user := "-"
+	if u, _, ok := r.BasicAuth(); ok && u != "" {
+		user = u
+	}
+
+	buf := make([]byte, 0, 256)
+	buf = append(buf, host...)
+	buf = append(buf, " - "...)
+	buf = appendCombinedLogValue(buf, user)
+	buf = append(buf, " ["...)
+	buf = start.AppendFormat(buf, "02/Jan/2006:15:04:05 -0700")
+	buf = append(buf, `] "`...)
+	buf = appendCombinedLogValue(buf, r.Method+" "+r.RequestURI+" "+r.Proto)
+	buf = append(buf, `" `...)
+	buf = strconv.AppendInt(buf, int64(status), 10)
+	buf = append(buf, ' ')
+	if size == 0 {
+		buf = append(buf, '-')
+	} else {
+		buf = strconv.AppendInt(buf, int64(size), 10)
+	}
+	buf = append(buf, ` "`...)
+	buf = appendCombinedLogValue(buf, orDash(r.Referer()))
+	buf = append(buf, `" "`...)
+	buf = appendCombinedLogValue(buf, orDash(r.UserAgent()))
+	buf = append(buf, "\"\n"...)
+	handler.combinedLog.Write(buf)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// appendCombinedLogValue appends value, escaping quotes, backslashes and control characters
+// as Apache does.
+func appendCombinedLogValue(dst []byte, value string) []byte {
+	const hexDigits = "0123456789abcdef"
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '"' || c == '\\':
+			dst = append(dst, '\\', c)
+		case c < 0x20 || c == 0x7f:
+			dst = append(dst, '\\', 'x', hexDigits[c>>4], hexDigits[c&0xf])
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,279 @@
+package loghttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bloom42/gobox/log"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// decodeEvents returns the JSON events written to out, one per line.
+func decodeEvents(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	var events []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func newTestLogger(out *bytes.Buffer) log.Logger {
+	return log.New(log.SetWriter(out), log.SetFields(log.Timestamp(false)))
+}
+
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	out := &bytes.Buffer{}
+	handler := Handler(newTestLogger(out))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+
+	r := httptest.NewRequest("GET", "/hello?a=b", nil)
+	r.Header.Set("User-Agent", "test")
+	r = r.WithContext(context.WithValue(r.Context(), RequestIDCtxKey, "123"))
+	serve(handler, r)
+	serve(handler, httptest.NewRequest("POST", "/missing", nil))
+
+	events := decodeEvents(t, out)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got: %v", events)
+	}
+	delete(events[0], "duration")
+	want := map[string]interface{}{
+		"level":          "info",
+		"message":        "access",
+		"scheme":         "http",
+		"method":         "GET",
+		"url":            "/hello?a=b",
+		"host":           "example.com",
+		"remote_address": "192.0.2.1",
+		"user_agent":     "test",
+		"size":           5.0,
+		"status":         200.0,
+		"request_id":     "123",
+	}
+	if !reflect.DeepEqual(events[0], want) {
+		t.Errorf("invalid event:\ngot:  %v\nwant: %v", events[0], want)
+	}
+	if events[1]["level"] != "warning" || events[1]["status"] != 404.0 || events[1]["method"] != "POST" {
+		t.Errorf("invalid event: %v", events[1])
+	}
+}
+
+func TestHandlerHeadersAndBodies(t *testing.T) {
+	out := &bytes.Buffer{}
+	handler := Handler(newTestLogger(out),
+		RequestHeaders("X-Request", "Accept"),
+		ResponseHeaders("Content-Type", "X-Missing"),
+		RequestBody(5),
+		ResponseBody(100, "text/"),
+		Status(""),
+		Duration(""),
+		URL(""),
+		Host(""),
+		Scheme(""),
+		Method(""),
+		Size(""),
+		RemoteAddress(""),
+		UserAgent(""),
+		RequestID(""),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/image" {
+			w.Write([]byte("\x89PNG\r\n\x1a\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(append([]byte("echo: "), body...))
+	}))
+
+	r := httptest.NewRequest("POST", "/echo", strings.NewReader(`{"a":"b"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Add("Accept", "text/plain")
+	r.Header.Add("Accept", "application/json")
+	r.Header.Set("X-Request", "foo")
+	r.Header.Set("X-Other", "bar")
+	if w := serve(handler, r); w.Body.String() != `echo: {"a":"b"}` {
+		t.Fatalf("invalid response: %q", w.Body.String())
+	}
+
+	// bodies whose content type is not allowed are not captured
+	r = httptest.NewRequest("POST", "/image", strings.NewReader("data"))
+	r.Header.Set("Content-Type", "application/octet-stream")
+	serve(handler, r)
+
+	events := decodeEvents(t, out)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got: %v", events)
+	}
+	want := map[string]interface{}{
+		"level":   "info",
+		"message": "access",
+		"request_headers": map[string]interface{}{
+			"X-Request": "foo",
+			"Accept":    []interface{}{"text/plain", "application/json"},
+		},
+		"response_headers": map[string]interface{}{
+			"Content-Type": "text/plain; charset=utf-8",
+		},
+		"request_body":           `{"a":`,
+		"request_body_truncated": true,
+		"response_body":          `echo: {"a":"b"}`,
+	}
+	if !reflect.DeepEqual(events[0], want) {
+		t.Errorf("invalid event:\ngot:  %v\nwant: %v", events[0], want)
+	}
+	for _, field := range []string{"request_body", "response_body"} {
+		if _, ok := events[1][field]; ok {
+			t.Errorf("%s should not be captured: %v", field, events[1])
+		}
+	}
+}
+
+func TestHandlerRecover(t *testing.T) {
+	out := &bytes.Buffer{}
+	handler := Handler(newTestLogger(out), Recover(true))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/abort" {
+			panic(http.ErrAbortHandler)
+		}
+		if r.URL.Path == "/partial" {
+			w.Write([]byte("partial"))
+		}
+		panic("boom")
+	}))
+
+	w := serve(handler, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("invalid status: %d", w.Code)
+	}
+	w = serve(handler, httptest.NewRequest("GET", "/partial", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Errorf("invalid response: %d %q", w.Code, w.Body.String())
+	}
+
+	events := decodeEvents(t, out)
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got: %v", events)
+	}
+	for i, status := range []float64{500, 500} {
+		panicEvent, access := events[2*i], events[2*i+1]
+		if panicEvent["level"] != "error" || panicEvent["message"] != "panic" || panicEvent["panic"] != "boom" {
+			t.Errorf("invalid panic event: %v", panicEvent)
+		}
+		stack, _ := panicEvent["stack"].([]interface{})
+		if len(stack) == 0 || !strings.Contains(stack[0].(map[string]interface{})["func"].(string), "TestHandlerRecover") {
+			t.Errorf("invalid stack: %v", panicEvent["stack"])
+		}
+		if access["level"] != "error" || access["status"] != status {
+			t.Errorf("invalid access event: %v", access)
+		}
+	}
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("http.ErrAbortHandler was not propagated: %v", rec)
+		}
+	}()
+	serve(handler, httptest.NewRequest("GET", "/abort", nil))
+}
+
+func TestHandlerCombinedLogFormat(t *testing.T) {
+	out := &bytes.Buffer{}
+	combined := &bytes.Buffer{}
+	handler := Handler(newTestLogger(out), CombinedLogFormat(combined))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+
+	r := httptest.NewRequest("GET", `/hello?q="x"`, nil)
+	r.SetBasicAuth("john", "secret")
+	r.Header.Set("Referer", "https://example.org/")
+	r.Header.Set("User-Agent", "agent \"1\"\n")
+	serve(handler, r)
+	serve(handler, httptest.NewRequest("DELETE", "/empty", nil))
+
+	lines := strings.Split(combined.String(), "\n")
+	wants := []string{
+		`^192\.0\.2\.1 - john \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /hello\?q=\\"x\\" HTTP/1\.1" 200 5 "https://example\.org/" "agent \\"1\\"\\x0a"$`,
+		`^192\.0\.2\.1 - - \[[^\]]+\] "DELETE /empty HTTP/1\.1" 204 - "-" "-"$`,
+		`^$`,
+	}
+	if len(lines) != len(wants) {
+		t.Fatalf("invalid combined log: %q", combined.String())
+	}
+	for i, want := range wants {
+		if !regexp.MustCompile(want).MatchString(lines[i]) {
+			t.Errorf("invalid combined log line: %q", lines[i])
+		}
+	}
+	if out.Len() != 0 {
+		t.Errorf("no event should be logged: %s", out.String())
+	}
+}
+
+func TestHandlerChildLogger(t *testing.T) {
+	out := &bytes.Buffer{}
+	handler := Handler(newTestLogger(out))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.FromCtx(r.Context()).Info("inside", log.String("foo", "bar"))
+		if tc, ok := log.TraceContextFromCtx(r.Context()); !ok || tc.String() != testTraceparent {
+			t.Errorf("invalid trace context: %v", tc)
+		}
+	}))
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(TraceparentHeader, testTraceparent)
+		r = r.WithContext(context.WithValue(r.Context(), RequestIDCtxKey, "123"))
+		serve(handler, r)
+	}
+
+	events := decodeEvents(t, out)
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got: %v", events)
+	}
+	want := map[string]interface{}{
+		"level":                     "info",
+		"message":                   "inside",
+		"foo":                       "bar",
+		"request_id":                "123",
+		log.DefaultTraceIDFieldName: "4bf92f3577b34da6a3ce929d0e0e4736",
+		log.DefaultSpanIDFieldName:  "00f067aa0ba902b7",
+	}
+	for _, i := range []int{0, 2} {
+		// the fields of the access log don't leak to the child logger nor between requests
+		if !reflect.DeepEqual(events[i], want) {
+			t.Errorf("invalid event:\ngot:  %v\nwant: %v", events[i], want)
+		}
+		if events[i+1]["message"] != "access" || events[i+1][log.DefaultTraceIDFieldName] != want[log.DefaultTraceIDFieldName] {
+			t.Errorf("invalid access event: %v", events[i+1])
+		}
+	}
+}
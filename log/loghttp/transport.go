@@ -0,0 +1,223 @@
+package loghttp
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bloom42/gobox/log"
+	"github.com/bloom42/gobox/retry"
+)
+
+// RequestIDHeader is the header used by Transport to propagate the request ID.
+const RequestIDHeader = "X-Request-Id"
+
+// TransportOption are used to configure Transport.
+type TransportOption func(*loggingTransport)
+
+// HandlerOptions applies Handler's options to Transport, to configure the message and the
+// field names. The options specific to the server side (such as RemoteAddress, Recover or
+// CombinedLogFormat) are ignored.
+func HandlerOptions(options ...HandlerOption) TransportOption {
+	return func(transport *loggingTransport) {
+		for _, option := range options {
+			option(&transport.handler)
+		}
+	}
+}
+
+// AttemptField is used to updated Transport's attempt field name, which holds the number
+// of the attempt (starting at 1) when retries are enabled. Set an empty string to disable the field.
+func AttemptField(attemptFieldName string) TransportOption {
+	return func(transport *loggingTransport) {
+		transport.attemptField = attemptFieldName
+	}
+}
+
+// Retry makes Transport retry the requests which fail or receive a 5xx response, using
+// the given retry options. Each attempt is logged. The requests with a body are only retried
+// if their GetBody field is set, which is the case for the requests created by
+// http.NewRequest with a bytes.Buffer, bytes.Reader or strings.Reader body.
+//
+// A retry.RetryIf option can restrict the retried errors further, but retries always stop when
+// the request context is done (the delay between attempts is interrupted) or when the body
+// can't be obtained again.
+func Retry(options ...retry.Option) TransportOption {
+	return func(transport *loggingTransport) {
+		transport.retry = true
+		transport.retryOptions = options
+	}
+}
+
+// Transport is a helper middleware to log outgoing HTTP requests. The message and the field
+// names are configured with HandlerOptions. The default message is "request" and the size
+// field holds the content length of the response, when known.
+//
+// The request ID associated to the request context with RequestIDCtxKey is sent in the
+// RequestIDHeader header, unless the request already has one.
+//
+// If next is nil, http.DefaultTransport is used. It can be used with any http.Client:
+//
+//	client := &http.Client{Transport: loghttp.Transport(logger)(nil)}
+func Transport(logger log.Logger, options ...TransportOption) func(next http.RoundTripper) http.RoundTripper {
+	logger = logger.Clone()
+	return func(next http.RoundTripper) http.RoundTripper {
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		transport := &loggingTransport{
+			next:         next,
+			handler:      newHTTPHandler(logger, "request"),
+			attemptField: "attempt",
+		}
+		for _, option := range options {
+			option(transport)
+		}
+		return transport
+	}
+}
+
+type loggingTransport struct {
+	next         http.RoundTripper
+	handler      httpHandler
+	attemptField string
+	retry        bool
+	retryOptions []retry.Option
+}
+
+// errRetryStatus is used to retry the requests which received a 5xx response.
+var errRetryStatus = errors.New("loghttp: server error")
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestID := requestIDFromCtx(req)
+	if requestID != "" && req.Header.Get(RequestIDHeader) == "" {
+		// a RoundTripper must not modify the request
+		req = req.Clone(req.Context())
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+
+	if !t.retry || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return t.roundTrip(req, requestID, 0)
+	}
+
+	var res *http.Response
+	var attempt uint
+	// stopErr ends the retries whatever the caller's retry.RetryIf option returns
+	var stopErr error
+	retryOptions := append([]retry.Option{retry.LastErrorOnly(true)}, t.retryOptions...)
+	retryOptions = append(retryOptions, retry.Context(req.Context()))
+	err := retry.Do(func() error {
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				stopErr = err
+				return nil
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+		attempt++
+		if res != nil {
+			res.Body.Close()
+			res = nil
+		}
+		var err error
+		res, err = t.roundTrip(attemptReq, requestID, attempt)
+		if err != nil {
+			return err
+		}
+		if res.StatusCode >= 500 {
+			return errRetryStatus
+		}
+		return nil
+	}, retryOptions...)
+	if stopErr != nil {
+		err = stopErr
+	}
+	if res != nil {
+		// the last response is returned even if its status is a server error
+		return res, nil
+	}
+	return nil, err
+}
+
+// roundTrip sends req and logs it. attempt is 0 if retries are disabled.
+func (t *loggingTransport) roundTrip(req *http.Request, requestID string, attempt uint) (*http.Response, error) {
+	handler := t.handler
+	logger := handler.logger.Clone()
+	start := time.Now()
+
+	res, err := t.next.RoundTrip(req)
+
+	if handler.schemeField != "" {
+		logger.Append(log.String(handler.schemeField, req.URL.Scheme))
+	}
+	if handler.methodField != "" {
+		logger.Append(log.String(handler.methodField, req.Method))
+	}
+	if handler.urlField != "" {
+		logger.Append(log.String(handler.urlField, redactedURL(req.URL)))
+	}
+	if handler.hostField != "" {
+		logger.Append(log.String(handler.hostField, req.URL.Host))
+	}
+	if handler.userAgentField != "" {
+		logger.Append(log.String(handler.userAgentField, req.Header.Get("user-agent")))
+	}
+	if len(handler.requestHeaders) != 0 {
+		logger.Append(headersField(&logger, "request_headers", req.Header, handler.requestHeaders))
+	}
+	if res != nil {
+		if handler.sizeField != "" && res.ContentLength >= 0 {
+			logger.Append(log.Int64(handler.sizeField, res.ContentLength))
+		}
+		if handler.statusField != "" {
+			logger.Append(log.Int(handler.statusField, res.StatusCode))
+		}
+		if len(handler.responseHeaders) != 0 {
+			logger.Append(headersField(&logger, "response_headers", res.Header, handler.responseHeaders))
+		}
+	}
+	if handler.durationField != "" {
+		logger.Append(log.Int64(handler.durationField, time.Since(start).Nanoseconds()/1000000))
+	}
+	if handler.requestIDField != "" && requestID != "" {
+		logger.Append(log.String(handler.requestIDField, requestID))
+	}
+	if tc, ok := log.TraceContextFromCtx(req.Context()); ok {
+		if handler.traceIDField != "" {
+			logger.Append(log.String(handler.traceIDField, tc.TraceIDString()))
+		}
+		if handler.spanIDField != "" {
+			logger.Append(log.String(handler.spanIDField, tc.SpanIDString()))
+		}
+	}
+	if t.attemptField != "" && attempt > 0 {
+		logger.Append(log.Uint(t.attemptField, attempt))
+	}
+
+	switch {
+	case err != nil:
+		logger.Error(handler.message, log.Err("error", err))
+	case res.StatusCode < 400:
+		logger.Info(handler.message)
+	case res.StatusCode < 500:
+		logger.Warn(handler.message)
+	default:
+		logger.Error(handler.message)
+	}
+	return res, err
+}
+
+// redactedURL returns u as a string, with its password replaced by "xxxxx".
+func redactedURL(u *url.URL) string {
+	if _, ok := u.User.Password(); !ok {
+		return u.String()
+	}
+	redacted := *u
+	redacted.User = url.UserPassword(u.User.Username(), "xxxxx")
+	return redacted.String()
+}
@@ -0,0 +1,245 @@
+package loghttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bloom42/gobox/retry"
+)
+
+// failingServer returns a server which responds with a 503 status to the first failures requests.
+func failingServer(failures int32, requests *int32, bodies chan<- string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(requests, 1)
+		if bodies != nil {
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies <- string(body)
+		}
+		if n <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+}
+
+func TestTransport(t *testing.T) {
+	var requestID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = r.Header.Get(RequestIDHeader)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	client := &http.Client{Transport: Transport(newTestLogger(out), HandlerOptions(Duration(""), Message("out")))(nil)}
+
+	req, _ := http.NewRequest("GET", server.URL+"/hello", nil)
+	req = req.WithContext(context.WithValue(req.Context(), RequestIDCtxKey, "123"))
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if requestID != "123" {
+		t.Errorf("invalid request ID header: %q", requestID)
+	}
+	if req.Header.Get(RequestIDHeader) != "" {
+		t.Error("the request was modified")
+	}
+
+	// an existing header is kept
+	req, _ = http.NewRequest("GET", server.URL+"/missing", nil)
+	req.Header.Set(RequestIDHeader, "456")
+	req = req.WithContext(context.WithValue(req.Context(), RequestIDCtxKey, "123"))
+	res, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if requestID != "456" {
+		t.Errorf("invalid request ID header: %q", requestID)
+	}
+
+	events := decodeEvents(t, out)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got: %v", events)
+	}
+	want := map[string]interface{}{
+		"level":      "info",
+		"message":    "out",
+		"scheme":     "http",
+		"method":     "GET",
+		"url":        server.URL + "/hello",
+		"host":       strings.TrimPrefix(server.URL, "http://"),
+		"size":       5.0,
+		"status":     200.0,
+		"request_id": "123",
+	}
+	for key, value := range want {
+		if events[0][key] != value {
+			t.Errorf("invalid %s field: %v (want %v)", key, events[0][key], value)
+		}
+	}
+	if _, ok := events[0]["attempt"]; ok {
+		t.Errorf("attempt should not be logged without retries: %v", events[0])
+	}
+	if events[1]["level"] != "warning" || events[1]["status"] != 404.0 {
+		t.Errorf("invalid event: %v", events[1])
+	}
+}
+
+func TestTransportRetry(t *testing.T) {
+	var requests int32
+	bodies := make(chan string, 3)
+	server := failingServer(2, &requests, bodies)
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	client := &http.Client{Transport: Transport(newTestLogger(out), Retry(retry.Delay(time.Millisecond)))(nil)}
+
+	res, err := client.Post(server.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("invalid response: %d %q", res.StatusCode, body)
+	}
+	if requests != 3 {
+		t.Fatalf("expected 3 requests, got: %d", requests)
+	}
+	for i := 0; i < 3; i++ {
+		if body := <-bodies; body != "body" {
+			t.Errorf("the body of the attempt %d was not sent again: %q", i+1, body)
+		}
+	}
+
+	events := decodeEvents(t, out)
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got: %v", events)
+	}
+	for i, event := range events {
+		level, status := "error", 503.0
+		if i == 2 {
+			level, status = "info", 200.0
+		}
+		if event["level"] != level || event["status"] != status || event["attempt"] != float64(i+1) {
+			t.Errorf("invalid event: %v", event)
+		}
+	}
+}
+
+func TestTransportRetryServerError(t *testing.T) {
+	var requests int32
+	server := failingServer(10, &requests, nil)
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	transport := Transport(newTestLogger(out), Retry(retry.Attempts(3), retry.Delay(time.Millisecond)), AttemptField("try"))
+	client := &http.Client{Transport: transport(nil)}
+
+	// the last response is returned
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable || requests != 3 {
+		t.Errorf("invalid response: %d after %d requests", res.StatusCode, requests)
+	}
+	events := decodeEvents(t, out)
+	if len(events) != 3 || events[2]["try"] != 3.0 {
+		t.Errorf("invalid events: %v", events)
+	}
+}
+
+func TestTransportRetryWithoutGetBody(t *testing.T) {
+	var requests int32
+	server := failingServer(1, &requests, nil)
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	client := &http.Client{Transport: Transport(newTestLogger(out), Retry(retry.Delay(time.Millisecond)))(nil)}
+
+	// the body of the request can't be sent twice
+	body := ioutil.NopCloser(io.MultiReader(strings.NewReader("body")))
+	req, _ := http.NewRequest("POST", server.URL, body)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable || requests != 1 {
+		t.Errorf("invalid response: %d after %d requests", res.StatusCode, requests)
+	}
+	events := decodeEvents(t, out)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got: %v", events)
+	}
+	if _, ok := events[0]["attempt"]; ok {
+		t.Errorf("attempt should not be logged without retries: %v", events[0])
+	}
+
+	// GetBody errors stop the retries, whatever the caller's RetryIf returns
+	requests = 0
+	out.Reset()
+	transport := Transport(newTestLogger(out), Retry(
+		retry.Delay(time.Millisecond),
+		retry.RetryIf(func(error) bool { return true }),
+	))
+	client = &http.Client{Transport: transport(nil)}
+	req, _ = http.NewRequest("POST", server.URL, strings.NewReader("body"))
+	req.GetBody = func() (io.ReadCloser, error) { return nil, errors.New("no body") }
+	res, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable || requests != 1 {
+		t.Errorf("invalid response: %d after %d requests", res.StatusCode, requests)
+	}
+}
+
+func TestTransportRetryContext(t *testing.T) {
+	var requests int32
+	server := failingServer(10, &requests, nil)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &bytes.Buffer{}
+	transport := Transport(newTestLogger(out), Retry(
+		retry.Delay(time.Minute),
+		retry.OnRetry(func(uint, error) { cancel() }),
+		retry.RetryIf(func(error) bool { return true }),
+	))
+	client := &http.Client{Transport: transport(nil)}
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	start := time.Now()
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if time.Since(start) > 10*time.Second {
+		t.Error("the delay between attempts was not interrupted")
+	}
+	if res.StatusCode != http.StatusServiceUnavailable || requests != 1 {
+		t.Errorf("invalid response: %d after %d requests", res.StatusCode, requests)
+	}
+}
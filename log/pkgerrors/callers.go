@@ -0,0 +1,50 @@
+package pkgerrors
+
+import (
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	callersSourceFileName     = "source"
+	callersSourceLineName     = "line"
+	callersSourceFunctionName = "func"
+)
+
+// MarshalCallers returns the stack of the calling goroutine, skipping skip frames
+// (0 being the caller of MarshalCallers), in the same format as the stacks of pkg/errors.
+// It is useful when no error carries a stack, such as when recovering from a panic.
+//
+//   log.Any("stack", pkgerrors.MarshalCallers(0))
+func MarshalCallers(skip int) interface{} {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	out := make([]map[string]string, 0, n)
+	for {
+		frame, more := frames.Next()
+		out = append(out, map[string]string{
+			callersSourceFileName:     filepath.Base(frame.File),
+			callersSourceLineName:     strconv.Itoa(frame.Line),
+			callersSourceFunctionName: funcName(frame.Function),
+		})
+		if !more {
+			break
+		}
+	}
+	return out
+}
+
+// funcName removes the path and package prefix of the function name.
+func funcName(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
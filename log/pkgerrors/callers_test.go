@@ -0,0 +1,22 @@
+package pkgerrors
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/bloom42/gobox/log"
+)
+
+func TestMarshalCallers(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := log.New(log.SetWriter(out), log.SetFields(log.Timestamp(false)))
+
+	logger.Log("", log.Any("stack", MarshalCallers(0)))
+
+	got := out.String()
+	want := `\{"stack":\[\{"func":"TestMarshalCallers","line":"15","source":"callers_test.go"\},.*\]\}\n`
+	if ok, _ := regexp.MatchString(want, got); !ok {
+		t.Errorf("invalid log output:\ngot:  %v\nwant: %v", got, want)
+	}
+}
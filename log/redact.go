@@ -0,0 +1,360 @@
+package log
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bloom42/gobox/crypto"
+	"github.com/bloom42/gobox/validator"
+)
+
+// RedactAction defines how a redacted field is rewritten.
+type RedactAction int
+
+const (
+	// RedactMask replaces the value with DefaultRedactedValue.
+	RedactMask RedactAction = iota
+	// RedactHash replaces the value with its hex encoded BLAKE2b-256 hash, so identical
+	// values can still be correlated.
+	RedactHash
+	// RedactDrop removes the field.
+	RedactDrop
+)
+
+// RedactRule selects the fields to redact. A rule applies to a field if its key matches
+// one of Keys (or Keys is empty) and its value matches Match (or Match is nil).
+// Match is only called with string values (including strings nested in Any values):
+// other values never match a rule with Match set.
+type RedactRule struct {
+	// Keys are case insensitive glob patterns (see path.Match) matched against the field keys,
+	// such as "*password*" or "authorization".
+	Keys []string
+	// Match reports whether a value is sensitive.
+	Match func(value string) bool
+	// Action is applied to the fields matched by the rule.
+	Action RedactAction
+}
+
+// RedactKeys returns a rule applying action to the fields whose key matches one of patterns.
+func RedactKeys(action RedactAction, patterns ...string) RedactRule {
+	return RedactRule{Keys: patterns, Action: action}
+}
+
+// RedactValues returns a rule applying action to the string values for which match returns true.
+func RedactValues(action RedactAction, match func(value string) bool) RedactRule {
+	return RedactRule{Match: match, Action: action}
+}
+
+// RedactJWT returns a rule applying action to the values which look like JSON Web Tokens,
+// with an optional "Bearer " prefix.
+func RedactJWT(action RedactAction) RedactRule {
+	return RedactValues(action, isJWT)
+}
+
+// RedactCreditCard returns a rule applying action to credit card numbers.
+func RedactCreditCard(action RedactAction) RedactRule {
+	return RedactValues(action, validator.IsCreditCard)
+}
+
+// RedactEmail returns a rule applying action to email addresses.
+func RedactEmail(action RedactAction) RedactRule {
+	return RedactValues(action, validator.IsEmail)
+}
+
+// redactKeysCacheSize is the maximum number of keys for which the matching rules are cached,
+// so that the cache does not grow without bound with dynamic keys.
+const redactKeysCacheSize = 1024
+
+// redactor applies redaction rules to the fields of the events, before they are encoded.
+type redactor struct {
+	rules []RedactRule
+	// keys caches the indexes of the rules matching a key
+	keys      sync.Map
+	keysCount int32
+}
+
+func newRedactor(rules []RedactRule) *redactor {
+	r := &redactor{rules: make([]RedactRule, len(rules))}
+	for i, rule := range rules {
+		keys := make([]string, len(rule.Keys))
+		for j, key := range rule.Keys {
+			keys[j] = strings.ToLower(key)
+		}
+		rule.Keys = keys
+		r.rules[i] = rule
+	}
+	return r
+}
+
+func (r *redactor) rulesForKey(key string) []int {
+	if cached, ok := r.keys.Load(key); ok {
+		return cached.([]int)
+	}
+	lowerKey := strings.ToLower(key)
+	matching := []int{}
+	for i, rule := range r.rules {
+		if len(rule.Keys) == 0 {
+			matching = append(matching, i)
+			continue
+		}
+		for _, pattern := range rule.Keys {
+			if matched, _ := path.Match(pattern, lowerKey); matched {
+				matching = append(matching, i)
+				break
+			}
+		}
+	}
+	if atomic.LoadInt32(&r.keysCount) < redactKeysCacheSize {
+		if _, loaded := r.keys.LoadOrStore(key, matching); !loaded {
+			atomic.AddInt32(&r.keysCount, 1)
+		}
+	}
+	return matching
+}
+
+// keyAction returns the action of the first rule matching key without matching its value.
+func (r *redactor) keyAction(key string) (RedactAction, bool) {
+	for _, i := range r.rulesForKey(key) {
+		if r.rules[i].Match == nil {
+			return r.rules[i].Action, true
+		}
+	}
+	return 0, false
+}
+
+// stringAction returns the action of the first rule matching key and value.
+func (r *redactor) stringAction(key, value string) (RedactAction, bool) {
+	for _, i := range r.rulesForKey(key) {
+		if r.rules[i].Match == nil || r.rules[i].Match(value) {
+			return r.rules[i].Action, true
+		}
+	}
+	return 0, false
+}
+
+// redactText returns text, a free form text such as an error message, redacted: the rules
+// matching key and the whole text are applied, then the value rules are applied to each word
+// of the text, so that the secrets it contains are redacted. It returns false if the text
+// must be dropped.
+func (r *redactor) redactText(key, text string) (string, bool) {
+	if action, ok := r.stringAction(key, text); ok {
+		redacted, keep := redactedValue(action, text)
+		if !keep {
+			return "", false
+		}
+		return redacted.(string), true
+	}
+
+	var redacted strings.Builder
+	last := 0
+	for start := 0; start < len(text); {
+		end := strings.IndexFunc(text[start:], isTextSeparator)
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start
+		}
+		word := strings.TrimRight(text[start:end], ".:!?")
+		if action, ok := r.wordAction(key, word); ok {
+			redacted.WriteString(text[last:start])
+			if replacement, keep := redactedValue(action, word); keep {
+				redacted.WriteString(replacement.(string))
+			}
+			last = start + len(word)
+		}
+		if end < len(text) {
+			_, size := utf8.DecodeRuneInString(text[end:])
+			end += size - 1
+		}
+		start = end + 1
+	}
+	if last == 0 {
+		return text, true
+	}
+	redacted.WriteString(text[last:])
+	return redacted.String(), true
+}
+
+// wordAction returns the action of the first value rule matching key and word.
+func (r *redactor) wordAction(key, word string) (RedactAction, bool) {
+	if word == "" {
+		return 0, false
+	}
+	for _, i := range r.rulesForKey(key) {
+		if r.rules[i].Match != nil && r.rules[i].Match(word) {
+			return r.rules[i].Action, true
+		}
+	}
+	return 0, false
+}
+
+func isTextSeparator(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("\"'`()<>[]{},;=", r)
+}
+
+// redactValue returns v redacted, and false if it must be dropped. Maps and slices
+// (as decoded from JSON) are walked recursively.
+func (r *redactor) redactValue(key string, v interface{}) (interface{}, bool) {
+	switch val := v.(type) {
+	case string:
+		if action, ok := r.stringAction(key, val); ok {
+			return redactedValue(action, val)
+		}
+		return val, true
+	case map[string]interface{}:
+		if action, ok := r.keyAction(key); ok {
+			return redactedValue(action, val)
+		}
+		return r.redactMap(val), true
+	case []interface{}:
+		if action, ok := r.keyAction(key); ok {
+			return redactedValue(action, val)
+		}
+		redacted := make([]interface{}, 0, len(val))
+		for _, elem := range val {
+			if elem, keep := r.redactValue(key, elem); keep {
+				redacted = append(redacted, elem)
+			}
+		}
+		return redacted, true
+	case []string:
+		if action, ok := r.keyAction(key); ok {
+			return redactedValue(action, val)
+		}
+		return r.redactStrings(key, val), true
+	default:
+		if action, ok := r.keyAction(key); ok {
+			return redactedValue(action, val)
+		}
+		return val, true
+	}
+}
+
+func (r *redactor) redactMap(fields map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		if value, keep := r.redactValue(key, value); keep {
+			redacted[key] = value
+		}
+	}
+	return redacted
+}
+
+func (r *redactor) redactStrings(key string, vals []string) []string {
+	redacted := make([]string, 0, len(vals))
+	for _, val := range vals {
+		if action, ok := r.stringAction(key, val); ok {
+			if action == RedactDrop {
+				continue
+			}
+			redactedVal, _ := redactedValue(action, val)
+			val = redactedVal.(string)
+		}
+		redacted = append(redacted, val)
+	}
+	return redacted
+}
+
+func redactedValue(action RedactAction, value interface{}) (interface{}, bool) {
+	switch action {
+	case RedactDrop:
+		return nil, false
+	case RedactHash:
+		var data []byte
+		switch v := value.(type) {
+		case string:
+			data = []byte(v)
+		case []byte:
+			data = v
+		default:
+			data = []byte(fmt.Sprint(v))
+		}
+		return hex.EncodeToString(crypto.Hash256(data)), true
+	default:
+		return DefaultRedactedValue, true
+	}
+}
+
+// redact applies the rules matching key to value: value rules only apply to string values.
+// It returns true if the field has been redacted, in which case value must not be appended
+// to the event.
+func (e *Event) redact(key string, value interface{}) bool {
+	var action RedactAction
+	var ok bool
+	if s, isString := value.(string); isString {
+		action, ok = e.redactor.stringAction(key, s)
+	} else {
+		action, ok = e.redactor.keyAction(key)
+	}
+	if !ok {
+		return false
+	}
+	if redacted, keep := redactedValue(action, value); keep {
+		e.buf = e.encoder.AppendString(e.encoder.AppendKey(e.buf, key), redacted.(string))
+	}
+	return true
+}
+
+// redactText returns val, a free form text, redacted with the rules of the event
+// (see redactor.redactText). It returns false if the field must be dropped.
+func (e *Event) redactText(key, val string) (string, bool) {
+	if e.redactor == nil {
+		return val, true
+	}
+	return e.redactor.redactText(key, val)
+}
+
+// redactJSON decodes j, redacts it and returns it marshaled back to JSON.
+func (e *Event) redactJSON(key string, j []byte) ([]byte, bool) {
+	if action, ok := e.redactor.keyAction(key); ok {
+		redacted, keep := redactedValue(action, j)
+		if !keep {
+			return nil, false
+		}
+		quoted, _ := json.Marshal(redacted)
+		return quoted, true
+	}
+	var value interface{}
+	d := json.NewDecoder(bytes.NewReader(j))
+	d.UseNumber()
+	if err := d.Decode(&value); err != nil {
+		// not valid JSON: only key rules can be applied
+		return j, true
+	}
+	value, keep := e.redactor.redactValue(key, value)
+	if !keep {
+		return nil, false
+	}
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return j, true
+	}
+	return redacted, true
+}
+
+func isJWT(value string) bool {
+	value = strings.TrimPrefix(value, "Bearer ")
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 || len(parts[0]) < 4 || len(parts[1]) < 4 {
+		return false
+	}
+	// the header of a JWT is a JSON object: {"...
+	if !strings.HasPrefix(parts[0], "eyJ") {
+		return false
+	}
+	for _, part := range parts {
+		if _, err := base64.RawURLEncoding.DecodeString(part); err != nil {
+			return false
+		}
+	}
+	return true
+}
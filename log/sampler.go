@@ -1,7 +1,10 @@
 package log
 
 import (
+	"fmt"
+	"hash/fnv"
 	"math/rand"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -128,3 +131,195 @@ func (s SamplerLevel) Sample(lvl Level) bool {
 	}
 	return true
 }
+
+// SamplerBelowLevel passes the decision for events below Level to Sampler and
+// never drops events at or above Level. If Sampler is nil, all events are kept.
+//
+// For example, to keep all warnings and errors, and the first 100 other events per second
+// then 1 out of 10:
+//
+//	sampler := log.SamplerBelowLevel{
+//		Level: log.WarnLevel,
+//		Sampler: &log.SamplerBurst{Burst: 100, Period: time.Second, NextSampler: &log.SamplerBasic{N: 10}},
+//	}
+type SamplerBelowLevel struct {
+	Level   Level
+	Sampler Sampler
+}
+
+// Sample implements the Sampler interface.
+func (s SamplerBelowLevel) Sample(lvl Level) bool {
+	if lvl >= s.Level || s.Sampler == nil {
+		return true
+	}
+	return s.Sampler.Sample(lvl)
+}
+
+// SamplerDedup suppresses identical events: an event is logged once per Interval, and the
+// duplicates logged during the interval are dropped. The next logged event carries
+// the number of suppressed events in the FieldName field. The counts which are not reported
+// this way, because no identical event is logged after the interval, are logged with the
+// last suppressed event when the sampler sweeps its expired entries, or by Flush.
+//
+// Events are identified by their message and the encoded values of Fields. As a Sampler only
+// knows the level of the event, SamplerDedup is a Hook and must be installed with AddHook.
+type SamplerDedup struct {
+	// Interval during which duplicates are suppressed. If 0, no event is suppressed.
+	Interval time.Duration
+	// Fields are the names of the fields which, along with the message, identify an event.
+	Fields []string
+	// FieldName is the name of the field holding the number of suppressed events.
+	// If empty, DefaultSuppressedFieldName is used.
+	FieldName string
+
+	mutex   sync.Mutex
+	entries map[uint64]*dedupEntry
+	sweepAt int64
+}
+
+type dedupEntry struct {
+	until      int64
+	suppressed uint64
+	// last is a copy of the last suppressed event, used to report the suppressed count when
+	// no identical event is logged after the interval
+	last    Event
+	message string
+}
+
+// rawFieldEncoder is implemented by the encoders able to find a field in an encoded object.
+type rawFieldEncoder interface {
+	RawField(src []byte, key string) []byte
+}
+
+// Run implements the Hook interface.
+func (s *SamplerDedup) Run(e *Event, level Level, message string) {
+	if s.Interval <= 0 || level == Disabled {
+		return
+	}
+	key := s.key(e, message)
+	now := time.Now().UnixNano()
+
+	s.mutex.Lock()
+	if s.entries == nil {
+		s.entries = map[uint64]*dedupEntry{}
+	}
+	expired := s.sweep(now)
+	entry, ok := s.entries[key]
+	if ok && now < entry.until {
+		entry.suppressed++
+		buf := entry.last.buf
+		entry.last = *e
+		entry.last.buf = append(buf[:0], e.buf...)
+		entry.last.ch = nil
+		entry.last.ctx = nil
+		entry.last.done = nil
+		entry.message = message
+		s.mutex.Unlock()
+		s.report(expired)
+		e.discard()
+		return
+	}
+	var suppressed uint64
+	if ok {
+		suppressed = entry.suppressed
+		entry.suppressed = 0
+		entry.until = now + s.Interval.Nanoseconds()
+	} else {
+		s.entries[key] = &dedupEntry{until: now + s.Interval.Nanoseconds()}
+	}
+	s.mutex.Unlock()
+	s.report(expired)
+
+	if suppressed > 0 {
+		e.uint64(s.fieldName(), suppressed)
+	}
+}
+
+// Flush logs the counts of suppressed events which have not been reported yet, with the
+// last suppressed event. It should be called before exiting so that no count is lost.
+func (s *SamplerDedup) Flush() {
+	var pending []*dedupEntry
+	s.mutex.Lock()
+	for _, entry := range s.entries {
+		if entry.suppressed > 0 {
+			pending = append(pending, &dedupEntry{suppressed: entry.suppressed, last: entry.last, message: entry.message})
+			entry.suppressed = 0
+		}
+	}
+	s.mutex.Unlock()
+	s.report(pending)
+}
+
+func (s *SamplerDedup) fieldName() string {
+	if s.FieldName == "" {
+		return DefaultSuppressedFieldName
+	}
+	return s.FieldName
+}
+
+// report logs the last suppressed events of entries with their count of suppressed events.
+func (s *SamplerDedup) report(entries []*dedupEntry) {
+	for _, entry := range entries {
+		e := eventPool.Get().(*Event)
+		buf := e.buf
+		*e = entry.last
+		e.buf = append(buf[:0], entry.last.buf...)
+		e.uint64(s.fieldName(), entry.suppressed)
+		writeEvent(e, entry.message, nil)
+	}
+}
+
+// key returns the hash of the message and of the encoded values of s.Fields.
+func (s *SamplerDedup) key(e *Event, message string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(message))
+	if len(s.Fields) == 0 {
+		return hash.Sum64()
+	}
+	if encoder, ok := e.encoder.(rawFieldEncoder); ok {
+		for _, name := range s.Fields {
+			value := encoder.RawField(e.buf, name)
+			if value != nil {
+				hash.Write([]byte{1})
+			} else {
+				hash.Write([]byte{0})
+			}
+			hash.Write(value)
+		}
+		return hash.Sum64()
+	}
+
+	fields, err := e.Fields()
+	if err != nil {
+		return hash.Sum64()
+	}
+	for _, name := range s.Fields {
+		hash.Write([]byte{0})
+		if value, ok := fields[name]; ok {
+			fmt.Fprint(hash, value)
+		}
+	}
+	return hash.Sum64()
+}
+
+// sweep removes the entries expired for more than an interval, so the memory used
+// by the sampler does not grow with the number of distinct events. Entries which
+// expired more recently are kept to report their suppressed events. The removed entries
+// with suppressed events are returned to be reported.
+func (s *SamplerDedup) sweep(now int64) []*dedupEntry {
+	if now < s.sweepAt {
+		return nil
+	}
+	interval := s.Interval.Nanoseconds()
+	s.sweepAt = now + interval
+	var expired []*dedupEntry
+	for key, entry := range s.entries {
+		if entry.until+interval < now {
+			delete(s.entries, key)
+			if entry.suppressed > 0 {
+				expired = append(expired, entry)
+			}
+		}
+	}
+	return expired
+}
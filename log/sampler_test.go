@@ -1,6 +1,11 @@
 package log
 
 import (
+	"bytes"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -47,6 +52,13 @@ var samplers = []struct {
 		},
 		120, 40, 40,
 	},
+	{
+		"SamplerBelowLevel",
+		func() Sampler {
+			return SamplerBelowLevel{Level: WarnLevel, Sampler: &SamplerBasic{N: 5}}
+		},
+		100, 20, 20,
+	},
 }
 
 func TestSamplers(t *testing.T) {
@@ -67,6 +79,84 @@ func TestSamplers(t *testing.T) {
 	}
 }
 
+func TestSamplerBelowLevel(t *testing.T) {
+	sampler := SamplerBelowLevel{Level: WarnLevel, Sampler: &SamplerBurst{Burst: 1, Period: time.Hour}}
+	for _, lvl := range []Level{WarnLevel, ErrorLevel, FatalLevel, PanicLevel, WarnLevel} {
+		if !sampler.Sample(lvl) {
+			t.Errorf("event of level %s dropped", lvl)
+		}
+	}
+	if !sampler.Sample(DebugLevel) {
+		t.Error("first debug event dropped")
+	}
+	if sampler.Sample(InfoLevel) {
+		t.Error("info event after the burst not dropped")
+	}
+}
+
+func TestSamplerDedup(t *testing.T) {
+	out := &bytes.Buffer{}
+	sampler := &SamplerDedup{Interval: 50 * time.Millisecond, Fields: []string{"user"}}
+	logger := New(SetWriter(out), SetFields(Timestamp(false)), AddHook(sampler))
+
+	for i := 0; i < 5; i++ {
+		logger.Error("failed", String("user", "a"), Err("error", errors.New("boom")))
+	}
+	logger.Error("failed", String("user", "b"))
+	logger.Error("other")
+	time.Sleep(60 * time.Millisecond)
+	logger.Error("failed", String("user", "a"))
+	logger.Error("failed", String("user", "a"), Int("n", 1))
+	sampler.Flush()
+	sampler.Flush()
+
+	want := `{"level":"error","user":"a","error":"boom","message":"failed"}` + "\n" +
+		`{"level":"error","user":"b","message":"failed"}` + "\n" +
+		`{"level":"error","message":"other"}` + "\n" +
+		`{"level":"error","user":"a","suppressed":4,"message":"failed"}` + "\n" +
+		`{"level":"error","user":"a","n":1,"suppressed":1,"message":"failed"}` + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("invalid log output:\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+func TestSamplerDedupSweep(t *testing.T) {
+	for _, encoder := range []Encoder{EncoderJSON(), EncoderCBOR()} {
+		out := &bytes.Buffer{}
+		sampler := &SamplerDedup{Interval: 20 * time.Millisecond, Fields: []string{"user", "n"}}
+		logger := New(SetWriter(out), SetEncoder(encoder), SetFields(Timestamp(false)), AddHook(sampler))
+
+		logger.Info("hello", String("user", "a"), Int("n", 1))
+		logger.Info("hello", String("user", "a"), Int("n", 1))
+		logger.Info("hello", String("user", "a"), Int("n", 2))
+		logger.Info("hello", String("user", "a"), Int("n", 2))
+		logger.Info("hello", String("user", "a"), Int("n", 2))
+		// the entries expired for more than an interval are reported when sweeping
+		time.Sleep(50 * time.Millisecond)
+		logger.Info("other")
+
+		converted := out
+		if _, ok := encoder.(binaryEncoder); ok {
+			converted = &bytes.Buffer{}
+			if err := CBORToJSON(converted, out); err != nil {
+				t.Fatal(err)
+			}
+		}
+		lines := strings.Split(strings.TrimSpace(converted.String()), "\n")
+		sort.Strings(lines[2:4])
+		want := []string{
+			`{"level":"info","user":"a","n":1,"message":"hello"}`,
+			`{"level":"info","user":"a","n":2,"message":"hello"}`,
+			`{"level":"info","user":"a","n":1,"suppressed":1,"message":"hello"}`,
+			`{"level":"info","user":"a","n":2,"suppressed":2,"message":"hello"}`,
+			`{"level":"info","message":"other"}`,
+		}
+		if !reflect.DeepEqual(lines, want) {
+			t.Errorf("invalid log output:\ngot:  %q\nwant: %q", lines, want)
+		}
+	}
+}
+
 func BenchmarkSamplers(b *testing.B) {
 	for i := range samplers {
 		s := samplers[i]
@@ -0,0 +1,273 @@
+// +build go1.21
+
+package log
+
+// slog.go file contains the bridges between Logger and the log/slog package
+// of the standard library.
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type slogHandler struct {
+	logger      Logger
+	groups      []string
+	groupsAttrs [][]slog.Attr
+}
+
+// NewSlogHandler returns a slog.Handler which logs the records with logger.
+//
+// Attributes are converted to fields, groups to dicts and the logger's fields
+// are kept. Attributes added with WithAttrs are appended to the logger's fields.
+func NewSlogHandler(logger Logger) slog.Handler {
+	return &slogHandler{logger: logger.Clone()}
+}
+
+// Enabled implements the slog.Handler interface.
+func (h *slogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	lvl := levelFromSlog(level)
+	return h.logger.level != Disabled && lvl >= h.logger.level
+}
+
+// Handle implements the slog.Handler interface.
+func (h *slogHandler) Handle(ctx context.Context, record slog.Record) error {
+	fields := make([]Field, 0, record.NumAttrs()+3)
+	record.Attrs(func(attr slog.Attr) bool {
+		fields = h.appendAttr(fields, attr)
+		return true
+	})
+
+	for i := len(h.groups) - 1; i >= 0; i-- {
+		groupFields := h.appendAttrs(nil, h.groupsAttrs[i])
+		groupFields = append(groupFields, fields...)
+		fields = fields[:0]
+		if len(groupFields) != 0 {
+			fields = append(fields, Dict(h.groups[i], h.logger.NewDict(groupFields...)))
+		}
+	}
+
+	if h.logger.caller && record.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		fields = append(fields, Caller(false), String(h.logger.callerFieldName, frame.File+":"+strconv.Itoa(frame.Line)))
+	}
+	if h.logger.timestamp && !record.Time.IsZero() {
+		fields = append(fields, Timestamp(false), Time(h.logger.timestampFieldName, record.Time))
+	}
+
+	h.logger.LogWithLevelCtx(ctx, levelFromSlog(record.Level), record.Message, fields...)
+	return nil
+}
+
+// WithAttrs implements the slog.Handler interface.
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	handler := h.clone()
+	if len(handler.groups) == 0 {
+		handler.logger = handler.logger.Clone(SetFields(h.appendAttrs(nil, attrs)...))
+	} else {
+		last := len(handler.groupsAttrs) - 1
+		groupAttrs := handler.groupsAttrs[last]
+		handler.groupsAttrs[last] = append(groupAttrs[:len(groupAttrs):len(groupAttrs)], attrs...)
+	}
+	return handler
+}
+
+// WithGroup implements the slog.Handler interface.
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	handler := h.clone()
+	handler.groups = append(handler.groups, name)
+	handler.groupsAttrs = append(handler.groupsAttrs, nil)
+	return handler
+}
+
+func (h *slogHandler) clone() *slogHandler {
+	handler := &slogHandler{
+		logger:      h.logger,
+		groups:      h.groups[:len(h.groups):len(h.groups)],
+		groupsAttrs: make([][]slog.Attr, len(h.groupsAttrs)),
+	}
+	copy(handler.groupsAttrs, h.groupsAttrs)
+	return handler
+}
+
+func (h *slogHandler) appendAttrs(fields []Field, attrs []slog.Attr) []Field {
+	for _, attr := range attrs {
+		fields = h.appendAttr(fields, attr)
+	}
+	return fields
+}
+
+func (h *slogHandler) appendAttr(fields []Field, attr slog.Attr) []Field {
+	value := attr.Value.Resolve()
+	if attr.Key == "" && value.Kind() != slog.KindGroup {
+		return fields
+	}
+
+	switch value.Kind() {
+	case slog.KindString:
+		return append(fields, String(attr.Key, value.String()))
+	case slog.KindInt64:
+		return append(fields, Int64(attr.Key, value.Int64()))
+	case slog.KindUint64:
+		return append(fields, Uint64(attr.Key, value.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, Float64(attr.Key, value.Float64()))
+	case slog.KindBool:
+		return append(fields, Bool(attr.Key, value.Bool()))
+	case slog.KindDuration:
+		return append(fields, Duration(attr.Key, value.Duration()))
+	case slog.KindTime:
+		return append(fields, Time(attr.Key, value.Time()))
+	case slog.KindGroup:
+		groupAttrs := value.Group()
+		if len(groupAttrs) == 0 {
+			return fields
+		}
+		if attr.Key == "" {
+			// groups with an empty key are inlined
+			return h.appendAttrs(fields, groupAttrs)
+		}
+		return append(fields, Dict(attr.Key, h.logger.NewDict(h.appendAttrs(nil, groupAttrs)...)))
+	default:
+		if err, ok := value.Any().(error); ok {
+			return append(fields, Err(attr.Key, err))
+		}
+		return append(fields, Any(attr.Key, value.Any()))
+	}
+}
+
+type slogWriter struct {
+	handler slog.Handler
+}
+
+// SlogWriter returns a LevelWriter which decodes the JSON events written to it and
+// forwards them as records to handler.
+//
+// The events must use the default timestamp, level and message field names.
+func SlogWriter(handler slog.Handler) LevelWriter {
+	return slogWriter{handler: handler}
+}
+
+// NewSlogLogger creates a logger which forwards its events to handler.
+// See SlogWriter.
+func NewSlogLogger(handler slog.Handler, options ...LoggerOption) Logger {
+	options = append([]LoggerOption{SetWriter(SlogWriter(handler))}, options...)
+	return New(options...)
+}
+
+// Write implements the io.Writer interface.
+func (w slogWriter) Write(p []byte) (n int, err error) {
+	return w.WriteLevel(NoLevel, p)
+}
+
+// WriteLevel implements the LevelWriter interface.
+func (w slogWriter) WriteLevel(level Level, p []byte) (n int, err error) {
+	event, err := decodeEvent(p)
+	if err != nil {
+		return 0, err
+	}
+
+	if l, ok := event[DefaultLevelFieldName].(string); ok {
+		if parsed, err := ParseLevel(l); err == nil {
+			level = parsed
+		}
+	}
+	slogLevel := levelToSlog(level)
+
+	ctx := context.Background()
+	if !w.handler.Enabled(ctx, slogLevel) {
+		return len(p), nil
+	}
+
+	var timestamp time.Time
+	if t, ok := event[DefaultTimestampFieldName].(string); ok {
+		timestamp, _ = time.Parse(time.RFC3339Nano, t)
+	}
+	message, _ := event[DefaultMessageFieldName].(string)
+	delete(event, DefaultTimestampFieldName)
+	delete(event, DefaultLevelFieldName)
+	delete(event, DefaultMessageFieldName)
+
+	record := slog.NewRecord(timestamp, slogLevel, message, 0)
+	record.AddAttrs(slogAttrs(event)...)
+	if err = w.handler.Handle(ctx, record); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func slogAttrs(fields map[string]interface{}) []slog.Attr {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, slogAttr(key, fields[key]))
+	}
+	return attrs
+}
+
+func slogAttr(key string, value interface{}) slog.Attr {
+	switch value := value.(type) {
+	case string:
+		return slog.String(key, value)
+	case bool:
+		return slog.Bool(key, value)
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return slog.Int64(key, i)
+		}
+		if f, err := value.Float64(); err == nil {
+			return slog.Float64(key, f)
+		}
+		return slog.String(key, value.String())
+	case map[string]interface{}:
+		return slog.Attr{Key: key, Value: slog.GroupValue(slogAttrs(value)...)}
+	default:
+		return slog.Any(key, value)
+	}
+}
+
+func levelFromSlog(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return DebugLevel
+	case level < slog.LevelWarn:
+		return InfoLevel
+	case level < slog.LevelError:
+		return WarnLevel
+	default:
+		return ErrorLevel
+	}
+}
+
+func levelToSlog(level Level) slog.Level {
+	switch level {
+	case DebugLevel:
+		return slog.LevelDebug
+	case WarnLevel:
+		return slog.LevelWarn
+	case ErrorLevel:
+		return slog.LevelError
+	case FatalLevel:
+		return slog.LevelError + 4
+	case PanicLevel:
+		return slog.LevelError + 8
+	default:
+		return slog.LevelInfo
+	}
+}
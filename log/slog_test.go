@@ -0,0 +1,74 @@
+// +build go1.21
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSlogHandler(t *testing.T) {
+	t.Run("attrs", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		logger := slog.New(NewSlogHandler(New(SetWriter(out), SetFields(Timestamp(false)))))
+		logger.Info("hello", "foo", "bar", slog.Int("n", 123), slog.Group("g", slog.Bool("b", true)), slog.Any("error", errors.New("oops")))
+		want := `{"level":"info","foo":"bar","n":123,"g":{"b":true},"error":"oops","message":"hello"}` + "\n"
+		if got := out.String(); got != want {
+			t.Errorf("invalid log output:\ngot:  %v\nwant: %v", got, want)
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		logger := slog.New(NewSlogHandler(New(SetWriter(out), SetFields(Timestamp(false), String("app", "test")))))
+		logger = logger.With("foo", "bar").WithGroup("req").With("id", 1).WithGroup("empty")
+		logger.Warn("hello", "status", 200)
+		logger.Warn("")
+		want := `{"level":"warning","app":"test","foo":"bar","req":{"id":1,"empty":{"status":200}},"message":"hello"}` + "\n" +
+			`{"level":"warning","app":"test","foo":"bar","req":{"id":1}}` + "\n"
+		if got := out.String(); got != want {
+			t.Errorf("invalid log output:\ngot:  %v\nwant: %v", got, want)
+		}
+	})
+
+	t.Run("level", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		logger := slog.New(NewSlogHandler(New(SetWriter(out), SetLevel(WarnLevel), SetFields(Timestamp(false)))))
+		logger.Info("ignored")
+		logger.Log(context.Background(), slog.LevelError+2, "error")
+		want := `{"level":"error","message":"error"}` + "\n"
+		if got := out.String(); got != want {
+			t.Errorf("invalid log output:\ngot:  %v\nwant: %v", got, want)
+		}
+	})
+
+	t.Run("timestamp", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		handler := NewSlogHandler(New(SetWriter(out)))
+		record := slog.NewRecord(time.Date(2020, 11, 18, 10, 30, 0, 0, time.UTC), slog.LevelDebug, "hello", 0)
+		handler.Handle(context.Background(), record)
+		want := `{"level":"debug","timestamp":"2020-11-18T10:30:00Z","message":"hello"}` + "\n"
+		if got := out.String(); got != want {
+			t.Errorf("invalid log output:\ngot:  %v\nwant: %v", got, want)
+		}
+	})
+}
+
+func TestSlogWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	handler := slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelInfo})
+	logger := NewSlogLogger(handler, SetTimestampFunc(func() time.Time {
+		return time.Date(2020, 11, 18, 10, 30, 0, 0, time.UTC)
+	}))
+
+	logger.Debug("ignored")
+	logger.Error("hello", String("foo", "bar"), Int("n", 123), Float64("f", 1.5), Dict("d", NewDict(Bool("b", true))))
+	want := `{"time":"2020-11-18T10:30:00Z","level":"ERROR","msg":"hello","d":{"b":true},"f":1.5,"foo":"bar","n":123}` + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("invalid log output:\ngot:  %v\nwant: %v", got, want)
+	}
+}
@@ -0,0 +1,134 @@
+package log
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrInvalidTraceparent is returned when parsing a malformed traceparent header.
+var ErrInvalidTraceparent = errors.New("log: invalid traceparent")
+
+type traceCtxKey struct{}
+
+// TraceContext holds the trace and span IDs of a W3C Trace Context
+// (https://www.w3.org/TR/trace-context/), as carried by the traceparent header.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+// ParseTraceparent parses a traceparent header value such as
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceparent(traceparent string) (TraceContext, error) {
+	var tc TraceContext
+
+	// version-traceid-spanid-flags
+	if len(traceparent) < 55 || traceparent[2] != '-' || traceparent[35] != '-' || traceparent[52] != '-' {
+		return tc, ErrInvalidTraceparent
+	}
+	version := traceparent[:2]
+	if version == "ff" || !isLowerHex(version) {
+		return tc, ErrInvalidTraceparent
+	}
+	// future versions may append fields, version 00 may not
+	if (version == "00" && len(traceparent) != 55) || (len(traceparent) > 55 && traceparent[55] != '-') {
+		return tc, ErrInvalidTraceparent
+	}
+
+	traceID, spanID, flags := traceparent[3:35], traceparent[36:52], traceparent[53:55]
+	if !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) {
+		return tc, ErrInvalidTraceparent
+	}
+	hex.Decode(tc.TraceID[:], []byte(traceID))
+	hex.Decode(tc.SpanID[:], []byte(spanID))
+	var flagsBuf [1]byte
+	hex.Decode(flagsBuf[:], []byte(flags))
+	tc.Flags = flagsBuf[0]
+
+	if !tc.IsValid() {
+		return TraceContext{}, ErrInvalidTraceparent
+	}
+	return tc, nil
+}
+
+// IsValid returns true if both the trace ID and the span ID are not all zeros.
+func (tc TraceContext) IsValid() bool {
+	return tc.TraceID != [16]byte{} && tc.SpanID != [8]byte{}
+}
+
+// Sampled returns true if the sampled flag is set.
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&0x01 == 0x01
+}
+
+// TraceIDString returns the hex encoded trace ID.
+func (tc TraceContext) TraceIDString() string {
+	return hex.EncodeToString(tc.TraceID[:])
+}
+
+// SpanIDString returns the hex encoded span ID.
+func (tc TraceContext) SpanIDString() string {
+	return hex.EncodeToString(tc.SpanID[:])
+}
+
+// String returns tc formatted as a traceparent header value.
+func (tc TraceContext) String() string {
+	return "00-" + tc.TraceIDString() + "-" + tc.SpanIDString() + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+// ToCtx returns a copy of ctx with tc associated.
+func (tc TraceContext) ToCtx(ctx context.Context) context.Context {
+	return context.WithValue(ctx, traceCtxKey{}, tc)
+}
+
+// TraceContextFromCtx returns the TraceContext associated with ctx, if any.
+func TraceContextFromCtx(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceCtxKey{}).(TraceContext)
+	return tc, ok
+}
+
+// TraceExtractor extracts hex encoded trace and span IDs from a context. It can be used to plug
+// a tracing library (e.g. OpenTelemetry's trace.SpanContextFromContext) into TraceHook.
+type TraceExtractor func(ctx context.Context) (traceID, spanID string, ok bool)
+
+// TraceHook returns a hook which adds the trace_id and span_id fields to the events logged
+// with a context (see Logger.InfoCtx). If extractor is nil, the TraceContext associated
+// with the context by TraceContext.ToCtx is used.
+func TraceHook(extractor TraceExtractor) Hook {
+	if extractor == nil {
+		extractor = extractTraceContext
+	}
+	return HookFunc(func(e *Event, level Level, message string) {
+		if e.ctx == nil {
+			return
+		}
+		traceID, spanID, ok := extractor(e.ctx)
+		if !ok {
+			return
+		}
+		e.string(DefaultTraceIDFieldName, traceID)
+		if spanID != "" {
+			e.string(DefaultSpanIDFieldName, spanID)
+		}
+	})
+}
+
+func extractTraceContext(ctx context.Context) (traceID, spanID string, ok bool) {
+	tc, ok := TraceContextFromCtx(ctx)
+	if !ok || !tc.IsValid() {
+		return "", "", false
+	}
+	return tc.TraceIDString(), tc.SpanIDString(), true
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
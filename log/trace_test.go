@@ -0,0 +1,84 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		traceparent string
+		valid       bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		tc, err := ParseTraceparent(tt.traceparent)
+		if tt.valid != (err == nil) {
+			t.Errorf("ParseTraceparent(%q): unexpected error: %v", tt.traceparent, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got, want := tc.TraceIDString(), "4bf92f3577b34da6a3ce929d0e0e4736"; got != want {
+			t.Errorf("ParseTraceparent(%q): invalid trace ID: got %s, want %s", tt.traceparent, got, want)
+		}
+		if got, want := tc.SpanIDString(), "00f067aa0ba902b7"; got != want {
+			t.Errorf("ParseTraceparent(%q): invalid span ID: got %s, want %s", tt.traceparent, got, want)
+		}
+	}
+
+	tc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !tc.Sampled() {
+		t.Error("expected the sampled flag to be set")
+	}
+	if got, want := tc.String(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"; got != want {
+		t.Errorf("invalid traceparent: got %s, want %s", got, want)
+	}
+}
+
+func TestTraceHook(t *testing.T) {
+	out := &bytes.Buffer{}
+	log := New(SetWriter(out), SetFields(Timestamp(false)), AddHook(TraceHook(nil)))
+
+	tc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := tc.ToCtx(context.Background())
+	log.InfoCtx(ctx, "hello", String("foo", "bar"))
+	log.InfoCtx(context.Background(), "no trace")
+	log.Info("no context")
+
+	want := `{"level":"info","foo":"bar","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7","message":"hello"}` + "\n" +
+		`{"level":"info","message":"no trace"}` + "\n" +
+		`{"level":"info","message":"no context"}` + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("invalid log output:\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+type testTraceKey struct{}
+
+func TestTraceHookExtractor(t *testing.T) {
+	out := &bytes.Buffer{}
+	extractor := func(ctx context.Context) (string, string, bool) {
+		traceID, ok := ctx.Value(testTraceKey{}).(string)
+		return traceID, "", ok
+	}
+	log := New(SetWriter(out), SetFields(Timestamp(false)), AddHook(TraceHook(extractor)))
+
+	log.WarnCtx(context.WithValue(context.Background(), testTraceKey{}, "abc"), "hello")
+	want := `{"level":"warning","trace_id":"abc","message":"hello"}` + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("invalid log output:\ngot:  %v\nwant: %v", got, want)
+	}
+}
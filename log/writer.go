@@ -1,6 +1,8 @@
 package log
 
 import (
+	"bytes"
+	"encoding/json"
 	"io"
 	"sync"
 )
@@ -98,3 +100,23 @@ func MultiLevelWriter(writers ...io.Writer) LevelWriter {
 	}
 	return multiLevelWriter{lwriters}
 }
+
+// decodeEvent decodes an event written by a Logger, encoded in JSON or CBOR, for the writers
+// which need to access its fields. Numbers are decoded as json.Number.
+func decodeEvent(p []byte) (map[string]interface{}, error) {
+	var event map[string]interface{}
+	var err error
+
+	if len(p) > 0 && p[0] != '{' {
+		// events of loggers using the CBOR encoder
+		if p, err = toJSON(EncoderCBOR(), p); err != nil {
+			return nil, err
+		}
+	}
+	d := json.NewDecoder(bytes.NewReader(p))
+	d.UseNumber()
+	if err = d.Decode(&event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
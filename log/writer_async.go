@@ -0,0 +1,309 @@
+package log
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAsyncBufferSize is the default number of events an AsyncWriter can hold.
+	DefaultAsyncBufferSize = 1024
+
+	// DefaultAsyncDropReportInterval is the default interval at which an AsyncWriter
+	// reports dropped events.
+	DefaultAsyncDropReportInterval = 10 * time.Second
+)
+
+// OverflowPolicy defines what an AsyncWriter does when its buffer is full.
+type OverflowPolicy uint8
+
+const (
+	// OverflowBlock blocks the caller until there is room in the buffer.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest buffered event to make room for the new one.
+	OverflowDropOldest
+	// OverflowDropNewest drops the new event.
+	OverflowDropNewest
+	// OverflowDropBelowLevel drops the new event if its level is below the drop level
+	// (see AsyncDropLevel) and blocks otherwise.
+	OverflowDropBelowLevel
+)
+
+// AsyncWriter is a LevelWriter which buffers events and writes them to the underlying writer
+// from a background goroutine, so that a slow sink does not stall the callers.
+//
+// Dropped events are counted and, when the drop report interval is not 0, periodically
+// reported to the underlying writer as a warning event with a "dropped" field.
+type AsyncWriter struct {
+	writer         LevelWriter
+	policy         OverflowPolicy
+	dropLevel      Level
+	reportInterval time.Duration
+	encoder        Encoder
+	reporter       Logger
+
+	mu            sync.Mutex
+	notEmpty      *sync.Cond
+	notFull       *sync.Cond
+	entries       []asyncEntry
+	head          int
+	count         int
+	writing       bool
+	closed        bool
+	reportDue     bool
+	dropped       uint64
+	reported      uint64
+	flushWaiters  []chan struct{}
+	workerDone    chan struct{}
+	reporterClose chan struct{}
+}
+
+type asyncEntry struct {
+	level Level
+	p     []byte
+}
+
+// AsyncWriterOption is used to configure an AsyncWriter.
+type AsyncWriterOption func(w *AsyncWriter)
+
+// AsyncBufferSize sets the maximum number of events held by the writer. Default to DefaultAsyncBufferSize.
+func AsyncBufferSize(size int) AsyncWriterOption {
+	return func(w *AsyncWriter) {
+		if size > 0 {
+			w.entries = make([]asyncEntry, size)
+		}
+	}
+}
+
+// AsyncOverflowPolicy sets the policy applied when the buffer is full. Default to OverflowBlock.
+func AsyncOverflowPolicy(policy OverflowPolicy) AsyncWriterOption {
+	return func(w *AsyncWriter) {
+		w.policy = policy
+	}
+}
+
+// AsyncDropLevel sets the level below which events are dropped with the OverflowDropBelowLevel
+// policy. Default to WarnLevel.
+func AsyncDropLevel(level Level) AsyncWriterOption {
+	return func(w *AsyncWriter) {
+		w.dropLevel = level
+	}
+}
+
+// AsyncDropReportInterval sets the interval at which dropped events are reported.
+// Set to 0 to disable the reports. Default to DefaultAsyncDropReportInterval.
+func AsyncDropReportInterval(interval time.Duration) AsyncWriterOption {
+	return func(w *AsyncWriter) {
+		w.reportInterval = interval
+	}
+}
+
+// AsyncEncoder sets the encoder of the drop reports, which must be the encoder of the loggers
+// writing to the writer so that the reports don't corrupt the stream. Default to EncoderJSON.
+func AsyncEncoder(encoder Encoder) AsyncWriterOption {
+	return func(w *AsyncWriter) {
+		w.encoder = encoder
+	}
+}
+
+// NewAsyncWriter returns an AsyncWriter writing to w. If w implements the LevelWriter interface,
+// the WriteLevel method will be called instead of the Write one.
+// The writer must be closed with Close to flush the pending events.
+func NewAsyncWriter(w io.Writer, options ...AsyncWriterOption) *AsyncWriter {
+	lw, ok := w.(LevelWriter)
+	if !ok {
+		lw = levelWriterAdapter{w}
+	}
+	aw := &AsyncWriter{
+		writer:         lw,
+		policy:         OverflowBlock,
+		dropLevel:      WarnLevel,
+		reportInterval: DefaultAsyncDropReportInterval,
+		encoder:        EncoderJSON(),
+		entries:        make([]asyncEntry, DefaultAsyncBufferSize),
+		workerDone:     make(chan struct{}),
+		reporterClose:  make(chan struct{}),
+	}
+	for _, option := range options {
+		option(aw)
+	}
+	aw.notEmpty = sync.NewCond(&aw.mu)
+	aw.notFull = sync.NewCond(&aw.mu)
+	aw.reporter = New(SetWriter(lw), SetEncoder(aw.encoder))
+
+	go aw.work()
+	if aw.reportInterval > 0 {
+		go aw.tick()
+	}
+	return aw
+}
+
+// Write implements the io.Writer interface.
+func (w *AsyncWriter) Write(p []byte) (n int, err error) {
+	return w.WriteLevel(NoLevel, p)
+}
+
+// WriteLevel implements the LevelWriter interface. p is copied so the caller can reuse it.
+// A dropped event is not reported as an error.
+func (w *AsyncWriter) WriteLevel(level Level, p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for !w.closed && w.count == len(w.entries) {
+		switch w.policy {
+		case OverflowDropOldest:
+			w.pop()
+			w.dropped++
+		case OverflowDropNewest:
+			w.dropped++
+			return len(p), nil
+		case OverflowDropBelowLevel:
+			if level < w.dropLevel || level == NoLevel {
+				w.dropped++
+				return len(p), nil
+			}
+			w.notFull.Wait()
+		default:
+			w.notFull.Wait()
+		}
+	}
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	w.entries[(w.head+w.count)%len(w.entries)] = asyncEntry{
+		level: level,
+		p:     append([]byte(nil), p...),
+	}
+	w.count++
+	w.notEmpty.Signal()
+	return len(p), nil
+}
+
+// Dropped returns the total number of events dropped since the creation of the writer.
+func (w *AsyncWriter) Dropped() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dropped
+}
+
+// Flush waits until all the buffered events have been written to the underlying writer
+// or ctx is done.
+func (w *AsyncWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	if w.count == 0 && !w.writing {
+		w.mu.Unlock()
+		return nil
+	}
+	done := make(chan struct{})
+	w.flushWaiters = append(w.flushWaiters, done)
+	w.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close writes all the buffered events and stops the background goroutines. Subsequent writes
+// fail with os.ErrClosed. The underlying writer is not closed.
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return os.ErrClosed
+	}
+	w.closed = true
+	w.notEmpty.Broadcast()
+	w.notFull.Broadcast()
+	w.mu.Unlock()
+
+	close(w.reporterClose)
+	<-w.workerDone
+	return nil
+}
+
+func (w *AsyncWriter) pop() asyncEntry {
+	entry := w.entries[w.head]
+	w.entries[w.head] = asyncEntry{}
+	w.head = (w.head + 1) % len(w.entries)
+	w.count--
+	return entry
+}
+
+func (w *AsyncWriter) work() {
+	defer close(w.workerDone)
+
+	for {
+		w.mu.Lock()
+		for w.count == 0 && !w.closed && !w.reportDue {
+			w.notEmpty.Wait()
+		}
+
+		if w.reportDue || (w.closed && w.count == 0) {
+			w.reportDue = false
+			dropped := w.dropped - w.reported
+			w.reported = w.dropped
+			closed := w.closed && w.count == 0
+			if closed {
+				w.releaseFlushWaiters()
+			}
+			w.mu.Unlock()
+
+			if dropped > 0 {
+				w.reporter.Warn("log: events dropped", Uint64("dropped", dropped))
+			}
+			if closed {
+				return
+			}
+			continue
+		}
+
+		entry := w.pop()
+		w.writing = true
+		w.notFull.Signal()
+		w.mu.Unlock()
+
+		if _, err := w.writer.WriteLevel(entry.level, entry.p); err != nil {
+			handleWriterError(err)
+		}
+
+		w.mu.Lock()
+		w.writing = false
+		if w.count == 0 {
+			w.releaseFlushWaiters()
+		}
+		w.mu.Unlock()
+	}
+}
+
+func (w *AsyncWriter) releaseFlushWaiters() {
+	for _, done := range w.flushWaiters {
+		close(done)
+	}
+	w.flushWaiters = nil
+}
+
+func (w *AsyncWriter) tick() {
+	ticker := time.NewTicker(w.reportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			if w.dropped != w.reported {
+				w.reportDue = true
+				w.notEmpty.Signal()
+			}
+			w.mu.Unlock()
+		case <-w.reporterClose:
+			return
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gateWriter blocks every write until the gate is opened.
+type gateWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	started chan struct{}
+	gate    chan struct{}
+}
+
+func newGateWriter() *gateWriter {
+	return &gateWriter{
+		started: make(chan struct{}, 100),
+		gate:    make(chan struct{}),
+	}
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	w.started <- struct{}{}
+	<-w.gate
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *gateWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+// fillAsyncWriter writes "1" and waits for it to be picked up by the worker, then fills
+// the buffer of size 2 with "2" and "3".
+func fillAsyncWriter(t *testing.T, w *AsyncWriter, gw *gateWriter) {
+	w.WriteLevel(InfoLevel, []byte("1\n"))
+	select {
+	case <-gw.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker did not start writing")
+	}
+	w.WriteLevel(InfoLevel, []byte("2\n"))
+	w.WriteLevel(InfoLevel, []byte("3\n"))
+}
+
+func TestAsyncWriterOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     []AsyncWriterOption
+		write       func(w *AsyncWriter)
+		want        string
+		wantDropped uint64
+	}{
+		{"DropNewest", []AsyncWriterOption{AsyncOverflowPolicy(OverflowDropNewest)}, func(w *AsyncWriter) {
+			w.WriteLevel(ErrorLevel, []byte("4\n"))
+		}, "1\n2\n3\n", 1},
+		{"DropOldest", []AsyncWriterOption{AsyncOverflowPolicy(OverflowDropOldest)}, func(w *AsyncWriter) {
+			w.WriteLevel(InfoLevel, []byte("4\n"))
+		}, "1\n3\n4\n", 1},
+		{"DropBelowLevel", []AsyncWriterOption{AsyncOverflowPolicy(OverflowDropBelowLevel), AsyncDropLevel(WarnLevel)}, func(w *AsyncWriter) {
+			w.WriteLevel(InfoLevel, []byte("4\n"))
+		}, "1\n2\n3\n", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newGateWriter()
+			options := append([]AsyncWriterOption{AsyncBufferSize(2), AsyncDropReportInterval(0)}, tt.options...)
+			w := NewAsyncWriter(gw, options...)
+			fillAsyncWriter(t, w, gw)
+			tt.write(w)
+			close(gw.gate)
+
+			if err := w.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got := gw.String(); got != tt.want {
+				t.Errorf("invalid output:\ngot:  %q\nwant: %q", got, tt.want)
+			}
+			if got := w.Dropped(); got != tt.wantDropped {
+				t.Errorf("invalid dropped count: got %d, want %d", got, tt.wantDropped)
+			}
+			w.Close()
+		})
+	}
+}
+
+func TestAsyncWriterBlock(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowBlock, OverflowDropBelowLevel} {
+		gw := newGateWriter()
+		w := NewAsyncWriter(gw, AsyncBufferSize(2), AsyncOverflowPolicy(policy), AsyncDropReportInterval(0))
+		fillAsyncWriter(t, w, gw)
+
+		written := make(chan struct{})
+		go func() {
+			w.WriteLevel(ErrorLevel, []byte("4\n"))
+			close(written)
+		}()
+		select {
+		case <-written:
+			t.Fatalf("policy %d: write did not block on a full buffer", policy)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(gw.gate)
+		<-written
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := gw.String(), "1\n2\n3\n4\n"; got != want {
+			t.Errorf("policy %d: invalid output:\ngot:  %q\nwant: %q", policy, got, want)
+		}
+		if got := w.Dropped(); got != 0 {
+			t.Errorf("policy %d: invalid dropped count: got %d, want 0", policy, got)
+		}
+	}
+}
+
+func TestAsyncWriterFlushTimeout(t *testing.T) {
+	gw := newGateWriter()
+	w := NewAsyncWriter(gw, AsyncDropReportInterval(0))
+	w.Write([]byte("1\n"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := w.Flush(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	close(gw.gate)
+	w.Close()
+	if _, err := w.Write([]byte("2\n")); err != os.ErrClosed {
+		t.Errorf("expected os.ErrClosed, got: %v", err)
+	}
+}
+
+func TestAsyncWriterDropReport(t *testing.T) {
+	gw := newGateWriter()
+	w := NewAsyncWriter(gw,
+		AsyncBufferSize(2),
+		AsyncOverflowPolicy(OverflowDropNewest),
+		AsyncDropReportInterval(10*time.Millisecond),
+	)
+	fillAsyncWriter(t, w, gw)
+	w.WriteLevel(InfoLevel, []byte("4\n"))
+	w.WriteLevel(InfoLevel, []byte("5\n"))
+	close(gw.gate)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(gw.String(), `"dropped":2`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("dropped events were not reported, got: %q", gw.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	w.Close()
+
+	lines := strings.Split(strings.TrimSpace(gw.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got: %q", lines)
+	}
+	if !strings.Contains(lines[3], `"level":"warning"`) || !strings.Contains(lines[3], `"message":"log: events dropped"`) {
+		t.Errorf("invalid report line: %s", lines[3])
+	}
+}
+
+func TestAsyncWriterLogger(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := NewAsyncWriter(out)
+	log := New(SetWriter(w), SetFields(Timestamp(false)))
+	for i := 0; i < 3; i++ {
+		log.Info("hello", Int("i", i))
+	}
+	w.Close()
+
+	want := `{"level":"info","i":0,"message":"hello"}` + "\n" +
+		`{"level":"info","i":1,"message":"hello"}` + "\n" +
+		`{"level":"info","i":2,"message":"hello"}` + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("invalid log output:\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+func TestAsyncWriterDropReportEncoder(t *testing.T) {
+	gw := newGateWriter()
+	w := NewAsyncWriter(gw,
+		AsyncBufferSize(2),
+		AsyncOverflowPolicy(OverflowDropNewest),
+		AsyncDropReportInterval(0),
+		AsyncEncoder(EncoderCBOR()),
+	)
+	log := New(SetWriter(w), SetEncoder(EncoderCBOR()), SetFields(Timestamp(false)))
+	log.Info("1")
+	select {
+	case <-gw.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker did not start writing")
+	}
+	for i := 2; i <= 5; i++ {
+		log.Info(strconv.Itoa(i))
+	}
+	close(gw.gate)
+	w.Close()
+
+	out := &bytes.Buffer{}
+	if err := CBORToJSON(out, strings.NewReader(gw.String())); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"level":"info","message":"1"}` + "\n" +
+		`{"level":"info","message":"2"}` + "\n" +
+		`{"level":"info","message":"3"}` + "\n"
+	if got := out.String(); !strings.HasPrefix(got, want) || !strings.Contains(got, `"dropped":2`) {
+		t.Errorf("invalid log output:\ngot:  %v\nwant: %v", got, want)
+	}
+}
@@ -0,0 +1,469 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bloom42/gobox/appdir"
+)
+
+const (
+	// DefaultFileMode is the permission used to create log files.
+	DefaultFileMode os.FileMode = 0600
+
+	fileBackupTimeFormat = "2006-01-02T15-04-05.000"
+	fileCompressSuffix   = ".gz"
+)
+
+// FileWriter is a LevelWriter writing to a file which is rotated by size and/or by
+// wall-clock interval. Rotated files are renamed with a timestamp suffix, optionally
+// gzip-compressed in the background and pruned so that only MaxBackups files are kept.
+//
+// A FileWriter is safe for concurrent use by multiple Loggers.
+type FileWriter struct {
+	path          string
+	maxSize       int64
+	interval      time.Duration
+	maxBackups    int
+	compress      bool
+	mode          os.FileMode
+	clock         func() time.Time
+	reopenOnHUP   bool
+	mu            sync.Mutex
+	file          *os.File
+	size          int64
+	nextRotation  time.Time
+	millCh        chan struct{}
+	millWg        sync.WaitGroup
+	signalCh      chan os.Signal
+	signalStopped chan struct{}
+	closed        bool
+}
+
+// FileWriterOption is used to configure a FileWriter.
+type FileWriterOption func(w *FileWriter)
+
+// FileMaxSize sets the size in bytes after which the file is rotated. 0 disables size based rotation.
+func FileMaxSize(maxSize int64) FileWriterOption {
+	return func(w *FileWriter) {
+		w.maxSize = maxSize
+	}
+}
+
+// FileRotationInterval sets the wall-clock interval at which the file is rotated (e.g. 24 * time.Hour
+// rotates at midnight UTC). 0 disables time based rotation.
+func FileRotationInterval(interval time.Duration) FileWriterOption {
+	return func(w *FileWriter) {
+		w.interval = interval
+	}
+}
+
+// FileMaxBackups sets the maximum number of rotated files to keep. 0 keeps all of them.
+func FileMaxBackups(maxBackups int) FileWriterOption {
+	return func(w *FileWriter) {
+		w.maxBackups = maxBackups
+	}
+}
+
+// FileCompress enables gzip compression of rotated files.
+func FileCompress(compress bool) FileWriterOption {
+	return func(w *FileWriter) {
+		w.compress = compress
+	}
+}
+
+// FileMode sets the permission used when creating the log file. Default to DefaultFileMode.
+func FileMode(mode os.FileMode) FileWriterOption {
+	return func(w *FileWriter) {
+		w.mode = mode
+	}
+}
+
+// FileClock sets the function used to get the current time. Default to DefaultTimestampFunc.
+func FileClock(clock func() time.Time) FileWriterOption {
+	return func(w *FileWriter) {
+		w.clock = clock
+	}
+}
+
+// FileReopenOnSIGHUP makes the writer reopen its file when the process receives SIGHUP, which is
+// useful when the file is rotated by an external tool such as logrotate.
+func FileReopenOnSIGHUP(enable bool) FileWriterOption {
+	return func(w *FileWriter) {
+		w.reopenOnHUP = enable
+	}
+}
+
+// NewFileWriter opens (or creates) the file at path, creating the parent directories if needed,
+// and returns a FileWriter writing to it. The writer must be closed with Close.
+func NewFileWriter(path string, options ...FileWriterOption) (*FileWriter, error) {
+	w := &FileWriter{
+		path:   path,
+		mode:   DefaultFileMode,
+		clock:  DefaultTimestampFunc,
+		millCh: make(chan struct{}, 1),
+	}
+	for _, option := range options {
+		option(w)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("log: creating log directory: %w", err)
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	w.millWg.Add(1)
+	go w.mill()
+
+	if w.reopenOnHUP {
+		w.signalCh = make(chan os.Signal, 1)
+		w.signalStopped = make(chan struct{})
+		signal.Notify(w.signalCh, syscall.SIGHUP)
+		go w.handleSignals()
+	}
+
+	return w, nil
+}
+
+// NewUserLogsFileWriter returns a FileWriter writing to fileName under the user-specific logs
+// directory of dirs.
+func NewUserLogsFileWriter(dirs appdir.Dirs, fileName string, options ...FileWriterOption) (*FileWriter, error) {
+	logsDir, err := dirs.UserLogs()
+	if err != nil {
+		return nil, err
+	}
+	return NewFileWriter(filepath.Join(logsDir, fileName), options...)
+}
+
+// Write implements the io.Writer interface.
+func (w *FileWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	if w.file == nil {
+		// a previous rotation or reopen failed to open the file
+		if err = w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if w.shouldRotate(int64(len(p))) {
+		if err = w.rotate(); err != nil {
+			// keep writing to the current file rather than losing the events
+			handleWriterError(err)
+			if w.file == nil {
+				return 0, err
+			}
+		}
+	}
+
+	n, err = w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// WriteLevel implements the LevelWriter interface.
+func (w *FileWriter) WriteLevel(level Level, p []byte) (n int, err error) {
+	return w.Write(p)
+}
+
+// Rotate closes the current file, renames it with a timestamp suffix and opens a new one.
+func (w *FileWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+// Reopen closes and reopens the file at the writer's path, without renaming it.
+func (w *FileWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	closeErr := w.closeFile()
+	if err := w.open(); err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// Close closes the file and waits for the background compression of rotated files to finish.
+func (w *FileWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return os.ErrClosed
+	}
+	w.closed = true
+	err := w.closeFile()
+	close(w.millCh)
+	w.mu.Unlock()
+
+	if w.signalCh != nil {
+		signal.Stop(w.signalCh)
+		close(w.signalStopped)
+	}
+	w.millWg.Wait()
+	return err
+}
+
+func (w *FileWriter) shouldRotate(writeSize int64) bool {
+	if w.maxSize > 0 && w.size > 0 && w.size+writeSize > w.maxSize {
+		return true
+	}
+	if w.interval > 0 && !w.clock().Before(w.nextRotation) {
+		return true
+	}
+	return false
+}
+
+func (w *FileWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, w.mode)
+	if err != nil {
+		return fmt.Errorf("log: opening log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("log: opening log file: %w", err)
+	}
+
+	w.file = file
+	w.size = info.Size()
+	if w.interval > 0 {
+		w.nextRotation = w.clock().Truncate(w.interval).Add(w.interval)
+	}
+	return nil
+}
+
+// closeFile closes the current file, if any. w.file is nil afterwards, even on error.
+func (w *FileWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *FileWriter) rotate() error {
+	if err := w.closeFile(); err != nil {
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+
+	backupPath := w.backupPath(w.clock())
+	if err := os.Rename(w.path, backupPath); err != nil && !os.IsNotExist(err) {
+		// reopen the current file, so the writes can continue
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("log: renaming log file: %w", err)
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	select {
+	case w.millCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// backupPath returns a free path for a rotated file: name-timestamp.ext, with an additional
+// -N counter if several rotations happen during the same millisecond.
+func (w *FileWriter) backupPath(t time.Time) string {
+	prefix, ext := w.backupPrefixAndExt()
+	base := prefix + t.UTC().Format(fileBackupTimeFormat)
+
+	path := base + ext
+	for i := 1; fileExists(path) || fileExists(path+fileCompressSuffix); i++ {
+		path = base + "-" + strconv.Itoa(i) + ext
+	}
+	return path
+}
+
+func (w *FileWriter) backupPrefixAndExt() (prefix, ext string) {
+	ext = filepath.Ext(w.path)
+	prefix = strings.TrimSuffix(w.path, ext) + "-"
+	return
+}
+
+// mill compresses and prunes rotated files in the background.
+func (w *FileWriter) mill() {
+	defer w.millWg.Done()
+
+	for range w.millCh {
+		if err := w.compressAndPrune(); err != nil {
+			handleWriterError(err)
+		}
+	}
+}
+
+func (w *FileWriter) handleSignals() {
+	for {
+		select {
+		case <-w.signalCh:
+			if err := w.Reopen(); err != nil && !errors.Is(err, os.ErrClosed) {
+				handleWriterError(err)
+			}
+		case <-w.signalStopped:
+			return
+		}
+	}
+}
+
+type fileBackup struct {
+	path      string
+	timestamp string
+	seq       int
+}
+
+func (w *FileWriter) compressAndPrune() error {
+	backups, err := w.listBackups()
+	if err != nil {
+		return err
+	}
+
+	if w.compress {
+		for i, backup := range backups {
+			if strings.HasSuffix(backup.path, fileCompressSuffix) {
+				continue
+			}
+			if err = compressFile(backup.path, w.mode); err != nil {
+				return err
+			}
+			backups[i].path += fileCompressSuffix
+		}
+	}
+
+	if w.maxBackups > 0 && len(backups) > w.maxBackups {
+		for _, backup := range backups[:len(backups)-w.maxBackups] {
+			if err = os.Remove(backup.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// listBackups returns the rotated files, from the oldest to the newest.
+func (w *FileWriter) listBackups() ([]fileBackup, error) {
+	prefix, ext := w.backupPrefixAndExt()
+	dir := filepath.Dir(w.path)
+	prefix = filepath.Base(prefix)
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]fileBackup, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := strings.TrimSuffix(strings.TrimPrefix(name, prefix), fileCompressSuffix)
+		if !strings.HasSuffix(rest, ext) {
+			continue
+		}
+		rest = strings.TrimSuffix(rest, ext)
+		if len(rest) < len(fileBackupTimeFormat) {
+			continue
+		}
+		timestamp := rest[:len(fileBackupTimeFormat)]
+		if _, err = time.Parse(fileBackupTimeFormat, timestamp); err != nil {
+			continue
+		}
+		seq := 0
+		if counter := rest[len(fileBackupTimeFormat):]; counter != "" {
+			if seq, err = strconv.Atoi(strings.TrimPrefix(counter, "-")); err != nil || counter[0] != '-' {
+				continue
+			}
+		}
+		backups = append(backups, fileBackup{
+			path:      filepath.Join(dir, name),
+			timestamp: timestamp,
+			seq:       seq,
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].timestamp != backups[j].timestamp {
+			return backups[i].timestamp < backups[j].timestamp
+		}
+		return backups[i].seq < backups[j].seq
+	})
+	return backups, nil
+}
+
+func compressFile(path string, mode os.FileMode) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+fileCompressSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(path + fileCompressSuffix)
+		}
+	}()
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err != nil {
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func handleWriterError(err error) {
+	if ErrorHandler != nil {
+		ErrorHandler(err)
+	} else {
+		fmt.Fprintf(os.Stderr, "log: %v\n", err)
+	}
+}
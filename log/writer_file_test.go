@@ -0,0 +1,310 @@
+// +build !windows
+
+package log
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 11, 18, 10, 30, 0, 0, time.UTC)}
+}
+
+func listDir(t *testing.T, dir string) []string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFileWriterSizeRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clock := newFakeClock()
+	path := filepath.Join(dir, "app.log")
+	w, err := NewFileWriter(path, FileMaxSize(11), FileClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Write([]byte("12345\n"))
+	w.Write([]byte("6789\n"))
+	clock.Add(time.Second)
+	w.Write([]byte("abcdef\n"))
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"app-2020-11-18T10-30-01.000.log", "app.log"}
+	if got := listDir(t, dir); !equalStrings(got, want) {
+		t.Fatalf("invalid files:\ngot:  %v\nwant: %v", got, want)
+	}
+	if got, want := readFile(t, filepath.Join(dir, want[0])), "12345\n6789\n"; got != want {
+		t.Errorf("invalid backup content:\ngot:  %q\nwant: %q", got, want)
+	}
+	if got, want := readFile(t, path), "abcdef\n"; got != want {
+		t.Errorf("invalid file content:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestFileWriterIntervalRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clock := newFakeClock()
+	path := filepath.Join(dir, "app.log")
+	w, err := NewFileWriter(path, FileRotationInterval(time.Hour), FileClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Write([]byte("first\n"))
+	clock.Add(20 * time.Minute)
+	w.Write([]byte("second\n"))
+	clock.Add(10 * time.Minute)
+	w.Write([]byte("third\n"))
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"app-2020-11-18T11-00-00.000.log", "app.log"}
+	if got := listDir(t, dir); !equalStrings(got, want) {
+		t.Fatalf("invalid files:\ngot:  %v\nwant: %v", got, want)
+	}
+	if got, want := readFile(t, filepath.Join(dir, want[0])), "first\nsecond\n"; got != want {
+		t.Errorf("invalid backup content:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestFileWriterMaxBackupsAndCompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clock := newFakeClock()
+	path := filepath.Join(dir, "app.log")
+	w, err := NewFileWriter(path, FileMaxBackups(2), FileCompress(true), FileClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := New(SetWriter(w), SetFields(Timestamp(false)))
+	for i := 0; i < 4; i++ {
+		logger.Info("hello", Int("i", i))
+		if err = w.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"app-2020-11-18T10-30-00.000-2.log.gz",
+		"app-2020-11-18T10-30-00.000-3.log.gz",
+		"app.log",
+	}
+	if got := listDir(t, dir); !equalStrings(got, want) {
+		t.Fatalf("invalid files:\ngot:  %v\nwant: %v", got, want)
+	}
+
+	file, err := os.Open(filepath.Join(dir, want[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `{"level":"info","i":3,"message":"hello"}`+"\n"; got != want {
+		t.Errorf("invalid backup content:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestFileWriterReopenOnSIGHUP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	w, err := NewFileWriter(path, FileReopenOnSIGHUP(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.Write([]byte("before\n"))
+	if err = os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !fileExists(path) {
+		if time.Now().After(deadline) {
+			t.Fatal("file was not reopened after SIGHUP")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	w.Write([]byte("after\n"))
+
+	if got, want := readFile(t, path+".1"), "before\n"; got != want {
+		t.Errorf("invalid rotated content:\ngot:  %q\nwant: %q", got, want)
+	}
+	if got, want := readFile(t, path), "after\n"; got != want {
+		t.Errorf("invalid file content:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestFileWriterRotationFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the name of the rotated file is too long, so renaming the file fails
+	path := filepath.Join(dir, strings.Repeat("a", 240)+".log")
+	w, err := NewFileWriter(path, FileMaxSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if _, err = w.Write([]byte("before\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Rotate(); err == nil {
+		t.Fatal("expected rotation error")
+	}
+
+	// the write is reported but not lost when the rotation fails
+	var rotationErrors []error
+	defer func(handler func(error)) { ErrorHandler = handler }(ErrorHandler)
+	ErrorHandler = func(err error) { rotationErrors = append(rotationErrors, err) }
+	if _, err = w.Write([]byte("after\n")); err != nil {
+		t.Fatal(err)
+	}
+	if len(rotationErrors) != 1 {
+		t.Errorf("expected 1 rotation error, got: %v", rotationErrors)
+	}
+	if err = w.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+
+	w.maxSize = 0
+	if _, err = w.Write([]byte("again\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFile(t, path), "before\nafter\nagain\n"; got != want {
+		t.Errorf("invalid file content:\ngot:  %q\nwant: %q", got, want)
+	}
+	if got := listDir(t, dir); len(got) != 1 {
+		t.Errorf("unexpected files: %v", got)
+	}
+}
+
+func TestFileWriterConcurrentWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewFileWriter(filepath.Join(dir, "app.log"), FileMaxSize(1000), FileMaxBackups(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := New(SetWriter(w))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Info("concurrent", Int("j", j))
+			}
+		}()
+	}
+	wg.Wait()
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("closed")); err != os.ErrClosed {
+		t.Errorf("expected os.ErrClosed, got: %v", err)
+	}
+	if got := len(listDir(t, dir)); got > 4 {
+		t.Errorf("expected at most 4 files, got %d", got)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
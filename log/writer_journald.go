@@ -0,0 +1,227 @@
+// +build linux
+
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// DefaultJournaldSocket is the path of the socket of the native protocol of systemd-journald.
+const DefaultJournaldSocket = "/run/systemd/journal/socket"
+
+// JournaldWriter is a LevelWriter sending the events to systemd-journald using its native
+// protocol. The level of the events is mapped to the PRIORITY journal field, their message
+// to MESSAGE, and the other fields to journal fields with uppercased names
+// (e.g. request_id becomes REQUEST_ID).
+//
+// The fields are identified by their default names (DefaultLevelFieldName,
+// DefaultMessageFieldName and DefaultTimestampFieldName). The timestamp is not forwarded as
+// journald timestamps the entries itself.
+//
+// A JournaldWriter is safe for concurrent use by multiple Loggers.
+type JournaldWriter struct {
+	socket     string
+	identifier string
+	mu         sync.Mutex
+	conn       *net.UnixConn
+	buf        []byte
+}
+
+// JournaldWriterOption is used to configure a JournaldWriter.
+type JournaldWriterOption func(w *JournaldWriter)
+
+// JournaldSocket sets the path of the journald socket. Default to DefaultJournaldSocket.
+func JournaldSocket(socket string) JournaldWriterOption {
+	return func(w *JournaldWriter) {
+		w.socket = socket
+	}
+}
+
+// JournaldIdentifier sets the SYSLOG_IDENTIFIER field of the entries. Default to the name
+// of the executable.
+func JournaldIdentifier(identifier string) JournaldWriterOption {
+	return func(w *JournaldWriter) {
+		w.identifier = identifier
+	}
+}
+
+// NewJournaldWriter connects to the journald socket and returns a JournaldWriter sending
+// entries to it. The writer must be closed with Close.
+func NewJournaldWriter(options ...JournaldWriterOption) (*JournaldWriter, error) {
+	w := &JournaldWriter{
+		socket:     DefaultJournaldSocket,
+		identifier: filepath.Base(os.Args[0]),
+	}
+	for _, option := range options {
+		option(w)
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: w.socket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("log: connecting to journald: %w", err)
+	}
+	w.conn = conn
+	return w, nil
+}
+
+// Write implements the io.Writer interface.
+func (w *JournaldWriter) Write(p []byte) (n int, err error) {
+	return w.WriteLevel(NoLevel, p)
+}
+
+// WriteLevel implements the LevelWriter interface.
+func (w *JournaldWriter) WriteLevel(level Level, p []byte) (n int, err error) {
+	event, err := decodeEvent(p)
+	if err != nil {
+		return 0, err
+	}
+	if l, ok := event[DefaultLevelFieldName].(string); ok {
+		if parsed, err := ParseLevel(l); err == nil {
+			level = parsed
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return 0, os.ErrClosed
+	}
+
+	w.buf = w.appendEntry(w.buf[:0], level, event)
+	if _, err = w.conn.Write(w.buf); err != nil {
+		if !isMessageTooLong(err) {
+			return 0, err
+		}
+		// the entry does not fit in a datagram: pass it in a file descriptor instead
+		if err = w.writeFD(w.buf); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close closes the connection to journald.
+func (w *JournaldWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return os.ErrClosed
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *JournaldWriter) appendEntry(dst []byte, level Level, event map[string]interface{}) []byte {
+	message, _ := event[DefaultMessageFieldName].(string)
+	dst = appendJournaldField(dst, "MESSAGE", message)
+	dst = appendJournaldField(dst, "PRIORITY", strconv.Itoa(syslogSeverity(level)))
+	if w.identifier != "" {
+		dst = appendJournaldField(dst, "SYSLOG_IDENTIFIER", w.identifier)
+	}
+
+	keys := make([]string, 0, len(event))
+	for key := range event {
+		switch key {
+		case DefaultLevelFieldName, DefaultMessageFieldName, DefaultTimestampFieldName:
+		default:
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if name := journaldFieldName(key); name != "" {
+			dst = appendJournaldField(dst, name, fieldValueString(event[key]))
+		}
+	}
+	return dst
+}
+
+// writeFD writes entry to an unlinked temporary file and sends its file descriptor to journald.
+func (w *JournaldWriter) writeFD(entry []byte) error {
+	file, err := ioutil.TempFile("/dev/shm", "journal.")
+	if err != nil {
+		file, err = ioutil.TempFile("", "journal.")
+		if err != nil {
+			return err
+		}
+	}
+	defer file.Close()
+	if err = os.Remove(file.Name()); err != nil {
+		return err
+	}
+	if _, err = file.Write(entry); err != nil {
+		return err
+	}
+	// WriteMsgUnix can't be used on a connected datagram socket
+	raw, err := w.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(file.Fd()))
+	var sendErr error
+	err = raw.Write(func(fd uintptr) bool {
+		sendErr = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return sendErr != syscall.EAGAIN
+	})
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// appendJournaldField appends a field using the native protocol: NAME=value\n, or
+// NAME\n followed by the little endian 64 bits length of the value, the value and \n if
+// the value contains a newline.
+func appendJournaldField(dst []byte, name, value string) []byte {
+	dst = append(dst, name...)
+	if !strings.ContainsRune(value, '\n') {
+		dst = append(dst, '=')
+		dst = append(dst, value...)
+		return append(dst, '\n')
+	}
+	dst = append(dst, '\n')
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], uint64(len(value)))
+	dst = append(dst, length[:]...)
+	dst = append(dst, value...)
+	return append(dst, '\n')
+}
+
+// journaldFieldName converts key to a valid journal field name: uppercase letters, digits
+// and underscores, not starting with an underscore or a digit, at most 64 characters.
+// An empty string is returned if key can't be converted.
+func journaldFieldName(key string) string {
+	name := make([]byte, 0, len(key))
+	for i := 0; i < len(key) && len(name) < 64; i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		default:
+			c = '_'
+		}
+		if len(name) == 0 && (c == '_' || (c >= '0' && c <= '9')) {
+			// fields starting with an underscore are reserved to journald
+			continue
+		}
+		name = append(name, c)
+	}
+	return string(name)
+}
+
+func isMessageTooLong(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
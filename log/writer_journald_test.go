@@ -0,0 +1,129 @@
+// +build linux
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// readJournaldEntry reads an entry sent with the native protocol, either directly or
+// through a file descriptor, and returns its fields.
+func readJournaldEntry(t *testing.T, conn *net.UnixConn) map[string]string {
+	t.Helper()
+
+	buf := make([]byte, 1<<16)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf[:n]
+	if oobn > 0 {
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := os.NewFile(uintptr(fds[0]), "journal")
+		defer file.Close()
+		file.Seek(0, 0)
+		if data, err = ioutil.ReadAll(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fields := map[string]string{}
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			t.Fatalf("invalid entry: %q", data)
+		}
+		line := string(data[:i])
+		data = data[i+1:]
+		if j := strings.IndexByte(line, '='); j >= 0 {
+			fields[line[:j]] = line[j+1:]
+			continue
+		}
+		length := binary.LittleEndian.Uint64(data[:8])
+		fields[line] = string(data[8 : 8+length])
+		data = data[8+length+1:]
+	}
+	return fields
+}
+
+func TestJournaldWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := NewJournaldWriter(JournaldSocket(socket), JournaldIdentifier("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	log := New(SetWriter(w))
+	log.Error("hello\nworld", String("request-id", "abc"), Int("_n", 1), Strings("list", []string{"a", "b"}))
+
+	got := readJournaldEntry(t, conn)
+	want := map[string]string{
+		"MESSAGE":           "hello\nworld",
+		"PRIORITY":          "3",
+		"SYSLOG_IDENTIFIER": "app",
+		"REQUEST_ID":        "abc",
+		"N":                 "1",
+		"LIST":              `["a","b"]`,
+	}
+	if len(got) != len(want) {
+		t.Errorf("invalid fields: got %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("invalid field %s: got %q, want %q", key, got[key], value)
+		}
+	}
+
+	// entries larger than the maximum datagram size are passed with a file descriptor
+	large := strings.Repeat("x", 4<<20)
+	log.Info(large)
+	if got := readJournaldEntry(t, conn); got["MESSAGE"] != large {
+		t.Errorf("invalid large message of length %d", len(got["MESSAGE"]))
+	}
+}
+
+func TestJournaldFieldName(t *testing.T) {
+	tests := map[string]string{
+		"request_id":            "REQUEST_ID",
+		"http.path":             "HTTP_PATH",
+		"_private":              "PRIVATE",
+		"1st":                   "ST",
+		"__":                    "",
+		strings.Repeat("a", 70): strings.Repeat("A", 64),
+	}
+	for key, want := range tests {
+		if got := journaldFieldName(key); got != want {
+			t.Errorf("journaldFieldName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
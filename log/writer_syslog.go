@@ -0,0 +1,373 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyslogFacility is a syslog facility, as defined in RFC 5424 section 6.2.1.
+type SyslogFacility uint8
+
+const (
+	SyslogFacilityKern SyslogFacility = iota
+	SyslogFacilityUser
+	SyslogFacilityMail
+	SyslogFacilityDaemon
+	SyslogFacilityAuth
+	SyslogFacilitySyslog
+	SyslogFacilityLPR
+	SyslogFacilityNews
+	SyslogFacilityUUCP
+	SyslogFacilityCron
+	SyslogFacilityAuthPriv
+	SyslogFacilityFTP
+)
+
+const (
+	SyslogFacilityLocal0 SyslogFacility = iota + 16
+	SyslogFacilityLocal1
+	SyslogFacilityLocal2
+	SyslogFacilityLocal3
+	SyslogFacilityLocal4
+	SyslogFacilityLocal5
+	SyslogFacilityLocal6
+	SyslogFacilityLocal7
+)
+
+const (
+	// DefaultSyslogStructuredDataID is the default SD-ID of the structured data element holding
+	// the fields of the events. 32473 is the private enterprise number reserved for documentation.
+	DefaultSyslogStructuredDataID = "fields@32473"
+
+	syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+	syslogNilValue   = "-"
+)
+
+var syslogLocalPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// SyslogWriter is a LevelWriter sending the events to a syslog daemon using the RFC 5424
+// format. The level of the events is mapped to the syslog severity, their message to the
+// syslog message, and the other fields to the parameters of a structured data element.
+//
+// The fields are identified by their default names (DefaultLevelFieldName,
+// DefaultMessageFieldName and DefaultTimestampFieldName).
+//
+// A SyslogWriter is safe for concurrent use by multiple Loggers.
+type SyslogWriter struct {
+	network  string
+	addr     string
+	facility SyslogFacility
+	hostname string
+	appName  string
+	procID   string
+	sdID     string
+	clock    func() time.Time
+	mu       sync.Mutex
+	conn     net.Conn
+	stream   bool
+	buf      []byte
+	frame    []byte
+}
+
+// SyslogWriterOption is used to configure a SyslogWriter.
+type SyslogWriterOption func(w *SyslogWriter)
+
+// SyslogWithFacility sets the facility of the messages. Default to SyslogFacilityUser.
+func SyslogWithFacility(facility SyslogFacility) SyslogWriterOption {
+	return func(w *SyslogWriter) {
+		w.facility = facility
+	}
+}
+
+// SyslogHostname sets the hostname of the messages. Default to os.Hostname().
+func SyslogHostname(hostname string) SyslogWriterOption {
+	return func(w *SyslogWriter) {
+		w.hostname = hostname
+	}
+}
+
+// SyslogAppName sets the application name of the messages. Default to the name of the executable.
+func SyslogAppName(appName string) SyslogWriterOption {
+	return func(w *SyslogWriter) {
+		w.appName = appName
+	}
+}
+
+// SyslogStructuredDataID sets the SD-ID of the structured data element holding the fields
+// of the events. Default to DefaultSyslogStructuredDataID.
+func SyslogStructuredDataID(id string) SyslogWriterOption {
+	return func(w *SyslogWriter) {
+		w.sdID = id
+	}
+}
+
+// SyslogClock sets the function used to get the current time, for the events without
+// timestamp. Default to DefaultTimestampFunc.
+func SyslogClock(clock func() time.Time) SyslogWriterOption {
+	return func(w *SyslogWriter) {
+		w.clock = clock
+	}
+}
+
+// NewSyslogWriter connects to the syslog daemon at addr and returns a SyslogWriter sending
+// messages to it. network can be "udp", "tcp" or "unixgram" and "unix" for unix sockets.
+// With stream networks (tcp and unix), messages are framed using octet counting (RFC 6587).
+// If network is empty, the local syslog daemon is used.
+//
+// The writer must be closed with Close.
+func NewSyslogWriter(network, addr string, options ...SyslogWriterOption) (*SyslogWriter, error) {
+	w := &SyslogWriter{
+		network:  network,
+		addr:     addr,
+		facility: SyslogFacilityUser,
+		appName:  filepath.Base(os.Args[0]),
+		procID:   strconv.Itoa(os.Getpid()),
+		sdID:     DefaultSyslogStructuredDataID,
+		clock:    DefaultTimestampFunc,
+	}
+	w.hostname, _ = os.Hostname()
+	for _, option := range options {
+		option(w)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *SyslogWriter) connect() (err error) {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	if w.network != "" {
+		w.conn, err = net.Dial(w.network, w.addr)
+		if err != nil {
+			return fmt.Errorf("log: connecting to syslog: %w", err)
+		}
+		w.stream = !strings.HasPrefix(w.network, "udp") && w.network != "unixgram"
+		return nil
+	}
+
+	for _, path := range syslogLocalPaths {
+		for _, network := range []string{"unixgram", "unix"} {
+			if w.conn, err = net.Dial(network, path); err == nil {
+				w.stream = network == "unix"
+				return nil
+			}
+		}
+	}
+	return errors.New("log: local syslog daemon not found")
+}
+
+// Write implements the io.Writer interface.
+func (w *SyslogWriter) Write(p []byte) (n int, err error) {
+	return w.WriteLevel(NoLevel, p)
+}
+
+// WriteLevel implements the LevelWriter interface.
+func (w *SyslogWriter) WriteLevel(level Level, p []byte) (n int, err error) {
+	event, err := decodeEvent(p)
+	if err != nil {
+		return 0, err
+	}
+	if l, ok := event[DefaultLevelFieldName].(string); ok {
+		if parsed, err := ParseLevel(l); err == nil {
+			level = parsed
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return 0, os.ErrClosed
+	}
+
+	w.buf = w.appendMessage(w.buf[:0], level, event)
+	msg := w.buf
+	if w.stream {
+		// octet counting framing: MSG-LEN SP SYSLOG-MSG
+		w.frame = strconv.AppendInt(w.frame[:0], int64(len(w.buf)), 10)
+		w.frame = append(append(w.frame, ' '), w.buf...)
+		msg = w.frame
+	}
+	if _, err = w.conn.Write(msg); err != nil {
+		// the daemon may have been restarted: reconnect and try again once
+		if err = w.connect(); err == nil {
+			_, err = w.conn.Write(msg)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close closes the connection to the syslog daemon.
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return os.ErrClosed
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *SyslogWriter) appendMessage(dst []byte, level Level, event map[string]interface{}) []byte {
+	timestamp := w.clock()
+	if t, ok := event[DefaultTimestampFieldName].(string); ok {
+		if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			timestamp = parsed
+		}
+	}
+
+	// HEADER = PRI VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID
+	dst = append(dst, '<')
+	dst = strconv.AppendInt(dst, int64(w.facility)*8+int64(syslogSeverity(level)), 10)
+	dst = append(dst, ">1 "...)
+	dst = timestamp.AppendFormat(dst, syslogTimeFormat)
+	dst = append(dst, ' ')
+	dst = appendSyslogHeaderField(dst, w.hostname, 255)
+	dst = append(dst, ' ')
+	dst = appendSyslogHeaderField(dst, w.appName, 48)
+	dst = append(dst, ' ')
+	dst = appendSyslogHeaderField(dst, w.procID, 128)
+	dst = append(dst, " - "...)
+
+	// STRUCTURED-DATA
+	dst = w.appendStructuredData(dst, event)
+
+	// MSG
+	if message, ok := event[DefaultMessageFieldName].(string); ok && message != "" {
+		dst = append(dst, ' ')
+		dst = append(dst, message...)
+	}
+
+	return dst
+}
+
+func (w *SyslogWriter) appendStructuredData(dst []byte, event map[string]interface{}) []byte {
+	keys := make([]string, 0, len(event))
+	for key := range event {
+		switch key {
+		case DefaultLevelFieldName, DefaultMessageFieldName, DefaultTimestampFieldName:
+		default:
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return append(dst, syslogNilValue...)
+	}
+	sort.Strings(keys)
+
+	dst = append(dst, '[')
+	dst = append(dst, w.sdID...)
+	for _, key := range keys {
+		dst = append(dst, ' ')
+		dst = appendSyslogParamName(dst, key)
+		dst = append(dst, `="`...)
+		dst = appendSyslogParamValue(dst, fieldValueString(event[key]))
+		dst = append(dst, '"')
+	}
+	return append(dst, ']')
+}
+
+// syslogSeverity maps level to a syslog severity (RFC 5424 section 6.2.1).
+func syslogSeverity(level Level) int {
+	switch level {
+	case DebugLevel:
+		return 7 // debug
+	case InfoLevel:
+		return 6 // informational
+	case WarnLevel:
+		return 4 // warning
+	case ErrorLevel:
+		return 3 // error
+	case FatalLevel:
+		return 2 // critical
+	case PanicLevel:
+		return 1 // alert
+	default:
+		return 5 // notice
+	}
+}
+
+// fieldValueString returns the value of a decoded field as a string: strings are returned
+// as is, and other values as JSON.
+func fieldValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+}
+
+// appendSyslogHeaderField appends a header field, which must be made of at most maxLen
+// printable US-ASCII characters.
+func appendSyslogHeaderField(dst []byte, field string, maxLen int) []byte {
+	if field == "" {
+		return append(dst, syslogNilValue...)
+	}
+	if len(field) > maxLen {
+		field = field[:maxLen]
+	}
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c < 33 || c > 126 {
+			c = '_'
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+// appendSyslogParamName appends a PARAM-NAME: at most 32 printable US-ASCII characters,
+// except '=', SP, ']' and '"'.
+func appendSyslogParamName(dst []byte, name string) []byte {
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+// appendSyslogParamValue appends a PARAM-VALUE, where '"', '\' and ']' must be escaped.
+func appendSyslogParamValue(dst []byte, value string) []byte {
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '"', '\\', ']':
+			dst = append(dst, '\\', c)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,117 @@
+// +build !windows
+
+package log
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "syslog.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := NewSyslogWriter("unixgram", socket, SyslogHostname("host"), SyslogAppName("my app"),
+		SyslogWithFacility(SyslogFacilityLocal0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	timestamp := time.Date(2021, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	log := New(SetWriter(w), SetTimestampFunc(func() time.Time { return timestamp }),
+		SetTimeFieldFormat(time.RFC3339Nano))
+	log.Warn("hello world", String("user", "john \"doe\" [admin]"), Int("n", 42), Dict("d", log.NewDict(Bool("b", true))))
+	log.Debug("no fields")
+
+	pid := strconv.Itoa(os.Getpid())
+	want := []string{
+		`<132>1 2021-01-02T03:04:05.123456Z host my_app ` + pid + ` - [fields@32473 d="{\"b\":true}" n="42" user="john \"doe\" [admin\]"] hello world`,
+		`<135>1 2021-01-02T03:04:05.123456Z host my_app ` + pid + ` - - no fields`,
+	}
+	buf := make([]byte, 2048)
+	for _, want := range want {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); got != want {
+			t.Errorf("invalid syslog message:\ngot:  %s\nwant: %s", got, want)
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Error(err)
+	}
+	if err = w.Close(); err != os.ErrClosed {
+		t.Errorf("expected os.ErrClosed on second close, got %v", err)
+	}
+}
+
+func TestSyslogWriterTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	messages := make(chan string, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSuffix(length, " "))
+			msg := make([]byte, n)
+			if _, err = io.ReadFull(r, msg); err != nil {
+				return
+			}
+			messages <- string(msg)
+		}
+	}()
+
+	w, err := NewSyslogWriter("tcp", listener.Addr().String(), SyslogAppName("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	log := New(SetWriter(w))
+	log.Error("first")
+	log.Info("second")
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case msg := <-messages:
+			if !strings.HasSuffix(msg, " app "+strconv.Itoa(os.Getpid())+" - - "+want) {
+				t.Errorf("invalid syslog message: %s", msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for syslog message")
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package retry
 
 import (
+	"context"
 	"math/rand"
 	"time"
 )
@@ -23,6 +24,7 @@ type Config struct {
 	retryIf       RetryIfFunc
 	delayType     DelayTypeFunc
 	lastErrorOnly bool
+	context       context.Context
 }
 
 // Option represents an option for retry.
@@ -75,6 +77,15 @@ func DelayType(delayType DelayTypeFunc) Option {
 	}
 }
 
+// Context set the context of the retries: once it is done, the delay between
+// retries is interrupted and Do returns the error of the context
+// default is context.Background()
+func Context(ctx context.Context) Option {
+	return func(c *Config) {
+		c.context = ctx
+	}
+}
+
 // BackOffDelay is a DelayType which increases delay between consecutive retries
 func BackOffDelay(n uint, config *Config) time.Duration {
 	return config.delay * (1 << n)
@@ -65,6 +65,7 @@ BREAKING CHANGES
 package retry
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -95,6 +96,7 @@ func Do(retryableFunc RetryableFunc, opts ...Option) error {
 		retryIf:       DefaultRetryIf,
 		delayType:     DefaultDelayType,
 		lastErrorOnly: DefaultLastErrorOnly,
+		context:       context.Background(),
 	}
 
 	//apply opts
@@ -131,7 +133,9 @@ func Do(retryableFunc RetryableFunc, opts ...Option) error {
 			if config.maxDelay > 0 && delayTime > config.maxDelay {
 				delayTime = config.maxDelay
 			}
-			time.Sleep(delayTime)
+			if err := sleep(config.context, delayTime); err != nil {
+				return err
+			}
 		} else {
 			return nil
 		}
@@ -148,6 +152,21 @@ func Do(retryableFunc RetryableFunc, opts ...Option) error {
 	return errorLog
 }
 
+// sleep waits for delay, or until ctx is done.
+func sleep(ctx context.Context, delay time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Error type represents list of errors in retry
 type Error []error
 
@@ -1,6 +1,7 @@
 package retry
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -164,3 +165,21 @@ func TestMaxDelay(t *testing.T) {
 	assert.True(t, dur > 170*time.Millisecond, "5 times with maximum delay retry is longer than 70ms")
 	assert.True(t, dur < 200*time.Millisecond, "5 times with maximum delay retry is shorter than 200ms")
 }
+
+func TestContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var retryCount uint
+	start := time.Now()
+	err := Do(
+		func() error { return errors.New("test") },
+		OnRetry(func(n uint, err error) {
+			retryCount++
+			cancel()
+		}),
+		Delay(time.Second),
+		Context(ctx),
+	)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, uint(1), retryCount, "no retry once the context is canceled")
+	assert.True(t, time.Since(start) < time.Second, "the delay is interrupted when the context is canceled")
+}